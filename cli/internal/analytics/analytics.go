@@ -39,6 +39,13 @@ func (n *nullSink) RecordAnalyticsEvents(events Events) error {
 // analytics
 var NullSink = &nullSink{}
 
+type nullRecorder struct{}
+
+func (n *nullRecorder) LogEvent(payload EventPayload) {}
+
+// NullRecorder is an analytics recorder that discards events, for use outside of a run
+var NullRecorder Recorder = &nullRecorder{}
+
 type client struct {
 	ch     chan<- EventPayload
 	cancel func()
@@ -6,6 +6,7 @@ package cache
 import (
 	"sync"
 
+	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
@@ -50,14 +51,18 @@ func (c *asyncCache) Put(anchor turbopath.AbsoluteSystemPath, key string, durati
 	return nil
 }
 
-func (c *asyncCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, files []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
-	return c.realCache.Fetch(anchor, key, files)
+func (c *asyncCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	return c.realCache.Fetch(anchor, key, outputGlobs)
 }
 
 func (c *asyncCache) Exists(key string) (ItemStatus, error) {
 	return c.realCache.Exists(key)
 }
 
+func (c *asyncCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	return c.realCache.BatchExists(hashes)
+}
+
 func (c *asyncCache) Clean(anchor turbopath.AbsoluteSystemPath) {
 	c.realCache.Clean(anchor)
 }
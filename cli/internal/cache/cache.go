@@ -7,7 +7,11 @@ package cache
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/vercel/turbo/cli/internal/analytics"
@@ -20,9 +24,13 @@ import (
 // Cache is abstracted way to cache/fetch previously run tasks
 type Cache interface {
 	// Fetch returns true if there is a cache it. It is expected to move files
-	// into their correct position as a side effect
-	Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (bool, []turbopath.AnchoredSystemPath, int, error)
+	// into their correct position as a side effect. If outputGlobs is non-nil,
+	// only the files matching it are restored.
+	Fetch(anchor turbopath.AbsoluteSystemPath, hash string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error)
 	Exists(hash string) (ItemStatus, error)
+	// BatchExists returns the status of each of the given hashes, querying for all of
+	// them at once where the cache supports it
+	BatchExists(hashes []string) (map[string]ItemStatus, error)
 	// Put caches files for a given hash
 	Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error
 	Clean(anchor turbopath.AbsoluteSystemPath)
@@ -68,17 +76,85 @@ type Opts struct {
 	SkipFilesystem  bool
 	Workers         int
 	RemoteCacheOpts fs.RemoteCacheOptions
+	// MaxSize is the size in bytes above which the filesystem cache evicts its
+	// least recently used artifacts. Zero means unlimited.
+	MaxSize int64
+	// MaxAge is how long an artifact may go unused before the filesystem cache
+	// evicts it. Zero means unlimited.
+	MaxAge time.Duration
+	// Dedupe stores filesystem cache artifacts as manifests of content-addressed
+	// blobs, so that identical files are only stored once across artifacts.
+	Dedupe bool
+	// DedupeHardlinks allows restoring deduplicated files by hardlinking them
+	// when they can't be cloned. Something modifying a restored file in place
+	// would then also modify the cached copy.
+	DedupeHardlinks bool
+	// Policy restricts reading from and writing to each cache
+	Policy Policy
+	// SpoolUploads queues uploads to the remote cache on disk, under the cache
+	// directory, and sends them in the background, so that they outlive the process.
+	SpoolUploads bool
 }
 
-// resolveCacheDir calculates the location turbo should use to cache artifacts,
+// ResolveCacheDir calculates the location turbo should use to cache artifacts,
 // based on the options supplied by the user.
-func (o *Opts) resolveCacheDir(repoRoot turbopath.AbsoluteSystemPath) turbopath.AbsoluteSystemPath {
+func (o *Opts) ResolveCacheDir(repoRoot turbopath.AbsoluteSystemPath) turbopath.AbsoluteSystemPath {
 	if o.OverrideDir != "" {
 		return fs.ResolveUnknownPath(repoRoot, o.OverrideDir)
 	}
 	return DefaultLocation(repoRoot)
 }
 
+// SetEvictionPolicyFromEnv reads the filesystem cache eviction limits from
+// TURBO_CACHE_MAX_SIZE and TURBO_CACHE_MAX_AGE, if they are set.
+func (o *Opts) SetEvictionPolicyFromEnv() error {
+	if maxSize := os.Getenv("TURBO_CACHE_MAX_SIZE"); maxSize != "" {
+		size, err := util.ParseByteSize(maxSize)
+		if err != nil {
+			return fmt.Errorf("TURBO_CACHE_MAX_SIZE: %w", err)
+		}
+		o.MaxSize = size
+	}
+	if maxAge := os.Getenv("TURBO_CACHE_MAX_AGE"); maxAge != "" {
+		age, err := util.ParseDurationWithDays(maxAge)
+		if err != nil {
+			return fmt.Errorf("TURBO_CACHE_MAX_AGE: %w", err)
+		}
+		o.MaxAge = age
+	}
+	return nil
+}
+
+// SetDedupeFromEnv reads whether the filesystem cache deduplicates files from
+// TURBO_CACHE_DEDUPE. It accepts "true" or "1" to deduplicate, and "hardlink" to
+// also allow restoring by hardlink.
+func (o *Opts) SetDedupeFromEnv() error {
+	switch dedupe := os.Getenv("TURBO_CACHE_DEDUPE"); dedupe {
+	case "", "0", "false":
+	case "1", "true":
+		o.Dedupe = true
+	case "hardlink":
+		o.Dedupe = true
+		o.DedupeHardlinks = true
+	default:
+		return fmt.Errorf("TURBO_CACHE_DEDUPE: expected one of true, false, or hardlink, got %q", dedupe)
+	}
+	return nil
+}
+
+// SetSpoolFromEnv reads whether uploads to the remote cache are spooled on disk from
+// TURBO_CACHE_SPOOL. Spooling is off unless it is "true" or "1".
+func (o *Opts) SetSpoolFromEnv() error {
+	switch spool := os.Getenv("TURBO_CACHE_SPOOL"); spool {
+	case "", "0", "false":
+	case "1", "true":
+		o.SpoolUploads = true
+	default:
+		return fmt.Errorf("TURBO_CACHE_SPOOL: expected true or false, got %q", spool)
+	}
+	return nil
+}
+
 var _remoteOnlyHelp = `Ignore the local filesystem cache for all tasks. Only
 allow reading and caching artifacts using the remote cache.`
 
@@ -102,11 +178,20 @@ func New(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client client, record
 	return c, err
 }
 
+// newRemoteCache returns the remote cache that opts configures. A configured S3 bucket
+// takes the place of the Vercel Remote Cache.
+func newRemoteCache(opts Opts, client client, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) remoteUploader {
+	if s3Config := resolveS3Config(opts.RemoteCacheOpts.S3); s3Config != nil {
+		return newS3Cache(opts, s3Config, recorder, repoRoot)
+	}
+	return newHTTPCache(opts, client, recorder, repoRoot)
+}
+
 // newSyncCache can return an error with a usable noopCache.
 func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client client, recorder analytics.Recorder, onCacheRemoved OnCacheRemoved) (Cache, error) {
 	// Check to see if the user has turned off particular cache implementations.
-	useFsCache := !opts.SkipFilesystem
-	useHTTPCache := !opts.SkipRemote
+	useFsCache := !opts.SkipFilesystem && !opts.Policy.Local.Disabled()
+	useHTTPCache := !opts.SkipRemote && !opts.Policy.Remote.Disabled()
 
 	// Since the above two flags are not mutually exclusive it is possible to configure
 	// yourself out of having a cache. We should tell you about it but we shouldn't fail
@@ -130,7 +215,13 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client clien
 	}
 
 	if useHTTPCache {
-		implementation := newHTTPCache(opts, client, recorder)
+		var implementation Cache = newRemoteCache(opts, client, recorder, repoRoot)
+		if opts.SpoolUploads {
+			cacheDir := opts.ResolveCacheDir(repoRoot)
+			// The daemon only finds uploads spooled outside the default cache directory if they're registered
+			_ = registerSpoolDir(repoRoot, cacheDir)
+			implementation = newSpoolCache(implementation.(remoteUploader), cacheDir, opts.Workers)
+		}
 		cacheImplementations = append(cacheImplementations, implementation)
 	}
 
@@ -141,7 +232,8 @@ func newSyncCache(opts Opts, repoRoot turbopath.AbsoluteSystemPath, client clien
 
 	// Precisely two cache implementations:
 	// fsCache and httpCache OR httpCache and noopCache
-	useMultiplexer := len(cacheImplementations) > 1
+	// The multiplexer also enforces the cache policy, so it wraps a lone fsCache whose access is restricted.
+	useMultiplexer := len(cacheImplementations) > 1 || (useFsCache && opts.Policy.Local != Access{})
 	if useMultiplexer {
 		// We have early-returned any possible errors for this scenario.
 		return &cacheMultiplexer{
@@ -193,6 +285,9 @@ func (mplex *cacheMultiplexer) storeUntil(anchor turbopath.AbsoluteSystemPath, k
 		if i == stopAt {
 			break
 		}
+		if mplex.opts.Policy.accessFor(cache).SkipWrites {
+			continue
+		}
 		c := cache
 		i := i
 		g.Go(func() error {
@@ -241,7 +336,7 @@ func (mplex *cacheMultiplexer) removeCache(removal *cacheRemoval) {
 	}
 }
 
-func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key string, files []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
 	// Make a shallow copy of the caches, since storeUntil can call removeCache
 	mplex.mu.RLock()
 	caches := make([]Cache, len(mplex.caches))
@@ -251,7 +346,16 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 	// Retrieve from caches sequentially; if we did them simultaneously we could
 	// easily write the same file from two goroutines at once.
 	for i, cache := range caches {
-		ok, actualFiles, duration, err := cache.Fetch(anchor, key, files)
+		if mplex.opts.Policy.accessFor(cache).SkipReads {
+			continue
+		}
+		// A hit in a lower-priority cache is stored back into the higher-priority ones,
+		// so it has to be restored in full to avoid storing a partial artifact.
+		cacheOutputGlobs := outputGlobs
+		if i > 0 {
+			cacheOutputGlobs = nil
+		}
+		ok, actualFiles, duration, err := cache.Fetch(anchor, key, cacheOutputGlobs)
 		if err != nil {
 			cd := &util.CacheDisabledError{}
 			if errors.As(err, &cd) {
@@ -259,6 +363,9 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 					cache: cache,
 					err:   cd,
 				})
+			} else if errors.Is(err, errArtifactVerificationFailed) {
+				// Always surface these, since they may mean that someone is tampering with the cache.
+				log.Printf("[WARN] %v. Treating %v as a cache miss", err, key)
 			}
 			// We're ignoring the error in the else case, since with this cache
 			// abstraction, we want to check lower priority caches rather than fail
@@ -280,6 +387,10 @@ func (mplex *cacheMultiplexer) Fetch(anchor turbopath.AbsoluteSystemPath, key st
 func (mplex *cacheMultiplexer) Exists(target string) (ItemStatus, error) {
 	syncCacheState := ItemStatus{}
 	for _, cache := range mplex.caches {
+		if mplex.opts.Policy.accessFor(cache).SkipReads {
+			// An artifact that won't be read is no use to this run
+			continue
+		}
 		itemStatus, err := cache.Exists(target)
 		if err != nil {
 			return syncCacheState, err
@@ -291,6 +402,26 @@ func (mplex *cacheMultiplexer) Exists(target string) (ItemStatus, error) {
 	return syncCacheState, nil
 }
 
+func (mplex *cacheMultiplexer) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	syncCacheStates := make(map[string]ItemStatus, len(hashes))
+	for _, cache := range mplex.caches {
+		if mplex.opts.Policy.accessFor(cache).SkipReads {
+			continue
+		}
+		itemStatuses, err := cache.BatchExists(hashes)
+		if err != nil {
+			return syncCacheStates, err
+		}
+		for hash, itemStatus := range itemStatuses {
+			syncCacheState := syncCacheStates[hash]
+			syncCacheState.Local = syncCacheState.Local || itemStatus.Local
+			syncCacheState.Remote = syncCacheState.Remote || itemStatus.Remote
+			syncCacheStates[hash] = syncCacheState
+		}
+	}
+	return syncCacheStates, nil
+}
+
 func (mplex *cacheMultiplexer) Clean(anchor turbopath.AbsoluteSystemPath) {
 	for _, cache := range mplex.caches {
 		cache.Clean(anchor)
@@ -0,0 +1,391 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encrypted artifacts are an envelope around the usual tar+zstd body:
+//
+//	magic (8 bytes) | version (1 byte) | key ID length (1 byte) | key ID | salt (32 bytes) | nonce prefix (7 bytes) | chunks
+//
+// Each artifact is encrypted with its own subkey, derived from the configured key and the
+// artifact's random salt with HKDF-SHA256, so that the short nonces of artifacts encrypted
+// with one long-lived key can never collide under the same AES key.
+// The body is split into chunks of _encryptionChunkSize bytes, each sealed with AES-256-GCM
+// so that artifacts can be encrypted and decrypted as a stream. A chunk's nonce is the
+// nonce prefix, its big-endian index, and a final byte that is 1 only for the last chunk,
+// which stops an artifact from being truncated at a chunk boundary. The header and the
+// artifact hash are authenticated with every chunk, so that neither the key ID nor the
+// artifact can be swapped.
+const (
+	_encryptionMagic       = "TURBOENC"
+	_encryptionVersion     = 2
+	_encryptionChunkSize   = 64 * 1024
+	_encryptionSaltSize    = 32
+	_encryptionNoncePrefix = 7
+	_encryptionKeySize     = 32
+	_encryptionKeyIDSize   = 8
+)
+
+// errEncryptionKeyMissing is returned when encryption is enabled without any keys
+var errEncryptionKeyMissing = errors.New("remote cache encryption is enabled, but no key was found. You must specify a key in the TURBO_REMOTE_CACHE_ENCRYPTION_KEY environment variable, or a file containing one in TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE")
+
+// ArtifactEncryption encrypts artifacts before they are uploaded to a remote cache,
+// and decrypts them after they are downloaded.
+type ArtifactEncryption struct {
+	enabled  bool
+	repoRoot turbopath.AbsoluteSystemPath
+}
+
+// newArtifactEncryption returns the encrypter / decrypter for the given remote cache options.
+// A relative key file path is resolved against repoRoot.
+func newArtifactEncryption(opts fs.RemoteCacheOptions, repoRoot turbopath.AbsoluteSystemPath) *ArtifactEncryption {
+	return &ArtifactEncryption{
+		enabled:  opts.Encryption,
+		repoRoot: repoRoot,
+	}
+}
+
+func (ae *ArtifactEncryption) isEnabled() bool {
+	return ae != nil && ae.enabled
+}
+
+// encryptionKey is an AES-256 key along with its ID, which is recorded in the artifacts it encrypts
+type encryptionKey struct {
+	id  string
+	key []byte
+}
+
+// keys returns the configured keys, from the comma-separated TURBO_REMOTE_CACHE_ENCRYPTION_KEY
+// environment variable, or else from the file named by TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE,
+// which has one key per line. The first key encrypts new artifacts, and the rest are only
+// used to decrypt, which allows rotating keys without invalidating existing artifacts.
+func (ae *ArtifactEncryption) keys() ([]*encryptionKey, error) {
+	var rawKeys []string
+	source := "TURBO_REMOTE_CACHE_ENCRYPTION_KEY"
+	if env := os.Getenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY"); env != "" {
+		rawKeys = strings.Split(env, ",")
+	} else if file := os.Getenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE"); file != "" {
+		path := fs.ResolveUnknownPath(ae.repoRoot, file)
+		contents, err := path.ReadFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key: %w", err)
+		}
+		rawKeys = strings.Split(string(contents), "\n")
+		source = path.ToString()
+	}
+	keys := []*encryptionKey{}
+	for i, rawKey := range rawKeys {
+		rawKey = strings.TrimSpace(rawKey)
+		if rawKey == "" {
+			continue
+		}
+		key, err := parseEncryptionKey(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key at position %v of %v: %w", i+1, source, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errEncryptionKeyMissing
+	}
+	return keys, nil
+}
+
+// parseEncryptionKey decodes a base64-encoded 32 byte key. Its ID is derived from the key,
+// so that the key itself never needs to be named.
+func parseEncryptionKey(raw string) (*encryptionKey, error) {
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("expected a base64-encoded key: %w", err)
+	}
+	if len(key) != _encryptionKeySize {
+		return nil, fmt.Errorf("expected a %v byte key, got %v bytes", _encryptionKeySize, len(key))
+	}
+	digest := sha256.Sum256(key)
+	return &encryptionKey{
+		id:  hex.EncodeToString(digest[:_encryptionKeyIDSize]),
+		key: key,
+	}, nil
+}
+
+// newSealer returns a sealer that encrypts the artifact for hash with the first configured key.
+// It returns nil if encryption is disabled.
+func (ae *ArtifactEncryption) newSealer(hash string) (*artifactSealer, error) {
+	if !ae.isEnabled() {
+		return nil, nil
+	}
+	keys, err := ae.keys()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, _encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	noncePrefix := make([]byte, _encryptionNoncePrefix)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(keys[0].key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &artifactSealer{
+		aead:   aead,
+		header: encryptionHeader(keys[0].id, salt, noncePrefix),
+		hash:   hash,
+	}, nil
+}
+
+// decrypt decrypts the artifact for hash read from r into a temporary file, so that no part
+// of it is restored before all of it has been authenticated. Failures wrap errArtifactVerificationFailed.
+func (ae *ArtifactEncryption) decrypt(hash string, r io.Reader) (*tempArtifact, error) {
+	keys, err := ae.keys()
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(r, _encryptionChunkSize+2*aes.BlockSize)
+	keyID, salt, noncePrefix, header, err := readEncryptionHeader(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+	}
+	var key *encryptionKey
+	for _, candidate := range keys {
+		if candidate.id == keyID {
+			key = candidate
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: artifact was encrypted with key %v, which is not one of the %v configured keys", errArtifactVerificationFailed, keyID, len(keys))
+	}
+	aead, err := newAEAD(key.key, salt)
+	if err != nil {
+		return nil, err
+	}
+	opener := &artifactOpener{
+		aead:        aead,
+		r:           br,
+		additional:  append(header, hash...),
+		noncePrefix: noncePrefix,
+	}
+	artifact, err := newTempArtifact()
+	if err != nil {
+		return nil, err
+	}
+	if err := artifact.fill(opener); err != nil {
+		_ = artifact.Close()
+		return nil, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+	}
+	return artifact, nil
+}
+
+// newAEAD returns the cipher for the artifact with salt, using the subkey derived from key
+func newAEAD(key []byte, salt []byte) (cipher.AEAD, error) {
+	subkey := make([]byte, _encryptionKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(_encryptionMagic)), subkey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptionHeader(keyID string, salt []byte, noncePrefix []byte) []byte {
+	header := make([]byte, 0, len(_encryptionMagic)+2+len(keyID)+len(salt)+len(noncePrefix))
+	header = append(header, _encryptionMagic...)
+	header = append(header, _encryptionVersion, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, salt...)
+	return append(header, noncePrefix...)
+}
+
+// readEncryptionHeader reads the envelope header, returning the key ID, the salt, the nonce
+// prefix, and the raw header bytes, which are authenticated along with each chunk.
+func readEncryptionHeader(r io.Reader) (string, []byte, []byte, []byte, error) {
+	fixed := make([]byte, len(_encryptionMagic)+2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return "", nil, nil, nil, errors.New("artifact is not encrypted")
+	}
+	if string(fixed[:len(_encryptionMagic)]) != _encryptionMagic {
+		return "", nil, nil, nil, errors.New("artifact is not encrypted")
+	}
+	if version := fixed[len(_encryptionMagic)]; version != _encryptionVersion {
+		return "", nil, nil, nil, fmt.Errorf("unsupported encryption version %v", version)
+	}
+	keyIDLength := int(fixed[len(_encryptionMagic)+1])
+	rest := make([]byte, keyIDLength+_encryptionSaltSize+_encryptionNoncePrefix)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return "", nil, nil, nil, fmt.Errorf("truncated encryption header: %w", err)
+	}
+	keyID := string(rest[:keyIDLength])
+	salt := rest[keyIDLength : keyIDLength+_encryptionSaltSize]
+	noncePrefix := rest[keyIDLength+_encryptionSaltSize:]
+	return keyID, salt, noncePrefix, append(fixed, rest...), nil
+}
+
+// chunkNonce returns the nonce for the chunk at index
+func chunkNonce(noncePrefix []byte, index uint32, final bool) []byte {
+	nonce := make([]byte, 0, _encryptionNoncePrefix+5)
+	nonce = append(nonce, noncePrefix...)
+	nonce = nonce[:_encryptionNoncePrefix+4]
+	binary.BigEndian.PutUint32(nonce[_encryptionNoncePrefix:], index)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// artifactSealer encrypts a single artifact
+type artifactSealer struct {
+	aead   cipher.AEAD
+	header []byte
+	hash   string
+}
+
+// wrap returns a writer that encrypts everything written to it into w. Closing it
+// seals the final chunk and closes w.
+func (s *artifactSealer) wrap(w io.WriteCloser) io.WriteCloser {
+	return &sealingWriter{
+		sealer:     s,
+		w:          w,
+		additional: append(append([]byte{}, s.header...), s.hash...),
+		buf:        make([]byte, 0, _encryptionChunkSize),
+	}
+}
+
+type sealingWriter struct {
+	sealer      *artifactSealer
+	w           io.WriteCloser
+	additional  []byte
+	buf         []byte
+	index       uint32
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+func (sw *sealingWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// Only seal a full chunk once there is more data, since the last chunk is sealed differently.
+		if len(sw.buf) == _encryptionChunkSize {
+			if err := sw.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(sw.buf[len(sw.buf):_encryptionChunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (sw *sealingWriter) flush(final bool) error {
+	if !sw.wroteHeader {
+		if _, err := sw.w.Write(sw.sealer.header); err != nil {
+			sw.err = err
+			return err
+		}
+		sw.wroteHeader = true
+	}
+	noncePrefix := sw.sealer.header[len(sw.sealer.header)-_encryptionNoncePrefix:]
+	sealed := sw.sealer.aead.Seal(nil, chunkNonce(noncePrefix, sw.index, final), sw.buf, sw.additional)
+	if _, err := sw.w.Write(sealed); err != nil {
+		sw.err = err
+		return err
+	}
+	sw.index++
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+// Close seals the final chunk and closes the underlying writer. It is safe to call more than once.
+func (sw *sealingWriter) Close() error {
+	if sw.closed {
+		return sw.err
+	}
+	sw.closed = true
+	if sw.err == nil {
+		_ = sw.flush(true)
+	}
+	if err := sw.w.Close(); err != nil && sw.err == nil {
+		sw.err = err
+	}
+	return sw.err
+}
+
+// artifactOpener decrypts the chunks that follow an envelope header
+type artifactOpener struct {
+	aead        cipher.AEAD
+	r           *bufio.Reader
+	additional  []byte
+	noncePrefix []byte
+	index       uint32
+	plaintext   []byte
+	done        bool
+}
+
+func (o *artifactOpener) Read(p []byte) (int, error) {
+	for len(o.plaintext) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		if err := o.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, o.plaintext)
+	o.plaintext = o.plaintext[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk. A chunk shorter than the maximum, or one followed by
+// the end of the artifact, must be the final chunk.
+func (o *artifactOpener) next() error {
+	sealed := make([]byte, _encryptionChunkSize+o.aead.Overhead())
+	n, err := io.ReadFull(o.r, sealed)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	sealed = sealed[:n]
+	final := n < _encryptionChunkSize+o.aead.Overhead()
+	if !final {
+		if _, err := o.r.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plaintext, err := o.aead.Open(sealed[:0], chunkNonce(o.noncePrefix, o.index, final), sealed, o.additional)
+	if err != nil {
+		return errors.New("artifact failed to decrypt. It may have been tampered with, or encrypted for a different hash")
+	}
+	o.index++
+	o.plaintext = plaintext
+	o.done = final
+	return nil
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func newEncryptionKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, _encryptionKeySize)
+	_, err := rand.Read(key)
+	assert.NilError(t, err, "rand.Read")
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", newEncryptionKey(t))
+	encryption := newArtifactEncryption(fs.RemoteCacheOptions{Encryption: true}, "")
+
+	// Cover the empty artifact, and artifacts ending on and around a chunk boundary
+	for _, size := range []int{0, 1, _encryptionChunkSize - 1, _encryptionChunkSize, 2*_encryptionChunkSize + 7} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		assert.NilError(t, err, "rand.Read")
+
+		sealer, err := encryption.newSealer("some-hash")
+		assert.NilError(t, err, "newSealer")
+		sealed := &bytes.Buffer{}
+		w := sealer.wrap(nopWriteCloser{sealed})
+		_, err = w.Write(plaintext)
+		assert.NilError(t, err, "Write")
+		assert.NilError(t, w.Close(), "Close")
+		assert.NilError(t, w.Close(), "second Close")
+
+		decrypted, err := encryption.decrypt("some-hash", bytes.NewReader(sealed.Bytes()))
+		assert.NilError(t, err, "decrypt of %v bytes", size)
+		actual, err := ioutil.ReadAll(decrypted)
+		assert.NilError(t, err, "ReadAll")
+		assert.NilError(t, decrypted.Close(), "Close")
+		assert.Assert(t, bytes.Equal(actual, plaintext), "round trip of %v bytes", size)
+
+		// The artifact is bound to its hash
+		_, err = encryption.decrypt("other-hash", bytes.NewReader(sealed.Bytes()))
+		assert.Assert(t, errors.Is(err, errArtifactVerificationFailed))
+
+		if size > _encryptionChunkSize {
+			// Dropping the final chunk must not go unnoticed
+			header := len(sealer.header)
+			truncated := sealed.Bytes()[:header+_encryptionChunkSize+16]
+			_, err = encryption.decrypt("some-hash", bytes.NewReader(truncated))
+			assert.Assert(t, errors.Is(err, errArtifactVerificationFailed))
+		}
+	}
+}
+
+func TestEncryptionSubkeys(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", newEncryptionKey(t))
+	encryption := newArtifactEncryption(fs.RemoteCacheOptions{Encryption: true}, "")
+
+	seal := func(sealer *artifactSealer) []byte {
+		sealed := &bytes.Buffer{}
+		w := sealer.wrap(nopWriteCloser{sealed})
+		_, err := w.Write([]byte("the same contents"))
+		assert.NilError(t, err, "Write")
+		assert.NilError(t, w.Close(), "Close")
+		return sealed.Bytes()[len(sealer.header):]
+	}
+	first, err := encryption.newSealer("some-hash")
+	assert.NilError(t, err, "newSealer")
+	second, err := encryption.newSealer("some-hash")
+	assert.NilError(t, err, "newSealer")
+
+	// Even if two artifacts' nonces collide, each is sealed with its own subkey
+	copy(second.header[len(second.header)-_encryptionNoncePrefix:], first.header[len(first.header)-_encryptionNoncePrefix:])
+	assert.Assert(t, !bytes.Equal(seal(first), seal(second)))
+}
+
+func TestEncryptionKeys(t *testing.T) {
+	encryption := newArtifactEncryption(fs.RemoteCacheOptions{Encryption: true}, "")
+	_, err := encryption.newSealer("some-hash")
+	assert.ErrorIs(t, err, errEncryptionKeyMissing)
+
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", "dG9vIHNob3J0")
+	_, err = encryption.newSealer("some-hash")
+	assert.ErrorContains(t, err, "expected a 32 byte key, got 9 bytes")
+
+	// Keys can also come from a file, with one per line
+	oldKey, newKey := newEncryptionKey(t), newEncryptionKey(t)
+	keyFile := fs.AbsoluteSystemPathFromUpstream(t.TempDir()).UntypedJoin("keys")
+	assert.NilError(t, keyFile.WriteFile([]byte(oldKey+"\n"), 0600), "WriteFile")
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", "")
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE", keyFile.ToString())
+	keys, err := encryption.keys()
+	assert.NilError(t, err, "keys")
+	assert.Equal(t, len(keys), 1)
+	assert.Equal(t, len(keys[0].id), 2*_encryptionKeyIDSize)
+
+	// The environment takes precedence, and its later keys still decrypt
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", newKey+","+oldKey)
+	keys, err = encryption.keys()
+	assert.NilError(t, err, "keys")
+	assert.Equal(t, len(keys), 2)
+}
+
+func TestPutFetchEncryptedArtifact(t *testing.T) {
+	oldKey, newKey := newEncryptionKey(t), newEncryptionKey(t)
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", oldKey)
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "secret")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("top secret contents"), 0644), "WriteFile")
+
+	client := &memoryClient{}
+	opts := Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Signature: true, Encryption: true}}
+	cache := newHTTPCache(opts, client, analytics.NullRecorder, src)
+	assert.NilError(t, cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	assert.Assert(t, bytes.HasPrefix(client.body, []byte(_encryptionMagic)))
+
+	// The signature covers the encrypted artifact
+	expectedTag, err := cache.signerVerifier.generateTag("some-hash", client.body)
+	assert.NilError(t, err, "generateTag")
+	assert.Equal(t, client.tag, expectedTag)
+
+	// Rotating keys leaves existing artifacts readable
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", newKey+","+oldKey)
+	dst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	hit, files, _, err := cache.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.DeepEqual(t, files, []turbopath.AnchoredSystemPath{"a-file"})
+	contents, err := dst.UntypedJoin("a-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "top secret contents")
+
+	// Without the key, the artifact is unreadable, and nothing is restored
+	t.Setenv("TURBO_REMOTE_CACHE_ENCRYPTION_KEY", newKey)
+	unreadable := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	_, _, _, err = cache.Fetch(unreadable, "some-hash", nil)
+	assert.Assert(t, errors.Is(err, errArtifactVerificationFailed))
+	assert.ErrorContains(t, err, "not one of the 1 configured keys")
+	assert.Assert(t, !unreadable.UntypedJoin("a-file").FileExists())
+
+	// Unencrypted artifacts are rejected once encryption is enabled
+	plain := newHTTPCache(Opts{}, client, analytics.NullRecorder, src)
+	assert.NilError(t, plain.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	encrypted := newHTTPCache(Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Encryption: true}}, client, analytics.NullRecorder, src)
+	_, _, _, err = encrypted.Fetch(unreadable, "some-hash", nil)
+	assert.ErrorContains(t, err, "artifact is not encrypted")
+}
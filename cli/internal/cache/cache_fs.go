@@ -6,39 +6,69 @@
 package cache
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
+// errCorruptArtifact is the reason an artifact is quarantined when its contents
+// don't match the checksum recorded when it was stored
+var errCorruptArtifact = errors.New("artifact does not match its recorded checksum")
+
 // fsCache is a local filesystem cache
 type fsCache struct {
 	cacheDirectory turbopath.AbsoluteSystemPath
 	recorder       analytics.Recorder
+	maxSize        int64
+	maxAge         time.Duration
+	// dedupe writes new artifacts as manifests of blobs. Existing manifests
+	// are read regardless of this setting.
+	dedupe bool
+	blobs  *cacheitem.BlobStore
 }
 
 // newFsCache creates a new filesystem cache
 func newFsCache(opts Opts, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) (*fsCache, error) {
-	cacheDir := opts.resolveCacheDir(repoRoot)
+	cacheDir := opts.ResolveCacheDir(repoRoot)
 	if err := cacheDir.MkdirAll(0775); err != nil {
 		return nil, err
 	}
 	return &fsCache{
 		cacheDirectory: cacheDir,
 		recorder:       recorder,
+		maxSize:        opts.MaxSize,
+		maxAge:         opts.MaxAge,
+		dedupe:         opts.Dedupe,
+		blobs:          newBlobStore(cacheDir, opts.DedupeHardlinks),
 	}, nil
 }
 
+// newBlobStore returns the store for deduplicated files in the given cache directory
+func newBlobStore(cacheDir turbopath.AbsoluteSystemPath, allowHardlinks bool) *cacheitem.BlobStore {
+	return cacheitem.NewBlobStore(cacheDir.UntypedJoin("blobs"), allowHardlinks)
+}
+
 // Fetch returns true if items are cached. It moves them into position as a side effect.
-func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, _unusedOutputGlobs []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+// Artifacts are verified against the checksum recorded when they were stored before anything
+// is restored. A corrupt artifact is moved into the quarantine directory and reported as a miss.
+func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
 	uncompressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar")
 	compressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
+	manifestPath := f.cacheDirectory.UntypedJoin(hash + "-manifest.json")
 
 	var actualCachePath turbopath.AbsoluteSystemPath
-	if uncompressedCachePath.FileExists() {
+	if manifestPath.FileExists() {
+		actualCachePath = manifestPath
+	} else if uncompressedCachePath.FileExists() {
 		actualCachePath = uncompressedCachePath
 	} else if compressedCachePath.FileExists() {
 		actualCachePath = compressedCachePath
@@ -48,21 +78,44 @@ func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, _unuse
 		return false, nil, 0, nil
 	}
 
+	// Mark this entry as recently used before restoring, so that a concurrent
+	// eviction in another process leaves it alone.
+	f.recordAccess(hash)
+
+	meta, err := ReadCacheMetaFile(f.cacheDirectory.UntypedJoin(hash + "-meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		// The metadata is written last, so the artifact is still being written.
+		f.logFetch(false, hash, 0)
+		return false, nil, 0, nil
+	} else if err != nil {
+		return f.quarantine(hash, fmt.Errorf("error reading cache metadata: %w", err))
+	}
+
+	if actualCachePath == manifestPath {
+		return f.fetchManifest(anchor, hash, manifestPath, meta, outputGlobs)
+	}
+
 	cacheItem, openErr := cacheitem.Open(actualCachePath)
 	if openErr != nil {
 		return false, nil, 0, openErr
 	}
 
-	restoredFiles, restoreErr := cacheItem.Restore(anchor)
-	if restoreErr != nil {
-		_ = cacheItem.Close()
-		return false, nil, 0, restoreErr
+	if meta.Sha != "" {
+		sha, err := cacheItem.GetSha()
+		if err != nil {
+			_ = cacheItem.Close()
+			return false, nil, 0, err
+		}
+		if hex.EncodeToString(sha) != meta.Sha {
+			_ = cacheItem.Close()
+			return f.quarantine(hash, errCorruptArtifact)
+		}
 	}
 
-	meta, err := ReadCacheMetaFile(f.cacheDirectory.UntypedJoin(hash + "-meta.json"))
-	if err != nil {
+	restoredFiles, restoreErr := cacheItem.RestoreFiltered(anchor, outputFilter(outputGlobs))
+	if restoreErr != nil {
 		_ = cacheItem.Close()
-		return false, nil, 0, fmt.Errorf("error reading cache metadata: %w", err)
+		return false, nil, 0, restoreErr
 	}
 	f.logFetch(true, hash, meta.Duration)
 
@@ -74,17 +127,106 @@ func (f *fsCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, _unuse
 	return true, restoredFiles, meta.Duration, nil
 }
 
+// fetchManifest restores a deduplicated artifact from its manifest, after verifying
+// the manifest and every blob it references.
+func (f *fsCache) fetchManifest(anchor turbopath.AbsoluteSystemPath, hash string, manifestPath turbopath.AbsoluteSystemPath, meta *CacheMetadata, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	if meta.Sha != "" {
+		sha, err := fileSha(manifestPath)
+		if err != nil {
+			return false, nil, 0, err
+		}
+		if sha != meta.Sha {
+			return f.quarantine(hash, errCorruptArtifact)
+		}
+	}
+
+	manifest, err := cacheitem.ReadManifest(manifestPath)
+	if err != nil {
+		return f.quarantine(hash, err)
+	}
+	for _, entry := range manifest.Entries {
+		if entry.Digest == "" {
+			continue
+		}
+		if err := f.blobs.Verify(entry.Digest, entry.Size); err != nil {
+			if errors.Is(err, cacheitem.ErrBlobCorrupt) {
+				// The blob is shared, so move it aside as well to keep other artifacts from using it.
+				if quarantineErr := f.quarantineBlob(entry.Digest); quarantineErr != nil {
+					return false, nil, 0, quarantineErr
+				}
+			}
+			return f.quarantine(hash, err)
+		}
+	}
+
+	restoredFiles, err := manifest.Restore(f.blobs, anchor, outputFilter(outputGlobs))
+	if err != nil {
+		return false, nil, 0, err
+	}
+	f.logFetch(true, hash, meta.Duration)
+	return true, restoredFiles, meta.Duration, nil
+}
+
+// quarantineDirectory returns the directory that corrupt artifacts are moved into
+func (f *fsCache) quarantineDirectory() turbopath.AbsoluteSystemPath {
+	return f.cacheDirectory.UntypedJoin("quarantine")
+}
+
+// quarantine moves every file belonging to the artifact with the given hash out of the cache,
+// so that it can be inspected later, and reports the fetch as a miss. Another cache, or running
+// the task, will then replace it.
+func (f *fsCache) quarantine(hash string, reason error) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	f.logFetch(false, hash, 0)
+	quarantineDir := f.quarantineDirectory()
+	if err := quarantineDir.MkdirAll(0775); err != nil {
+		return false, nil, 0, err
+	}
+	for _, suffix := range _fsCacheEntrySuffixes {
+		name := hash + suffix
+		source := f.cacheDirectory.UntypedJoin(name)
+		if err := source.Rename(quarantineDir.UntypedJoin(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, nil, 0, fmt.Errorf("failed to quarantine artifact %v (%v): %w", hash, reason, err)
+		}
+	}
+	return false, nil, 0, nil
+}
+
+// quarantineBlob moves a corrupt blob out of the blob store
+func (f *fsCache) quarantineBlob(digest string) error {
+	quarantineDir := f.quarantineDirectory()
+	if err := quarantineDir.MkdirAll(0775); err != nil {
+		return err
+	}
+	if err := f.blobs.Path(digest).Rename(quarantineDir.UntypedJoin(digest)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
 func (f *fsCache) Exists(hash string) (ItemStatus, error) {
 	uncompressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar")
 	compressedCachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
+	manifestPath := f.cacheDirectory.UntypedJoin(hash + "-manifest.json")
 
-	if compressedCachePath.FileExists() || uncompressedCachePath.FileExists() {
+	if compressedCachePath.FileExists() || uncompressedCachePath.FileExists() || manifestPath.FileExists() {
 		return ItemStatus{Local: true}, nil
 	}
 
 	return ItemStatus{Local: false}, nil
 }
 
+func (f *fsCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	itemStatuses := make(map[string]ItemStatus, len(hashes))
+	for _, hash := range hashes {
+		itemStatus, err := f.Exists(hash)
+		if err != nil {
+			return nil, err
+		}
+		itemStatuses[hash] = itemStatus
+	}
+	return itemStatuses, nil
+}
+
 func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 	var event string
 	if hit {
@@ -102,6 +244,9 @@ func (f *fsCache) logFetch(hit bool, hash string, duration int) {
 }
 
 func (f *fsCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
+	if f.dedupe {
+		return f.putManifest(anchor, hash, duration, files)
+	}
 	cachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
 	cacheItem, err := cacheitem.Create(cachePath)
 	if err != nil {
@@ -116,25 +261,107 @@ func (f *fsCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration
 		}
 	}
 
-	writeErr := WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
+	if err := cacheItem.Close(); err != nil {
+		return err
+	}
+
+	// The checksum covers the archive exactly as it landed on disk.
+	sha, err := fileSha(cachePath)
+	if err != nil {
+		return err
+	}
+
+	// The metadata goes last, marking the artifact as complete.
+	return WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
 		Duration: duration,
 		Hash:     hash,
+		Sha:      sha,
 	})
+}
 
-	if writeErr != nil {
-		_ = cacheItem.Close()
-		return writeErr
+// putArtifact stores an artifact that is already a compressed tar, such as one downloaded
+// from a remote cache, as is.
+func (f *fsCache) putArtifact(hash string, duration int, tarReader io.Reader) error {
+	cachePath := f.cacheDirectory.UntypedJoin(hash + ".tar.zst")
+	file, err := cachePath.Create()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, tarReader); err != nil {
+		_ = file.Close()
+		_ = cachePath.Remove()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	sha, err := fileSha(cachePath)
+	if err != nil {
+		return err
 	}
 
-	return cacheItem.Close()
+	// The metadata goes last, marking the artifact as complete.
+	return WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
+		Duration: duration,
+		Hash:     hash,
+		Sha:      sha,
+	})
+}
+
+// putManifest stores files as deduplicated blobs, along with a manifest describing the artifact
+func (f *fsCache) putManifest(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
+	manifest := &cacheitem.Manifest{}
+	for _, file := range files {
+		if err := manifest.AddFile(f.blobs, anchor, file); err != nil {
+			return err
+		}
+	}
+	manifestPath := f.cacheDirectory.UntypedJoin(hash + "-manifest.json")
+	if err := manifest.Write(manifestPath); err != nil {
+		return err
+	}
+	sha, err := fileSha(manifestPath)
+	if err != nil {
+		return err
+	}
+	return WriteCacheMetaFile(f.cacheDirectory.UntypedJoin(hash+"-meta.json"), &CacheMetadata{
+		Duration: duration,
+		Hash:     hash,
+		Sha:      sha,
+	})
 }
 
+// fileSha returns the hex-encoded SHA-512 of the file at path, as recorded in CacheMetadata
+func fileSha(path turbopath.AbsoluteSystemPath) (string, error) {
+	cacheItem, err := cacheitem.Open(path)
+	if err != nil {
+		return "", err
+	}
+	sha, shaErr := cacheItem.GetSha()
+	closeErr := cacheItem.Close()
+	if shaErr != nil {
+		return "", shaErr
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return hex.EncodeToString(sha), nil
+}
+
+// Clean evicts artifacts that exceed the configured MaxSize or MaxAge.
+// It is a no-op if no limits are configured.
 func (f *fsCache) Clean(anchor turbopath.AbsoluteSystemPath) {
-	fmt.Println("Not implemented yet")
+	if !f.hasEvictionPolicy() {
+		return
+	}
+	// Eviction is best-effort; if another process is already cleaning, it will do the work.
+	_, _ = f.evict(false, time.Now())
 }
 
+// CleanAll removes every artifact from the filesystem cache
 func (f *fsCache) CleanAll() {
-	fmt.Println("Not implemented yet")
+	_, _ = f.evict(true, time.Now())
 }
 
 func (f *fsCache) Shutdown() {}
@@ -144,6 +371,12 @@ func (f *fsCache) Shutdown() {}
 type CacheMetadata struct {
 	Hash     string `json:"hash"`
 	Duration int    `json:"duration"`
+	// Sha is the hex-encoded SHA-512 of the artifact as written to disk. Artifacts
+	// written by older versions of turbo don't have one, and aren't verified.
+	Sha string `json:"sha,omitempty"`
+	// Tag is the signature uploaded with the artifact, which `turbo cache serve`
+	// hands back to clients so that they can verify it.
+	Tag string `json:"tag,omitempty"`
 }
 
 // WriteCacheMetaFile writes cache metadata file at a path
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// _evictionGracePeriod protects artifacts that were written or read very recently.
+// Another turbo process may still be writing the archive, or restoring from it,
+// so we never evict an entry that has been touched within this window.
+const _evictionGracePeriod = time.Minute
+
+// ErrCleanInProgress is returned when another process is already evicting
+// artifacts from the same filesystem cache directory.
+var ErrCleanInProgress = errors.New("another turbo process is already cleaning this cache")
+
+// CleanSummary reports the result of evicting artifacts from the filesystem cache
+type CleanSummary struct {
+	Removed        int   `json:"removed"`
+	RemovedBytes   int64 `json:"removedBytes"`
+	Remaining      int   `json:"remaining"`
+	RemainingBytes int64 `json:"remainingBytes"`
+}
+
+// fsCacheEntry groups together the files on disk that make up a single cached artifact
+type fsCacheEntry struct {
+	hash       string
+	size       int64
+	lastAccess time.Time
+	files      []turbopath.AbsoluteSystemPath
+	hasMeta    bool
+	// digests are the blobs referenced by this entry's manifest, if it has one
+	digests []string
+}
+
+// _fsCacheEntrySuffixes are the file suffixes that belong to a cache entry, keyed by hash
+var _fsCacheEntrySuffixes = []string{".tar.zst", ".tar", "-manifest.json", "-meta.json"}
+
+// CleanLocal evicts artifacts from the filesystem cache configured by opts.
+// If all is true, every artifact is removed. Otherwise, only artifacts over the
+// configured MaxAge or MaxSize limits are removed, least recently used first.
+func CleanLocal(opts Opts, repoRoot turbopath.AbsoluteSystemPath, all bool) (*CleanSummary, error) {
+	cacheDir := opts.ResolveCacheDir(repoRoot)
+	if !cacheDir.DirExists() {
+		return &CleanSummary{}, nil
+	}
+	f := &fsCache{
+		cacheDirectory: cacheDir,
+		maxSize:        opts.MaxSize,
+		maxAge:         opts.MaxAge,
+		blobs:          newBlobStore(cacheDir, opts.DedupeHardlinks),
+	}
+	return f.evict(all, time.Now())
+}
+
+// recordAccess bumps the modification time of the metadata file for the given hash.
+// The metadata file's modification time is what we use to order entries for eviction.
+func (f *fsCache) recordAccess(hash string) {
+	now := time.Now()
+	_ = f.cacheDirectory.UntypedJoin(hash+"-meta.json").Chtimes(now, now)
+}
+
+// hasEvictionPolicy returns true if this cache has been configured with any limits
+func (f *fsCache) hasEvictionPolicy() bool {
+	return f.maxSize > 0 || f.maxAge > 0
+}
+
+// evict removes entries from the cache directory according to the configured policy.
+// Only one process may evict from a given cache directory at a time. Readers in other
+// processes are protected by the grace period, and by treating a concurrently-removed
+// entry as a cache miss.
+func (f *fsCache) evict(all bool, now time.Time) (*CleanSummary, error) {
+	lock, err := lockfile.New(f.cacheDirectory.UntypedJoin("clean.lock").ToString())
+	if err != nil {
+		// lockfile.New only fails for relative paths, and our cache directory is absolute.
+		return nil, err
+	}
+	if err := lock.TryLock(); err != nil {
+		if errors.Is(err, lockfile.ErrBusy) {
+			return nil, ErrCleanInProgress
+		}
+		return nil, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	entries, err := f.listEntries()
+	if err != nil {
+		return nil, err
+	}
+	// Least recently used first
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastAccess.Before(entries[j].lastAccess)
+	})
+
+	totalSize := int64(0)
+	for _, entry := range entries {
+		totalSize += entry.size
+	}
+
+	summary := &CleanSummary{}
+	referencedBlobs := make(map[string]struct{})
+	for _, entry := range entries {
+		shouldEvict := all
+		if !shouldEvict && now.Sub(entry.lastAccess) < _evictionGracePeriod {
+			// Either in the middle of being written, or just restored. Leave it be.
+			shouldEvict = false
+		} else if !shouldEvict {
+			tooOld := f.maxAge > 0 && now.Sub(entry.lastAccess) > f.maxAge
+			tooBig := f.maxSize > 0 && totalSize > f.maxSize
+			// Entries without metadata past the grace period are leftovers from interrupted writes.
+			shouldEvict = tooOld || tooBig || !entry.hasMeta
+		}
+		if !shouldEvict {
+			summary.Remaining++
+			summary.RemainingBytes += entry.size
+			for _, digest := range entry.digests {
+				referencedBlobs[digest] = struct{}{}
+			}
+			continue
+		}
+		if err := entry.remove(); err != nil {
+			return nil, err
+		}
+		totalSize -= entry.size
+		summary.Removed++
+		summary.RemovedBytes += entry.size
+	}
+	if err := f.collectBlobs(referencedBlobs, all, now); err != nil {
+		return nil, err
+	}
+	if all {
+		if err := f.quarantineDirectory().RemoveAll(); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// collectBlobs removes deduplicated blobs that are no longer referenced by any manifest.
+// Blobs written within the grace period are kept unless all is set, since their manifest
+// may not have been written yet.
+func (f *fsCache) collectBlobs(referenced map[string]struct{}, all bool, now time.Time) error {
+	if f.blobs == nil {
+		return nil
+	}
+	return f.blobs.Walk(func(digest string, info os.FileInfo) error {
+		if _, ok := referenced[digest]; ok {
+			return nil
+		}
+		if !all && now.Sub(info.ModTime()) < _evictionGracePeriod {
+			return nil
+		}
+		return f.blobs.Remove(digest)
+	})
+}
+
+// listEntries collects the artifacts in the cache directory, keyed by hash
+func (f *fsCache) listEntries() ([]*fsCacheEntry, error) {
+	dirEntries, err := os.ReadDir(f.cacheDirectory.ToString())
+	if err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]*fsCacheEntry)
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.Type().IsRegular() {
+			continue
+		}
+		name := dirEntry.Name()
+		for _, suffix := range _fsCacheEntrySuffixes {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			info, err := dirEntry.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed out from under us, nothing to account for.
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			hash := strings.TrimSuffix(name, suffix)
+			entry, ok := byHash[hash]
+			if !ok {
+				entry = &fsCacheEntry{hash: hash}
+				byHash[hash] = entry
+			}
+			entry.size += info.Size()
+			entry.files = append(entry.files, f.cacheDirectory.UntypedJoin(name))
+			if suffix == "-manifest.json" {
+				// Count the referenced blobs towards this entry. Blobs shared between
+				// entries are counted once per entry, which overestimates the total.
+				manifest, err := cacheitem.ReadManifest(f.cacheDirectory.UntypedJoin(name))
+				if err == nil {
+					for _, manifestEntry := range manifest.Entries {
+						entry.size += manifestEntry.Size
+					}
+					entry.digests = manifest.Digests()
+				}
+			}
+			if suffix == "-meta.json" {
+				entry.hasMeta = true
+				// The metadata file's mtime is bumped on every read, so it wins.
+				entry.lastAccess = info.ModTime()
+			} else if !entry.hasMeta && info.ModTime().After(entry.lastAccess) {
+				entry.lastAccess = info.ModTime()
+			}
+			break
+		}
+	}
+	entries := make([]*fsCacheEntry, 0, len(byHash))
+	for _, entry := range byHash {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// remove deletes the files making up this entry. The metadata file goes last
+// so that a partially-removed entry still looks like an entry to the next clean.
+func (e *fsCacheEntry) remove() error {
+	sort.Slice(e.files, func(i, j int) bool {
+		return !strings.HasSuffix(e.files[i].ToString(), "-meta.json") && strings.HasSuffix(e.files[j].ToString(), "-meta.json")
+	})
+	for _, file := range e.files {
+		if err := file.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeTestEntry creates a fake cache entry with an archive of the given size
+// and a metadata file last accessed at the given time.
+func writeTestEntry(t *testing.T, cacheDir turbopath.AbsoluteSystemPath, hash string, size int, lastAccess time.Time) {
+	t.Helper()
+	archivePath := cacheDir.UntypedJoin(hash + ".tar.zst")
+	assert.NilError(t, archivePath.WriteFile([]byte(strings.Repeat("a", size)), 0644), "WriteFile")
+	assert.NilError(t, archivePath.Chtimes(lastAccess, lastAccess), "Chtimes")
+	metaPath := cacheDir.UntypedJoin(hash + "-meta.json")
+	assert.NilError(t, WriteCacheMetaFile(metaPath, &CacheMetadata{Hash: hash}), "WriteCacheMetaFile")
+	assert.NilError(t, metaPath.Chtimes(lastAccess, lastAccess), "Chtimes")
+}
+
+func remainingHashes(t *testing.T, f *fsCache) []string {
+	t.Helper()
+	entries, err := f.listEntries()
+	assert.NilError(t, err, "listEntries")
+	hashes := []string{}
+	for _, entry := range entries {
+		hashes = append(hashes, entry.hash)
+	}
+	return hashes
+}
+
+func TestEvictMaxSize(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "oldest", 1000, now.Add(-3*time.Hour))
+	writeTestEntry(t, cacheDir, "middle", 1000, now.Add(-2*time.Hour))
+	writeTestEntry(t, cacheDir, "newest", 1000, now.Add(-1*time.Hour))
+
+	f := &fsCache{cacheDirectory: cacheDir, maxSize: 2500}
+	summary, err := f.evict(false, now)
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, summary.Removed, 1)
+	assert.Equal(t, summary.Remaining, 2)
+	assert.Assert(t, summary.RemainingBytes <= 2500)
+	assert.Assert(t, !cacheDir.UntypedJoin("oldest.tar.zst").FileExists())
+	assert.Assert(t, !cacheDir.UntypedJoin("oldest-meta.json").FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("middle.tar.zst").FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("newest.tar.zst").FileExists())
+}
+
+func TestEvictMaxAge(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "stale", 10, now.Add(-10*24*time.Hour))
+	writeTestEntry(t, cacheDir, "fresh", 10, now.Add(-1*time.Hour))
+
+	f := &fsCache{cacheDirectory: cacheDir, maxAge: 7 * 24 * time.Hour}
+	summary, err := f.evict(false, now)
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, summary.Removed, 1)
+	assert.DeepEqual(t, remainingHashes(t, f), []string{"fresh"})
+}
+
+func TestEvictRespectsGracePeriod(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "in-use", 1000, now)
+	// An archive without metadata that is still being written
+	assert.NilError(t, cacheDir.UntypedJoin("writing.tar.zst").WriteFile([]byte("partial"), 0644), "WriteFile")
+	// An archive without metadata that was abandoned
+	orphanPath := cacheDir.UntypedJoin("orphan.tar.zst")
+	assert.NilError(t, orphanPath.WriteFile([]byte("partial"), 0644), "WriteFile")
+	assert.NilError(t, orphanPath.Chtimes(now.Add(-time.Hour), now.Add(-time.Hour)), "Chtimes")
+
+	f := &fsCache{cacheDirectory: cacheDir, maxSize: 1}
+	summary, err := f.evict(false, now)
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, summary.Removed, 1)
+	assert.Assert(t, !orphanPath.FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("in-use.tar.zst").FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("writing.tar.zst").FileExists())
+}
+
+func TestEvictAll(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	now := time.Now()
+	writeTestEntry(t, cacheDir, "one", 10, now)
+	writeTestEntry(t, cacheDir, "two", 10, now.Add(-time.Hour))
+
+	f := &fsCache{cacheDirectory: cacheDir}
+	summary, err := f.evict(true, now)
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, summary.Removed, 2)
+	assert.Equal(t, summary.Remaining, 0)
+	assert.DeepEqual(t, remainingHashes(t, f), []string{})
+}
+
+func TestEvictWithoutPolicyIsNoop(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	writeTestEntry(t, cacheDir, "old", 10, time.Now().Add(-100*24*time.Hour))
+
+	f := &fsCache{cacheDirectory: cacheDir}
+	f.Clean(cacheDir)
+	assert.DeepEqual(t, remainingHashes(t, f), []string{"old"})
+}
+
+func TestEvictConcurrentClean(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	// Simulate another live process holding the lock. Our own pid would be
+	// treated as re-entrant by lockfile, so use our parent's.
+	lockPath := cacheDir.UntypedJoin("clean.lock")
+	assert.NilError(t, lockPath.WriteFile([]byte(fmt.Sprintf("%d\n", os.Getppid())), 0644), "WriteFile")
+
+	f := &fsCache{cacheDirectory: cacheDir, maxSize: 1}
+	_, err := f.evict(false, time.Now())
+	assert.ErrorIs(t, err, ErrCleanInProgress)
+}
+
+func TestFetchRecordsAccess(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	aPath := src.UntypedJoin("a")
+	assert.NilError(t, aPath.WriteFile([]byte("hello"), 0644), "WriteFile")
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	f := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder}
+	assert.NilError(t, f.Put(src, "the-hash", 0, []turbopath.AnchoredSystemPath{"a"}), "Put")
+
+	longAgo := time.Now().Add(-48 * time.Hour)
+	metaPath := cacheDir.UntypedJoin("the-hash-meta.json")
+	assert.NilError(t, metaPath.Chtimes(longAgo, longAgo), "Chtimes")
+
+	hit, _, _, err := f.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+
+	info, err := metaPath.Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.Assert(t, info.ModTime().After(longAgo.Add(time.Hour)))
+}
+
+func TestEvictCollectsUnreferencedBlobs(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	for _, file := range []string{"old", "new"} {
+		assert.NilError(t, src.UntypedJoin(file).WriteFile([]byte(file+" contents"), 0644), "WriteFile")
+	}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	f := &fsCache{
+		cacheDirectory: cacheDir,
+		recorder:       analytics.NullRecorder,
+		maxAge:         24 * time.Hour,
+		dedupe:         true,
+		blobs:          newBlobStore(cacheDir, false),
+	}
+	assert.NilError(t, f.Put(src, "old", 0, []turbopath.AnchoredSystemPath{"old"}), "Put")
+	assert.NilError(t, f.Put(src, "new", 0, []turbopath.AnchoredSystemPath{"new"}), "Put")
+
+	// Age everything past the grace period, and the old entry past the max age.
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	assert.NilError(t, f.blobs.Walk(func(digest string, _ os.FileInfo) error {
+		return f.blobs.Path(digest).Chtimes(past, past)
+	}), "Walk")
+	stale := now.Add(-48 * time.Hour)
+	assert.NilError(t, cacheDir.UntypedJoin("old-meta.json").Chtimes(stale, stale), "Chtimes")
+	assert.NilError(t, cacheDir.UntypedJoin("new-meta.json").Chtimes(past, past), "Chtimes")
+
+	// An unreferenced blob inside the grace period belongs to an in-progress Put.
+	inProgress, _, err := f.blobs.Add(strings.NewReader("in progress"))
+	assert.NilError(t, err, "Add")
+
+	summary, err := f.evict(false, now)
+	assert.NilError(t, err, "evict")
+	assert.Equal(t, summary.Removed, 1)
+	assert.DeepEqual(t, remainingHashes(t, f), []string{"new"})
+
+	blobs := []string{}
+	assert.NilError(t, f.blobs.Walk(func(digest string, _ os.FileInfo) error {
+		blobs = append(blobs, digest)
+		return nil
+	}), "Walk")
+	assert.Equal(t, len(blobs), 2)
+	assert.Assert(t, f.blobs.Has(inProgress))
+
+	hit, _, _, err := f.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "new", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+
+	_, err = f.evict(true, now)
+	assert.NilError(t, err, "evict")
+	assert.Assert(t, !f.blobs.Has(inProgress))
+}
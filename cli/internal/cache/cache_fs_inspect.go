@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"sort"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// LocalArtifact describes an artifact in the local filesystem cache
+type LocalArtifact struct {
+	Hash string `json:"hash"`
+	// Size is the size on disk in bytes, including any deduplicated files
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"lastUsed"`
+	// Duration is how long the task took to run in milliseconds, which is the time a hit saves
+	Duration int `json:"duration"`
+	// Sha is the checksum recorded when the artifact was written, if any
+	Sha string `json:"sha,omitempty"`
+}
+
+// ListLocal returns the artifacts in the local filesystem cache configured by opts,
+// most recently used first.
+func ListLocal(opts Opts, repoRoot turbopath.AbsoluteSystemPath) ([]*LocalArtifact, error) {
+	cacheDir := opts.ResolveCacheDir(repoRoot)
+	if !cacheDir.DirExists() {
+		return []*LocalArtifact{}, nil
+	}
+	f := &fsCache{cacheDirectory: cacheDir}
+	entries, err := f.listEntries()
+	if err != nil {
+		return nil, err
+	}
+	artifacts := make([]*LocalArtifact, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.hasMeta {
+			// Still being written, or left over from an interrupted write
+			continue
+		}
+		artifact := &LocalArtifact{
+			Hash:     entry.hash,
+			Size:     entry.size,
+			LastUsed: entry.lastAccess,
+		}
+		if meta, err := ReadCacheMetaFile(cacheDir.UntypedJoin(entry.hash + "-meta.json")); err == nil {
+			artifact.Duration = meta.Duration
+			artifact.Sha = meta.Sha
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].LastUsed.After(artifacts[j].LastUsed)
+	})
+	return artifacts, nil
+}
+
+// RemoveLocal removes the artifact with the given hash from the local filesystem cache
+// configured by opts, returning false if there was no such artifact. Deduplicated files
+// that are no longer referenced are left for the next clean to remove.
+func RemoveLocal(opts Opts, repoRoot turbopath.AbsoluteSystemPath, hash string) (bool, error) {
+	cacheDir := opts.ResolveCacheDir(repoRoot)
+	entry := &fsCacheEntry{hash: hash}
+	for _, suffix := range _fsCacheEntrySuffixes {
+		if path := cacheDir.UntypedJoin(hash + suffix); path.FileExists() {
+			entry.files = append(entry.files, path)
+		}
+	}
+	if len(entry.files) == 0 {
+		return false, nil
+	}
+	return true, entry.remove()
+}
@@ -1,19 +1,17 @@
 package cache
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"gotest.tools/v3/assert"
 )
 
-type dummyRecorder struct{}
-
-func (dr *dummyRecorder) LogEvent(payload analytics.EventPayload) {}
-
 func TestPut(t *testing.T) {
 	// Set up a test source and cache directory
 	// The "source" directory simulates a package
@@ -67,7 +65,7 @@ func TestPut(t *testing.T) {
 	}
 
 	dst := turbopath.AbsoluteSystemPath(t.TempDir())
-	dr := &dummyRecorder{}
+	dr := analytics.NullRecorder
 
 	cache := &fsCache{
 		cacheDirectory: dst,
@@ -195,7 +193,7 @@ func TestFetch(t *testing.T) {
 	err = metadataPath.WriteFile([]byte(`{"hash":"the-hash","duration":0}`), 0777)
 	assert.NilError(t, err, "WriteFile")
 
-	dr := &dummyRecorder{}
+	dr := analytics.NullRecorder
 
 	cache := &fsCache{
 		cacheDirectory: cacheDir,
@@ -216,7 +214,7 @@ func TestFetch(t *testing.T) {
 
 	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
 	dstOutputPath := "some-package"
-	hit, files, _, err := cache.Fetch(outputDir, "the-hash", []string{})
+	hit, files, _, err := cache.Fetch(outputDir, "the-hash", nil)
 	assert.NilError(t, err, "Fetch")
 	if !hit {
 		t.Error("Fetch got false, want true")
@@ -250,3 +248,158 @@ func TestFetch(t *testing.T) {
 	assert.NilError(t, circleReadlinkErr, "Circle Readlink")
 	assert.Equal(t, circleTarget, srcCircleLinkTarget.ToString())
 }
+
+func TestFetchOutputGlobs(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	inputFiles := []turbopath.AnchoredSystemPath{}
+	for _, file := range []string{"pkg/dist/a.js", "pkg/dist/cache/b.js", "pkg/lib/c.js"} {
+		path := turbopath.AnchoredUnixPath(file).ToSystemPath()
+		abs := path.RestoreAnchor(src)
+		assert.NilError(t, abs.EnsureDir(), "EnsureDir")
+		assert.NilError(t, abs.WriteFile([]byte(file), 0644), "WriteFile")
+		inputFiles = append(inputFiles, path)
+	}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder}
+	assert.NilError(t, cache.Put(src, "the-hash", 0, inputFiles), "Put")
+
+	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	outputGlobs := &fs.TaskOutputs{
+		Inclusions: []string{filepath.Join("pkg", "dist", "**")},
+		Exclusions: []string{filepath.Join("pkg", "dist", "cache", "**")},
+	}
+	hit, files, _, err := cache.Fetch(outputDir, "the-hash", outputGlobs)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.DeepEqual(t, files, []turbopath.AnchoredSystemPath{turbopath.AnchoredUnixPath("pkg/dist/a.js").ToSystemPath()})
+	assert.Assert(t, outputDir.UntypedJoin("pkg", "dist", "a.js").FileExists())
+	assert.Assert(t, !outputDir.UntypedJoin("pkg", "dist", "cache", "b.js").FileExists())
+	assert.Assert(t, !outputDir.UntypedJoin("pkg", "lib", "c.js").FileExists())
+}
+
+func TestPutFetchDedupe(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	inputFiles := []turbopath.AnchoredSystemPath{}
+	for _, file := range []string{"pkg-a/dist/index.js", "pkg-b/dist/index.js"} {
+		path := turbopath.AnchoredUnixPath(file).ToSystemPath()
+		abs := path.RestoreAnchor(src)
+		assert.NilError(t, abs.EnsureDir(), "EnsureDir")
+		assert.NilError(t, abs.WriteFile([]byte("identical output"), 0644), "WriteFile")
+		inputFiles = append(inputFiles, path)
+	}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache, err := newFsCache(Opts{OverrideDir: cacheDir.ToString(), Dedupe: true}, analytics.NullRecorder, src)
+	assert.NilError(t, err, "newFsCache")
+	assert.NilError(t, cache.Put(src, "hash-a", 5, inputFiles[:1]), "Put")
+	assert.NilError(t, cache.Put(src, "hash-b", 5, inputFiles[1:]), "Put")
+	assert.Assert(t, cacheDir.UntypedJoin("hash-a-manifest.json").FileExists())
+	assert.Assert(t, !cacheDir.UntypedJoin("hash-a.tar.zst").FileExists())
+
+	blobCount := 0
+	assert.NilError(t, cache.blobs.Walk(func(string, os.FileInfo) error {
+		blobCount++
+		return nil
+	}), "Walk")
+	assert.Equal(t, blobCount, 1)
+
+	status, err := cache.Exists("hash-b")
+	assert.NilError(t, err, "Exists")
+	assert.Assert(t, status.Local)
+
+	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	hit, files, duration, err := cache.Fetch(outputDir, "hash-b", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.Equal(t, duration, 5)
+	assert.DeepEqual(t, files, inputFiles[1:])
+	contents, err := outputDir.UntypedJoin("pkg-b", "dist", "index.js").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "identical output")
+
+	// Artifacts written before deduplication was enabled are still readable.
+	cache.dedupe = false
+	assert.NilError(t, cache.Put(src, "hash-tar", 1, inputFiles[:1]), "Put")
+	cache.dedupe = true
+	hit, _, _, err = cache.Fetch(turbopath.AbsoluteSystemPath(t.TempDir()), "hash-tar", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+}
+
+func TestFetchQuarantinesCorruptArtifact(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("output.txt").WriteFile([]byte("output contents"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{"output.txt"}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder}
+	assert.NilError(t, cache.Put(src, "the-hash", 0, files), "Put")
+	meta, err := ReadCacheMetaFile(cacheDir.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	assert.Assert(t, meta.Sha != "")
+
+	// Truncate the archive, as a full disk would.
+	archivePath := cacheDir.UntypedJoin("the-hash.tar.zst")
+	contents, err := archivePath.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.NilError(t, archivePath.WriteFile(contents[:len(contents)/2], 0644), "WriteFile")
+
+	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	hit, restored, _, err := cache.Fetch(outputDir, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+	assert.Equal(t, len(restored), 0)
+	assert.Assert(t, !outputDir.UntypedJoin("output.txt").FileExists())
+	assert.Assert(t, !archivePath.FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("quarantine", "the-hash.tar.zst").FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("quarantine", "the-hash-meta.json").FileExists())
+}
+
+func TestFetchQuarantinesCorruptBlob(t *testing.T) {
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("output.txt").WriteFile([]byte("output contents"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{"output.txt"}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	cache := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder, dedupe: true, blobs: newBlobStore(cacheDir, false)}
+	assert.NilError(t, cache.Put(src, "the-hash", 0, files), "Put")
+
+	manifest, err := cacheitem.ReadManifest(cacheDir.UntypedJoin("the-hash-manifest.json"))
+	assert.NilError(t, err, "ReadManifest")
+	digest := manifest.Digests()[0]
+	assert.NilError(t, cache.blobs.Path(digest).WriteFile([]byte("output c0ntents"), 0644), "WriteFile")
+
+	outputDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	hit, _, _, err := cache.Fetch(outputDir, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+	assert.Assert(t, !outputDir.UntypedJoin("output.txt").FileExists())
+	assert.Assert(t, !cache.blobs.Has(digest))
+	assert.Assert(t, cacheDir.UntypedJoin("quarantine", digest).FileExists())
+	assert.Assert(t, cacheDir.UntypedJoin("quarantine", "the-hash-manifest.json").FileExists())
+}
+
+func TestCorruptArtifactFallsThroughMultiplexer(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	assert.NilError(t, repoRoot.UntypedJoin("output.txt").WriteFile([]byte("output contents"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{"output.txt"}
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	local := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder}
+	assert.NilError(t, local.Put(repoRoot, "the-hash", 0, files), "Put")
+	assert.NilError(t, cacheDir.UntypedJoin("the-hash.tar.zst").WriteFile([]byte("garbage"), 0644), "WriteFile")
+
+	remote := &testCache{entries: map[string][]turbopath.AnchoredSystemPath{"the-hash": files}}
+	mplex := &cacheMultiplexer{caches: []Cache{local, remote}}
+	hit, _, _, err := mplex.Fetch(repoRoot, "the-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+
+	// The remote hit replaced the quarantined local artifact.
+	meta, err := ReadCacheMetaFile(cacheDir.UntypedJoin("the-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	sha, err := fileSha(cacheDir.UntypedJoin("the-hash.tar.zst"))
+	assert.NilError(t, err, "fileSha")
+	assert.Equal(t, sha, meta.Sha)
+}
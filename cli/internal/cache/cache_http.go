@@ -5,7 +5,6 @@ package cache
 
 import (
 	"archive/tar"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -20,14 +19,16 @@ import (
 	"github.com/DataDog/zstd"
 
 	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/tarpatch"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
 type client interface {
-	PutArtifact(hash string, body []byte, duration int, tag string) error
+	PutArtifact(hash string, body io.Reader, size int64, duration int, tag string) error
 	FetchArtifact(hash string) (*http.Response, error)
 	ArtifactExists(hash string) (*http.Response, error)
+	ArtifactsExist(hashes []string) (map[string]bool, error)
 	GetTeamID() string
 }
 
@@ -37,7 +38,7 @@ type httpCache struct {
 	requestLimiter limiter
 	recorder       analytics.Recorder
 	signerVerifier *ArtifactSignatureAuthentication
-	repoRoot       turbopath.AbsoluteSystemPath
+	encryption     *ArtifactEncryption
 }
 
 type limiter chan struct{}
@@ -57,32 +58,37 @@ var mtime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
 const nobody = 65534
 
 func (cache *httpCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
-	// if cache.writable {
-	cache.requestLimiter.acquire()
-	defer cache.requestLimiter.release()
-
-	r, w := io.Pipe()
-	go cache.write(w, hash, files)
-
-	// Read the entire artifact tar into memory so we can easily compute the signature.
-	// Note: retryablehttp.NewRequest reads the files into memory anyways so there's no
-	// additional overhead by doing the ioutil.ReadAll here instead.
-	artifactBody, err := ioutil.ReadAll(r)
+	prepared, err := cache.prepareUpload(anchor, hash, files)
 	if err != nil {
-		return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+		return err
 	}
-	tag := ""
-	if cache.signerVerifier.isEnabled() {
-		tag, err = cache.signerVerifier.generateTag(hash, artifactBody)
-		if err != nil {
-			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
-		}
+	defer func() { _ = prepared.body.Close() }()
+	return cache.upload(hash, duration, prepared)
+}
+
+// prepareUpload spools the artifact to disk, computing the signature in the same pass,
+// so that it can be streamed to the server without holding it in memory.
+func (cache *httpCache) prepareUpload(anchor turbopath.AbsoluteSystemPath, hash string, files []turbopath.AnchoredSystemPath) (*preparedUpload, error) {
+	prepared, err := prepareUpload(cache.signerVerifier, cache.encryption, anchor, hash, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store files in HTTP cache: %w", err)
 	}
-	return cache.client.PutArtifact(hash, artifactBody, duration, tag)
+	return prepared, nil
 }
 
-// write writes a series of files into the given Writer.
-func (cache *httpCache) write(w io.WriteCloser, hash string, files []turbopath.AnchoredSystemPath) {
+func (cache *httpCache) upload(hash string, duration int, prepared *preparedUpload) error {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	return cache.client.PutArtifact(hash, prepared.body, prepared.size, duration, prepared.tag)
+}
+
+func (cache *httpCache) destination() string {
+	return "team:" + cache.client.GetTeamID()
+}
+
+// writeTar writes a series of files, relative to anchor, into the given Writer
+// as a zstd-compressed tar.
+func writeTar(w io.WriteCloser, anchor turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath) {
 	defer w.Close()
 	defer func() { _ = w.Close() }()
 	zw := zstd.NewWriter(w)
@@ -91,15 +97,15 @@ func (cache *httpCache) write(w io.WriteCloser, hash string, files []turbopath.A
 	defer func() { _ = tw.Close() }()
 	for _, file := range files {
 		// log.Printf("caching file %v", file)
-		if err := cache.storeFile(tw, file); err != nil {
+		if err := storeFile(tw, anchor, file); err != nil {
 			log.Printf("[ERROR] Error uploading artifact %s to HTTP cache due to: %s", file, err)
 			// TODO(jaredpalmer): How can we cancel the request at this point?
 		}
 	}
 }
 
-func (cache *httpCache) storeFile(tw *tar.Writer, repoRelativePath turbopath.AnchoredSystemPath) error {
-	absoluteFilePath := repoRelativePath.RestoreAnchor(cache.repoRoot)
+func storeFile(tw *tar.Writer, anchor turbopath.AbsoluteSystemPath, repoRelativePath turbopath.AnchoredSystemPath) error {
+	absoluteFilePath := repoRelativePath.RestoreAnchor(anchor)
 	info, err := absoluteFilePath.Lstat()
 	if err != nil {
 		return err
@@ -143,10 +149,8 @@ func (cache *httpCache) storeFile(tw *tar.Writer, repoRelativePath turbopath.Anc
 	return err
 }
 
-func (cache *httpCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, _unusedOutputGlobs []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
-	cache.requestLimiter.acquire()
-	defer cache.requestLimiter.release()
-	hit, files, duration, err := cache.retrieve(key)
+func (cache *httpCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	hit, files, duration, err := cache.retrieve(anchor, key, outputFilter(outputGlobs))
 	if err != nil {
 		// TODO: analytics event?
 		return false, files, duration, fmt.Errorf("failed to retrieve files from HTTP cache: %w", err)
@@ -165,6 +169,20 @@ func (cache *httpCache) Exists(key string) (ItemStatus, error) {
 	return ItemStatus{Remote: hit}, err
 }
 
+func (cache *httpCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	exists, err := cache.client.ArtifactsExist(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify files from HTTP cache: %w", err)
+	}
+	itemStatuses := make(map[string]ItemStatus, len(hashes))
+	for _, hash := range hashes {
+		itemStatuses[hash] = ItemStatus{Remote: exists[hash]}
+	}
+	return itemStatuses, nil
+}
+
 func (cache *httpCache) logFetch(hit bool, hash string, duration int) {
 	var event string
 	if hit {
@@ -197,24 +215,43 @@ func (cache *httpCache) exists(hash string) (bool, error) {
 	return true, err
 }
 
-func (cache *httpCache) retrieve(hash string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+func (cache *httpCache) retrieve(anchor turbopath.AbsoluteSystemPath, hash string, include func(turbopath.AnchoredSystemPath) bool) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	var files []turbopath.AnchoredSystemPath
+	var duration int
+	hit, err := cache.download(hash, func(tarReader io.Reader, artifactDuration int) error {
+		var err error
+		files, err = restoreTar(anchor, tarReader, include)
+		duration = artifactDuration
+		return err
+	})
+	if err != nil || !hit {
+		return false, nil, 0, err
+	}
+	return true, files, duration, nil
+}
+
+// download fetches the artifact for hash, verifying and decrypting it as configured, and
+// passes the compressed tar to handle. It returns false if there is no such artifact.
+func (cache *httpCache) download(hash string, handle func(tarReader io.Reader, duration int) error) (bool, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
 	resp, err := cache.client.FetchArtifact(hash)
 	if err != nil {
-		return false, nil, 0, err
+		return false, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
-		return false, nil, 0, nil // doesn't exist - not an error
+		return false, nil // doesn't exist - not an error
 	} else if resp.StatusCode != http.StatusOK {
 		b, _ := ioutil.ReadAll(resp.Body)
-		return false, nil, 0, fmt.Errorf("%s", string(b))
+		return false, fmt.Errorf("%s", string(b))
 	}
 	// If present, extract the duration from the response.
 	duration := 0
 	if resp.Header.Get("x-artifact-duration") != "" {
 		intVar, err := strconv.Atoi(resp.Header.Get("x-artifact-duration"))
 		if err != nil {
-			return false, nil, 0, fmt.Errorf("invalid x-artifact-duration header: %w", err)
+			return false, fmt.Errorf("invalid x-artifact-duration header: %w", err)
 		}
 		duration = intVar
 	}
@@ -225,37 +262,50 @@ func (cache *httpCache) retrieve(hash string) (bool, []turbopath.AnchoredSystemP
 		expectedTag := resp.Header.Get("x-artifact-tag")
 		if expectedTag == "" {
 			// If the verifier is enabled all incoming artifact downloads must have a signature
-			return false, nil, 0, errors.New("artifact verification failed: Downloaded artifact is missing required x-artifact-tag header")
+			return false, fmt.Errorf("%w: Downloaded artifact is missing required x-artifact-tag header", errArtifactVerificationFailed)
 		}
-		b, err := ioutil.ReadAll(resp.Body)
+		// The artifact must be verified before any of it is restored, so spool it
+		// to disk rather than memory while computing its tag.
+		validator, err := cache.signerVerifier.newStreamValidator(hash)
 		if err != nil {
-			return false, nil, 0, fmt.Errorf("artifact verification failed: %w", err)
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
 		}
-		isValid, err := cache.signerVerifier.validate(hash, b, expectedTag)
+		artifact, err := newTempArtifact()
 		if err != nil {
-			return false, nil, 0, fmt.Errorf("artifact verification failed: %w", err)
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+		}
+		defer func() { _ = artifact.Close() }()
+		if err := artifact.fill(resp.Body, validator); err != nil {
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
 		}
-		if !isValid {
-			err = fmt.Errorf("artifact verification failed: artifact tag does not match expected tag %s", expectedTag)
-			return false, nil, 0, err
+		if !validator.Validate(expectedTag) {
+			return false, validator.mismatchError(expectedTag)
 		}
 		// The artifact has been verified and the body can be read and untarred
-		tarReader = bytes.NewReader(b)
+		tarReader = artifact
 	} else {
 		tarReader = resp.Body
 	}
-	files, err := restoreTar(cache.repoRoot, tarReader)
-	if err != nil {
-		return false, nil, 0, err
+	if cache.encryption.isEnabled() {
+		// Decrypted after verification, since the signature covers the encrypted artifact
+		plaintext, err := cache.encryption.decrypt(hash, tarReader)
+		if err != nil {
+			return false, err
+		}
+		defer func() { _ = plaintext.Close() }()
+		tarReader = plaintext
 	}
-	return true, files, duration, nil
+	if err := handle(tarReader, duration); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // restoreTar returns posix-style repo-relative paths of the files it
-// restored. In the future, these should likely be repo-relative system paths
+// restored. If include is non-nil, only the files it returns true for are restored. In the future, these should likely be repo-relative system paths
 // so that they are suitable for being fed into cache.Put for other caches.
 // For now, I think this is working because windows also accepts /-delimited paths.
-func restoreTar(root turbopath.AbsoluteSystemPath, reader io.Reader) ([]turbopath.AnchoredSystemPath, error) {
+func restoreTar(root turbopath.AbsoluteSystemPath, reader io.Reader, include func(turbopath.AnchoredSystemPath) bool) ([]turbopath.AnchoredSystemPath, error) {
 	files := []turbopath.AnchoredSystemPath{}
 	missingLinks := []*tar.Header{}
 	zr := zstd.NewReader(reader)
@@ -280,6 +330,9 @@ func restoreTar(root turbopath.AbsoluteSystemPath, reader io.Reader) ([]turbopat
 		// hdr.Name is always a posix-style path
 		// FIXME: THIS IS A BUG.
 		restoredName := turbopath.AnchoredUnixPath(hdr.Name)
+		if include != nil && !include(restoredName.ToSystemPath()) {
+			continue
+		}
 		files = append(files, restoredName.ToSystemPath())
 		filename := restoredName.ToSystemPath().RestoreAnchor(root)
 		if isChild, err := root.ContainsPath(filename); err != nil {
@@ -359,17 +412,15 @@ func (cache *httpCache) CleanAll() {
 
 func (cache *httpCache) Shutdown() {}
 
-func newHTTPCache(opts Opts, client client, recorder analytics.Recorder) *httpCache {
+func newHTTPCache(opts Opts, client client, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) *httpCache {
 	return &httpCache{
 		writable:       true,
 		client:         client,
 		requestLimiter: make(limiter, 20),
 		recorder:       recorder,
-		signerVerifier: &ArtifactSignatureAuthentication{
-			// TODO(Gaspar): this should use RemoteCacheOptions.TeamId once we start
-			// enforcing team restrictions for repositories.
-			teamId:  client.GetTeamID(),
-			enabled: opts.RemoteCacheOpts.Signature,
-		},
+		// TODO(Gaspar): this should use RemoteCacheOptions.TeamId once we start
+		// enforcing team restrictions for repositories.
+		signerVerifier: newArtifactSignatureAuthentication(client.GetTeamID(), opts.RemoteCacheOpts, repoRoot),
+		encryption:     newArtifactEncryption(opts.RemoteCacheOpts, repoRoot),
 	}
 }
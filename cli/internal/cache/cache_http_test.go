@@ -3,12 +3,18 @@ package cache
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"testing"
 
 	"github.com/DataDog/zstd"
 
+	"github.com/vercel/turbo/cli/internal/analytics"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/util"
@@ -19,7 +25,7 @@ type errorResp struct {
 	err error
 }
 
-func (sr *errorResp) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (sr *errorResp) PutArtifact(hash string, body io.Reader, size int64, duration int, tag string) error {
 	return sr.err
 }
 
@@ -31,6 +37,10 @@ func (sr *errorResp) ArtifactExists(hash string) (*http.Response, error) {
 	return nil, sr.err
 }
 
+func (sr *errorResp) ArtifactsExist(hashes []string) (map[string]bool, error) {
+	return nil, sr.err
+}
+
 func (sr *errorResp) GetTeamID() string {
 	return ""
 }
@@ -46,7 +56,7 @@ func TestRemoteCachingDisabled(t *testing.T) {
 		requestLimiter: make(limiter, 20),
 	}
 	cd := &util.CacheDisabledError{}
-	_, _, _, err := cache.Fetch("unused-target", "some-hash", []string{"unused", "outputs"})
+	_, _, _, err := cache.Fetch("unused-target", "some-hash", nil)
 	if !errors.As(err, &cd) {
 		t.Errorf("cache.Fetch err got %v, want a CacheDisabled error", err)
 	}
@@ -187,7 +197,7 @@ func TestRestoreTar(t *testing.T) {
 		turbopath.AnchoredUnixPath("my-pkg/link-to-extra-file").ToSystemPath(),
 		turbopath.AnchoredUnixPath("my-pkg/broken-link").ToSystemPath(),
 	}
-	files, err := restoreTar(root, tar)
+	files, err := restoreTar(root, tar, nil)
 	assert.NilError(t, err, "readTar")
 
 	expectedSet := make(util.Set)
@@ -230,7 +240,7 @@ func TestRestoreInvalidTar(t *testing.T) {
 	// use a child directory so that blindly untarring will squash the file
 	// that we just wrote above.
 	repoRoot := root.UntypedJoin("repo")
-	_, err = restoreTar(repoRoot, tar)
+	_, err = restoreTar(repoRoot, tar, nil)
 	if err == nil {
 		t.Error("expected error untarring invalid tar")
 	}
@@ -240,6 +250,123 @@ func TestRestoreInvalidTar(t *testing.T) {
 	assert.Equal(t, string(contents), string(expectedContents), "expected to not overwrite file")
 }
 
-// Note that testing Put will require mocking the filesystem and is not currently the most
-// interesting test. The current implementation directly returns the error from PutArtifact.
-// We should still add the test once feasible to avoid future breakage.
+// memoryClient is a client that stores a single artifact in memory
+type memoryClient struct {
+	body []byte
+	size int64
+	tag  string
+}
+
+func (mc *memoryClient) PutArtifact(hash string, body io.Reader, size int64, duration int, tag string) error {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	mc.body = b
+	mc.size = size
+	mc.tag = tag
+	return nil
+}
+
+func (mc *memoryClient) FetchArtifact(hash string) (*http.Response, error) {
+	if mc.body == nil {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	header := http.Header{}
+	header.Set("x-artifact-tag", mc.tag)
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(bytes.NewReader(mc.body))}, nil
+}
+
+func (mc *memoryClient) ArtifactExists(hash string) (*http.Response, error) {
+	panic("unimplemented")
+}
+
+func (mc *memoryClient) ArtifactsExist(hashes []string) (map[string]bool, error) {
+	exists := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		exists[hash] = mc.body != nil
+	}
+	return exists, nil
+}
+
+func (mc *memoryClient) GetTeamID() string {
+	return "team-id"
+}
+
+func TestPutFetchSignedArtifact(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "secret")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+
+	client := &memoryClient{}
+	cache := newHTTPCache(Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Signature: true}}, client, analytics.NullRecorder, src)
+	assert.NilError(t, cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	assert.Equal(t, client.size, int64(len(client.body)))
+	expectedTag, err := cache.signerVerifier.generateTag("some-hash", client.body)
+	assert.NilError(t, err, "generateTag")
+	assert.Equal(t, client.tag, expectedTag)
+
+	dst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	hit, files, _, err := cache.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.DeepEqual(t, files, []turbopath.AnchoredSystemPath{"a-file"})
+	contents, err := dst.UntypedJoin("a-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "contents")
+
+	// A tampered artifact must not be restored
+	client.body[len(client.body)-1] ^= 0xff
+	tampered := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	_, _, _, err = cache.Fetch(tampered, "some-hash", nil)
+	assert.ErrorContains(t, err, "artifact verification failed")
+	assert.Assert(t, !tampered.UntypedJoin("a-file").FileExists())
+}
+
+func TestPutFetchEd25519SignedArtifact(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err, "GenerateKey")
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err, "GenerateKey")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	opts := Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Signature: true, SignatureAlgorithm: "ed25519"}}
+
+	// Machines without a private key never upload, and say so
+	client := &memoryClient{}
+	cache := newHTTPCache(opts, client, analytics.NullRecorder, src)
+	err = cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"})
+	assert.Assert(t, errors.Is(err, errSignatureVerifyOnly))
+	assert.ErrorContains(t, err, "artifact some-hash was not uploaded")
+	assert.Assert(t, client.body == nil)
+
+	// Sign with a key this machine doesn't trust
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", base64.StdEncoding.EncodeToString(otherPrivateKey.Seed()))
+	assert.NilError(t, cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	assert.Assert(t, client.body != nil)
+
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", "")
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS", base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)))
+	dst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	_, _, _, err = cache.Fetch(dst, "some-hash", nil)
+	assert.Assert(t, errors.Is(err, errArtifactVerificationFailed))
+	assert.ErrorContains(t, err, "not made by any of the 1 trusted public keys")
+	assert.Assert(t, !dst.UntypedJoin("a-file").FileExists())
+
+	// A falsely-signed artifact is a miss to the multiplexer, not an error
+	mplex := &cacheMultiplexer{caches: []Cache{cache}}
+	hit, _, _, err := mplex.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+
+	// Sign with the trusted key
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", base64.StdEncoding.EncodeToString(privateKey.Seed()))
+	assert.NilError(t, cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", "")
+	hit, _, _, err = cache.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	contents, err := dst.UntypedJoin("a-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "contents")
+}
@@ -1,6 +1,9 @@
 package cache
 
-import "github.com/vercel/turbo/cli/internal/turbopath"
+import (
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
 
 type noopCache struct{}
 
@@ -11,12 +14,15 @@ func newNoopCache() *noopCache {
 func (c *noopCache) Put(anchor turbopath.AbsoluteSystemPath, key string, duration int, files []turbopath.AnchoredSystemPath) error {
 	return nil
 }
-func (c *noopCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, files []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+func (c *noopCache) Fetch(anchor turbopath.AbsoluteSystemPath, key string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
 	return false, nil, 0, nil
 }
 func (c *noopCache) Exists(key string) (ItemStatus, error) {
 	return ItemStatus{}, nil
 }
+func (c *noopCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	return map[string]ItemStatus{}, nil
+}
 
 func (c *noopCache) Clean(anchor turbopath.AbsoluteSystemPath) {}
 func (c *noopCache) CleanAll()                                 {}
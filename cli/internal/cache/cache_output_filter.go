@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"path/filepath"
+
+	"github.com/vercel/turbo/cli/internal/doublestar"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// outputFilter returns a function that reports whether a file in an artifact matches
+// the given repo-relative output globs and should be restored. A nil filter is returned
+// if outputGlobs is nil, meaning that everything should be restored.
+func outputFilter(outputGlobs *fs.TaskOutputs) func(turbopath.AnchoredSystemPath) bool {
+	if outputGlobs == nil {
+		return nil
+	}
+	inclusions := make([]string, len(outputGlobs.Inclusions))
+	for i, glob := range outputGlobs.Inclusions {
+		inclusions[i] = filepath.ToSlash(glob)
+	}
+	exclusions := make([]string, len(outputGlobs.Exclusions))
+	for i, glob := range outputGlobs.Exclusions {
+		exclusions[i] = filepath.ToSlash(glob)
+	}
+	return func(file turbopath.AnchoredSystemPath) bool {
+		name := file.ToUnixPath().ToString()
+		// A pattern that fails to parse is treated as matching for inclusions and as not matching
+		// for exclusions, so that we err on the side of restoring too much rather than too little.
+		for _, exclusion := range exclusions {
+			if matches, err := doublestar.Match(exclusion, name); err == nil && matches {
+				return false
+			}
+		}
+		for _, inclusion := range inclusions {
+			if matches, err := doublestar.Match(inclusion, name); err != nil || matches {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Access restricts what a run may do with a single cache. The zero value allows
+// both reading and writing.
+type Access struct {
+	SkipReads  bool
+	SkipWrites bool
+}
+
+// Disabled returns true if the cache can be neither read from nor written to
+func (a Access) Disabled() bool {
+	return a.SkipReads && a.SkipWrites
+}
+
+// String renders the access as used in a policy, e.g. "rw"
+func (a Access) String() string {
+	switch {
+	case a.Disabled():
+		return "none"
+	case a.SkipWrites:
+		return "r"
+	case a.SkipReads:
+		return "w"
+	default:
+		return "rw"
+	}
+}
+
+func parseAccess(raw string) (Access, error) {
+	switch raw {
+	case "rw", "wr":
+		return Access{}, nil
+	case "r":
+		return Access{SkipWrites: true}, nil
+	case "w":
+		return Access{SkipReads: true}, nil
+	case "none", "":
+		return Access{SkipReads: true, SkipWrites: true}, nil
+	default:
+		return Access{}, fmt.Errorf("invalid access %q. Expected one of rw, r, w, or none", raw)
+	}
+}
+
+// Policy restricts what a run may do with the local filesystem cache and the remote
+// cache. The zero value allows everything.
+type Policy struct {
+	Local  Access
+	Remote Access
+}
+
+// ParsePolicy parses a policy such as "local:rw,remote:r". A cache that isn't
+// mentioned may be read from and written to.
+func ParsePolicy(raw string) (Policy, error) {
+	policy := Policy{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, rawAccess, ok := strings.Cut(part, ":")
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid cache policy %q. Expected a list such as local:rw,remote:r", raw)
+		}
+		access, err := parseAccess(strings.TrimSpace(rawAccess))
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid cache policy %q: %w", raw, err)
+		}
+		switch strings.TrimSpace(name) {
+		case "local":
+			policy.Local = access
+		case "remote":
+			policy.Remote = access
+		default:
+			return Policy{}, fmt.Errorf("invalid cache policy %q: unknown cache %q. Expected local or remote", raw, name)
+		}
+	}
+	return policy, nil
+}
+
+// IsRestricted returns true if the policy restricts any cache
+func (p Policy) IsRestricted() bool {
+	return p != Policy{}
+}
+
+// String renders the policy in the form ParsePolicy accepts
+func (p Policy) String() string {
+	return fmt.Sprintf("local:%v,remote:%v", p.Local, p.Remote)
+}
+
+// accessFor returns the access the policy allows for the given cache implementation
+func (p Policy) accessFor(c Cache) Access {
+	switch c.(type) {
+	case *fsCache:
+		return p.Local
+	case *httpCache, *s3Cache, *spoolCache:
+		return p.Remote
+	default:
+		return Access{}
+	}
+}
+
+// SetPolicy sets the cache policy from the first of flag, the TURBO_CACHE environment
+// variable, and config (turbo.json's cachePolicy) that is non-empty. A cache that the
+// policy disables entirely is skipped.
+func (o *Opts) SetPolicy(flag string, config string) error {
+	raw, source := flag, "--cache"
+	if raw == "" {
+		raw, source = os.Getenv("TURBO_CACHE"), "TURBO_CACHE"
+	}
+	if raw == "" {
+		raw, source = config, "cachePolicy in turbo.json"
+	}
+	policy, err := ParsePolicy(raw)
+	if err != nil {
+		return fmt.Errorf("%v: %w", source, err)
+	}
+	o.Policy = policy
+	if policy.Local.Disabled() {
+		o.SkipFilesystem = true
+	}
+	if policy.Remote.Disabled() {
+		o.SkipRemote = true
+	}
+	return nil
+}
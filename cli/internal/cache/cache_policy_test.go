@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	cases := map[string]Policy{
+		"":                  {},
+		"local:rw,remote:r": {Remote: Access{SkipWrites: true}},
+		"remote:w":          {Remote: Access{SkipReads: true}},
+		" local:r , remote:none ": {
+			Local:  Access{SkipWrites: true},
+			Remote: Access{SkipReads: true, SkipWrites: true},
+		},
+	}
+	for input, expected := range cases {
+		policy, err := ParsePolicy(input)
+		assert.NilError(t, err, "ParsePolicy(%q)", input)
+		assert.Equal(t, policy, expected, "ParsePolicy(%q)", input)
+	}
+	assert.Equal(t, Policy{Remote: Access{SkipWrites: true}}.String(), "local:rw,remote:r")
+
+	for _, input := range []string{"local", "local:x", "s3:rw"} {
+		_, err := ParsePolicy(input)
+		assert.ErrorContains(t, err, "invalid cache policy", "ParsePolicy(%q)", input)
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	opts := Opts{}
+	assert.NilError(t, opts.SetPolicy("", "remote:r"), "SetPolicy")
+	assert.Equal(t, opts.Policy, Policy{Remote: Access{SkipWrites: true}})
+
+	t.Setenv("TURBO_CACHE", "remote:none")
+	assert.NilError(t, opts.SetPolicy("", "remote:r"), "SetPolicy")
+	assert.Assert(t, opts.Policy.Remote.Disabled())
+	assert.Assert(t, opts.SkipRemote)
+
+	opts = Opts{}
+	assert.NilError(t, opts.SetPolicy("local:r", "remote:r"), "SetPolicy")
+	assert.Equal(t, opts.Policy, Policy{Local: Access{SkipWrites: true}})
+
+	t.Setenv("TURBO_CACHE", "remote:rwx")
+	err := opts.SetPolicy("", "")
+	assert.ErrorContains(t, err, "TURBO_CACHE: invalid cache policy")
+}
+
+func TestMultiplexerEnforcesPolicy(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{"a-file"}
+
+	// A developer machine reads from the remote cache, but never writes to it
+	client := &memoryClient{}
+	readOnly, err := newSyncCache(Opts{Policy: Policy{Remote: Access{SkipWrites: true}}}, repoRoot, client, analytics.NullRecorder, nil)
+	assert.NilError(t, err, "newSyncCache")
+	assert.NilError(t, readOnly.Put(src, "some-hash", 5, files), "Put")
+	assert.Assert(t, client.body == nil, "expected no upload")
+
+	// CI writes to it
+	ci, err := newSyncCache(Opts{OverrideDir: "ci-cache"}, repoRoot, client, analytics.NullRecorder, nil)
+	assert.NilError(t, err, "newSyncCache")
+	assert.NilError(t, ci.Put(src, "other-hash", 5, files), "Put")
+	assert.Assert(t, client.body != nil, "expected an upload")
+
+	// A remote hit is stored locally, unless the local cache is read-only
+	localReadOnly, err := newSyncCache(Opts{OverrideDir: "read-only", Policy: Policy{Local: Access{SkipWrites: true}}}, repoRoot, client, analytics.NullRecorder, nil)
+	assert.NilError(t, err, "newSyncCache")
+	hit, _, _, err := localReadOnly.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "other-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.Assert(t, !repoRoot.UntypedJoin("read-only", "other-hash-meta.json").FileExists())
+
+	hit, _, _, err = readOnly.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "other-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.Assert(t, DefaultLocation(repoRoot).UntypedJoin("other-hash-meta.json").FileExists())
+
+	// A write-only remote cache is never read from
+	writeOnly, err := newSyncCache(Opts{OverrideDir: "write-only", Policy: Policy{Remote: Access{SkipReads: true}}}, repoRoot, client, analytics.NullRecorder, nil)
+	assert.NilError(t, err, "newSyncCache")
+	hit, _, _, err = writeOnly.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "other-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+
+	// A lone filesystem cache still has its policy enforced
+	localOnly, err := newSyncCache(Opts{OverrideDir: "local-only", SkipRemote: true, Policy: Policy{Local: Access{SkipReads: true}}}, repoRoot, client, analytics.NullRecorder, nil)
+	assert.NilError(t, err, "newSyncCache")
+	assert.NilError(t, localOnly.Put(src, "some-hash", 5, files), "Put")
+	hit, _, _, err = localOnly.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+}
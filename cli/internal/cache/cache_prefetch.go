@@ -0,0 +1,58 @@
+package cache
+
+import "io"
+
+// artifactDownloader is implemented by the remote caches, which can hand over an
+// artifact as the compressed tar it was uploaded as, without restoring it
+type artifactDownloader interface {
+	// download fetches the artifact for hash, verifying and decrypting it as configured,
+	// and passes the compressed tar to handle. It returns false if there is no such artifact.
+	download(hash string, handle func(tarReader io.Reader, duration int) error) (bool, error)
+}
+
+// Prefetcher is implemented by caches that can copy an artifact from the remote cache
+// into the local one, so that restoring it later doesn't wait on the network
+type Prefetcher interface {
+	// Prefetch stores the remote artifact for hash in the local cache, without restoring
+	// it. It returns false if there is no such artifact, or nowhere to store it.
+	Prefetch(hash string) (bool, error)
+}
+
+func (c *asyncCache) Prefetch(hash string) (bool, error) {
+	if prefetcher, ok := c.realCache.(Prefetcher); ok {
+		return prefetcher.Prefetch(hash)
+	}
+	return false, nil
+}
+
+func (c *spoolCache) download(hash string, handle func(tarReader io.Reader, duration int) error) (bool, error) {
+	return c.remote.download(hash, handle)
+}
+
+// Prefetch downloads the artifact for hash from the first remote cache that may be read
+// from, straight into the filesystem cache, if it may be written to.
+func (mplex *cacheMultiplexer) Prefetch(hash string) (bool, error) {
+	mplex.mu.RLock()
+	caches := make([]Cache, len(mplex.caches))
+	copy(caches, mplex.caches)
+	mplex.mu.RUnlock()
+
+	var local *fsCache
+	for _, cache := range caches {
+		access := mplex.opts.Policy.accessFor(cache)
+		if f, ok := cache.(*fsCache); ok {
+			if !access.SkipWrites {
+				local = f
+			}
+			continue
+		}
+		downloader, ok := cache.(artifactDownloader)
+		if !ok || access.SkipReads || local == nil {
+			continue
+		}
+		return downloader.download(hash, func(tarReader io.Reader, duration int) error {
+			return local.putArtifact(hash, duration, tarReader)
+		})
+	}
+	return false, nil
+}
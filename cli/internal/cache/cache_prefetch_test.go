@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+func TestPrefetch(t *testing.T) {
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "secret")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	files := []turbopath.AnchoredSystemPath{"a-file"}
+
+	client := &memoryClient{}
+	remote := newHTTPCache(Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Signature: true}}, client, analytics.NullRecorder, src)
+	assert.NilError(t, remote.Put(src, "some-hash", 5, files), "Put")
+
+	cacheDir := turbopath.AbsoluteSystemPath(t.TempDir())
+	local := &fsCache{cacheDirectory: cacheDir, recorder: analytics.NullRecorder}
+	mplex := &cacheMultiplexer{caches: []Cache{local, remote}}
+	hit, err := mplex.Prefetch("some-hash")
+	assert.NilError(t, err, "Prefetch")
+	assert.Assert(t, hit)
+
+	// Nothing is prefetched if the local cache may not be written to
+	readOnly := &cacheMultiplexer{
+		caches: []Cache{&fsCache{cacheDirectory: turbopath.AbsoluteSystemPath(t.TempDir())}, remote},
+		opts:   Opts{Policy: Policy{Local: Access{SkipWrites: true}}},
+	}
+	hit, err = readOnly.Prefetch("some-hash")
+	assert.NilError(t, err, "Prefetch")
+	assert.Assert(t, !hit)
+
+	// The remote cache isn't needed to restore the artifact any more
+	client.body = nil
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	hit, restored, _, err := local.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.DeepEqual(t, restored, files)
+	contents, err := dst.UntypedJoin("a-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "contents")
+}
@@ -0,0 +1,516 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"golang.org/x/sync/errgroup"
+)
+
+// s3Config is the fully-resolved configuration for an S3-compatible remote cache,
+// merged from turbo.json and the environment.
+type s3Config struct {
+	bucket   string
+	prefix   string
+	region   string
+	endpoint string
+	creds    s3Credentials
+}
+
+// s3Credentials are the AWS credentials used to sign requests.
+// If accessKeyID is empty, requests are sent unsigned, which is sufficient
+// for reading from a public bucket.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+const (
+	_s3DurationHeader = "X-Amz-Meta-Artifact-Duration"
+	_s3TagHeader      = "X-Amz-Meta-Artifact-Tag"
+	_s3DefaultRegion  = "us-east-1"
+)
+
+// resolveS3Config merges S3 options from turbo.json with the environment.
+// Environment variables take precedence. It returns nil if no bucket is configured.
+func resolveS3Config(opts *fs.S3CacheOptions) *s3Config {
+	config := &s3Config{}
+	if opts != nil {
+		config.bucket = opts.Bucket
+		config.prefix = opts.Prefix
+		config.region = opts.Region
+		config.endpoint = opts.Endpoint
+	}
+	overrideFromEnv(&config.bucket, "TURBO_REMOTE_CACHE_S3_BUCKET")
+	overrideFromEnv(&config.prefix, "TURBO_REMOTE_CACHE_S3_PREFIX")
+	overrideFromEnv(&config.endpoint, "TURBO_REMOTE_CACHE_S3_ENDPOINT")
+	if config.region == "" {
+		overrideFromEnv(&config.region, "AWS_DEFAULT_REGION")
+		overrideFromEnv(&config.region, "AWS_REGION")
+	}
+	overrideFromEnv(&config.region, "TURBO_REMOTE_CACHE_S3_REGION")
+	if config.region == "" {
+		config.region = _s3DefaultRegion
+	}
+	if config.bucket == "" {
+		return nil
+	}
+	config.creds = s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	return config
+}
+
+func overrideFromEnv(value *string, envVar string) {
+	if fromEnv := os.Getenv(envVar); fromEnv != "" {
+		*value = fromEnv
+	}
+}
+
+// UsesS3 returns true if an S3-compatible bucket is configured as the remote cache,
+// either in turbo.json or via the environment.
+func (o *Opts) UsesS3() bool {
+	return resolveS3Config(o.RemoteCacheOpts.S3) != nil
+}
+
+// s3Cache stores artifacts as <prefix><hash>.tar.zst objects in an S3-compatible bucket
+type s3Cache struct {
+	config         *s3Config
+	client         *retryablehttp.Client
+	requestLimiter limiter
+	recorder       analytics.Recorder
+	signerVerifier *ArtifactSignatureAuthentication
+	encryption     *ArtifactEncryption
+	// now is overridable for tests
+	now func() time.Time
+}
+
+func newS3Cache(opts Opts, config *s3Config, recorder analytics.Recorder, repoRoot turbopath.AbsoluteSystemPath) *s3Cache {
+	client := retryablehttp.NewClient()
+	client.RetryMax = 2
+	client.Logger = nil
+	return &s3Cache{
+		config:         config,
+		client:         client,
+		requestLimiter: make(limiter, 20),
+		recorder:       recorder,
+		signerVerifier: newArtifactSignatureAuthentication(opts.RemoteCacheOpts.TeamID, opts.RemoteCacheOpts, repoRoot),
+		encryption:     newArtifactEncryption(opts.RemoteCacheOpts, repoRoot),
+		now:            time.Now,
+	}
+}
+
+// objectURL returns the URL for the given key. Buckets on a custom endpoint are
+// addressed path-style, while AWS buckets use virtual-hosted-style addressing.
+func (cache *s3Cache) objectURL(key string) (*url.URL, error) {
+	escapedKey := s3EscapePath(key)
+	if cache.config.endpoint != "" {
+		endpoint := strings.TrimSuffix(cache.config.endpoint, "/")
+		objectURL, err := url.Parse(fmt.Sprintf("%v/%v/%v", endpoint, s3Escape(cache.config.bucket), escapedKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %v: %w", cache.config.endpoint, err)
+		}
+		return objectURL, nil
+	}
+	return url.Parse(fmt.Sprintf("https://%v.s3.%v.amazonaws.com/%v", cache.config.bucket, cache.config.region, escapedKey))
+}
+
+func (cache *s3Cache) key(hash string) string {
+	return cache.config.prefix + hash + ".tar.zst"
+}
+
+func (cache *s3Cache) newRequest(method string, hash string, body io.ReadSeeker, size int64) (*retryablehttp.Request, error) {
+	objectURL, err := cache.objectURL(cache.key(hash))
+	if err != nil {
+		return nil, err
+	}
+	var rawBody interface{}
+	if body != nil {
+		// Passed as an io.ReadSeeker, so retryablehttp streams it and rewinds it on retry
+		rawBody = body
+	}
+	req, err := retryablehttp.NewRequest(method, objectURL.String(), rawBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.URL = objectURL
+	return req, nil
+}
+
+// do signs and sends req. payloadHash is the hex-encoded SHA-256 of the request body.
+func (cache *s3Cache) do(req *retryablehttp.Request, payloadHash string) (*http.Response, error) {
+	signS3Request(req.Request, payloadHash, cache.config.region, cache.config.creds, cache.now())
+	return cache.client.Do(req)
+}
+
+func (cache *s3Cache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
+	prepared, err := cache.prepareUpload(anchor, hash, files)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = prepared.body.Close() }()
+	return cache.upload(hash, duration, prepared)
+}
+
+// prepareUpload spools the artifact to disk. SigV4 signs the payload hash, which is
+// computed, along with the artifact tag, in the same pass.
+func (cache *s3Cache) prepareUpload(anchor turbopath.AbsoluteSystemPath, hash string, files []turbopath.AnchoredSystemPath) (*preparedUpload, error) {
+	prepared, err := prepareUpload(cache.signerVerifier, cache.encryption, anchor, hash, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	return prepared, nil
+}
+
+func (cache *s3Cache) upload(hash string, duration int, prepared *preparedUpload) error {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	req, err := cache.newRequest(http.MethodPut, hash, prepared.body, prepared.size)
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(_s3DurationHeader, strconv.Itoa(duration))
+	if prepared.tag != "" {
+		req.Header.Set(_s3TagHeader, prepared.tag)
+	}
+	resp, err := cache.do(req, prepared.sha256)
+	if err != nil {
+		return fmt.Errorf("failed to store files in S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to store files in S3 cache: %w", s3ResponseError(resp))
+	}
+	return nil
+}
+
+func (cache *s3Cache) destination() string {
+	return "s3://" + cache.config.bucket + "/" + cache.config.prefix
+}
+
+func (cache *s3Cache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	hit, files, duration, err := cache.retrieve(anchor, hash, outputFilter(outputGlobs))
+	if err != nil {
+		return false, files, duration, fmt.Errorf("failed to retrieve files from S3 cache: %w", err)
+	}
+	cache.logFetch(hit, hash, duration)
+	return hit, files, duration, nil
+}
+
+func (cache *s3Cache) retrieve(anchor turbopath.AbsoluteSystemPath, hash string, include func(turbopath.AnchoredSystemPath) bool) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	var files []turbopath.AnchoredSystemPath
+	var duration int
+	hit, err := cache.download(hash, func(tarReader io.Reader, artifactDuration int) error {
+		var err error
+		files, err = restoreTar(anchor, tarReader, include)
+		duration = artifactDuration
+		return err
+	})
+	if err != nil || !hit {
+		return false, nil, 0, err
+	}
+	return true, files, duration, nil
+}
+
+// download fetches the artifact for hash, verifying and decrypting it as configured, and
+// passes the compressed tar to handle. It returns false if there is no such artifact.
+func (cache *s3Cache) download(hash string, handle func(tarReader io.Reader, duration int) error) (bool, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	req, err := cache.newRequest(http.MethodGet, hash, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp, err := cache.do(req, _s3EmptyPayloadHash)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil // doesn't exist - not an error
+	} else if resp.StatusCode != http.StatusOK {
+		return false, s3ResponseError(resp)
+	}
+	duration := 0
+	if durationHeader := resp.Header.Get(_s3DurationHeader); durationHeader != "" {
+		duration, err = strconv.Atoi(durationHeader)
+		if err != nil {
+			return false, fmt.Errorf("invalid %v header: %w", _s3DurationHeader, err)
+		}
+	}
+	var tarReader io.Reader = resp.Body
+	if cache.signerVerifier.isEnabled() {
+		expectedTag := resp.Header.Get(_s3TagHeader)
+		if expectedTag == "" {
+			return false, fmt.Errorf("%w: Downloaded artifact is missing required %v header", errArtifactVerificationFailed, _s3TagHeader)
+		}
+		validator, err := cache.signerVerifier.newStreamValidator(hash)
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+		}
+		artifact, err := newTempArtifact()
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+		}
+		defer func() { _ = artifact.Close() }()
+		if err := artifact.fill(resp.Body, validator); err != nil {
+			return false, fmt.Errorf("%w: %v", errArtifactVerificationFailed, err)
+		}
+		if !validator.Validate(expectedTag) {
+			return false, validator.mismatchError(expectedTag)
+		}
+		tarReader = artifact
+	}
+	if cache.encryption.isEnabled() {
+		// Decrypted after verification, since the signature covers the encrypted artifact
+		plaintext, err := cache.encryption.decrypt(hash, tarReader)
+		if err != nil {
+			return false, err
+		}
+		defer func() { _ = plaintext.Close() }()
+		tarReader = plaintext
+	}
+	if err := handle(tarReader, duration); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (cache *s3Cache) Exists(hash string) (ItemStatus, error) {
+	cache.requestLimiter.acquire()
+	defer cache.requestLimiter.release()
+	req, err := cache.newRequest(http.MethodHead, hash, nil, 0)
+	if err != nil {
+		return ItemStatus{}, err
+	}
+	resp, err := cache.do(req, _s3EmptyPayloadHash)
+	if err != nil {
+		return ItemStatus{}, fmt.Errorf("failed to verify files from S3 cache: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return ItemStatus{}, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return ItemStatus{}, fmt.Errorf("failed to verify files from S3 cache: %s", strconv.Itoa(resp.StatusCode))
+	}
+	return ItemStatus{Remote: true}, nil
+}
+
+// BatchExists checks for each artifact concurrently, since S3 can't be asked about
+// several objects at once
+func (cache *s3Cache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	var mu sync.Mutex
+	itemStatuses := make(map[string]ItemStatus, len(hashes))
+	g := &errgroup.Group{}
+	for _, hash := range hashes {
+		hash := hash
+		g.Go(func() error {
+			itemStatus, err := cache.Exists(hash)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			itemStatuses[hash] = itemStatus
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return itemStatuses, nil
+}
+
+func (cache *s3Cache) logFetch(hit bool, hash string, duration int) {
+	var event string
+	if hit {
+		event = cacheEventHit
+	} else {
+		event = cacheEventMiss
+	}
+	payload := &CacheEvent{
+		Source:   "REMOTE",
+		Event:    event,
+		Hash:     hash,
+		Duration: duration,
+	}
+	cache.recorder.LogEvent(payload)
+}
+
+func (cache *s3Cache) Clean(anchor turbopath.AbsoluteSystemPath) {
+	// Eviction is left to the bucket's lifecycle rules.
+}
+
+func (cache *s3Cache) CleanAll() {
+	// Also left to the bucket's lifecycle rules.
+}
+
+func (cache *s3Cache) Shutdown() {}
+
+// s3ResponseError builds an error from a non-successful S3 response,
+// including the XML error body if there is one.
+func s3ResponseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if len(body) > 0 {
+		return fmt.Errorf("%v: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("%v", resp.Status)
+}
+
+// _s3EmptyPayloadHash is the hex-encoded SHA-256 of an empty request body
+var _s3EmptyPayloadHash = sha256Hex(nil)
+
+// signS3Request signs req in place using AWS Signature Version 4.
+// payloadHash is the hex-encoded SHA-256 of the request body.
+// Every header already present on the request, plus Host, is signed.
+// If no credentials are configured the request is left unsigned.
+func signS3Request(req *http.Request, payloadHash string, region string, creds s3Credentials, now time.Time) {
+	if creds.accessKeyID == "" {
+		return
+	}
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := s3CanonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), []byte(shortDate))
+	signingKey = hmacSHA256(signingKey, []byte(region))
+	signingKey = hmacSHA256(signingKey, []byte("s3"))
+	signingKey = hmacSHA256(signingKey, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// s3CanonicalHeaders returns the canonical header block and the list of signed header names
+func s3CanonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for name, headerValues := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(headerValues))
+		for i, value := range headerValues {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		values[lower] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteString(":")
+		canonical.WriteString(values[name])
+		canonical.WriteString("\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+func s3CanonicalQuery(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except the unreserved characters, as SigV4 requires
+func s3Escape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+// s3EscapePath escapes each segment of an object key, preserving the slashes between them
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
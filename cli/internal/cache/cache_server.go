@@ -0,0 +1,421 @@
+package cache
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// _artifactsPrefix is the path under which the Remote Caching API serves artifacts
+const _artifactsPrefix = "/v8/artifacts/"
+
+// _serverCleanInterval is the minimum time between evictions triggered by uploads
+const _serverCleanInterval = time.Minute
+
+// _maxQuerySize is the largest batch query body the server reads
+const _maxQuerySize = 1 << 20
+
+// _defaultMaxUploadSize is the largest artifact the server accepts when no limit is given
+const _defaultMaxUploadSize = 1 << 30
+
+// _validHash matches the hashes the server accepts, which keeps them from escaping the cache directory
+var _validHash = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Server serves a filesystem cache over the same HTTP API as the Vercel Remote Cache,
+// so that the artifacts it holds can be shared by pointing --api at it. Artifacts are
+// stored in the same layout as the local filesystem cache, so the directory can be
+// cleaned and inspected with the other `turbo cache` commands.
+type Server struct {
+	cache         *fsCache
+	tokens        []string
+	maxUploadSize int64
+	logger        hclog.Logger
+
+	cleanMu   sync.Mutex
+	lastClean time.Time
+
+	// hashLocks keeps an artifact's archive and metadata consistent while they
+	// are replaced by an upload
+	hashLocksMu sync.Mutex
+	hashLocks   map[string]*hashLock
+}
+
+// hashLock guards the files of one artifact, and counts the requests using it so
+// that it can be dropped once none are
+type hashLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// NewServer creates a Server backed by the filesystem cache that opts configures. Requests
+// must carry one of the given tokens as a bearer token. Uploads larger than maxUploadSize
+// bytes are rejected; if it is 0, a default of 1GB applies.
+func NewServer(opts Opts, repoRoot turbopath.AbsoluteSystemPath, tokens []string, maxUploadSize int64, logger hclog.Logger) (*Server, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("at least one token is required")
+	}
+	f, err := newFsCache(opts, analytics.NullRecorder, repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	if maxUploadSize <= 0 {
+		maxUploadSize = _defaultMaxUploadSize
+	}
+	return &Server{
+		cache:         f,
+		tokens:        tokens,
+		maxUploadSize: maxUploadSize,
+		logger:        logger,
+		hashLocks:     make(map[string]*hashLock),
+	}, nil
+}
+
+// lockHash locks the files of the artifact for hash, exclusively if the caller
+// replaces them, and returns the function that unlocks them.
+func (s *Server) lockHash(hash string, exclusive bool) func() {
+	s.hashLocksMu.Lock()
+	lock, ok := s.hashLocks[hash]
+	if !ok {
+		lock = &hashLock{}
+		s.hashLocks[hash] = lock
+	}
+	lock.refs++
+	s.hashLocksMu.Unlock()
+
+	if exclusive {
+		lock.Lock()
+	} else {
+		lock.RLock()
+	}
+	return func() {
+		if exclusive {
+			lock.Unlock()
+		} else {
+			lock.RUnlock()
+		}
+		s.hashLocksMu.Lock()
+		defer s.hashLocksMu.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.hashLocks, hash)
+		}
+	}
+}
+
+// Directory returns the cache directory that the server stores artifacts in
+func (s *Server) Directory() turbopath.AbsoluteSystemPath {
+	return s.cache.cacheDirectory
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		// Answer pre-flight requests the way the Vercel API does, allowing authorization.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, PUT, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-artifact-duration, Authorization, User-Agent, x-artifact-tag")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	isQuery := r.URL.Path == strings.TrimSuffix(_artifactsPrefix, "/")
+	if !isQuery && !strings.HasPrefix(r.URL.Path, _artifactsPrefix) {
+		writeServerError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !s.authorized(r) {
+		writeServerError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	if isQuery {
+		if r.Method != http.MethodPost {
+			writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.queryArtifacts(w, r)
+		return
+	}
+
+	switch name := strings.TrimPrefix(r.URL.Path, _artifactsPrefix); name {
+	case "status":
+		if r.Method != http.MethodGet {
+			writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeServerJSON(w, http.StatusOK, map[string]string{"status": "enabled"})
+	case "events":
+		// Analytics events are accepted, but there's nowhere to report them.
+		if r.Method != http.MethodPost {
+			writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	default:
+		if !_validHash.MatchString(name) {
+			writeServerError(w, http.StatusBadRequest, "invalid artifact hash")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.getArtifact(w, r, name)
+		case http.MethodPut:
+			s.putArtifact(w, r, name)
+		default:
+			writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// authorized returns true if the request carries one of the server's tokens
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(header, "Bearer "))
+	authorized := false
+	for _, candidate := range s.tokens {
+		// Check every token, so that timing doesn't reveal which one was close
+		if subtle.ConstantTimeCompare(token, []byte(candidate)) == 1 {
+			authorized = true
+		}
+	}
+	return authorized
+}
+
+// artifactInfo describes an artifact in the response to a batch query
+type artifactInfo struct {
+	Size           int64  `json:"size"`
+	TaskDurationMs int    `json:"taskDurationMs"`
+	Tag            string `json:"tag,omitempty"`
+}
+
+// queryArtifacts answers a batch query for the artifacts listed in the request body.
+// Artifacts that the server can't serve are reported as null.
+func (s *Server) queryArtifacts(w http.ResponseWriter, r *http.Request) {
+	query := struct {
+		Hashes []string `json:"hashes"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, _maxQuerySize)).Decode(&query); err != nil {
+		writeServerError(w, http.StatusBadRequest, "invalid query")
+		return
+	}
+	results := make(map[string]*artifactInfo, len(query.Hashes))
+	for _, hash := range query.Hashes {
+		if !_validHash.MatchString(hash) {
+			writeServerError(w, http.StatusBadRequest, "invalid artifact hash")
+			return
+		}
+		results[hash] = nil
+		meta, err := ReadCacheMetaFile(s.cache.cacheDirectory.UntypedJoin(hash + "-meta.json"))
+		if err != nil {
+			continue
+		}
+		info, err := s.cache.cacheDirectory.UntypedJoin(hash + ".tar.zst").Lstat()
+		if err != nil {
+			continue
+		}
+		results[hash] = &artifactInfo{
+			Size:           info.Size(),
+			TaskDurationMs: meta.Duration,
+			Tag:            meta.Tag,
+		}
+	}
+	writeServerJSON(w, http.StatusOK, results)
+}
+
+// getArtifact serves the artifact for hash. Only compressed artifacts can be served,
+// since that is the format clients expect; deduplicated artifacts are reported as misses.
+func (s *Server) getArtifact(w http.ResponseWriter, r *http.Request, hash string) {
+	// The metadata must describe the archive that is served
+	unlock := s.lockHash(hash, false)
+	defer unlock()
+	meta, err := ReadCacheMetaFile(s.cache.cacheDirectory.UntypedJoin(hash + "-meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		writeServerError(w, http.StatusNotFound, "artifact not found")
+		return
+	} else if err != nil {
+		s.logger.Error(fmt.Sprintf("failed to read metadata for %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to read artifact")
+		return
+	}
+	cacheItem, err := cacheitem.Open(s.cache.cacheDirectory.UntypedJoin(hash + ".tar.zst"))
+	if errors.Is(err, os.ErrNotExist) {
+		writeServerError(w, http.StatusNotFound, "artifact not found")
+		return
+	} else if err != nil {
+		s.logger.Error(fmt.Sprintf("failed to open %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to read artifact")
+		return
+	}
+	defer func() { _ = cacheItem.Close() }()
+	s.cache.recordAccess(hash)
+
+	// Don't hand out an artifact that was corrupted at rest
+	if r.Method == http.MethodGet && meta.Sha != "" {
+		sha, err := cacheItem.GetSha()
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("failed to read %v", hash), "error", err)
+			writeServerError(w, http.StatusInternalServerError, "failed to read artifact")
+			return
+		}
+		if hex.EncodeToString(sha) != meta.Sha {
+			_ = cacheItem.Close()
+			s.logger.Warn(fmt.Sprintf("quarantined corrupt artifact %v", hash))
+			_, _, _, _ = s.cache.quarantine(hash, errCorruptArtifact)
+			writeServerError(w, http.StatusNotFound, "artifact not found")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("x-artifact-duration", strconv.Itoa(meta.Duration))
+	if meta.Tag != "" {
+		w.Header().Set("x-artifact-tag", meta.Tag)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	handle, err := cacheItem.Path.Open()
+	if err != nil {
+		writeServerError(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+	defer func() { _ = handle.Close() }()
+	if info, err := handle.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, handle)
+}
+
+// putArtifact stores the uploaded artifact for hash. The upload is written to a temporary
+// file and moved into place once complete, followed by its metadata, so that readers never
+// see a partial artifact. Uploads of the same hash replace its files one at a time, so
+// that the metadata always describes the archive.
+func (s *Server) putArtifact(w http.ResponseWriter, r *http.Request, hash string) {
+	duration := 0
+	if header := r.Header.Get("x-artifact-duration"); header != "" {
+		parsed, err := strconv.Atoi(header)
+		if err != nil {
+			writeServerError(w, http.StatusBadRequest, "invalid x-artifact-duration header")
+			return
+		}
+		duration = parsed
+	}
+	if r.ContentLength > s.maxUploadSize {
+		writeServerError(w, http.StatusRequestEntityTooLarge, "artifact is too large")
+		return
+	}
+
+	cacheDir := s.cache.cacheDirectory
+	upload, err := ioutil.TempFile(cacheDir.ToString(), hash+".*.upload")
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("failed to store %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to store artifact")
+		return
+	}
+	uploadPath := turbopath.AbsoluteSystemPathFromUpstream(upload.Name())
+	defer func() { _ = uploadPath.Remove() }()
+	sha := sha512.New()
+	body := http.MaxBytesReader(w, r.Body, s.maxUploadSize)
+	written, copyErr := io.Copy(io.MultiWriter(upload, sha), body)
+	closeErr := upload.Close()
+	if copyErr != nil && written >= s.maxUploadSize {
+		writeServerError(w, http.StatusRequestEntityTooLarge, "artifact is too large")
+		return
+	} else if copyErr != nil {
+		writeServerError(w, http.StatusBadRequest, "failed to read artifact")
+		return
+	} else if closeErr != nil {
+		s.logger.Error(fmt.Sprintf("failed to store %v", hash), "error", closeErr)
+		writeServerError(w, http.StatusInternalServerError, "failed to store artifact")
+		return
+	}
+
+	unlock := s.lockHash(hash, true)
+	defer unlock()
+	// Readers treat an artifact without metadata as incomplete, so remove any
+	// existing metadata before replacing the archive it describes.
+	metaPath := cacheDir.UntypedJoin(hash + "-meta.json")
+	if err := metaPath.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Error(fmt.Sprintf("failed to store %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to store artifact")
+		return
+	}
+	if err := uploadPath.Rename(cacheDir.UntypedJoin(hash + ".tar.zst")); err != nil {
+		s.logger.Error(fmt.Sprintf("failed to store %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to store artifact")
+		return
+	}
+	if err := WriteCacheMetaFile(metaPath, &CacheMetadata{
+		Hash:     hash,
+		Duration: duration,
+		Sha:      hex.EncodeToString(sha.Sum(nil)),
+		Tag:      r.Header.Get("x-artifact-tag"),
+	}); err != nil {
+		s.logger.Error(fmt.Sprintf("failed to store %v", hash), "error", err)
+		writeServerError(w, http.StatusInternalServerError, "failed to store artifact")
+		return
+	}
+	s.logger.Debug("stored artifact", "hash", hash, "duration", duration)
+	writeServerJSON(w, http.StatusAccepted, map[string][]string{"urls": {r.URL.Path}})
+	s.maybeClean()
+}
+
+// maybeClean evicts artifacts in the background if the cache has an eviction
+// policy, at most once per _serverCleanInterval.
+func (s *Server) maybeClean() {
+	if !s.cache.hasEvictionPolicy() {
+		return
+	}
+	s.cleanMu.Lock()
+	defer s.cleanMu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastClean) < _serverCleanInterval {
+		return
+	}
+	s.lastClean = now
+	go func() {
+		if _, err := s.cache.evict(false, time.Now()); err != nil && !errors.Is(err, ErrCleanInProgress) {
+			s.logger.Warn("failed to evict artifacts", "error", err)
+		}
+	}()
+}
+
+// serverError is the body of an error response, in the shape the Vercel API uses
+type serverError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeServerError(w http.ResponseWriter, status int, message string) {
+	body := &serverError{}
+	body.Error.Message = message
+	writeServerJSON(w, status, body)
+}
+
+func writeServerJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
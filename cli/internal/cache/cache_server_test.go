@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	turboclient "github.com/vercel/turbo/cli/internal/client"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+	"gotest.tools/v3/assert"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	server, err := NewServer(Opts{}, repoRoot, []string{"other-token", "the-token"}, 1<<20, hclog.NewNullLogger())
+	assert.NilError(t, err, "NewServer")
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+func newTestServerClient(url string, token string) *turboclient.ApiClient {
+	apiClient := turboclient.NewClient(turboclient.RemoteConfig{
+		Token:  token,
+		TeamID: "team_test",
+		APIURL: url,
+	}, hclog.NewNullLogger(), "test", turboclient.Opts{})
+	apiClient.HttpClient.RetryMax = 0
+	return apiClient
+}
+
+func TestServerPutFetch(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	apiClient := newTestServerClient(httpServer.URL, "the-token")
+
+	status, err := apiClient.GetCachingStatus()
+	assert.NilError(t, err, "GetCachingStatus")
+	assert.Equal(t, status, util.CachingStatusEnabled)
+
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_KEY", "secret")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	cache := newHTTPCache(Opts{RemoteCacheOpts: fs.RemoteCacheOptions{Signature: true}}, apiClient, analytics.NullRecorder, src)
+
+	itemStatus, err := cache.Exists("some-hash")
+	assert.NilError(t, err, "Exists")
+	assert.Assert(t, !itemStatus.Remote)
+	hit, _, _, err := cache.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+
+	assert.NilError(t, cache.Put(src, "some-hash", 42, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	itemStatus, err = cache.Exists("some-hash")
+	assert.NilError(t, err, "Exists")
+	assert.Assert(t, itemStatus.Remote)
+	itemStatuses, err := cache.BatchExists([]string{"some-hash", "other-hash"})
+	assert.NilError(t, err, "BatchExists")
+	assert.DeepEqual(t, itemStatuses, map[string]ItemStatus{"some-hash": {Remote: true}, "other-hash": {}})
+
+	// The signature round trips through the server's metadata
+	dst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	hit, files, duration, err := cache.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.Equal(t, duration, 42)
+	assert.DeepEqual(t, files, []turbopath.AnchoredSystemPath{"a-file"})
+	contents, err := dst.UntypedJoin("a-file").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "contents")
+
+	// Uploads land in the filesystem cache layout, and are readable as such
+	local := &fsCache{cacheDirectory: server.Directory(), recorder: analytics.NullRecorder}
+	localDst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	hit, _, duration, err = local.Fetch(localDst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.Equal(t, duration, 42)
+}
+
+func TestServerQuarantinesCorruptArtifact(t *testing.T) {
+	server, httpServer := newTestServer(t)
+	apiClient := newTestServerClient(httpServer.URL, "the-token")
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	cache := newHTTPCache(Opts{}, apiClient, analytics.NullRecorder, src)
+	assert.NilError(t, cache.Put(src, "some-hash", 1, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+
+	artifactPath := server.Directory().UntypedJoin("some-hash.tar.zst")
+	artifact, err := artifactPath.ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	artifact[len(artifact)-1] ^= 0xff
+	assert.NilError(t, artifactPath.WriteFile(artifact, 0644), "WriteFile")
+
+	hit, _, _, err := cache.Fetch(fs.AbsoluteSystemPathFromUpstream(t.TempDir()), "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, !hit)
+	assert.Assert(t, server.Directory().UntypedJoin("quarantine", "some-hash.tar.zst").FileExists())
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	_, httpServer := newTestServer(t)
+
+	for _, token := range []string{"", "wrong-token"} {
+		req, err := http.NewRequest(http.MethodHead, httpServer.URL+"/v8/artifacts/some-hash", nil)
+		assert.NilError(t, err, "NewRequest")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err, "Do")
+		_ = resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	// Hashes can't name files outside of the cache directory
+	req, err := http.NewRequest(http.MethodGet, httpServer.URL+"/v8/artifacts/..%2Fclean.lock", nil)
+	assert.NilError(t, err, "NewRequest")
+	req.Header.Set("Authorization", "Bearer the-token")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NilError(t, err, "Do")
+	_ = resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+
+	_, err = NewServer(Opts{}, fs.AbsoluteSystemPathFromUpstream(t.TempDir()), nil, 0, hclog.NewNullLogger())
+	assert.ErrorContains(t, err, "token is required")
+}
+
+func putServerArtifact(t *testing.T, url string, body io.Reader) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, url+"/v8/artifacts/some-hash", body)
+	assert.NilError(t, err, "NewRequest")
+	req.Header.Set("Authorization", "Bearer the-token")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NilError(t, err, "Do")
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServerConcurrentPuts(t *testing.T) {
+	server, httpServer := newTestServer(t)
+
+	// Uploads of the same hash with different bodies, as encrypted artifacts have
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := bytes.Repeat([]byte{byte(i)}, 64<<10)
+			assert.Equal(t, putServerArtifact(t, httpServer.URL, bytes.NewReader(body)), http.StatusAccepted)
+		}(i)
+	}
+	wg.Wait()
+
+	meta, err := ReadCacheMetaFile(server.Directory().UntypedJoin("some-hash-meta.json"))
+	assert.NilError(t, err, "ReadCacheMetaFile")
+	archive, err := server.Directory().UntypedJoin("some-hash.tar.zst").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	sha := sha512.Sum512(archive)
+	assert.Equal(t, meta.Sha, hex.EncodeToString(sha[:]))
+}
+
+func TestServerMaxUploadSize(t *testing.T) {
+	server, httpServer := newTestServer(t)
+
+	tooLarge := make([]byte, 2<<20)
+	assert.Equal(t, putServerArtifact(t, httpServer.URL, bytes.NewReader(tooLarge)), http.StatusRequestEntityTooLarge)
+	// Without a Content-Length, the upload is cut off once it passes the limit
+	assert.Equal(t, putServerArtifact(t, httpServer.URL, io.MultiReader(bytes.NewReader(tooLarge))), http.StatusRequestEntityTooLarge)
+	assert.Assert(t, !server.Directory().UntypedJoin("some-hash.tar.zst").FileExists())
+	assert.Equal(t, putServerArtifact(t, httpServer.URL, bytes.NewReader(make([]byte, 1<<20))), http.StatusAccepted)
+}
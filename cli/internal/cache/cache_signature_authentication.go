@@ -4,25 +4,75 @@
 package cache
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"hash"
 	"os"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+const (
+	// _signatureAlgorithmHMAC signs artifacts with a secret shared by every machine
+	// that reads or writes the cache. It is the default.
+	_signatureAlgorithmHMAC = "hmac-sha256"
+	// _signatureAlgorithmEd25519 signs artifacts with a private key, and verifies
+	// them with any of a set of trusted public keys.
+	_signatureAlgorithmEd25519 = "ed25519"
 )
 
+// errArtifactVerificationFailed is wrapped by every error that results from
+// a downloaded artifact failing signature verification.
+var errArtifactVerificationFailed = errors.New("artifact verification failed")
+
+// errSignatureVerifyOnly is returned when asked to sign an artifact on a machine
+// that only holds public keys. Such machines read from the cache but never write to it.
+var errSignatureVerifyOnly = errors.New("no private key is configured to sign artifacts")
+
 type ArtifactSignatureAuthentication struct {
 	teamId  string
 	enabled bool
+	// algorithm is one of the _signatureAlgorithm constants. Empty means HMAC.
+	algorithm string
+	// publicKeyFiles contain Ed25519 public keys trusted to sign artifacts
+	publicKeyFiles []turbopath.AbsoluteSystemPath
+	repoRoot       turbopath.AbsoluteSystemPath
+}
+
+// newArtifactSignatureAuthentication returns the signer / verifier for the given remote cache options.
+// Relative key file paths are resolved against repoRoot.
+func newArtifactSignatureAuthentication(teamId string, opts fs.RemoteCacheOptions, repoRoot turbopath.AbsoluteSystemPath) *ArtifactSignatureAuthentication {
+	publicKeyFiles := make([]turbopath.AbsoluteSystemPath, len(opts.SignaturePublicKeys))
+	for i, file := range opts.SignaturePublicKeys {
+		publicKeyFiles[i] = fs.ResolveUnknownPath(repoRoot, file)
+	}
+	return &ArtifactSignatureAuthentication{
+		teamId:         teamId,
+		enabled:        opts.Signature,
+		algorithm:      opts.SignatureAlgorithm,
+		publicKeyFiles: publicKeyFiles,
+		repoRoot:       repoRoot,
+	}
 }
 
 func (asa *ArtifactSignatureAuthentication) isEnabled() bool {
 	return asa.enabled
 }
 
+func (asa *ArtifactSignatureAuthentication) isEd25519() bool {
+	return asa.algorithm == _signatureAlgorithmEd25519
+}
+
 // If the secret key is not found or the secret key length is 0, an error is returned
 // Preference is given to the environment specified secret key.
 func (asa *ArtifactSignatureAuthentication) secretKey() ([]byte, error) {
@@ -33,21 +83,83 @@ func (asa *ArtifactSignatureAuthentication) secretKey() ([]byte, error) {
 	return []byte(secret), nil
 }
 
+// privateKey returns the Ed25519 private key used to sign artifacts, from the
+// TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY environment variable, or else from the file named by
+// TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY_FILE. errSignatureVerifyOnly is returned if neither is set.
+func (asa *ArtifactSignatureAuthentication) privateKey() (ed25519.PrivateKey, error) {
+	if key := os.Getenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY"); key != "" {
+		privateKey, err := parseEd25519PrivateKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY: %w", err)
+		}
+		return privateKey, nil
+	}
+	if file := os.Getenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY_FILE"); file != "" {
+		path := fs.ResolveUnknownPath(asa.repoRoot, file)
+		contents, err := path.ReadFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature private key: %w", err)
+		}
+		privateKey, err := parseEd25519PrivateKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature private key %v: %w", path, err)
+		}
+		return privateKey, nil
+	}
+	return nil, errSignatureVerifyOnly
+}
+
+// publicKeys returns every Ed25519 public key trusted to sign artifacts: the files listed in
+// turbo.json, the comma-separated keys in TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS, and the
+// public half of the private key, if one is configured. Listing several keys allows rotating
+// the signing key without invalidating artifacts signed with the old one.
+func (asa *ArtifactSignatureAuthentication) publicKeys() ([]ed25519.PublicKey, error) {
+	publicKeys := []ed25519.PublicKey{}
+	for _, file := range asa.publicKeyFiles {
+		contents, err := file.ReadFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature public key: %w", err)
+		}
+		publicKey, err := parseEd25519PublicKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature public key %v: %w", file, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if keys := os.Getenv("TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS"); keys != "" {
+		for i, key := range strings.Split(keys, ",") {
+			publicKey, err := parseEd25519PublicKey([]byte(key))
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key at position %v of TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS: %w", i+1, err)
+			}
+			publicKeys = append(publicKeys, publicKey)
+		}
+	}
+	privateKey, err := asa.privateKey()
+	if err == nil {
+		publicKeys = append(publicKeys, privateKey.Public().(ed25519.PublicKey))
+	} else if !errors.Is(err, errSignatureVerifyOnly) {
+		return nil, err
+	}
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no trusted public keys found. You must list public key files in remoteCache.signaturePublicKeys in turbo.json, or set TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS")
+	}
+	return publicKeys, nil
+}
+
 func (asa *ArtifactSignatureAuthentication) generateTag(hash string, artifactBody []byte) (string, error) {
-	tag, err := asa.getTagGenerator(hash)
+	signer, err := asa.newStreamSigner(hash)
 	if err != nil {
 		return "", err
 	}
-	tag.Write(artifactBody)
-	return base64.StdEncoding.EncodeToString(tag.Sum(nil)), nil
+	_, _ = signer.Write(artifactBody)
+	return signer.CurrentValue(), nil
 }
 
+// getTagGenerator returns the running hash of the artifact metadata, to which the body is then written.
+// For HMAC the final hash is the tag, while for Ed25519 it is the message that gets signed.
 func (asa *ArtifactSignatureAuthentication) getTagGenerator(hash string) (hash.Hash, error) {
 	teamId := asa.teamId
-	secret, err := asa.secretKey()
-	if err != nil {
-		return nil, err
-	}
 	artifactMetadata := &struct {
 		Hash   string `json:"hash"`
 		TeamId string `json:"teamId"`
@@ -60,29 +172,164 @@ func (asa *ArtifactSignatureAuthentication) getTagGenerator(hash string) (hash.H
 		return nil, err
 	}
 
-	// TODO(Gaspar) Support additional signing algorithms here
-	h := hmac.New(sha256.New, secret)
-	h.Write(metadata)
-	return h, nil
+	switch asa.algorithm {
+	case "", _signatureAlgorithmHMAC:
+		secret, err := asa.secretKey()
+		if err != nil {
+			return nil, err
+		}
+		h := hmac.New(sha256.New, secret)
+		h.Write(metadata)
+		return h, nil
+	case _signatureAlgorithmEd25519:
+		h := sha512.New()
+		h.Write(metadata)
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown remoteCache.signatureAlgorithm %q. Expected %v or %v", asa.algorithm, _signatureAlgorithmHMAC, _signatureAlgorithmEd25519)
+	}
 }
 
 func (asa *ArtifactSignatureAuthentication) validate(hash string, artifactBody []byte, expectedTag string) (bool, error) {
-	computedTag, err := asa.generateTag(hash, artifactBody)
+	validator, err := asa.newStreamValidator(hash)
 	if err != nil {
 		return false, fmt.Errorf("failed to verify artifact tag: %w", err)
 	}
-	return hmac.Equal([]byte(computedTag), []byte(expectedTag)), nil
+	_, _ = validator.Write(artifactBody)
+	return validator.Validate(expectedTag), nil
+}
+
+// newStreamSigner returns a StreamValidator for incrementally computing
+// the tag of an artifact as it is written. With Ed25519, errSignatureVerifyOnly
+// is returned if this machine has no private key.
+func (asa *ArtifactSignatureAuthentication) newStreamSigner(hash string) (*StreamValidator, error) {
+	tag, err := asa.getTagGenerator(hash)
+	if err != nil {
+		return nil, err
+	}
+	sv := &StreamValidator{currentHash: tag}
+	if asa.isEd25519() {
+		sv.privateKey, err = asa.privateKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sv, nil
+}
+
+// newStreamValidator returns a StreamValidator for incrementally computing
+// the tag of an artifact as it is read.
+func (asa *ArtifactSignatureAuthentication) newStreamValidator(hash string) (*StreamValidator, error) {
+	tag, err := asa.getTagGenerator(hash)
+	if err != nil {
+		return nil, err
+	}
+	sv := &StreamValidator{currentHash: tag}
+	if asa.isEd25519() {
+		sv.publicKeys, err = asa.publicKeys()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sv, nil
 }
 
 type StreamValidator struct {
 	currentHash hash.Hash
+	// With Ed25519, the final hash is signed with privateKey, and a tag is
+	// valid if it was signed by any of publicKeys.
+	privateKey ed25519.PrivateKey
+	publicKeys []ed25519.PublicKey
+}
+
+// Write adds more of the artifact body to the running tag
+func (sv *StreamValidator) Write(p []byte) (int, error) {
+	return sv.currentHash.Write(p)
 }
 
 func (sv *StreamValidator) Validate(expectedTag string) bool {
+	if sv.publicKeys != nil {
+		signature, err := base64.StdEncoding.DecodeString(expectedTag)
+		if err != nil {
+			return false
+		}
+		digest := sv.currentHash.Sum(nil)
+		for _, publicKey := range sv.publicKeys {
+			if ed25519.Verify(publicKey, digest, signature) {
+				return true
+			}
+		}
+		return false
+	}
 	computedTag := base64.StdEncoding.EncodeToString(sv.currentHash.Sum(nil))
 	return hmac.Equal([]byte(computedTag), []byte(expectedTag))
 }
 
+// mismatchError describes a failed call to Validate
+func (sv *StreamValidator) mismatchError(expectedTag string) error {
+	if sv.publicKeys != nil {
+		return fmt.Errorf("%w: artifact signature was not made by any of the %v trusted public keys", errArtifactVerificationFailed, len(sv.publicKeys))
+	}
+	return fmt.Errorf("%w: artifact tag does not match expected tag %s", errArtifactVerificationFailed, expectedTag)
+}
+
 func (sv *StreamValidator) CurrentValue() string {
+	if sv.privateKey != nil {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(sv.privateKey, sv.currentHash.Sum(nil)))
+	}
 	return base64.StdEncoding.EncodeToString(sv.currentHash.Sum(nil))
 }
+
+// parseEd25519PublicKey accepts either a PEM-encoded PKIX public key, as written by
+// `openssl pkey -pubout`, or the base64-encoded 32 byte key.
+func parseEd25519PublicKey(data []byte) (ed25519.PublicKey, error) {
+	data = []byte(strings.TrimSpace(string(data)))
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 public key")
+		}
+		return publicKey, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, errors.New("expected a PEM or base64-encoded Ed25519 public key")
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a %v byte Ed25519 public key, got %v bytes", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// parseEd25519PrivateKey accepts either a PEM-encoded PKCS #8 private key, as written by
+// `openssl genpkey -algorithm ed25519`, or the base64-encoded 32 byte seed or 64 byte key.
+func parseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	data = []byte(strings.TrimSpace(string(data)))
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 private key")
+		}
+		return privateKey, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, errors.New("expected a PEM or base64-encoded Ed25519 private key")
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("expected a %v byte Ed25519 seed or %v byte private key, got %v bytes", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
@@ -4,13 +4,19 @@
 package cache
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
 )
 
 func Test_SecretKeySuccess(t *testing.T) {
@@ -193,3 +199,104 @@ func Test_Utils(t *testing.T) {
 	expectedTag := "9Fu8YniPZ2dEBolTPQoNlFWG0LNMW8EXrBsRmf/fEHk="
 	assert.True(t, hmac.Equal([]byte(testTag), []byte(expectedTag)))
 }
+
+func Test_Ed25519SignAndVerify(t *testing.T) {
+	teamId := "team_someid"
+	hash := "the-artifact-hash"
+	artifactBody := []byte("the artifact body as bytes")
+	ciPublicKey, ciPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	oldPublicKey, oldPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, untrustedPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	asa := &ArtifactSignatureAuthentication{
+		teamId:    teamId,
+		enabled:   true,
+		algorithm: _signatureAlgorithmEd25519,
+	}
+	sign := func(privateKey ed25519.PrivateKey) string {
+		t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", base64.StdEncoding.EncodeToString(privateKey.Seed()))
+		tag, err := asa.generateTag(hash, artifactBody)
+		assert.NoError(t, err)
+		return tag
+	}
+	ciTag := sign(ciPrivateKey)
+	oldTag := sign(oldPrivateKey)
+	untrustedTag := sign(untrustedPrivateKey)
+
+	// A developer machine only has the public keys, including the one being rotated out
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY", "")
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PUBLIC_KEYS", base64.StdEncoding.EncodeToString(ciPublicKey)+","+base64.StdEncoding.EncodeToString(oldPublicKey))
+
+	_, err = asa.generateTag(hash, artifactBody)
+	assert.ErrorIs(t, err, errSignatureVerifyOnly)
+
+	for _, tag := range []string{ciTag, oldTag} {
+		isValid, err := asa.validate(hash, artifactBody, tag)
+		assert.NoError(t, err)
+		assert.True(t, isValid)
+	}
+	isValid, err := asa.validate(hash, artifactBody, untrustedTag)
+	assert.NoError(t, err)
+	assert.False(t, isValid)
+	isValid, err = asa.validate("wrong-hash", artifactBody, ciTag)
+	assert.NoError(t, err)
+	assert.False(t, isValid)
+	isValid, err = asa.validate(hash, []byte("wrong-artifact-body"), ciTag)
+	assert.NoError(t, err)
+	assert.False(t, isValid)
+}
+
+func Test_Ed25519KeyFiles(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(publicKey)
+	assert.NoError(t, err)
+	assert.NoError(t, repoRoot.UntypedJoin("ci.key").WriteFile(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600))
+	assert.NoError(t, repoRoot.UntypedJoin("ci.pub").WriteFile(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), 0644))
+
+	signer := newArtifactSignatureAuthentication("team_someid", fs.RemoteCacheOptions{
+		Signature:          true,
+		SignatureAlgorithm: _signatureAlgorithmEd25519,
+	}, repoRoot)
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY_FILE", "ci.key")
+	tag, err := signer.generateTag("the-artifact-hash", []byte("body"))
+	assert.NoError(t, err)
+
+	t.Setenv("TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY_FILE", "")
+	verifier := newArtifactSignatureAuthentication("team_someid", fs.RemoteCacheOptions{
+		Signature:           true,
+		SignatureAlgorithm:  _signatureAlgorithmEd25519,
+		SignaturePublicKeys: []string{"ci.pub"},
+	}, repoRoot)
+	isValid, err := verifier.validate("the-artifact-hash", []byte("body"), tag)
+	assert.NoError(t, err)
+	assert.True(t, isValid)
+
+	// Without any trusted keys, nothing can be verified
+	_, err = signer.validate("the-artifact-hash", []byte("body"), tag)
+	assert.ErrorContains(t, err, "no trusted public keys found")
+}
+
+func Test_ParseEd25519Keys(t *testing.T) {
+	_, err := parseEd25519PublicKey([]byte("not a key"))
+	assert.Error(t, err)
+	_, err = parseEd25519PublicKey([]byte(base64.StdEncoding.EncodeToString([]byte("too short"))))
+	assert.ErrorContains(t, err, "32 byte")
+	_, err = parseEd25519PrivateKey([]byte(base64.StdEncoding.EncodeToString([]byte("too short"))))
+	assert.ErrorContains(t, err, "32 byte Ed25519 seed")
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	parsedPrivateKey, err := parseEd25519PrivateKey([]byte(base64.StdEncoding.EncodeToString(privateKey) + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, privateKey, parsedPrivateKey)
+	parsedPublicKey, err := parseEd25519PublicKey([]byte(base64.StdEncoding.EncodeToString(publicKey)))
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, parsedPublicKey)
+}
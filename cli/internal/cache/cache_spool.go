@@ -0,0 +1,616 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nightlyone/lockfile"
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// _spoolDirectory is the directory, under the cache directory, where uploads wait
+const _spoolDirectory = "upload-spool"
+
+// _spoolMaxAttempts is how many times an upload is tried before it is marked as failed
+const _spoolMaxAttempts = 10
+
+// _spoolMinBackoff and _spoolMaxBackoff bound the wait between attempts at an upload,
+// which doubles after each failure
+const _spoolMinBackoff = 5 * time.Second
+const _spoolMaxBackoff = 10 * time.Minute
+
+// _spoolShutdownGrace is how long a run keeps uploading after its tasks have finished.
+// Anything left stays spooled, for the next invocation or the daemon to upload.
+const _spoolShutdownGrace = 10 * time.Second
+
+// _spoolPollInterval is how often DrainSpool checks for uploads spooled by other processes
+const _spoolPollInterval = time.Minute
+
+// _spoolOrphanAge is how old a spooled artifact without an entry must be before it is
+// removed. Artifacts are written before their entry, so younger ones may be in progress.
+const _spoolOrphanAge = time.Hour
+
+// _spoolRegistry is the file, in the default cache directory, that lists the other cache
+// directories that runs have spooled uploads in, so that the daemon can find them
+const _spoolRegistry = "upload-spool-dirs"
+
+var errSpooledArtifactCorrupt = errors.New("spooled artifact is corrupt")
+
+// SpoolEntry describes an upload waiting in the spool
+type SpoolEntry struct {
+	Hash string `json:"hash"`
+	// Destination identifies the remote cache the upload is for
+	Destination string    `json:"destination"`
+	Duration    int       `json:"duration"`
+	Tag         string    `json:"tag,omitempty"`
+	Size        int64     `json:"size"`
+	Sha256      string    `json:"sha256"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	// Failed is set once an upload has used up its attempts, or can never succeed
+	Failed bool `json:"failed"`
+}
+
+// uploadSpool keeps uploads on disk until they have been sent, so that they survive
+// the process that produced them exiting. Each upload is a prepared artifact, written
+// first, and an entry describing it, which marks it as complete. Any number of
+// processes may add to and drain the same spool.
+type uploadSpool struct {
+	dir turbopath.AbsoluteSystemPath
+	// now is overridable for tests
+	now func() time.Time
+	// onDisabled, if set, is called when an upload fails because the remote cache is disabled
+	onDisabled func(err *util.CacheDisabledError)
+}
+
+func newUploadSpool(cacheDir turbopath.AbsoluteSystemPath) *uploadSpool {
+	return &uploadSpool{
+		dir: cacheDir.UntypedJoin(_spoolDirectory),
+		now: time.Now,
+	}
+}
+
+func (s *uploadSpool) entryPath(hash string) turbopath.AbsoluteSystemPath {
+	return s.dir.UntypedJoin(hash + ".json")
+}
+
+func (s *uploadSpool) artifactPath(hash string) turbopath.AbsoluteSystemPath {
+	return s.dir.UntypedJoin(hash + ".artifact")
+}
+
+func (s *uploadSpool) lock(hash string) (lockfile.Lockfile, error) {
+	lock, err := lockfile.New(s.dir.UntypedJoin(hash + ".lock").ToString())
+	if err != nil {
+		return "", err
+	}
+	return lock, lock.TryLock()
+}
+
+// add moves a prepared upload into the spool
+func (s *uploadSpool) add(destination string, hash string, duration int, prepared *preparedUpload) error {
+	if err := s.dir.MkdirAll(0775); err != nil {
+		return err
+	}
+	if err := s.writeArtifact(hash, prepared); err != nil {
+		return err
+	}
+	return s.writeEntry(&SpoolEntry{
+		Hash:        hash,
+		Destination: destination,
+		Duration:    duration,
+		Tag:         prepared.tag,
+		Size:        prepared.size,
+		Sha256:      prepared.sha256,
+		Created:     s.now(),
+	})
+}
+
+// writeArtifact moves the prepared artifact into place if it is a temporary file on
+// the same filesystem, and otherwise copies it
+func (s *uploadSpool) writeArtifact(hash string, prepared *preparedUpload) error {
+	if artifact, ok := prepared.body.(*tempArtifact); ok {
+		if err := os.Rename(artifact.Name(), s.artifactPath(hash).ToString()); err == nil {
+			return nil
+		}
+	}
+	if _, err := prepared.body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir.ToString(), hash+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := turbopath.AbsoluteSystemPathFromUpstream(tmp.Name())
+	defer func() { _ = tmpPath.Remove() }()
+	_, err = io.Copy(tmp, prepared.body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return tmpPath.Rename(s.artifactPath(hash))
+}
+
+// writeEntry atomically replaces the entry for an upload
+func (s *uploadSpool) writeEntry(entry *SpoolEntry) error {
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir.ToString(), entry.Hash+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := turbopath.AbsoluteSystemPathFromUpstream(tmp.Name())
+	defer func() { _ = tmpPath.Remove() }()
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return tmpPath.Rename(s.entryPath(entry.Hash))
+}
+
+func (s *uploadSpool) readEntry(hash string) (*SpoolEntry, error) {
+	contents, err := s.entryPath(hash).ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	entry := &SpoolEntry{}
+	if err := json.Unmarshal(contents, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// remove deletes an upload. The entry goes first, so that nothing tries to send the
+// upload once its artifact is gone.
+func (s *uploadSpool) remove(hash string) error {
+	if err := s.entryPath(hash).Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := s.artifactPath(hash).Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// list returns the uploads in the spool, oldest first, and removes leftovers from
+// interrupted writes
+func (s *uploadSpool) list() ([]*SpoolEntry, error) {
+	dirEntries, err := os.ReadDir(s.dir.ToString())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	hasEntry := make(map[string]bool)
+	for _, dirEntry := range dirEntries {
+		if name := dirEntry.Name(); strings.HasSuffix(name, ".json") {
+			hasEntry[strings.TrimSuffix(name, ".json")] = true
+		}
+	}
+	entries := []*SpoolEntry{}
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		switch {
+		case strings.HasSuffix(name, ".json"):
+			entry, err := s.readEntry(strings.TrimSuffix(name, ".json"))
+			if err == nil {
+				entries = append(entries, entry)
+			}
+		case strings.HasSuffix(name, ".tmp") || (strings.HasSuffix(name, ".artifact") && !hasEntry[strings.TrimSuffix(name, ".artifact")]):
+			if info, err := dirEntry.Info(); err == nil && s.now().Sub(info.ModTime()) > _spoolOrphanAge {
+				_ = s.dir.UntypedJoin(name).Remove()
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries, nil
+}
+
+// drain sends the uploads for remote that are due, using up to workers concurrent
+// uploads. It returns when the next upload will be due, or the zero time if none are
+// waiting. After a failure, no further uploads are started, since the remote cache is
+// likely to be unavailable.
+func (s *uploadSpool) drain(remote remoteUploader, workers int) time.Time {
+	entries, err := s.list()
+	if err != nil {
+		return time.Time{}
+	}
+	now := s.now()
+	destination := remote.destination()
+	var mu sync.Mutex
+	var next time.Time
+	updateNext := func(t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	due := []string{}
+	for _, entry := range entries {
+		if entry.Failed || entry.Destination != destination {
+			continue
+		}
+		if entry.NextAttempt.After(now) {
+			updateNext(entry.NextAttempt)
+			continue
+		}
+		due = append(due, entry.Hash)
+	}
+
+	var failed uint32
+	queue := make(chan string)
+	wg := &sync.WaitGroup{}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range queue {
+				if atomic.LoadUint32(&failed) == 1 {
+					continue
+				}
+				if retryAt, ok := s.send(remote, hash); !ok {
+					atomic.StoreUint32(&failed, 1)
+					updateNext(retryAt)
+				}
+			}
+		}()
+	}
+	for _, hash := range due {
+		queue <- hash
+	}
+	close(queue)
+	wg.Wait()
+	return next
+}
+
+// send uploads a single spooled artifact, unless another process is already sending
+// it. It returns false if the upload failed, along with when it should be retried.
+func (s *uploadSpool) send(remote remoteUploader, hash string) (time.Time, bool) {
+	lock, err := s.lock(hash)
+	if err != nil {
+		// Someone else is uploading it
+		return time.Time{}, true
+	}
+	defer func() { _ = lock.Unlock() }()
+	// Re-read the entry now that we hold the lock, since it may have been sent already
+	entry, err := s.readEntry(hash)
+	if err != nil || entry.Failed || entry.NextAttempt.After(s.now()) {
+		return time.Time{}, true
+	}
+
+	err = s.upload(remote, entry)
+	if err == nil {
+		_ = s.remove(hash)
+		return time.Time{}, true
+	}
+	entry.Attempts++
+	entry.LastError = err.Error()
+	cd := &util.CacheDisabledError{}
+	disabled := errors.As(err, &cd)
+	if disabled && s.onDisabled != nil {
+		s.onDisabled(cd)
+	}
+	if entry.Attempts >= _spoolMaxAttempts || disabled || errors.Is(err, errSpooledArtifactCorrupt) {
+		entry.Failed = true
+		entry.NextAttempt = time.Time{}
+	} else {
+		entry.NextAttempt = s.now().Add(spoolBackoff(entry.Attempts))
+	}
+	_ = s.writeEntry(entry)
+	return entry.NextAttempt, false
+}
+
+// upload verifies that a spooled artifact is intact, and sends it
+func (s *uploadSpool) upload(remote remoteUploader, entry *SpoolEntry) error {
+	f, err := s.artifactPath(entry.Hash).Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSpooledArtifactCorrupt, err)
+	}
+	defer func() { _ = f.Close() }()
+	checksum := sha256.New()
+	size, err := io.Copy(checksum, f)
+	if err != nil {
+		return err
+	}
+	if size != entry.Size || hex.EncodeToString(checksum.Sum(nil)) != entry.Sha256 {
+		return errSpooledArtifactCorrupt
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return remote.upload(entry.Hash, entry.Duration, &preparedUpload{
+		body:   f,
+		size:   entry.Size,
+		sha256: entry.Sha256,
+		tag:    entry.Tag,
+	})
+}
+
+// spoolBackoff returns how long to wait after the given number of failed attempts
+func spoolBackoff(attempts int) time.Duration {
+	backoff := _spoolMinBackoff
+	for i := 1; i < attempts && backoff < _spoolMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > _spoolMaxBackoff {
+		return _spoolMaxBackoff
+	}
+	return backoff
+}
+
+// spoolCache wraps a remote cache, spooling uploads to disk so that they survive the
+// process exiting, and sending them in the background with retries. Once the remote
+// cache reports that it is disabled, Put returns that error instead of spooling, so
+// that the cacheMultiplexer removes the cache.
+type spoolCache struct {
+	remote  remoteUploader
+	spool   *uploadSpool
+	workers int
+
+	disabledMu sync.Mutex
+	disabled   *util.CacheDisabledError
+
+	wake      chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newSpoolCache(remote remoteUploader, cacheDir turbopath.AbsoluteSystemPath, workers int) *spoolCache {
+	c := &spoolCache{
+		remote:  remote,
+		spool:   newUploadSpool(cacheDir),
+		workers: workers,
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	c.spool.onDisabled = c.disable
+	// Start with anything left over from earlier invocations
+	go c.run()
+	return c
+}
+
+func (c *spoolCache) run() {
+	defer close(c.done)
+	for {
+		next := c.spool.drain(c.remote, c.workers)
+		retry := &time.Timer{}
+		if !next.IsZero() {
+			retry = time.NewTimer(time.Until(next))
+		}
+		select {
+		case <-c.wake:
+		case <-retry.C:
+		case <-c.closing:
+			select {
+			case <-c.wake:
+				// Send what was added while draining, then stop
+			default:
+				// Anything left is waiting out a backoff
+				return
+			}
+		}
+		if retry.C != nil {
+			retry.Stop()
+		}
+	}
+}
+
+// signal wakes the background uploader, without blocking if it is already awake
+func (c *spoolCache) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// disable records that the remote cache rejected an upload because it is disabled
+func (c *spoolCache) disable(err *util.CacheDisabledError) {
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+	if c.disabled == nil {
+		c.disabled = err
+	}
+}
+
+func (c *spoolCache) disabledErr() error {
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+	if c.disabled == nil {
+		return nil
+	}
+	return c.disabled
+}
+
+func (c *spoolCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
+	// Don't prepare uploads that the remote cache is known to reject
+	if err := c.disabledErr(); err != nil {
+		return err
+	}
+	prepared, err := c.remote.prepareUpload(anchor, hash, files)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = prepared.body.Close() }()
+	if err := c.spool.add(c.remote.destination(), hash, duration, prepared); err != nil {
+		// Without a spool, upload directly, as though there were none
+		if _, err := prepared.body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return c.remote.upload(hash, duration, prepared)
+	}
+	c.signal()
+	return nil
+}
+
+func (c *spoolCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	return c.remote.Fetch(anchor, hash, outputGlobs)
+}
+
+func (c *spoolCache) Exists(hash string) (ItemStatus, error) {
+	return c.remote.Exists(hash)
+}
+
+func (c *spoolCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	return c.remote.BatchExists(hashes)
+}
+
+func (c *spoolCache) Clean(anchor turbopath.AbsoluteSystemPath) {
+	c.remote.Clean(anchor)
+}
+
+func (c *spoolCache) CleanAll() {
+	c.remote.CleanAll()
+}
+
+// Shutdown sends whatever is due, giving up after a grace period. Uploads that
+// haven't been sent by then stay spooled.
+func (c *spoolCache) Shutdown() {
+	c.closeOnce.Do(func() { close(c.closing) })
+	select {
+	case <-c.done:
+	case <-time.After(_spoolShutdownGrace):
+	}
+	c.remote.Shutdown()
+}
+
+// registerSpoolDir records that uploads are spooled in cacheDir, if it isn't the default
+// cache directory, which is always drained
+func registerSpoolDir(repoRoot turbopath.AbsoluteSystemPath, cacheDir turbopath.AbsoluteSystemPath) error {
+	if cacheDir == DefaultLocation(repoRoot) {
+		return nil
+	}
+	for _, dir := range spoolDirs(repoRoot) {
+		if dir == cacheDir {
+			return nil
+		}
+	}
+	registry := DefaultLocation(repoRoot).UntypedJoin(_spoolRegistry)
+	if err := registry.EnsureDir(); err != nil {
+		return err
+	}
+	f, err := registry.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(cacheDir.ToString() + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// spoolDirs returns the default cache directory, followed by the other cache
+// directories that runs have registered spooled uploads in
+func spoolDirs(repoRoot turbopath.AbsoluteSystemPath) []turbopath.AbsoluteSystemPath {
+	dirs := []turbopath.AbsoluteSystemPath{DefaultLocation(repoRoot)}
+	contents, err := DefaultLocation(repoRoot).UntypedJoin(_spoolRegistry).ReadFile()
+	if err != nil {
+		return dirs
+	}
+	seen := make(util.Set)
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen.Includes(line) || !filepath.IsAbs(line) {
+			continue
+		}
+		seen.Add(line)
+		dirs = append(dirs, turbopath.AbsoluteSystemPathFromUpstream(line))
+	}
+	return dirs
+}
+
+// DrainSpool sends the uploads spooled in the default cache directory, and in every
+// other cache directory that runs have spooled uploads in, retrying failures as their
+// backoff expires, until ctx is done. The daemon uses it to finish uploads that the
+// runs that spooled them didn't.
+func DrainSpool(ctx context.Context, opts Opts, repoRoot turbopath.AbsoluteSystemPath, client client) {
+	remote := newRemoteCache(opts, client, analytics.NullRecorder, repoRoot)
+	for {
+		// Re-read the registered directories, since runs may add to them
+		next := time.Time{}
+		for _, dir := range spoolDirs(repoRoot) {
+			dirNext := newUploadSpool(dir).drain(remote, opts.Workers)
+			if !dirNext.IsZero() && (next.IsZero() || dirNext.Before(next)) {
+				next = dirNext
+			}
+		}
+		wait := _spoolPollInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// ListSpool returns the uploads spooled in the cache directory that opts configures,
+// oldest first
+func ListSpool(opts Opts, repoRoot turbopath.AbsoluteSystemPath) ([]*SpoolEntry, error) {
+	return newUploadSpool(opts.ResolveCacheDir(repoRoot)).list()
+}
+
+// RetryFailedUploads marks the failed uploads in the cache directory that opts
+// configures as due, so that the next invocation tries them again. It returns how
+// many were marked.
+func RetryFailedUploads(opts Opts, repoRoot turbopath.AbsoluteSystemPath) (int, error) {
+	spool := newUploadSpool(opts.ResolveCacheDir(repoRoot))
+	entries, err := spool.list()
+	if err != nil {
+		return 0, err
+	}
+	retried := 0
+	for _, entry := range entries {
+		if !entry.Failed {
+			continue
+		}
+		lock, err := spool.lock(entry.Hash)
+		if err != nil {
+			continue
+		}
+		entry.Failed = false
+		entry.Attempts = 0
+		entry.NextAttempt = time.Time{}
+		err = spool.writeEntry(entry)
+		_ = lock.Unlock()
+		if err != nil {
+			return retried, err
+		}
+		retried++
+	}
+	return retried, nil
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+	"gotest.tools/v3/assert"
+)
+
+// flakyClient is a memoryClient whose uploads fail while err is set
+type flakyClient struct {
+	*memoryClient
+	err     error
+	uploads int
+}
+
+func (fc *flakyClient) PutArtifact(hash string, body io.Reader, size int64, duration int, tag string) error {
+	fc.uploads++
+	if fc.err != nil {
+		return fc.err
+	}
+	return fc.memoryClient.PutArtifact(hash, body, size, duration, tag)
+}
+
+// spoolUpload prepares an artifact for remote and adds it to spool
+func spoolUpload(t *testing.T, spool *uploadSpool, remote remoteUploader, hash string) {
+	t.Helper()
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	prepared, err := remote.prepareUpload(src, hash, []turbopath.AnchoredSystemPath{"a-file"})
+	assert.NilError(t, err, "prepareUpload")
+	defer func() { _ = prepared.body.Close() }()
+	assert.NilError(t, spool.add(remote.destination(), hash, 5, prepared), "add")
+}
+
+func TestUploadSpoolRetriesWithBackoff(t *testing.T) {
+	cacheDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	client := &flakyClient{memoryClient: &memoryClient{}, err: errors.New("connection reset")}
+	remote := newHTTPCache(Opts{}, client, analytics.NullRecorder, cacheDir)
+	spool := newUploadSpool(cacheDir)
+	now := time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC)
+	spool.now = func() time.Time { return now }
+	spoolUpload(t, spool, remote, "some-hash")
+
+	next := spool.drain(remote, 1)
+	assert.Equal(t, next, now.Add(_spoolMinBackoff))
+	entries, err := spool.list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Attempts, 1)
+	assert.Equal(t, entries[0].LastError, "connection reset")
+	assert.Assert(t, !entries[0].Failed)
+
+	// Nothing is sent before the backoff expires
+	client.err = nil
+	assert.Equal(t, spool.drain(remote, 1), now.Add(_spoolMinBackoff))
+	assert.Equal(t, client.uploads, 1)
+
+	now = now.Add(_spoolMinBackoff)
+	assert.Assert(t, spool.drain(remote, 1).IsZero())
+	assert.Equal(t, client.uploads, 2)
+	assert.Equal(t, client.size, int64(len(client.body)))
+	entries, err = spool.list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(entries), 0)
+	assert.Assert(t, !spool.artifactPath("some-hash").FileExists())
+}
+
+func TestUploadSpoolFailsAndRetries(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	opts := Opts{OverrideDir: "cache"}
+	client := &flakyClient{memoryClient: &memoryClient{}, err: &util.CacheDisabledError{
+		Status:  util.CachingStatusDisabled,
+		Message: "Remote Caching has been disabled for this team",
+	}}
+	remote := newHTTPCache(opts, client, analytics.NullRecorder, repoRoot)
+	spool := newUploadSpool(opts.ResolveCacheDir(repoRoot))
+	spoolUpload(t, spool, remote, "some-hash")
+
+	// Disabled caching can't be fixed by retrying, so the upload fails immediately
+	assert.Assert(t, spool.drain(remote, 1).IsZero())
+	entries, err := ListSpool(opts, repoRoot)
+	assert.NilError(t, err, "ListSpool")
+	assert.Equal(t, len(entries), 1)
+	assert.Assert(t, entries[0].Failed)
+	spool.drain(remote, 1)
+	assert.Equal(t, client.uploads, 1)
+
+	client.err = nil
+	retried, err := RetryFailedUploads(opts, repoRoot)
+	assert.NilError(t, err, "RetryFailedUploads")
+	assert.Equal(t, retried, 1)
+	spool.drain(remote, 1)
+	assert.Equal(t, client.uploads, 2)
+	entries, err = ListSpool(opts, repoRoot)
+	assert.NilError(t, err, "ListSpool")
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestUploadSpoolCorruptArtifact(t *testing.T) {
+	cacheDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	client := &flakyClient{memoryClient: &memoryClient{}}
+	remote := newHTTPCache(Opts{}, client, analytics.NullRecorder, cacheDir)
+	spool := newUploadSpool(cacheDir)
+	spoolUpload(t, spool, remote, "some-hash")
+	assert.NilError(t, spool.artifactPath("some-hash").WriteFile([]byte("garbage"), 0644), "WriteFile")
+
+	spool.drain(remote, 1)
+	assert.Equal(t, client.uploads, 0)
+	entry, err := spool.readEntry("some-hash")
+	assert.NilError(t, err, "readEntry")
+	assert.Assert(t, entry.Failed)
+	assert.Equal(t, entry.LastError, errSpooledArtifactCorrupt.Error())
+}
+
+func TestUploadSpoolSkipsOtherDestinations(t *testing.T) {
+	cacheDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	spool := newUploadSpool(cacheDir)
+	other := newHTTPCache(Opts{}, &errorResp{}, analytics.NullRecorder, cacheDir)
+	spoolUpload(t, spool, other, "some-hash")
+
+	client := &flakyClient{memoryClient: &memoryClient{}}
+	remote := newHTTPCache(Opts{}, client, analytics.NullRecorder, cacheDir)
+	assert.Assert(t, spool.drain(remote, 1).IsZero())
+	assert.Equal(t, client.uploads, 0)
+	entries, err := spool.list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Destination, "team:")
+}
+
+func TestSpoolCacheUploadsBeforeShutdown(t *testing.T) {
+	cacheDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	client := &memoryClient{}
+	cache := newSpoolCache(newHTTPCache(Opts{}, client, analytics.NullRecorder, src), cacheDir, 1)
+
+	assert.NilError(t, cache.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	cache.Shutdown()
+	assert.Assert(t, client.body != nil)
+	entries, err := cache.spool.list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(entries), 0)
+
+	dst := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	hit, files, _, err := cache.Fetch(dst, "some-hash", nil)
+	assert.NilError(t, err, "Fetch")
+	assert.Assert(t, hit)
+	assert.DeepEqual(t, files, []turbopath.AnchoredSystemPath{"a-file"})
+}
+
+func TestSpoolCacheReportsDisabledCaching(t *testing.T) {
+	cacheDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.NilError(t, src.UntypedJoin("a-file").WriteFile([]byte("contents"), 0644), "WriteFile")
+	client := &flakyClient{memoryClient: &memoryClient{}, err: &util.CacheDisabledError{
+		Status:  util.CachingStatusDisabled,
+		Message: "Remote Caching has been disabled for this team",
+	}}
+	spool := newSpoolCache(newHTTPCache(Opts{}, client, analytics.NullRecorder, src), cacheDir, 1)
+	var removed error
+	mplex := &cacheMultiplexer{
+		caches: []Cache{spool},
+		onCacheRemoved: func(_ Cache, err error) {
+			removed = err
+		},
+	}
+
+	// The first upload is spooled, and rejected in the background
+	assert.NilError(t, mplex.Put(src, "some-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	spool.Shutdown()
+	assert.Equal(t, client.uploads, 1)
+
+	// Later ones aren't spooled, and the cache is removed
+	assert.NilError(t, mplex.Put(src, "other-hash", 5, []turbopath.AnchoredSystemPath{"a-file"}), "Put")
+	cd := &util.CacheDisabledError{}
+	assert.Assert(t, errors.As(removed, &cd))
+	assert.Equal(t, len(mplex.caches), 0)
+	entries, err := spool.spool.list()
+	assert.NilError(t, err, "list")
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Hash, "some-hash")
+}
+
+func TestSpoolDirs(t *testing.T) {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	assert.DeepEqual(t, spoolDirs(repoRoot), []turbopath.AbsoluteSystemPath{DefaultLocation(repoRoot)})
+
+	// Runs that spool in another cache directory register it once
+	cacheDir := (&Opts{OverrideDir: "custom-cache"}).ResolveCacheDir(repoRoot)
+	assert.NilError(t, registerSpoolDir(repoRoot, cacheDir), "registerSpoolDir")
+	assert.NilError(t, registerSpoolDir(repoRoot, cacheDir), "registerSpoolDir")
+	assert.NilError(t, registerSpoolDir(repoRoot, DefaultLocation(repoRoot)), "registerSpoolDir")
+	assert.DeepEqual(t, spoolDirs(repoRoot), []turbopath.AbsoluteSystemPath{DefaultLocation(repoRoot), cacheDir})
+
+	// The daemon drains them
+	src := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	client := &flakyClient{memoryClient: &memoryClient{}}
+	remote := newHTTPCache(Opts{}, client, analytics.NullRecorder, src)
+	spoolUpload(t, newUploadSpool(cacheDir), remote, "some-hash")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	DrainSpool(ctx, Opts{}, repoRoot, client)
+	assert.Equal(t, client.uploads, 1)
+}
+
+func TestSpoolBackoff(t *testing.T) {
+	assert.Equal(t, spoolBackoff(1), _spoolMinBackoff)
+	assert.Equal(t, spoolBackoff(2), 2*_spoolMinBackoff)
+	assert.Equal(t, spoolBackoff(4), 8*_spoolMinBackoff)
+	assert.Equal(t, spoolBackoff(_spoolMaxAttempts), _spoolMaxBackoff)
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// tempArtifact is a compressed artifact spooled to a temporary file so that it can be
+// uploaded, and rewound for retries, without holding the whole artifact in memory.
+type tempArtifact struct {
+	*os.File
+	size int64
+}
+
+// newTempArtifact creates an empty temporary file to spool an artifact into
+func newTempArtifact() (*tempArtifact, error) {
+	f, err := ioutil.TempFile("", "turbo-artifact-*.tar.zst")
+	if err != nil {
+		return nil, err
+	}
+	return &tempArtifact{File: f}, nil
+}
+
+// writeTempArtifact tars and compresses files, relative to anchor, into a temporary file,
+// encrypting them if sealer is non-nil. Each of the given writers sees the bytes as they
+// are written, which allows signatures and checksums to be computed in the same pass.
+func writeTempArtifact(anchor turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath, sealer *artifactSealer, writers ...io.Writer) (*tempArtifact, error) {
+	artifact, err := newTempArtifact()
+	if err != nil {
+		return nil, err
+	}
+	r, pw := io.Pipe()
+	var w io.WriteCloser = pw
+	if sealer != nil {
+		w = sealer.wrap(pw)
+	}
+	go writeTar(w, anchor, files)
+	if err := artifact.fill(r, writers...); err != nil {
+		_ = r.CloseWithError(err)
+		_ = artifact.Close()
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// fill copies r into the temporary file, and any additional writers, and rewinds it
+// so that it is ready to be read back.
+func (a *tempArtifact) fill(r io.Reader, writers ...io.Writer) error {
+	size, err := io.Copy(io.MultiWriter(append([]io.Writer{a.File}, writers...)...), r)
+	if err != nil {
+		return err
+	}
+	a.size = size
+	_, err = a.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close closes and deletes the temporary file
+func (a *tempArtifact) Close() error {
+	closeErr := a.File.Close()
+	if err := os.Remove(a.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return closeErr
+}
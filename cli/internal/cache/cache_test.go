@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"io"
 	"net/http"
 	"reflect"
 	"sync/atomic"
@@ -13,11 +14,13 @@ import (
 )
 
 type testCache struct {
-	disabledErr *util.CacheDisabledError
-	entries     map[string][]turbopath.AnchoredSystemPath
+	disabledErr     *util.CacheDisabledError
+	entries         map[string][]turbopath.AnchoredSystemPath
+	lastOutputGlobs *fs.TaskOutputs
 }
 
-func (tc *testCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, files []string) (bool, []turbopath.AnchoredSystemPath, int, error) {
+func (tc *testCache) Fetch(anchor turbopath.AbsoluteSystemPath, hash string, outputGlobs *fs.TaskOutputs) (bool, []turbopath.AnchoredSystemPath, int, error) {
+	tc.lastOutputGlobs = outputGlobs
 	if tc.disabledErr != nil {
 		return false, nil, 0, tc.disabledErr
 	}
@@ -40,6 +43,18 @@ func (tc *testCache) Exists(hash string) (ItemStatus, error) {
 	return ItemStatus{}, nil
 }
 
+func (tc *testCache) BatchExists(hashes []string) (map[string]ItemStatus, error) {
+	itemStatuses := make(map[string]ItemStatus, len(hashes))
+	for _, hash := range hashes {
+		itemStatus, err := tc.Exists(hash)
+		if err != nil {
+			return nil, err
+		}
+		itemStatuses[hash] = itemStatus
+	}
+	return itemStatuses, nil
+}
+
 func (tc *testCache) Put(anchor turbopath.AbsoluteSystemPath, hash string, duration int, files []turbopath.AnchoredSystemPath) error {
 	if tc.disabledErr != nil {
 		return tc.disabledErr
@@ -106,7 +121,7 @@ func TestPutCachingDisabled(t *testing.T) {
 	mplex.mu.RUnlock()
 
 	// subsequent Fetch should still work
-	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", []string{"unused", "files"})
+	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", nil)
 	if err != nil {
 		t.Errorf("got error fetching files: %v", err)
 	}
@@ -152,6 +167,28 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestBatchExists(t *testing.T) {
+	first, second := newEnabledCache(), newEnabledCache()
+	mplex := &cacheMultiplexer{
+		caches: []Cache{first, second},
+	}
+	first.entries["first-hash"] = []turbopath.AnchoredSystemPath{"a-file"}
+	second.entries["second-hash"] = []turbopath.AnchoredSystemPath{"a-file"}
+
+	itemStatuses, err := mplex.BatchExists([]string{"first-hash", "second-hash", "missing-hash"})
+	if err != nil {
+		t.Errorf("got error verifying files: %v", err)
+	}
+	expected := map[string]ItemStatus{
+		"first-hash":   {Local: true},
+		"second-hash":  {Local: true},
+		"missing-hash": {},
+	}
+	if !reflect.DeepEqual(itemStatuses, expected) {
+		t.Errorf("BatchExists got %v, want %v", itemStatuses, expected)
+	}
+}
+
 type fakeClient struct{}
 
 // FetchArtifact implements client
@@ -163,13 +200,17 @@ func (*fakeClient) ArtifactExists(hash string) (*http.Response, error) {
 	panic("unimplemented")
 }
 
+func (*fakeClient) ArtifactsExist(hashes []string) (map[string]bool, error) {
+	panic("unimplemented")
+}
+
 // GetTeamID implements client
 func (*fakeClient) GetTeamID() string {
 	return "fake-team-id"
 }
 
 // PutArtifact implements client
-func (*fakeClient) PutArtifact(hash string, body []byte, duration int, tag string) error {
+func (*fakeClient) PutArtifact(hash string, body io.Reader, size int64, duration int, tag string) error {
 	panic("unimplemented")
 }
 
@@ -191,7 +232,7 @@ func TestFetchCachingDisabled(t *testing.T) {
 		},
 	}
 
-	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", []string{"unused", "files"})
+	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", nil)
 	if err != nil {
 		// don't leak the cache removal
 		t.Errorf("Fetch got error %v, want <nil>", err)
@@ -217,10 +258,6 @@ func TestFetchCachingDisabled(t *testing.T) {
 	mplex.mu.RUnlock()
 }
 
-type nullRecorder struct{}
-
-func (nullRecorder) LogEvent(analytics.EventPayload) {}
-
 func TestNew(t *testing.T) {
 	// Test will bomb if this fails, no need to specially handle the error
 	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
@@ -243,7 +280,7 @@ func TestNew(t *testing.T) {
 					SkipFilesystem: true,
 					SkipRemote:     true,
 				},
-				recorder:       &nullRecorder{},
+				recorder:       analytics.NullRecorder,
 				onCacheRemoved: func(Cache, error) {},
 			},
 			want:    &noopCache{},
@@ -258,7 +295,7 @@ func TestNew(t *testing.T) {
 						Signature: true,
 					},
 				},
-				recorder:       &nullRecorder{},
+				recorder:       analytics.NullRecorder,
 				onCacheRemoved: func(Cache, error) {},
 			},
 			want: &cacheMultiplexer{
@@ -272,7 +309,7 @@ func TestNew(t *testing.T) {
 				opts: Opts{
 					SkipRemote: true,
 				},
-				recorder:       &nullRecorder{},
+				recorder:       analytics.NullRecorder,
 				onCacheRemoved: func(Cache, error) {},
 			},
 			want: &fsCache{},
@@ -285,7 +322,7 @@ func TestNew(t *testing.T) {
 						Signature: true,
 					},
 				},
-				recorder:       &nullRecorder{},
+				recorder:       analytics.NullRecorder,
 				onCacheRemoved: func(Cache, error) {},
 			},
 			want: &cacheMultiplexer{
@@ -320,3 +357,31 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchOutputGlobsOnlyForFirstCache(t *testing.T) {
+	local := &testCache{entries: make(map[string][]turbopath.AnchoredSystemPath)}
+	remote := &testCache{entries: map[string][]turbopath.AnchoredSystemPath{
+		"some-hash": {"a-file"},
+	}}
+	mplex := &cacheMultiplexer{
+		caches: []Cache{local, remote},
+	}
+	outputGlobs := &fs.TaskOutputs{Inclusions: []string{"dist/**"}}
+	hit, _, _, err := mplex.Fetch("unused-target", "some-hash", outputGlobs)
+	if err != nil {
+		t.Errorf("Fetch got error %v, want <nil>", err)
+	}
+	if !hit {
+		t.Error("Fetch got false, want true")
+	}
+	if local.lastOutputGlobs != outputGlobs {
+		t.Errorf("local cache got output globs %v, want %v", local.lastOutputGlobs, outputGlobs)
+	}
+	// The remote hit is stored back into the local cache, so it must be restored in full
+	if remote.lastOutputGlobs != nil {
+		t.Errorf("remote cache got output globs %v, want <nil>", remote.lastOutputGlobs)
+	}
+	if _, ok := local.entries["some-hash"]; !ok {
+		t.Error("expected remote hit to be stored in the local cache")
+	}
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// preparedUpload is an artifact in exactly the form it will be sent to a remote cache:
+// compressed, encrypted if configured, and with its signature computed.
+type preparedUpload struct {
+	body io.ReadSeekCloser
+	size int64
+	// sha256 is the hex-encoded SHA-256 of body
+	sha256 string
+	tag    string
+}
+
+// remoteUploader is implemented by the remote caches. Preparing an upload is separate
+// from sending it, so that prepared uploads can be spooled to disk and sent later.
+type remoteUploader interface {
+	Cache
+	artifactDownloader
+	prepareUpload(anchor turbopath.AbsoluteSystemPath, hash string, files []turbopath.AnchoredSystemPath) (*preparedUpload, error)
+	upload(hash string, duration int, prepared *preparedUpload) error
+	// destination identifies where uploads are sent, so that an upload spooled for one
+	// remote cache is never sent to another
+	destination() string
+}
+
+// prepareUpload writes files, relative to anchor, to a temporary artifact, encrypting
+// and signing it as configured. It returns an error wrapping errSignatureVerifyOnly if
+// this machine can't sign artifacts, since anything it uploaded would be rejected by
+// everyone else.
+func prepareUpload(signerVerifier *ArtifactSignatureAuthentication, encryption *ArtifactEncryption, anchor turbopath.AbsoluteSystemPath, hash string, files []turbopath.AnchoredSystemPath) (*preparedUpload, error) {
+	checksum := sha256.New()
+	writers := []io.Writer{checksum}
+	var validator *StreamValidator
+	if signerVerifier.isEnabled() {
+		var err error
+		validator, err = signerVerifier.newStreamSigner(hash)
+		if errors.Is(err, errSignatureVerifyOnly) {
+			return nil, fmt.Errorf("artifact %v was not uploaded: %w; use --cache=remote:r to only read from the remote cache", hash, err)
+		} else if err != nil {
+			return nil, err
+		}
+		writers = append(writers, validator)
+	}
+	sealer, err := encryption.newSealer(hash)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := writeTempArtifact(anchor, files, sealer, writers...)
+	if err != nil {
+		return nil, err
+	}
+	prepared := &preparedUpload{
+		body:   artifact,
+		size:   artifact.size,
+		sha256: hex.EncodeToString(checksum.Sum(nil)),
+	}
+	if validator != nil {
+		prepared.tag = validator.CurrentValue()
+	}
+	return prepared, nil
+}
@@ -0,0 +1,73 @@
+package cachecmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// openCache returns the local filesystem cache on its own, or the remote cache on its own if remote is true.
+func openCache(base *cmdutil.CmdBase, opts cache.Opts, remote bool) (cache.Cache, error) {
+	if !remote {
+		if err := opts.SetDedupeFromEnv(); err != nil {
+			return nil, err
+		}
+		opts.SkipRemote = true
+		return cache.New(opts, base.RepoRoot, base.APIClient, analytics.NullRecorder, nil)
+	}
+
+	rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package.json: %w", err)
+	}
+	turboJSON, err := fs.LoadTurboConfig(base.RepoRoot, rootPackageJSON, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.SkipFilesystem = true
+	opts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
+	if !opts.UsesS3() && !base.APIClient.IsLinked() {
+		return nil, errors.New("remote caching is not configured. Run `turbo link`, or configure an S3 bucket in turbo.json")
+	}
+	return cache.New(opts, base.RepoRoot, base.APIClient, analytics.NullRecorder, func(_ cache.Cache, err error) {
+		base.LogWarning("Remote Caching is unavailable", err)
+	})
+}
+
+// fetchArtifact restores the artifact with the given hash into a new temporary directory,
+// returning the directory, the files that were restored, and the duration recorded with
+// the artifact. The caller is responsible for removing the directory.
+func fetchArtifact(c cache.Cache, hash string) (turbopath.AbsoluteSystemPath, []turbopath.AnchoredSystemPath, int, error) {
+	tmp, err := ioutil.TempDir("", "turbo-cache-")
+	if err != nil {
+		return "", nil, 0, err
+	}
+	dir := turbopath.AbsoluteSystemPathFromUpstream(tmp)
+	hit, files, duration, err := c.Fetch(dir, hash, nil)
+	if err != nil {
+		_ = dir.RemoveAll()
+		return "", nil, 0, err
+	}
+	if !hit {
+		_ = dir.RemoveAll()
+		return "", nil, 0, fmt.Errorf("artifact %v not found", hash)
+	}
+	return dir, files, duration, nil
+}
+
+// printJSON renders v as indented JSON
+func printJSON(base *cmdutil.CmdBase, v interface{}) error {
+	rendered, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	base.UI.Output(string(rendered))
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package cachecmd implements the `turbo cache` family of subcommands
+package cachecmd
+
+import (
+	"fmt"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/signals"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+)
+
+// ExecuteCache executes the `cache` command and dispatches to its subcommands
+func ExecuteCache(helper *cmdutil.Helper, signalWatcher *signals.Watcher, args *turbostate.ParsedArgsFromRust) error {
+	base, err := helper.GetCmdBase(args)
+	if err != nil {
+		return err
+	}
+	if args.TestRun {
+		base.UI.Info("Cache test run successful")
+		return nil
+	}
+
+	payload := args.Command.Cache
+	opts := cache.Opts{
+		OverrideDir: payload.CacheDir,
+	}
+	switch payload.Command {
+	case "Clean":
+		return runClean(base, opts, payload)
+	case "Ls":
+		return runLs(base, opts, payload)
+	case "Inspect":
+		return runInspect(base, opts, payload)
+	case "Export":
+		return runExport(base, opts, payload)
+	case "Import":
+		return runImport(base, opts, payload)
+	case "Rm":
+		return runRm(base, opts, payload)
+	case "Serve":
+		return runServe(base, signalWatcher, opts, payload, args.Token)
+	case "Status":
+		return runStatus(base, opts, payload)
+	default:
+		return fmt.Errorf("unknown cache command: %v", payload.Command)
+	}
+}
+
+// formatBytes renders a byte count using binary units, e.g. 1.5 GB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
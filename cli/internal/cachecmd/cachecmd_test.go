@@ -0,0 +1,110 @@
+package cachecmd
+
+import (
+	"github.com/vercel/turbo/cli/internal/analytics"
+	"path/filepath"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1.0 KB",
+		1536:               "1.5 KB",
+		10 * 1024 * 1024:   "10.0 MB",
+		3 * 1024 * 1 << 30: "3.0 TB",
+	}
+	for input, expected := range cases {
+		if actual := formatBytes(input); actual != expected {
+			t.Errorf("formatBytes(%v) got %v, want %v", input, actual, expected)
+		}
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	source := turbopath.AbsoluteSystemPath(t.TempDir())
+	logFile := turbopath.AnchoredSystemPath(filepath.Join("apps", "web", ".turbo", "turbo-build.log"))
+	if err := logFile.RestoreAnchor(source).EnsureDir(); err != nil {
+		t.Fatalf("EnsureDir: %v", err)
+	}
+	if err := logFile.RestoreAnchor(source).WriteFile([]byte("building\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	openLocal := func(dir string) cache.Cache {
+		c, err := cache.New(cache.Opts{OverrideDir: dir, SkipRemote: true}, repoRoot, nil, analytics.NullRecorder, nil)
+		if err != nil {
+			t.Fatalf("cache.New: %v", err)
+		}
+		return c
+	}
+	exporting := openLocal("exporting")
+	if err := exporting.Put(source, "the-hash", 500, []turbopath.AnchoredSystemPath{logFile}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	dir, files, duration, err := fetchArtifact(exporting, "the-hash")
+	if err != nil {
+		t.Fatalf("fetchArtifact: %v", err)
+	}
+	defer func() { _ = dir.RemoveAll() }()
+	if duration != 500 {
+		t.Errorf("duration got %v, want 500", duration)
+	}
+	if len(files) != 1 || !isTaskLog(files[0]) {
+		t.Errorf("files got %v, want the task log", files)
+	}
+	if _, _, _, err := fetchArtifact(exporting, "missing"); err == nil {
+		t.Error("fetchArtifact of a missing hash got no error")
+	}
+
+	exported := repoRoot.UntypedJoin("out", "the-hash.tar.zst")
+	if err := exportArtifact(dir, files, exported); err != nil {
+		t.Fatalf("exportArtifact: %v", err)
+	}
+	importing := openLocal("importing")
+	hash := hashFromFilename(exported)
+	if hash != "the-hash" {
+		t.Errorf("hashFromFilename got %v, want the-hash", hash)
+	}
+	if err := importArtifact(importing, exported, hash); err != nil {
+		t.Fatalf("importArtifact: %v", err)
+	}
+
+	importedOpts := cache.Opts{OverrideDir: "importing"}
+	artifacts, err := cache.ListLocal(importedOpts, repoRoot)
+	if err != nil {
+		t.Fatalf("ListLocal: %v", err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Hash != "the-hash" {
+		t.Fatalf("ListLocal got %v, want the-hash", artifacts)
+	}
+	removed, err := cache.RemoveLocal(importedOpts, repoRoot, "the-hash")
+	if err != nil || !removed {
+		t.Errorf("RemoveLocal got %v, %v, want true", removed, err)
+	}
+	removed, err = cache.RemoveLocal(importedOpts, repoRoot, "the-hash")
+	if err != nil || removed {
+		t.Errorf("second RemoveLocal got %v, %v, want false", removed, err)
+	}
+}
+
+func TestImportRejectsInvalidArtifact(t *testing.T) {
+	repoRoot := turbopath.AbsoluteSystemPath(t.TempDir())
+	invalid := repoRoot.UntypedJoin("invalid.tar")
+	if err := invalid.WriteFile([]byte("not a tarball"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	c, err := cache.New(cache.Opts{SkipRemote: true}, repoRoot, nil, analytics.NullRecorder, nil)
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	if err := importArtifact(c, invalid, "invalid"); err == nil {
+		t.Error("importArtifact of an invalid tarball got no error")
+	}
+}
@@ -0,0 +1,48 @@
+package cachecmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// runClean executes `turbo cache clean`, evicting artifacts from the local
+// filesystem cache according to the configured size and age limits.
+func runClean(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	// Flags take precedence over the environment
+	if err := opts.SetEvictionPolicyFromEnv(); err != nil {
+		return err
+	}
+	if payload.MaxSize != "" {
+		maxSize, err := util.ParseByteSize(payload.MaxSize)
+		if err != nil {
+			return fmt.Errorf("--max-size: %w", err)
+		}
+		opts.MaxSize = maxSize
+	}
+	if payload.MaxAge != "" {
+		maxAge, err := util.ParseDurationWithDays(payload.MaxAge)
+		if err != nil {
+			return fmt.Errorf("--max-age: %w", err)
+		}
+		opts.MaxAge = maxAge
+	}
+	if !payload.All && opts.MaxSize == 0 && opts.MaxAge == 0 {
+		return errors.New("no eviction limits are configured. Pass --max-size, --max-age, or --all, or set TURBO_CACHE_MAX_SIZE or TURBO_CACHE_MAX_AGE")
+	}
+
+	summary, err := cache.CleanLocal(opts, base.RepoRoot, payload.All)
+	if err != nil {
+		return err
+	}
+	if payload.JSON {
+		return printJSON(base, summary)
+	}
+	base.UI.Output(fmt.Sprintf("Removed %v artifacts (%v)", summary.Removed, formatBytes(summary.RemovedBytes)))
+	base.UI.Output(fmt.Sprintf("%v artifacts remaining (%v)", summary.Remaining, formatBytes(summary.RemainingBytes)))
+	return nil
+}
@@ -0,0 +1,129 @@
+package cachecmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cacheitem"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+)
+
+// runExport executes `turbo cache export`, writing an artifact out as a portable
+// tarball that `turbo cache import` can read.
+func runExport(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	c, err := openCache(base, opts, payload.Remote)
+	if err != nil {
+		return err
+	}
+	defer c.Shutdown()
+	dir, files, _, err := fetchArtifact(c, payload.Hash)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dir.RemoveAll() }()
+
+	output := payload.Output
+	if output == "" {
+		output = payload.Hash + ".tar.zst"
+	}
+	cwd, err := fs.GetCwd("")
+	if err != nil {
+		return err
+	}
+	outputPath := fs.ResolveUnknownPath(cwd, output)
+	if err := exportArtifact(dir, files, outputPath); err != nil {
+		return err
+	}
+	if payload.JSON {
+		return printJSON(base, map[string]string{"hash": payload.Hash, "file": outputPath.ToString()})
+	}
+	base.UI.Output(fmt.Sprintf("Exported %v to %v", payload.Hash, outputPath))
+	return nil
+}
+
+// exportArtifact writes the given files, restored under dir, to a tarball at outputPath
+func exportArtifact(dir turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath, outputPath turbopath.AbsoluteSystemPath) error {
+	if err := outputPath.Dir().MkdirAll(0755); err != nil {
+		return err
+	}
+	item, err := cacheitem.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := item.AddFile(dir, file); err != nil {
+			_ = item.Close()
+			_ = outputPath.Remove()
+			return err
+		}
+	}
+	return item.Close()
+}
+
+// runImport executes `turbo cache import`, adding a tarball produced by
+// `turbo cache export` to the local cache, or the remote cache.
+func runImport(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	cwd, err := fs.GetCwd("")
+	if err != nil {
+		return err
+	}
+	inputPath := fs.ResolveUnknownPath(cwd, payload.File)
+	hash := payload.Hash
+	if hash == "" {
+		hash = hashFromFilename(inputPath)
+	}
+
+	c, err := openCache(base, opts, payload.Remote)
+	if err != nil {
+		return err
+	}
+	defer c.Shutdown()
+	if err := importArtifact(c, inputPath, hash); err != nil {
+		return err
+	}
+	if payload.JSON {
+		return printJSON(base, map[string]string{"hash": hash, "file": inputPath.ToString()})
+	}
+	base.UI.Output(fmt.Sprintf("Imported %v as %v", inputPath, hash))
+	return nil
+}
+
+// importArtifact restores the tarball at inputPath into a temporary directory, which
+// also validates it, and then puts those files into c under the given hash.
+func importArtifact(c cache.Cache, inputPath turbopath.AbsoluteSystemPath, hash string) error {
+	tmp, err := ioutil.TempDir("", "turbo-cache-")
+	if err != nil {
+		return err
+	}
+	dir := turbopath.AbsoluteSystemPathFromUpstream(tmp)
+	defer func() { _ = dir.RemoveAll() }()
+
+	item, err := cacheitem.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	files, err := item.Restore(dir)
+	_ = item.Close()
+	if err != nil {
+		return fmt.Errorf("%v is not a valid cache artifact: %w", inputPath, err)
+	}
+	// The original duration isn't part of the tarball
+	return c.Put(dir, hash, 0, files)
+}
+
+// hashFromFilename returns the hash for an exported artifact named after it, e.g. <hash>.tar.zst
+func hashFromFilename(path turbopath.AbsoluteSystemPath) string {
+	name := filepath.Base(path.ToString())
+	for _, suffix := range []string{".tar.zst", ".tar"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
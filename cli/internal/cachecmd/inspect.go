@@ -0,0 +1,101 @@
+package cachecmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+)
+
+// artifactDetails is the output of `turbo cache inspect`
+type artifactDetails struct {
+	Hash string `json:"hash"`
+	// Duration is how long the task took to run in milliseconds
+	Duration int `json:"duration"`
+	// Local is only set for artifacts in the local cache
+	Local *cache.LocalArtifact `json:"local,omitempty"`
+	Files []string             `json:"files"`
+	// Logs maps the path of each task log in the artifact to its contents
+	Logs map[string]string `json:"logs"`
+}
+
+// runInspect executes `turbo cache inspect`, showing the metadata, files and
+// logs of a single artifact.
+func runInspect(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	details := &artifactDetails{Hash: payload.Hash, Logs: map[string]string{}}
+	if !payload.Remote {
+		// Read this before fetching, which counts as a use
+		artifacts, err := cache.ListLocal(opts, base.RepoRoot)
+		if err != nil {
+			return err
+		}
+		for _, artifact := range artifacts {
+			if artifact.Hash == payload.Hash {
+				details.Local = artifact
+				break
+			}
+		}
+	}
+
+	c, err := openCache(base, opts, payload.Remote)
+	if err != nil {
+		return err
+	}
+	defer c.Shutdown()
+	dir, files, duration, err := fetchArtifact(c, payload.Hash)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dir.RemoveAll() }()
+
+	details.Duration = duration
+	details.Files = make([]string, 0, len(files))
+	for _, file := range files {
+		details.Files = append(details.Files, file.ToUnixPath().ToString())
+		if isTaskLog(file) {
+			contents, err := file.RestoreAnchor(dir).ReadFile()
+			if err != nil {
+				return err
+			}
+			details.Logs[file.ToUnixPath().ToString()] = string(contents)
+		}
+	}
+
+	if payload.JSON {
+		return printJSON(base, details)
+	}
+	base.UI.Output(fmt.Sprintf("Hash: %v", details.Hash))
+	base.UI.Output(fmt.Sprintf("Saves: %v", time.Duration(details.Duration)*time.Millisecond))
+	if details.Local != nil {
+		base.UI.Output(fmt.Sprintf("Size: %v", formatBytes(details.Local.Size)))
+		base.UI.Output(fmt.Sprintf("Last used: %v", details.Local.LastUsed.Format(time.RFC3339)))
+		if details.Local.Sha != "" {
+			base.UI.Output(fmt.Sprintf("SHA-512: %v", details.Local.Sha))
+		}
+	}
+	base.UI.Output(fmt.Sprintf("Files (%v):", len(details.Files)))
+	for _, file := range details.Files {
+		base.UI.Output("  " + file)
+	}
+	for _, file := range details.Files {
+		if log, ok := details.Logs[file]; ok {
+			base.UI.Output("")
+			base.UI.Output(fmt.Sprintf("Logs from %v:", file))
+			base.UI.Output(strings.TrimRight(log, "\n"))
+		}
+	}
+	return nil
+}
+
+// isTaskLog returns true for the log files that turbo saves alongside task outputs,
+// which are named .turbo/turbo-<task>.log
+func isTaskLog(file turbopath.AnchoredSystemPath) bool {
+	name := filepath.Base(file.ToString())
+	parent := filepath.Base(filepath.Dir(file.ToString()))
+	return parent == ".turbo" && strings.HasPrefix(name, "turbo-") && strings.HasSuffix(name, ".log")
+}
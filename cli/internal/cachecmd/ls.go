@@ -0,0 +1,99 @@
+package cachecmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+)
+
+// artifactListing is a row of `turbo cache ls` output
+type artifactListing struct {
+	*cache.LocalArtifact
+	// Local is false for hashes that were asked about but aren't in the local cache
+	Local bool `json:"local"`
+	// Remote is only set when the remote cache was checked
+	Remote *bool `json:"remote,omitempty"`
+}
+
+// runLs executes `turbo cache ls`, listing the artifacts in the local cache, or
+// the status of the given hashes.
+func runLs(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	artifacts, err := cache.ListLocal(opts, base.RepoRoot)
+	if err != nil {
+		return err
+	}
+	listings := make([]*artifactListing, 0, len(artifacts))
+	if len(payload.Hashes) == 0 {
+		for _, artifact := range artifacts {
+			listings = append(listings, &artifactListing{LocalArtifact: artifact, Local: true})
+		}
+	} else {
+		byHash := make(map[string]*cache.LocalArtifact, len(artifacts))
+		for _, artifact := range artifacts {
+			byHash[artifact.Hash] = artifact
+		}
+		for _, hash := range payload.Hashes {
+			if artifact, ok := byHash[hash]; ok {
+				listings = append(listings, &artifactListing{LocalArtifact: artifact, Local: true})
+			} else {
+				listings = append(listings, &artifactListing{LocalArtifact: &cache.LocalArtifact{Hash: hash}})
+			}
+		}
+	}
+
+	if payload.Remote {
+		remoteCache, err := openCache(base, opts, true)
+		if err != nil {
+			return err
+		}
+		defer remoteCache.Shutdown()
+		hashes := make([]string, len(listings))
+		for i, listing := range listings {
+			hashes[i] = listing.Hash
+		}
+		statuses, err := remoteCache.BatchExists(hashes)
+		if err != nil {
+			return err
+		}
+		for _, listing := range listings {
+			exists := statuses[listing.Hash].Remote
+			listing.Remote = &exists
+		}
+	}
+
+	if payload.JSON {
+		return printJSON(base, listings)
+	}
+	if len(listings) == 0 {
+		base.UI.Output("No artifacts in the local cache")
+		return nil
+	}
+	now := time.Now()
+	for _, listing := range listings {
+		base.UI.Output(formatListing(listing, now))
+	}
+	return nil
+}
+
+func formatListing(listing *artifactListing, now time.Time) string {
+	var location string
+	switch {
+	case listing.Local && listing.Remote != nil && *listing.Remote:
+		location = "local, remote"
+	case listing.Local:
+		location = "local"
+	case listing.Remote != nil && *listing.Remote:
+		location = "remote"
+	default:
+		return fmt.Sprintf("%v  not found", listing.Hash)
+	}
+	if !listing.Local {
+		return fmt.Sprintf("%v  %v", listing.Hash, location)
+	}
+	age := now.Sub(listing.LastUsed).Truncate(time.Second)
+	saved := time.Duration(listing.Duration) * time.Millisecond
+	return fmt.Sprintf("%v  %v  %v  used %v ago  saves %v", listing.Hash, location, formatBytes(listing.Size), age, saved)
+}
@@ -0,0 +1,40 @@
+package cachecmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+)
+
+// removeSummary is the outcome of `turbo cache rm`
+type removeSummary struct {
+	Removed  []string `json:"removed"`
+	NotFound []string `json:"notFound"`
+}
+
+// runRm executes `turbo cache rm`, removing specific artifacts from the local cache
+func runRm(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	summary := &removeSummary{Removed: []string{}, NotFound: []string{}}
+	for _, hash := range payload.Hashes {
+		removed, err := cache.RemoveLocal(opts, base.RepoRoot, hash)
+		if err != nil {
+			return fmt.Errorf("failed to remove %v: %w", hash, err)
+		}
+		if removed {
+			summary.Removed = append(summary.Removed, hash)
+		} else {
+			summary.NotFound = append(summary.NotFound, hash)
+		}
+	}
+	if payload.JSON {
+		return printJSON(base, summary)
+	}
+	base.UI.Output(fmt.Sprintf("Removed %v artifacts", len(summary.Removed)))
+	if len(summary.NotFound) > 0 {
+		base.UI.Warn(fmt.Sprintf("Not in the local cache: %v", strings.Join(summary.NotFound, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cachecmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/signals"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// _shutdownTimeout is how long in-flight requests get to finish once the server is stopped
+const _shutdownTimeout = 10 * time.Second
+
+// runServe executes `turbo cache serve`, serving the local filesystem cache over the
+// Remote Caching API until interrupted.
+func runServe(base *cmdutil.CmdBase, signalWatcher *signals.Watcher, opts cache.Opts, payload *turbostate.CachePayload, token string) error {
+	if token == "" {
+		token = os.Getenv("TURBO_TOKEN")
+	}
+	var tokens []string
+	for _, t := range strings.Split(token, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return errors.New("a token is required to serve the cache. Pass --token, or set TURBO_TOKEN")
+	}
+	if err := opts.SetEvictionPolicyFromEnv(); err != nil {
+		return err
+	}
+	var maxUploadSize int64
+	if payload.MaxUploadSize != "" {
+		size, err := util.ParseByteSize(payload.MaxUploadSize)
+		if err != nil {
+			return fmt.Errorf("--max-upload-size: %w", err)
+		}
+		maxUploadSize = size
+	}
+	server, err := cache.NewServer(opts, base.RepoRoot, tokens, maxUploadSize, base.Logger.Named("cache-server"))
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(payload.Port)))
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Signal handlers run before turbo exits, so in-flight uploads are finished here
+	signalWatcher.AddOnClose(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), _shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(ctx)
+	})
+
+	base.UI.Output(fmt.Sprintf("Serving %v at http://%v", server.Directory(), listener.Addr()))
+	base.UI.Output(fmt.Sprintf("Point turbo at it with --api=http://%v --token=<token> --team=<any team>", listener.Addr()))
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
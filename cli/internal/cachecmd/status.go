@@ -0,0 +1,83 @@
+package cachecmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/ui"
+)
+
+// uploadStatus is the output of `turbo cache status`
+type uploadStatus struct {
+	Pending []*cache.SpoolEntry `json:"pending"`
+	Failed  []*cache.SpoolEntry `json:"failed"`
+	// Retried is how many failed uploads --retry marked to be tried again
+	Retried int `json:"retried"`
+}
+
+// runStatus executes `turbo cache status`, listing the remote cache uploads spooled in
+// the cache directory, and optionally marking the failed ones to be retried.
+func runStatus(base *cmdutil.CmdBase, opts cache.Opts, payload *turbostate.CachePayload) error {
+	status := &uploadStatus{Pending: []*cache.SpoolEntry{}, Failed: []*cache.SpoolEntry{}}
+	if payload.Retry {
+		retried, err := cache.RetryFailedUploads(opts, base.RepoRoot)
+		if err != nil {
+			return fmt.Errorf("failed to retry uploads: %w", err)
+		}
+		status.Retried = retried
+	}
+	entries, err := cache.ListSpool(opts, base.RepoRoot)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Failed {
+			status.Failed = append(status.Failed, entry)
+		} else {
+			status.Pending = append(status.Pending, entry)
+		}
+	}
+
+	if payload.JSON {
+		return printJSON(base, status)
+	}
+	if payload.Retry {
+		base.UI.Output(fmt.Sprintf("Marked %v failed uploads to be retried", status.Retried))
+	}
+	if len(entries) == 0 {
+		base.UI.Output("No remote cache uploads are waiting to be sent")
+		return nil
+	}
+	now := time.Now()
+	if len(status.Pending) > 0 {
+		base.UI.Output(ui.Bold(fmt.Sprintf("Pending uploads (%v)", len(status.Pending))))
+		for _, entry := range status.Pending {
+			base.UI.Output(formatSpoolEntry(entry, now))
+		}
+	}
+	if len(status.Failed) > 0 {
+		base.UI.Output(ui.Bold(fmt.Sprintf("Failed uploads (%v)", len(status.Failed))))
+		for _, entry := range status.Failed {
+			base.UI.Output(formatSpoolEntry(entry, now))
+		}
+		base.UI.Output(ui.Dim("Run `turbo cache status --retry` to try them again"))
+	}
+	return nil
+}
+
+func formatSpoolEntry(entry *cache.SpoolEntry, now time.Time) string {
+	line := fmt.Sprintf("%v  %v  %v  queued %v ago", entry.Hash, entry.Destination, formatBytes(entry.Size), now.Sub(entry.Created).Truncate(time.Second))
+	if entry.Attempts > 0 {
+		line += fmt.Sprintf("  %v attempts", entry.Attempts)
+	}
+	if !entry.Failed && entry.NextAttempt.After(now) {
+		line += fmt.Sprintf("  retry in %v", entry.NextAttempt.Sub(now).Truncate(time.Second))
+	}
+	if entry.LastError != "" {
+		line += fmt.Sprintf("  last error: %v", entry.LastError)
+	}
+	return line
+}
@@ -0,0 +1,218 @@
+package cacheitem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/moby/sys/sequential"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// errReflinkUnsupported is returned when the platform or filesystem can't clone files.
+var errReflinkUnsupported = errors.New("reflinks are not supported")
+
+// ErrBlobCorrupt is returned when a blob's contents no longer match its digest.
+var ErrBlobCorrupt = errors.New("blob does not match its digest")
+
+// _blobMode is the mode that blobs are stored with. Most outputs have this mode,
+// so they can be restored by hardlinking the blob, which shares its mode.
+const _blobMode os.FileMode = 0644
+
+// BlobStore is a directory of files keyed by the SHA-256 of their contents.
+// Identical files from any number of artifacts are stored once.
+type BlobStore struct {
+	dir turbopath.AbsoluteSystemPath
+	// allowHardlinks restores blobs by hardlinking them into place when they
+	// can't be cloned. This is fast but unsafe if something later modifies the
+	// restored file in place, since that also modifies the blob.
+	allowHardlinks bool
+}
+
+// NewBlobStore returns a BlobStore rooted at dir. The directory is created lazily.
+func NewBlobStore(dir turbopath.AbsoluteSystemPath, allowHardlinks bool) *BlobStore {
+	return &BlobStore{
+		dir:            dir,
+		allowHardlinks: allowHardlinks,
+	}
+}
+
+// Path returns the location on disk of the blob with the given digest.
+func (bs *BlobStore) Path(digest string) turbopath.AbsoluteSystemPath {
+	if len(digest) < 2 {
+		return bs.dir.UntypedJoin(digest)
+	}
+	return bs.dir.UntypedJoin(digest[:2], digest)
+}
+
+// Has returns true if the blob with the given digest is present.
+func (bs *BlobStore) Has(digest string) bool {
+	return bs.Path(digest).FileExists()
+}
+
+// AddFile stores the contents of source, returning its digest and size.
+func (bs *BlobStore) AddFile(source turbopath.AbsoluteSystemPath) (string, int64, error) {
+	// Windows has a distinct "sequential read" opening mode.
+	// We use a library that will switch to this mode for Windows.
+	sourceFile, err := sequential.OpenFile(source.ToString(), os.O_RDONLY, 0777)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = sourceFile.Close() }()
+	return bs.Add(sourceFile)
+}
+
+// Add stores the contents of r, returning its digest and size.
+// If a blob with the same contents already exists, it is reused.
+func (bs *BlobStore) Add(r io.Reader) (string, int64, error) {
+	if err := bs.dir.MkdirAll(0755); err != nil {
+		return "", 0, err
+	}
+	// Write to a temporary file first so that a blob is never visible
+	// at its final path with partial contents.
+	tmp, err := ioutil.TempFile(bs.dir.ToString(), ".tmp-")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpPath := turbopath.AbsoluteSystemPathFromUpstream(tmp.Name())
+	defer func() { _ = tmpPath.Remove() }()
+
+	sha := sha256.New()
+	size, copyErr := io.Copy(io.MultiWriter(tmp, sha), r)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		return "", 0, copyErr
+	}
+	if closeErr != nil {
+		return "", 0, closeErr
+	}
+	if err := tmpPath.Chmod(_blobMode); err != nil {
+		return "", 0, err
+	}
+
+	digest := hex.EncodeToString(sha.Sum(nil))
+	blobPath := bs.Path(digest)
+	if blobPath.FileExists() {
+		// Deduplicated. Leave the existing blob's contents alone, but mark it as recently
+		// used so that garbage collection doesn't remove it before its new manifest is written.
+		// The temporary file is cleaned up above.
+		now := time.Now()
+		_ = blobPath.Chtimes(now, now)
+		return digest, size, nil
+	}
+	if err := blobPath.EnsureDir(); err != nil {
+		return "", 0, err
+	}
+	if err := tmpPath.Rename(blobPath); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// Verify checks that the blob with the given digest exists, has the given size,
+// and that its contents still hash to its digest.
+func (bs *BlobStore) Verify(digest string, size int64) error {
+	blob, err := bs.Open(digest)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = blob.Close() }()
+
+	sha := sha256.New()
+	actualSize, err := io.Copy(sha, blob)
+	if err != nil {
+		return err
+	}
+	if actualSize != size || hex.EncodeToString(sha.Sum(nil)) != digest {
+		return fmt.Errorf("%w: %v", ErrBlobCorrupt, digest)
+	}
+	return nil
+}
+
+// Open opens the blob with the given digest for reading.
+func (bs *BlobStore) Open(digest string) (*os.File, error) {
+	return sequential.OpenFile(bs.Path(digest).ToString(), os.O_RDONLY, 0777)
+}
+
+// Remove deletes the blob with the given digest.
+func (bs *BlobStore) Remove(digest string) error {
+	if err := bs.Path(digest).Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Walk calls fn for every blob in the store.
+func (bs *BlobStore) Walk(fn func(digest string, info os.FileInfo) error) error {
+	if !bs.dir.DirExists() {
+		return nil
+	}
+	return filepath.Walk(bs.dir.ToString(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || filepath.Dir(path) == bs.dir.ToString() {
+			// Skip directories, and temporary files at the top level.
+			return nil
+		}
+		return fn(info.Name(), info)
+	})
+}
+
+// restore places the blob with the given digest at target. It prefers cloning the
+// blob, which is instant on copy-on-write filesystems, then hardlinking if allowed,
+// and finally falls back to a plain copy.
+func (bs *BlobStore) restore(digest string, target turbopath.AbsoluteSystemPath, mode os.FileMode) error {
+	source := bs.Path(digest)
+	// Never write through an existing file: if it is a hardlink to a blob,
+	// truncating it would corrupt the blob.
+	if err := target.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := reflink(source, target); err == nil {
+		return target.Chmod(mode)
+	}
+	// A hardlink shares the blob's mode, and chmodding it would change the blob and
+	// every other file linked to it, so only link blobs that already have mode.
+	if bs.allowHardlinks && bs.hasMode(source, mode) {
+		if err := target.Link(source); err == nil {
+			return nil
+		}
+	}
+	return bs.copy(source, target, mode)
+}
+
+// hasMode returns whether the blob at source has the permissions in mode.
+func (bs *BlobStore) hasMode(source turbopath.AbsoluteSystemPath, mode os.FileMode) bool {
+	info, err := source.Lstat()
+	if err != nil {
+		return false
+	}
+	return info.Mode().Perm() == mode.Perm()
+}
+
+func (bs *BlobStore) copy(source turbopath.AbsoluteSystemPath, target turbopath.AbsoluteSystemPath, mode os.FileMode) error {
+	sourceFile, err := sequential.OpenFile(source.ToString(), os.O_RDONLY, 0777)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sourceFile.Close() }()
+	targetFile, err := target.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(targetFile, sourceFile); err != nil {
+		_ = targetFile.Close()
+		return err
+	}
+	return targetFile.Close()
+}
@@ -66,11 +66,19 @@ func (ci *CacheItem) Close() error {
 }
 
 // GetSha returns the SHA-512 hash for the CacheItem.
+// The CacheItem is rewound afterwards so that it can still be restored.
 func (ci *CacheItem) GetSha() ([]byte, error) {
+	if _, err := ci.handle.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
 	sha := sha512.New()
 	if _, err := io.Copy(sha, ci.handle); err != nil {
 		return nil, err
 	}
 
+	if _, err := ci.handle.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 	return sha.Sum(nil), nil
 }
@@ -0,0 +1,251 @@
+package cacheitem
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/vercel/turbo/cli/internal/tarpatch"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// Manifest describes a cached artifact whose regular files are stored as
+// deduplicated blobs in a BlobStore, rather than inline in a tar.
+// The entries mirror, in order, the headers of the equivalent tar.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is a single file, directory, or symlink in a Manifest.
+type ManifestEntry struct {
+	// Name is the posix-style anchored path, with a trailing slash for directories.
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Mode     int64  `json:"mode"`
+	Linkname string `json:"linkname,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// Digest is the SHA-256 of the contents of a regular file, which is its key in the BlobStore.
+	Digest string `json:"digest,omitempty"`
+}
+
+const (
+	_manifestTypeFile    = "file"
+	_manifestTypeDir     = "dir"
+	_manifestTypeSymlink = "symlink"
+)
+
+var errUnknownManifestType = errors.New("manifest entry has an unknown type")
+
+// ReadManifest reads a Manifest from disk.
+func ReadManifest(path turbopath.AbsoluteSystemPath) (*Manifest, error) {
+	contents, err := path.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(contents, manifest); err != nil {
+		return nil, fmt.Errorf("invalid cache manifest %v: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Write atomically writes the Manifest to disk, so that a reader never sees a partial manifest.
+func (m *Manifest) Write(path turbopath.AbsoluteSystemPath) error {
+	contents, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(path.Dir().ToString(), ".tmp-manifest-")
+	if err != nil {
+		return err
+	}
+	tmpPath := turbopath.AbsoluteSystemPathFromUpstream(tmp.Name())
+	defer func() { _ = tmpPath.Remove() }()
+	_, writeErr := tmp.Write(contents)
+	closeErr := tmp.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return tmpPath.Rename(path)
+}
+
+// Digests returns the digests of every blob referenced by the Manifest.
+func (m *Manifest) Digests() []string {
+	digests := []string{}
+	for _, entry := range m.Entries {
+		if entry.Digest != "" {
+			digests = append(digests, entry.Digest)
+		}
+	}
+	return digests
+}
+
+// AddFile adds a user-cached item to the Manifest, storing its contents in blobs.
+// It produces the same header information as CacheItem.AddFile.
+func (m *Manifest) AddFile(blobs *BlobStore, fsAnchor turbopath.AbsoluteSystemPath, filePath turbopath.AnchoredSystemPath) error {
+	sourcePath := filePath.RestoreAnchor(fsAnchor)
+
+	fileInfo, lstatErr := sourcePath.Lstat()
+	if lstatErr != nil {
+		return lstatErr
+	}
+
+	var link string
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		linkTarget, readlinkErr := sourcePath.Readlink()
+		if readlinkErr != nil {
+			return readlinkErr
+		}
+		link = linkTarget
+	}
+
+	header, headerErr := tarpatch.FileInfoHeader(filePath.ToUnixPath(), fileInfo, link)
+	if headerErr != nil {
+		return headerErr
+	}
+
+	var digest string
+	if header.Typeflag == tar.TypeReg && header.Size > 0 {
+		var size int64
+		var err error
+		digest, size, err = blobs.AddFile(sourcePath)
+		if err != nil {
+			return err
+		}
+		// The file may have changed size between the Lstat and reading it.
+		header.Size = size
+	}
+	return m.addHeader(header, digest)
+}
+
+// addHeader appends an entry for the given tar header, whose contents, if any, are in the given blob.
+func (m *Manifest) addHeader(header *tar.Header, digest string) error {
+	entry := ManifestEntry{
+		Name:     header.Name,
+		Mode:     header.Mode,
+		Linkname: header.Linkname,
+	}
+	switch header.Typeflag {
+	case tar.TypeReg:
+		entry.Type = _manifestTypeFile
+		entry.Size = header.Size
+		entry.Digest = digest
+	case tar.TypeDir:
+		entry.Type = _manifestTypeDir
+	case tar.TypeSymlink:
+		entry.Type = _manifestTypeSymlink
+	default:
+		return errUnsupportedFileType
+	}
+	m.Entries = append(m.Entries, entry)
+	return nil
+}
+
+// header reconstructs the tar header that CacheItem.AddFile would have written for this entry.
+func (e *ManifestEntry) header() (*tar.Header, error) {
+	header := &tar.Header{
+		Name:       e.Name,
+		Mode:       e.Mode,
+		Linkname:   e.Linkname,
+		Format:     tar.FormatPAX,
+		AccessTime: time.Unix(0, 0),
+		ModTime:    time.Unix(0, 0),
+		ChangeTime: time.Unix(0, 0),
+	}
+	switch e.Type {
+	case _manifestTypeFile:
+		header.Typeflag = tar.TypeReg
+		header.Size = e.Size
+	case _manifestTypeDir:
+		header.Typeflag = tar.TypeDir
+	case _manifestTypeSymlink:
+		header.Typeflag = tar.TypeSymlink
+	default:
+		return nil, errUnknownManifestType
+	}
+	return header, nil
+}
+
+// Restore places the contents of the Manifest at anchor, restoring only the entries
+// for which include returns true. A nil include restores every entry. Regular files
+// are cloned, linked, or copied out of blobs.
+func (m *Manifest) Restore(blobs *BlobStore, anchor turbopath.AbsoluteSystemPath, include func(turbopath.AnchoredSystemPath) bool) ([]turbopath.AnchoredSystemPath, error) {
+	restored := make([]turbopath.AnchoredSystemPath, 0)
+	if err := anchor.MkdirAll(0755); err != nil {
+		return nil, err
+	}
+	dirCache := &cachedDirTree{
+		anchorAtDepth: []turbopath.AbsoluteSystemPath{anchor},
+	}
+
+	var symlinks []*tar.Header
+	for _, entry := range m.Entries {
+		header, err := entry.header()
+		if err != nil {
+			return restored, err
+		}
+		processedName, err := canonicalizeName(header.Name)
+		if err != nil {
+			return restored, err
+		}
+		if include != nil && !include(processedName) {
+			continue
+		}
+
+		var file turbopath.AnchoredSystemPath
+		switch header.Typeflag {
+		case tar.TypeDir:
+			file, err = restoreDirectory(dirCache, anchor, header)
+		case tar.TypeSymlink:
+			file, err = restoreSymlink(dirCache, anchor, header)
+			if errors.Is(err, errMissingSymlinkTarget) {
+				// Links get one shot to be valid, then they're accumulated, DAG'd, and restored on delay.
+				symlinks = append(symlinks, header)
+				continue
+			}
+		case tar.TypeReg:
+			file, err = restoreBlob(dirCache, blobs, anchor, processedName, &entry)
+		}
+		if err != nil {
+			return restored, err
+		}
+		restored = append(restored, file)
+	}
+
+	symlinksRestored, err := topologicallyRestoreSymlinks(dirCache, anchor, symlinks, nil)
+	restored = append(restored, symlinksRestored...)
+	return restored, err
+}
+
+// restoreBlob restores a regular file from the BlobStore.
+func restoreBlob(dirCache *cachedDirTree, blobs *BlobStore, anchor turbopath.AbsoluteSystemPath, processedName turbopath.AnchoredSystemPath, entry *ManifestEntry) (turbopath.AnchoredSystemPath, error) {
+	// We need to traverse `processedName` from base to root split at
+	// `os.Separator` to make sure we don't end up following a symlink
+	// outside of the restore path.
+	if err := safeMkdirFile(dirCache, anchor, processedName, entry.Mode); err != nil {
+		return "", err
+	}
+	target := processedName.RestoreAnchor(anchor)
+	if entry.Digest == "" {
+		// Empty files aren't stored as blobs.
+		if err := target.Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		f, err := target.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(entry.Mode))
+		if err != nil {
+			return "", err
+		}
+		return processedName, f.Close()
+	}
+	if err := blobs.restore(entry.Digest, target, os.FileMode(entry.Mode)); err != nil {
+		return "", err
+	}
+	return processedName, nil
+}
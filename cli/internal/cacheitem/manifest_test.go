@@ -0,0 +1,129 @@
+package cacheitem
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"gotest.tools/v3/assert"
+)
+
+// writeManifestFixture creates:
+//
+//	dist/
+//	dist/a.js
+//	dist/b.js     (same contents as a.js)
+//	dist/empty
+//	dist/link -> a.js
+func writeManifestFixture(t *testing.T, anchor turbopath.AbsoluteSystemPath) []turbopath.AnchoredSystemPath {
+	t.Helper()
+	dist := anchor.UntypedJoin("dist")
+	assert.NilError(t, dist.MkdirAll(0755), "MkdirAll")
+	assert.NilError(t, dist.UntypedJoin("a.js").WriteFile([]byte("shared contents"), 0644), "WriteFile")
+	assert.NilError(t, dist.UntypedJoin("b.js").WriteFile([]byte("shared contents"), 0755), "WriteFile")
+	assert.NilError(t, dist.UntypedJoin("empty").WriteFile(nil, 0644), "WriteFile")
+	assert.NilError(t, dist.UntypedJoin("link").Symlink("a.js"), "Symlink")
+	return []turbopath.AnchoredSystemPath{
+		turbopath.AnchoredUnixPath("dist/").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/a.js").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/b.js").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/empty").ToSystemPath(),
+		turbopath.AnchoredUnixPath("dist/link").ToSystemPath(),
+	}
+}
+
+func TestManifest_Restore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	files := writeManifestFixture(t, src)
+
+	blobs := NewBlobStore(turbopath.AbsoluteSystemPath(t.TempDir()), false)
+	manifest := &Manifest{}
+	for _, file := range files {
+		assert.NilError(t, manifest.AddFile(blobs, src, file), "AddFile")
+	}
+	// a.js and b.js share a blob, and empty files aren't stored at all.
+	digests := manifest.Digests()
+	assert.Equal(t, len(digests), 2)
+	assert.Equal(t, digests[0], digests[1])
+	blobCount := 0
+	assert.NilError(t, blobs.Walk(func(string, os.FileInfo) error {
+		blobCount++
+		return nil
+	}), "Walk")
+	assert.Equal(t, blobCount, 1)
+
+	manifestPath := turbopath.AbsoluteSystemPath(t.TempDir()).UntypedJoin("manifest.json")
+	assert.NilError(t, manifest.Write(manifestPath), "Write")
+	manifest, err := ReadManifest(manifestPath)
+	assert.NilError(t, err, "ReadManifest")
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	restored, err := manifest.Restore(blobs, dst, nil)
+	assert.NilError(t, err, "Restore")
+	assert.Equal(t, len(restored), len(files))
+
+	contents, err := dst.UntypedJoin("dist", "b.js").ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(contents), "shared contents")
+	info, err := dst.UntypedJoin("dist", "b.js").Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0755))
+	linkTarget, err := dst.UntypedJoin("dist", "link").Readlink()
+	assert.NilError(t, err, "Readlink")
+	assert.Equal(t, linkTarget, "a.js")
+	assert.Assert(t, dst.UntypedJoin("dist", "empty").FileExists())
+
+	// Restoring must never modify the blob, even when overwriting a restored file.
+	assert.NilError(t, dst.UntypedJoin("dist", "a.js").WriteFile([]byte("modified"), 0644), "WriteFile")
+	_, err = manifest.Restore(blobs, dst, nil)
+	assert.NilError(t, err, "Restore")
+	blobContents, err := blobs.Path(digests[0]).ReadFile()
+	assert.NilError(t, err, "ReadFile")
+	assert.Equal(t, string(blobContents), "shared contents")
+
+	// Filtered restore
+	filtered := turbopath.AbsoluteSystemPath(t.TempDir())
+	restored, err = manifest.Restore(blobs, filtered, func(file turbopath.AnchoredSystemPath) bool {
+		return file == turbopath.AnchoredUnixPath("dist/a.js").ToSystemPath()
+	})
+	assert.NilError(t, err, "Restore")
+	assert.DeepEqual(t, restored, []turbopath.AnchoredSystemPath{turbopath.AnchoredUnixPath("dist/a.js").ToSystemPath()})
+	assert.Assert(t, !filtered.UntypedJoin("dist", "b.js").FileExists())
+}
+
+func TestManifest_RestoreHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+	src := turbopath.AbsoluteSystemPath(t.TempDir())
+	files := writeManifestFixture(t, src)
+
+	blobs := NewBlobStore(turbopath.AbsoluteSystemPath(t.TempDir()), true)
+	manifest := &Manifest{}
+	for _, file := range files {
+		assert.NilError(t, manifest.AddFile(blobs, src, file), "AddFile")
+	}
+	digests := manifest.Digests()
+	blobPath := blobs.Path(digests[0])
+
+	dst := turbopath.AbsoluteSystemPath(t.TempDir())
+	_, err := manifest.Restore(blobs, dst, nil)
+	assert.NilError(t, err, "Restore")
+
+	// a.js has the blob's mode, so it may be linked, but the executable b.js has
+	// its own mode, so it must not share the blob's inode
+	blobInfo, err := blobPath.Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.Equal(t, blobInfo.Mode().Perm(), os.FileMode(0644))
+	aInfo, err := dst.UntypedJoin("dist", "a.js").Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.Equal(t, aInfo.Mode().Perm(), os.FileMode(0644))
+	bInfo, err := dst.UntypedJoin("dist", "b.js").Lstat()
+	assert.NilError(t, err, "Lstat")
+	assert.Equal(t, bInfo.Mode().Perm(), os.FileMode(0755))
+	assert.Assert(t, !os.SameFile(bInfo, blobInfo), "the executable was linked to the blob")
+}
@@ -0,0 +1,11 @@
+package cacheitem
+
+import (
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"golang.org/x/sys/unix"
+)
+
+// reflink creates target as a copy-on-write clone of source, which is supported by APFS.
+func reflink(source turbopath.AbsoluteSystemPath, target turbopath.AbsoluteSystemPath) error {
+	return unix.Clonefile(source.ToString(), target.ToString(), unix.CLONE_NOFOLLOW)
+}
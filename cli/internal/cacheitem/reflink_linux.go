@@ -0,0 +1,29 @@
+package cacheitem
+
+import (
+	"os"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"golang.org/x/sys/unix"
+)
+
+// reflink creates target as a copy-on-write clone of source using the FICLONE ioctl,
+// which is supported by btrfs, XFS, and some others.
+func reflink(source turbopath.AbsoluteSystemPath, target turbopath.AbsoluteSystemPath) error {
+	sourceFile, err := source.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sourceFile.Close() }()
+	targetFile, err := target.OpenFile(os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	cloneErr := unix.IoctlFileClone(int(targetFile.Fd()), int(sourceFile.Fd()))
+	closeErr := targetFile.Close()
+	if cloneErr != nil {
+		_ = target.Remove()
+		return cloneErr
+	}
+	return closeErr
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cacheitem
+
+import "github.com/vercel/turbo/cli/internal/turbopath"
+
+// reflink is not supported on this platform.
+func reflink(source turbopath.AbsoluteSystemPath, target turbopath.AbsoluteSystemPath) error {
+	return errReflinkUnsupported
+}
@@ -30,22 +30,19 @@ func Open(path turbopath.AbsoluteSystemPath) (*CacheItem, error) {
 
 // Restore extracts a cache to a specified disk location.
 func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.AnchoredSystemPath, error) {
-	var tr *tar.Reader
-	var closeError error
-
-	// We're reading a tar, possibly wrapped in zstd.
-	if ci.compressed {
-		zr := zstd.NewReader(ci.handle)
+	return ci.RestoreFiltered(anchor, nil)
+}
 
-		// The `Close` function for compression effectively just returns the singular
-		// error field on the decompressor instance. This is extremely unlikely to be
-		// set without triggering one of the numerous other errors, but we should still
-		// handle that possible edge case.
-		defer func() { closeError = zr.Close() }()
-		tr = tar.NewReader(zr)
-	} else {
-		tr = tar.NewReader(ci.handle)
-	}
+// RestoreFiltered extracts only the entries of a cache for which include returns true
+// to a specified disk location. A nil include restores every entry.
+func (ci *CacheItem) RestoreFiltered(anchor turbopath.AbsoluteSystemPath, include func(turbopath.AnchoredSystemPath) bool) ([]turbopath.AnchoredSystemPath, error) {
+	var closeError error
+	tr, closeReader := ci.tarReader()
+	// The `Close` function for compression effectively just returns the singular
+	// error field on the decompressor instance. This is extremely unlikely to be
+	// set without triggering one of the numerous other errors, but we should still
+	// handle that possible edge case.
+	defer func() { closeError = closeReader() }()
 
 	// On first attempt to restore it's possible that a link target doesn't exist.
 	// Save them and topsort them.
@@ -93,6 +90,14 @@ func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.A
 		// The reader will not advance until tr.Next is called.
 		// We can treat this as file metadata + body reader.
 
+		// Skip anything that wasn't asked for. Malformed names fall through
+		// so that restoreEntry reports them.
+		if include != nil {
+			if processedName, err := canonicalizeName(header.Name); err == nil && !include(processedName) {
+				continue
+			}
+		}
+
 		// Attempt to place the file on disk.
 		file, restoreErr := restoreEntry(dirCache, anchor, header, tr)
 		if restoreErr != nil {
@@ -109,6 +114,17 @@ func (ci *CacheItem) Restore(anchor turbopath.AbsoluteSystemPath) ([]turbopath.A
 	return restored, closeError
 }
 
+// tarReader returns a reader for the tar in the CacheItem, decompressing it if needed,
+// along with a function to close the decompressor.
+func (ci *CacheItem) tarReader() (*tar.Reader, func() error) {
+	// We're reading a tar, possibly wrapped in zstd.
+	if ci.compressed {
+		zr := zstd.NewReader(ci.handle)
+		return tar.NewReader(zr), zr.Close
+	}
+	return tar.NewReader(ci.handle), func() error { return nil }
+}
+
 // restoreRegular is the entry point for all things read from the tar.
 func restoreEntry(dirCache *cachedDirTree, anchor turbopath.AbsoluteSystemPath, header *tar.Header, reader *tar.Reader) (turbopath.AnchoredSystemPath, error) {
 	// We're permissive on creation, but restrictive on restoration.
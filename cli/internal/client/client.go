@@ -35,11 +35,17 @@ type ApiClient struct {
 	teamSlug   string
 	// Whether or not to send preflight requests before uploads
 	usePreflight bool
+	// Set once the server has reported that it doesn't support querying artifacts
+	// in batches. Must be used via atomic package
+	batchQueryUnsupported uint32
 }
 
 // ErrTooManyFailures is returned from remote cache API methods after `maxRemoteFailCount` errors have occurred
 var ErrTooManyFailures = errors.New("skipping HTTP Request, too many failures have occurred")
 
+// _maxBatchQuerySize is the most artifacts that are queried in a single request
+const _maxBatchQuerySize = 100
+
 // _maxRemoteFailCount is the number of failed requests before we stop trying to upload/download
 // artifacts to the remote cache
 const _maxRemoteFailCount = uint64(3)
@@ -250,7 +256,11 @@ func (c *ApiClient) handle403(body io.Reader) error {
 	return disabledErr
 }
 
-func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int, tag string) error {
+// PutArtifact uploads an artifact to the Remote Caching server, streaming it from artifactBody.
+// size is sent as the Content-Length, or pass -1 if it is unknown. If artifactBody is an
+// io.ReadSeeker it is rewound on retry, otherwise the request is attempted only once, since
+// it cannot be retried without buffering the whole artifact.
+func (c *ApiClient) PutArtifact(hash string, artifactBody io.Reader, size int64, duration int, tag string) error {
 	if err := c.okToRequest(); err != nil {
 		return err
 	}
@@ -274,7 +284,13 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 		allowAuth = strings.Contains(strings.ToLower(headers), strings.ToLower("Authorization"))
 	}
 
-	req, err := retryablehttp.NewRequest(http.MethodPut, requestURL, artifactBody)
+	req, err := http.NewRequest(http.MethodPut, requestURL, artifactBody)
+	if err != nil {
+		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("x-artifact-duration", fmt.Sprintf("%v", duration))
 	if allowAuth {
@@ -284,13 +300,24 @@ func (c *ApiClient) PutArtifact(hash string, artifactBody []byte, duration int,
 	if tag != "" {
 		req.Header.Set("x-artifact-tag", tag)
 	}
-	if err != nil {
-		return fmt.Errorf("[WARNING] Invalid cache URL: %w", err)
-	}
 
-	resp, err := c.HttpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+	var resp *http.Response
+	if _, ok := artifactBody.(io.ReadSeeker); ok {
+		retryableReq, err := retryablehttp.FromRequest(req)
+		if err != nil {
+			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+		}
+		resp, err = c.HttpClient.Do(retryableReq)
+		if err != nil {
+			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+		}
+	} else {
+		// retryablehttp would read the whole artifact into memory so that it could be
+		// replayed on retry. A non-seekable body can only be sent once, so skip retries.
+		resp, err = c.HttpClient.HTTPClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to store files in HTTP cache: %w", err)
+		}
 	}
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode == http.StatusForbidden {
@@ -311,6 +338,115 @@ func (c *ApiClient) ArtifactExists(hash string) (*http.Response, error) {
 	return c.getArtifact(hash, http.MethodHead)
 }
 
+// artifactQueryResult is the status of a single artifact, as returned by a batch query.
+// Artifacts that don't exist are either null or carry an error.
+type artifactQueryResult struct {
+	Size  int64 `json:"size"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// ArtifactsExist determines which of the build artifacts with the given hashes exist in
+// the Remote Caching server, querying for them in batches. Servers that don't support
+// batch queries are asked about each artifact in turn.
+func (c *ApiClient) ArtifactsExist(hashes []string) (map[string]bool, error) {
+	exists := make(map[string]bool, len(hashes))
+	for len(hashes) > 0 {
+		batch := hashes
+		if len(batch) > _maxBatchQuerySize {
+			batch = batch[:_maxBatchQuerySize]
+		}
+		hashes = hashes[len(batch):]
+
+		if atomic.LoadUint32(&c.batchQueryUnsupported) == 0 {
+			results, err := c.queryArtifacts(batch)
+			if err != nil {
+				return nil, err
+			}
+			if results != nil {
+				for _, hash := range batch {
+					result, ok := results[hash]
+					exists[hash] = ok && result != nil && result.Error == nil
+				}
+				continue
+			}
+			atomic.StoreUint32(&c.batchQueryUnsupported, 1)
+		}
+		for _, hash := range batch {
+			resp, err := c.ArtifactExists(hash)
+			if err != nil {
+				return nil, err
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+				return nil, fmt.Errorf("failed to check artifact %v: unexpected HTTP status %v", hash, resp.Status)
+			}
+			exists[hash] = resp.StatusCode == http.StatusOK
+		}
+	}
+	return exists, nil
+}
+
+// queryArtifacts asks the Remote Caching server about the given artifacts in a single
+// request. It returns nil results if the server doesn't support batch queries.
+func (c *ApiClient) queryArtifacts(hashes []string) (map[string]*artifactQueryResult, error) {
+	if err := c.okToRequest(); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	c.addTeamParam(&params)
+	encoded := params.Encode()
+	if encoded != "" {
+		encoded = "?" + encoded
+	}
+	body, err := json.Marshal(map[string][]string{"hashes": hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	requestURL := c.makeUrl("/v8/artifacts" + encoded)
+	allowAuth := true
+	if c.usePreflight {
+		resp, latestRequestURL, err := c.doPreflight(requestURL, http.MethodPost, "Content-Type, Authorization, User-Agent")
+		if err != nil {
+			return nil, fmt.Errorf("pre-flight request failed before trying to query HTTP cache: %w", err)
+		}
+		requestURL = latestRequestURL
+		headers := resp.Header.Get("Access-Control-Allow-Headers")
+		allowAuth = strings.Contains(strings.ToLower(headers), strings.ToLower("Authorization"))
+	}
+
+	req, err := retryablehttp.NewRequest(http.MethodPost, requestURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if allowAuth {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("User-Agent", c.UserAgent())
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query artifacts: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, nil
+	case http.StatusForbidden:
+		return nil, c.handle403(resp.Body)
+	default:
+		return nil, fmt.Errorf("failed to query artifacts: unexpected HTTP status %v", resp.Status)
+	}
+	results := make(map[string]*artifactQueryResult)
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to read artifact query response: %w", err)
+	}
+	return results, nil
+}
+
 // FetchArtifact attempts to retrieve the build artifact with the given hash from the
 // Remote Caching server
 func (c *ApiClient) getArtifact(hash string, httpMethod string) (*http.Response, error) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -94,7 +95,7 @@ func Test_PutArtifact(t *testing.T) {
 	expectedArtifactBody := []byte("My string artifact")
 
 	// Test Put Artifact
-	apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	apiClient.PutArtifact("hash", bytes.NewReader(expectedArtifactBody), int64(len(expectedArtifactBody)), 500, "")
 	testBody := <-ch
 	if !bytes.Equal(expectedArtifactBody, testBody) {
 		t.Errorf("Handler read '%v', wants '%v'", testBody, expectedArtifactBody)
@@ -102,6 +103,40 @@ func Test_PutArtifact(t *testing.T) {
 
 }
 
+func Test_PutArtifactNonSeekable(t *testing.T) {
+	ch := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		if _, err := ioutil.ReadAll(req.Body); err != nil {
+			t.Errorf("failed to read request %v", err)
+		}
+		ch <- req
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	remoteConfig := RemoteConfig{
+		TeamSlug: "my-team-slug",
+		APIURL:   ts.URL,
+		Token:    "my-token",
+	}
+	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
+	// A pipe can't be rewound, so it must be streamed rather than buffered for retries
+	r, w := io.Pipe()
+	go func() {
+		_, _ = w.Write([]byte("My streamed artifact"))
+		_ = w.Close()
+	}()
+	err := apiClient.PutArtifact("hash", r, -1, 500, "")
+	if err != nil {
+		t.Errorf("PutArtifact got error %v, want <nil>", err)
+	}
+	req := <-ch
+	if req.ContentLength != -1 {
+		t.Errorf("ContentLength got %v, want -1 (chunked)", req.ContentLength)
+	}
+}
+
 func Test_PutWhenCachingDisabled(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		defer func() { _ = req.Body.Close() }()
@@ -119,7 +154,7 @@ func Test_PutWhenCachingDisabled(t *testing.T) {
 	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
 	expectedArtifactBody := []byte("My string artifact")
 	// Test Put Artifact
-	err := apiClient.PutArtifact("hash", expectedArtifactBody, 500, "")
+	err := apiClient.PutArtifact("hash", bytes.NewReader(expectedArtifactBody), int64(len(expectedArtifactBody)), 500, "")
 	cd := &util.CacheDisabledError{}
 	if !errors.As(err, &cd) {
 		t.Errorf("expected cache disabled error, got %v", err)
@@ -157,3 +192,87 @@ func Test_FetchWhenCachingDisabled(t *testing.T) {
 		t.Errorf("response got %v, want <nil>", resp)
 	}
 }
+
+func Test_ArtifactsExist(t *testing.T) {
+	queries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() { _ = req.Body.Close() }()
+		if req.Method != http.MethodPost || req.URL.Path != "/v8/artifacts" {
+			t.Errorf("unexpected request %v %v", req.Method, req.URL.Path)
+		}
+		queries++
+		body := struct {
+			Hashes []string `json:"hashes"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("failed to read request %v", err)
+		}
+		results := map[string]interface{}{}
+		for _, hash := range body.Hashes {
+			switch hash {
+			case "present":
+				results[hash] = map[string]interface{}{"size": 10, "taskDurationMs": 5}
+			case "errored":
+				results[hash] = map[string]interface{}{"error": map[string]string{"message": "not found"}}
+			default:
+				results[hash] = nil
+			}
+		}
+		_ = json.NewEncoder(w).Encode(results)
+	}))
+	defer ts.Close()
+
+	remoteConfig := RemoteConfig{
+		TeamSlug: "my-team-slug",
+		APIURL:   ts.URL,
+		Token:    "my-token",
+	}
+	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
+	exists, err := apiClient.ArtifactsExist([]string{"present", "errored", "missing"})
+	if err != nil {
+		t.Fatalf("ArtifactsExist: %v", err)
+	}
+	expected := map[string]bool{"present": true, "errored": false, "missing": false}
+	if !reflect.DeepEqual(exists, expected) {
+		t.Errorf("ArtifactsExist got %v, want %v", exists, expected)
+	}
+	if queries != 1 {
+		t.Errorf("expected a single query, got %v", queries)
+	}
+}
+
+func Test_ArtifactsExistFallsBackToHead(t *testing.T) {
+	heads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() { _ = req.Body.Close() }()
+		switch {
+		case req.Method == http.MethodPost:
+			w.WriteHeader(http.StatusNotFound)
+		case req.Method == http.MethodHead && req.URL.Path == "/v8/artifacts/present":
+			heads++
+			w.WriteHeader(http.StatusOK)
+		default:
+			heads++
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	remoteConfig := RemoteConfig{
+		TeamSlug: "my-team-slug",
+		APIURL:   ts.URL,
+		Token:    "my-token",
+	}
+	apiClient := NewClient(remoteConfig, hclog.Default(), "v1", Opts{})
+	exists, err := apiClient.ArtifactsExist([]string{"present", "missing"})
+	if err != nil {
+		t.Fatalf("ArtifactsExist: %v", err)
+	}
+	expected := map[string]bool{"present": true, "missing": false}
+	if !reflect.DeepEqual(exists, expected) {
+		t.Errorf("ArtifactsExist got %v, want %v", exists, expected)
+	}
+	if heads != 2 {
+		t.Errorf("expected a HEAD request per artifact, got %v", heads)
+	}
+}
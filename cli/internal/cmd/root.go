@@ -9,6 +9,7 @@ import (
 	"runtime/trace"
 
 	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cachecmd"
 	"github.com/vercel/turbo/cli/internal/cmd/auth"
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/daemon"
@@ -19,6 +20,7 @@ import (
 	"github.com/vercel/turbo/cli/internal/signals"
 	"github.com/vercel/turbo/cli/internal/turbostate"
 	"github.com/vercel/turbo/cli/internal/util"
+	"github.com/vercel/turbo/cli/internal/validate"
 )
 
 func initializeOutputFiles(helper *cmdutil.Helper, parsedArgs turbostate.ParsedArgsFromRust) error {
@@ -66,7 +68,9 @@ func RunWithArgs(args turbostate.ParsedArgsFromRust, turboVersion string) int {
 	var execErr error
 	go func() {
 		command := args.Command
-		if command.Link != nil {
+		if command.Cache != nil {
+			execErr = cachecmd.ExecuteCache(helper, signalWatcher, &args)
+		} else if command.Link != nil {
 			execErr = login.ExecuteLink(helper, &args)
 		} else if command.Login != nil {
 			execErr = login.ExecuteLogin(ctx, helper, &args)
@@ -78,6 +82,10 @@ func RunWithArgs(args turbostate.ParsedArgsFromRust, turboVersion string) int {
 			execErr = prune.ExecutePrune(helper, &args)
 		} else if command.Run != nil {
 			execErr = run.ExecuteRun(ctx, helper, signalWatcher, &args)
+		} else if command.Validate != nil {
+			execErr = validate.ExecuteValidate(helper, &args)
+		} else if command.WhyMiss != nil {
+			execErr = run.ExecuteWhyMiss(ctx, helper, signalWatcher, &args)
 		} else {
 			execErr = fmt.Errorf("unknown command: %v", command)
 		}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/vercel/turbo/cli/internal/fs"
@@ -84,8 +85,10 @@ type EngineExecutionOptions struct {
 }
 
 // Execute executes the pipeline, constructing an internal task graph and walking it accordingly.
+// Each task takes as many of the Concurrency slots as its weight, and waits for other tasks
+// that hold any of its resources to finish.
 func (e *Engine) Execute(visitor Visitor, opts EngineExecutionOptions) []error {
-	var sema = util.NewSemaphore(opts.Concurrency)
+	var sema = util.NewWeightedSemaphore(opts.Concurrency)
 	return e.TaskGraph.Walk(func(v dag.Vertex) error {
 		// Each vertex in the graph is a taskID (package#task format)
 		taskID := dag.VertexName(v)
@@ -95,16 +98,37 @@ func (e *Engine) Execute(visitor Visitor, opts EngineExecutionOptions) []error {
 			return nil
 		}
 
-		// Acquire the semaphore unless parallel
-		if !opts.Parallel {
-			sema.Acquire()
-			defer sema.Release()
+		weight, resources := e.taskWeight(taskID)
+		// Parallel tasks don't take slots, but still hold their resources
+		if opts.Parallel {
+			weight = 0
 		}
+		sema.Acquire(weight, resources)
+		defer sema.Release(weight, resources)
 
 		return visitor(taskID)
 	})
 }
 
+// taskWeight returns the number of concurrency slots, and the resources, that taskID
+// holds while it runs
+func (e *Engine) taskWeight(taskID string) (int, []string) {
+	taskDefinition, ok := e.completeGraph.TaskDefinitions[taskID]
+	if !ok {
+		return 1, nil
+	}
+	return definitionWeight(taskDefinition), taskDefinition.Resources
+}
+
+// definitionWeight returns the number of concurrency slots that a task with
+// taskDefinition takes
+func definitionWeight(taskDefinition *fs.TaskDefinition) int {
+	if taskDefinition.Weight < 1 {
+		return 1
+	}
+	return taskDefinition.Weight
+}
+
 func (e *Engine) getTaskDefinition(taskName string, taskID string) (*Task, error) {
 	if task, ok := e.Tasks[taskID]; ok {
 		return task, nil
@@ -112,6 +136,10 @@ func (e *Engine) getTaskDefinition(taskName string, taskID string) (*Task, error
 	if task, ok := e.Tasks[taskName]; ok {
 		return task, nil
 	}
+	pkg, _ := util.GetPackageTaskFromId(taskID)
+	if taskDefinition, ok := e.completeGraph.WorkspaceTurboJSONs[pkg].ResolveTask(taskName, nil); ok {
+		return &Task{Name: taskID, TaskDefinition: *taskDefinition}, nil
+	}
 
 	return nil, fmt.Errorf("Missing task definition, configure \"%s\" or \"%s\" in turbo.json", taskName, taskID)
 }
@@ -340,9 +368,9 @@ func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph) erro
 			// Parse the taskID of this dependency task
 			packageName, taskName := util.GetPackageTaskFromId(depTaskID)
 
-			// Get the Task Definition so we can check if it is Persistent
-			// TODO(mehulkar): Do we need to get a resolved taskDefinition here?
-			depTaskDefinition, taskExists := e.getTaskDefinition(taskName, depTaskID)
+			// Get the Task Definition so we can check if it is Persistent. It's resolved,
+			// since the workspace's turbo.json may change whether it is.
+			depTaskDefinition, taskExists := e.GetResolvedTaskDefinition(&graph.Pipeline, taskName, depTaskID)
 			if taskExists != nil {
 				return fmt.Errorf("Cannot find task definition for %v in package %v", depTaskID, packageName)
 			}
@@ -355,7 +383,7 @@ func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph) erro
 			_, hasScript := pkg.Scripts[taskName]
 
 			// If both conditions are true set a value and break out of checking the dependencies
-			if depTaskDefinition.TaskDefinition.Persistent && hasScript {
+			if depTaskDefinition.Persistent && hasScript {
 				validationError = fmt.Errorf(
 					"\"%s\" is a persistent task, \"%s\" cannot depend on it",
 					util.GetTaskId(packageName, taskName),
@@ -377,9 +405,129 @@ func (e *Engine) ValidatePersistentDependencies(graph *graph.CompleteGraph) erro
 	return validationError
 }
 
-// GetResolvedTaskDefinition returns a "resolved" TaskDefinition.
-// Today, it just looks up the task from the root Pipeline, but in the future
-// we will compose the TaskDefinition from workspaces using the `extends` key.
+// ValidatePersistentResources checks that no task shares a resource with a persistent task.
+// Persistent tasks don't exit, so they never release their resources, and any other task
+// that needs one of them would wait forever.
+func (e *Engine) ValidatePersistentResources(graph *graph.CompleteGraph) error {
+	// the tasks that need each resource, and the first persistent one
+	holders := map[string][]string{}
+	persistentHolders := map[string]string{}
+	for _, taskID := range e.runnableTaskIDs(graph) {
+		taskDefinition := graph.TaskDefinitions[taskID]
+		for _, resource := range taskDefinition.Resources {
+			holders[resource] = append(holders[resource], taskID)
+			if _, ok := persistentHolders[resource]; !ok && taskDefinition.Persistent {
+				persistentHolders[resource] = taskID
+			}
+		}
+	}
+
+	resources := make([]string, 0, len(persistentHolders))
+	for resource := range persistentHolders {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for _, resource := range resources {
+		persistentTaskID := persistentHolders[resource]
+		for _, taskID := range holders[resource] {
+			if taskID != persistentTaskID {
+				return fmt.Errorf(
+					"\"%s\" is a persistent task, so it never releases resource \"%s\", which \"%s\" also needs",
+					persistentTaskID,
+					resource,
+					taskID,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidatePersistentWeights checks that persistent tasks leave enough of the concurrency
+// slots free for every other task. Persistent tasks don't exit, so they never release
+// their slots, and a task that needs more than they leave would wait forever.
+func (e *Engine) ValidatePersistentWeights(graph *graph.CompleteGraph, concurrency int) error {
+	clamp := func(weight int) int {
+		if weight > concurrency {
+			return concurrency
+		}
+		return weight
+	}
+
+	persistentWeight := 0
+	heaviestTaskID := ""
+	heaviestWeight := 0
+	for _, taskID := range e.runnableTaskIDs(graph) {
+		taskDefinition := graph.TaskDefinitions[taskID]
+		weight := clamp(definitionWeight(taskDefinition))
+		if taskDefinition.Persistent {
+			persistentWeight += weight
+		} else if weight > heaviestWeight {
+			heaviestTaskID = taskID
+			heaviestWeight = weight
+		}
+	}
+
+	if persistentWeight > concurrency {
+		return fmt.Errorf(
+			"persistent tasks take %v slots, but the concurrency is %v. Use --concurrency=%v or lower their weights",
+			persistentWeight,
+			concurrency,
+			persistentWeight,
+		)
+	}
+	if heaviestTaskID != "" && persistentWeight+heaviestWeight > concurrency {
+		return fmt.Errorf(
+			"persistent tasks never release %v of the %v slots, which leaves %v, so \"%s\" with weight %v could never start. Use --concurrency=%v or lower their weights",
+			persistentWeight,
+			concurrency,
+			concurrency-persistentWeight,
+			heaviestTaskID,
+			heaviestWeight,
+			persistentWeight+heaviestWeight,
+		)
+	}
+	return nil
+}
+
+// runnableTaskIDs returns the sorted IDs of the tasks in the task graph that have a
+// definition and a script to run. Tasks without a script don't run, so they don't
+// hold any slots or resources.
+func (e *Engine) runnableTaskIDs(graph *graph.CompleteGraph) []string {
+	taskIDs := []string{}
+	for _, v := range e.TaskGraph.Vertices() {
+		taskID := dag.VertexName(v)
+		if strings.Contains(taskID, ROOT_NODE_NAME) {
+			continue
+		}
+		if _, ok := graph.TaskDefinitions[taskID]; !ok {
+			continue
+		}
+		packageName, taskName := util.GetPackageTaskFromId(taskID)
+		pkg, ok := graph.WorkspaceInfos[packageName]
+		if !ok {
+			continue
+		}
+		if _, hasScript := pkg.Scripts[taskName]; !hasScript {
+			continue
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Strings(taskIDs)
+	return taskIDs
+}
+
+// GetResolvedTaskDefinition returns a "resolved" TaskDefinition: the task from the root
+// Pipeline, with the fields set by the turbo.json in the task's workspace, which
+// extends the root turbo.json, overriding it.
 func (e *Engine) GetResolvedTaskDefinition(rootPipeline *fs.Pipeline, taskName string, taskID string) (*fs.TaskDefinition, error) {
-	return rootPipeline.GetTask(taskID, taskName)
+	rootTaskDefinition, err := rootPipeline.GetTask(taskID, taskName)
+	if err != nil {
+		rootTaskDefinition = nil
+	}
+	pkg, _ := util.GetPackageTaskFromId(taskID)
+	if taskDefinition, ok := e.completeGraph.WorkspaceTurboJSONs[pkg].ResolveTask(taskName, rootTaskDefinition); ok {
+		return taskDefinition, nil
+	}
+	return nil, err
 }
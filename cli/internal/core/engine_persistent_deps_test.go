@@ -106,6 +106,49 @@ func TestPrepare_PersistentDependencies_SameWorkspace(t *testing.T) {
 	testifyAssert.Regexp(t, expected, actualErr)
 }
 
+func TestPrepare_PersistentDependencies_WorkspaceTurboJSON(t *testing.T) {
+	completeGraph, workspaces := _buildCompleteGraph(_workspaceGraphDefinition)
+
+	buildTask := fs.TaskDefinition{Persistent: false, TopologicalDependencies: []string{"dev"}}
+	devTask := fs.TaskDefinition{Persistent: false}
+
+	completeGraph.Pipeline = fs.Pipeline{
+		"build": buildTask,
+		"dev":   devTask,
+	}
+
+	// workspace-c's turbo.json makes its dev task persistent
+	workspaceDir := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	err := workspaceDir.UntypedJoin("turbo.json").WriteFile([]byte(`{"extends": ["//"], "pipeline": {"dev": {"persistent": true}}}`), 0644)
+	assert.NilError(t, err, "WriteFile")
+	workspaceTurboJSON, err := fs.ReadWorkspaceTurboConfig(workspaceDir)
+	assert.NilError(t, err, "ReadWorkspaceTurboConfig")
+	completeGraph.WorkspaceTurboJSONs = map[string]*fs.WorkspaceTurboJSON{"workspace-c": workspaceTurboJSON}
+
+	engine := NewEngine(completeGraph)
+
+	// "build": dependsOn: ["^dev"] (where dev is only persistent in workspace-c)
+	engine.AddTask(&Task{Name: "build", TaskDefinition: buildTask})
+	engine.AddTask(&Task{Name: "dev", TaskDefinition: devTask})
+
+	opts := &EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"build"},
+	}
+
+	err = engine.Prepare(opts)
+	assert.NilError(t, err, "Failed to prepare engine")
+
+	assert.Equal(t, completeGraph.TaskDefinitions["workspace-c#dev"].Persistent, true)
+	assert.Equal(t, completeGraph.TaskDefinitions["workspace-a#build"].Persistent, false)
+
+	// do the validation
+	actualErr := engine.ValidatePersistentDependencies(completeGraph)
+
+	expected := regexp.MustCompile("\"workspace-c#dev\" is a persistent task, \"workspace-[a|b]#build\" cannot depend on it")
+	testifyAssert.Regexp(t, expected, actualErr)
+}
+
 func TestPrepare_PersistentDependencies_WorkspaceSpecific(t *testing.T) {
 	completeGraph, workspaces := _buildCompleteGraph(_workspaceGraphDefinition)
 	buildTask := fs.TaskDefinition{Persistent: false, TaskDependencies: []string{"workspace-b#dev"}}
@@ -491,3 +534,80 @@ func _buildCompleteGraph(workspaceEasyDefinition map[string][]string) (*graph.Co
 
 	return completeGraph, workspaces
 }
+
+func TestPrepare_PersistentResources(t *testing.T) {
+	completeGraph, workspaces := _buildCompleteGraph(_workspaceGraphDefinition)
+
+	// Each workspace's dev server binds the same port
+	devTask := fs.TaskDefinition{Persistent: true, Resources: []string{"port-3000"}}
+	buildTask := fs.TaskDefinition{Resources: []string{"port-3000"}}
+	completeGraph.Pipeline = fs.Pipeline{
+		"dev":   devTask,
+		"build": buildTask,
+	}
+
+	engine := NewEngine(completeGraph)
+	engine.AddTask(&Task{Name: "dev", TaskDefinition: devTask})
+	engine.AddTask(&Task{Name: "build", TaskDefinition: buildTask})
+
+	// Tasks that aren't persistent can share resources
+	err := engine.Prepare(&EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"build"},
+	})
+	assert.NilError(t, err, "Failed to prepare engine")
+	assert.NilError(t, engine.ValidatePersistentResources(completeGraph))
+
+	engine = NewEngine(completeGraph)
+	engine.AddTask(&Task{Name: "dev", TaskDefinition: devTask})
+	err = engine.Prepare(&EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"dev"},
+	})
+	assert.NilError(t, err, "Failed to prepare engine")
+	actualErr := engine.ValidatePersistentResources(completeGraph)
+	assert.Error(t, actualErr, "\"workspace-a#dev\" is a persistent task, so it never releases resource \"port-3000\", which \"workspace-b#dev\" also needs")
+}
+
+func TestPrepare_PersistentWeights(t *testing.T) {
+	completeGraph, workspaces := _buildCompleteGraph(map[string][]string{
+		"workspace-a": {},
+		"workspace-b": {},
+	})
+
+	devTask := fs.TaskDefinition{Persistent: true, Weight: 2}
+	buildTask := fs.TaskDefinition{Weight: 3}
+	completeGraph.Pipeline = fs.Pipeline{
+		"dev":   devTask,
+		"build": buildTask,
+	}
+
+	engine := NewEngine(completeGraph)
+	engine.AddTask(&Task{Name: "dev", TaskDefinition: devTask})
+	engine.AddTask(&Task{Name: "build", TaskDefinition: buildTask})
+	err := engine.Prepare(&EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"dev", "build"},
+	})
+	assert.NilError(t, err, "Failed to prepare engine")
+
+	// The dev servers hold 4 slots, which leaves 3 for each build
+	assert.NilError(t, engine.ValidatePersistentWeights(completeGraph, 7))
+
+	actualErr := engine.ValidatePersistentWeights(completeGraph, 6)
+	assert.Error(t, actualErr, "persistent tasks never release 4 of the 6 slots, which leaves 2, so \"workspace-a#build\" with weight 3 could never start. Use --concurrency=7 or lower their weights")
+
+	// Weights are clamped to the concurrency, so the dev servers take every slot
+	actualErr = engine.ValidatePersistentWeights(completeGraph, 2)
+	assert.Error(t, actualErr, "persistent tasks take 4 slots, but the concurrency is 2. Use --concurrency=4 or lower their weights")
+
+	// Persistent tasks on their own can take every slot
+	engine = NewEngine(completeGraph)
+	engine.AddTask(&Task{Name: "dev", TaskDefinition: devTask})
+	err = engine.Prepare(&EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"dev"},
+	})
+	assert.NilError(t, err, "Failed to prepare engine")
+	assert.NilError(t, engine.ValidatePersistentWeights(completeGraph, 4))
+}
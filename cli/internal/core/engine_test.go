@@ -3,7 +3,9 @@ package core
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
@@ -593,3 +595,82 @@ b#test
 c#test
   ___ROOT___
 `
+
+func TestExecute_WeightsAndResources(t *testing.T) {
+	var workspaceGraph dag.AcyclicGraph
+	workspaces := []string{"a", "b", "c", "d"}
+	workspaceInfos := graph.WorkspaceInfos{}
+	for _, workspace := range workspaces {
+		workspaceGraph.Add(workspace)
+		workspaceInfos[workspace] = &fs.PackageJSON{}
+	}
+
+	buildTask := fs.TaskDefinition{Weight: 2}
+	e2eTask := fs.TaskDefinition{Resources: []string{"port-3000"}}
+	lintTask := fs.TaskDefinition{}
+	pipeline := fs.Pipeline{
+		"build": buildTask,
+		"e2e":   e2eTask,
+		"lint":  lintTask,
+	}
+	p := NewEngine(&graph.CompleteGraph{
+		WorkspaceGraph:  workspaceGraph,
+		Pipeline:        pipeline,
+		TaskDefinitions: map[string]*fs.TaskDefinition{},
+		WorkspaceInfos:  workspaceInfos,
+	})
+	p.AddTask(&Task{Name: "build", TaskDefinition: buildTask})
+	p.AddTask(&Task{Name: "e2e", TaskDefinition: e2eTask})
+	p.AddTask(&Task{Name: "lint", TaskDefinition: lintTask})
+	err := p.Prepare(&EngineBuildingOptions{
+		Packages:  workspaces,
+		TaskNames: []string{"build", "e2e", "lint"},
+	})
+	assert.NilError(t, err, "Prepare")
+
+	var mu sync.Mutex
+	running := 0
+	maxRunning := 0
+	e2eRunning := 0
+	maxE2ERunning := 0
+	visitor := func(taskID string) error {
+		weight, _ := p.taskWeight(taskID)
+		_, taskName := util.GetPackageTaskFromId(taskID)
+		mu.Lock()
+		running += weight
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if taskName == "e2e" {
+			e2eRunning++
+			if e2eRunning > maxE2ERunning {
+				maxE2ERunning = e2eRunning
+			}
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running -= weight
+		if taskName == "e2e" {
+			e2eRunning--
+		}
+		mu.Unlock()
+		return nil
+	}
+	errs := p.Execute(visitor, EngineExecutionOptions{Concurrency: 3})
+	for _, err := range errs {
+		assert.NilError(t, err, "Execute")
+	}
+	assert.Assert(t, maxRunning <= 3, "expected a total weight of at most 3, got %v", maxRunning)
+	assert.Equal(t, maxE2ERunning, 1)
+
+	// Weights are ignored in parallel, but resources are not
+	maxE2ERunning = 0
+	errs = p.Execute(visitor, EngineExecutionOptions{Concurrency: 1, Parallel: true})
+	for _, err := range errs {
+		assert.NilError(t, err, "Execute")
+	}
+	assert.Equal(t, maxE2ERunning, 1)
+}
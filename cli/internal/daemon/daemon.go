@@ -16,6 +16,7 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/nightlyone/lockfile"
 	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/daemon/connector"
 	"github.com/vercel/turbo/cli/internal/fs"
@@ -140,6 +141,9 @@ func ExecuteDaemon(ctx context.Context, helper *cmdutil.Helper, signalWatcher *s
 		return err
 	}
 	defer func() { _ = turboServer.Close() }()
+	drainCtx, cancelDrain := context.WithCancel(ctx)
+	defer cancelDrain()
+	go drainUploadSpool(drainCtx, base, d.logger.Named("upload spool"))
 	err = d.runTurboServer(ctx, turboServer, signalWatcher)
 	if err != nil {
 		d.logError(err)
@@ -148,6 +152,22 @@ func ExecuteDaemon(ctx context.Context, helper *cmdutil.Helper, signalWatcher *s
 	return nil
 }
 
+// drainUploadSpool sends the remote cache uploads that runs spooled, in the default cache
+// directory or any other, but didn't finish sending before they exited
+func drainUploadSpool(ctx context.Context, base *cmdutil.CmdBase, logger hclog.Logger) {
+	opts := cache.Opts{Workers: 1}
+	if rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.UntypedJoin("package.json")); err == nil {
+		if turboJSON, err := fs.LoadTurboConfig(base.RepoRoot, rootPackageJSON, false); err == nil {
+			opts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
+		}
+	}
+	if !opts.UsesS3() && !base.APIClient.IsLinked() {
+		logger.Debug("remote caching is not configured, not draining the upload spool")
+		return
+	}
+	cache.DrainSpool(ctx, opts, base.RepoRoot, base.APIClient)
+}
+
 var errInactivityTimeout = errors.New("turbod shut down from inactivity")
 
 // tryAcquirePidfileLock attempts to ensure that only one daemon is running from the given pid file path
@@ -0,0 +1,160 @@
+package env
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// ParseDotEnv parses the contents of a .env file into variables. Each line is a
+// KEY=VALUE pair, optionally prefixed with "export". Values may be single quoted,
+// which is literal, or double quoted, which understands \n, \r, \t, \" and \\ escapes,
+// and quoted values may span lines. # starts a comment, except inside a quoted value
+// or immediately after a non-whitespace character. Variables aren't expanded.
+func ParseDotEnv(contents []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	text := strings.ReplaceAll(string(contents), "\r\n", "\n")
+	lineNumber := 0
+	for len(text) > 0 {
+		var line string
+		line, text = cutLine(text)
+		lineNumber++
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		separator := strings.Index(line, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("line %v: expected KEY=VALUE", lineNumber)
+		}
+		key := strings.TrimSpace(line[:separator])
+		if !isValidDotEnvKey(key) {
+			return nil, fmt.Errorf("line %v: invalid variable name %q", lineNumber, key)
+		}
+		value := strings.TrimSpace(line[separator+1:])
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			startLine := lineNumber
+			rest := value[1:]
+			end := closingQuote(rest, quote)
+			for end < 0 {
+				if text == "" {
+					return nil, fmt.Errorf("line %v: unterminated quoted value for %v", startLine, key)
+				}
+				var next string
+				next, text = cutLine(text)
+				lineNumber++
+				rest += "\n" + next
+				end = closingQuote(rest, quote)
+			}
+			trailing := strings.TrimSpace(rest[end+1:])
+			if trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return nil, fmt.Errorf("line %v: unexpected %q after quoted value for %v", lineNumber, trailing, key)
+			}
+			value = rest[:end]
+			if quote == '"' {
+				value = unescapeDotEnvValue(value)
+			}
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// cutLine splits text into its first line and the remainder
+func cutLine(text string) (string, string) {
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return text[:i], text[i+1:]
+	}
+	return text, ""
+}
+
+// closingQuote returns the index in value of the quote that ends it, or -1
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && quote == '"' {
+			i++
+		} else if value[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+var _dotEnvEscapes = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+func unescapeDotEnvValue(value string) string {
+	return _dotEnvEscapes.Replace(value)
+}
+
+func isValidDotEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '_' && c != '.' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// ExistingDotEnvFiles returns those of files, relative to dir, that exist, in order
+func ExistingDotEnvFiles(dir turbopath.AbsoluteSystemPath, files []string) []string {
+	existing := []string{}
+	for _, file := range files {
+		if dir.UntypedJoin(file).FileExists() {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+// ReadDotEnvFiles reads and parses files, relative to dir. Files that don't exist are
+// skipped. A variable set by more than one file takes its value from the earliest of them,
+// so files should be listed from the highest precedence to the lowest.
+func ReadDotEnvFiles(dir turbopath.AbsoluteSystemPath, files []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, file := range ExistingDotEnvFiles(dir, files) {
+		contents, err := dir.UntypedJoin(file).ReadFile()
+		if err != nil {
+			return nil, err
+		}
+		fileVars, err := ParseDotEnv(contents)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		for key, value := range fileVars {
+			if _, ok := vars[key]; !ok {
+				vars[key] = value
+			}
+		}
+	}
+	return vars, nil
+}
+
+// DotEnvPairs returns key=value pairs for the variables in vars that aren't already set
+// in environ, sorted by key. Variables in the environment take precedence over .env files.
+func DotEnvPairs(environ []string, vars map[string]string) []string {
+	set := make(map[string]bool, len(environ))
+	for _, pair := range environ {
+		set[envKey(strings.SplitN(pair, "=", 2)[0])] = true
+	}
+	pairs := []string{}
+	for key, value := range vars {
+		if !set[envKey(key)] {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", key, value))
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,115 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "simple values",
+			contents: "A=1\nB = two \n\n# a comment\nexport C=3\n",
+			want:     map[string]string{"A": "1", "B": "two", "C": "3"},
+		},
+		{
+			name:     "empty value",
+			contents: "EMPTY=\n",
+			want:     map[string]string{"EMPTY": ""},
+		},
+		{
+			name:     "inline comments",
+			contents: "A=1 # one\nURL=https://example.com/#anchor\n",
+			want:     map[string]string{"A": "1", "URL": "https://example.com/#anchor"},
+		},
+		{
+			name:     "quoted values",
+			contents: "SINGLE='a \\n # b' # comment\nDOUBLE=\"a\\nb \\\"c\\\" \\\\n\"\n",
+			want:     map[string]string{"SINGLE": "a \\n # b", "DOUBLE": "a\nb \"c\" \\n"},
+		},
+		{
+			name:     "multi-line value",
+			contents: "KEY=\"-----BEGIN-----\nabc\n-----END-----\"\nNEXT=1\n",
+			want:     map[string]string{"KEY": "-----BEGIN-----\nabc\n-----END-----", "NEXT": "1"},
+		},
+		{
+			name:     "windows line endings",
+			contents: "A=1\r\nB=2\r\n",
+			want:     map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name:     "later values win within a file",
+			contents: "A=1\nA=2\n",
+			want:     map[string]string{"A": "2"},
+		},
+		{
+			name:     "missing separator",
+			contents: "A\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid name",
+			contents: "MY VAR=1\n",
+			wantErr:  true,
+		},
+		{
+			name:     "unterminated quote",
+			contents: "A=\"abc\nB=1\n",
+			wantErr:  true,
+		},
+		{
+			name:     "text after quoted value",
+			contents: "A=\"abc\" def\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotEnv([]byte(tt.contents))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDotEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDotEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDotEnvFiles(t *testing.T) {
+	dir := turbopath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	if err := dir.UntypedJoin(".env").WriteFile([]byte("A=env\nB=env\n"), 0644); err != nil {
+		t.Fatalf("failed to write .env: %v", err)
+	}
+	if err := dir.UntypedJoin(".env.local").WriteFile([]byte("A=local\n"), 0644); err != nil {
+		t.Fatalf("failed to write .env.local: %v", err)
+	}
+
+	files := []string{".env.local", ".env.missing", ".env"}
+	if got := ExistingDotEnvFiles(dir, files); !reflect.DeepEqual(got, []string{".env.local", ".env"}) {
+		t.Errorf("ExistingDotEnvFiles() = %v, want [.env.local .env]", got)
+	}
+
+	// Earlier files take precedence
+	vars, err := ReadDotEnvFiles(dir, files)
+	if err != nil {
+		t.Fatalf("ReadDotEnvFiles() error: %v", err)
+	}
+	want := map[string]string{"A": "local", "B": "env"}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("ReadDotEnvFiles() = %v, want %v", vars, want)
+	}
+
+	// The environment takes precedence over .env files
+	pairs := DotEnvPairs([]string{"B=environment", "PATH=/usr/bin"}, vars)
+	if !reflect.DeepEqual(pairs, []string{"A=local"}) {
+		t.Errorf("DotEnvPairs() = %v, want [A=local]", pairs)
+	}
+}
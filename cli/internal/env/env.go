@@ -54,12 +54,95 @@ func getEnvPairsFromPrefixes(includePrefixes []string, excludePrefix string, all
 	return allEnvPairs
 }
 
-// GetHashableEnvPairs returns all sorted key=value env var pairs for both frameworks and from envKeys
+// IsWildcard reports whether an env pattern matches variables by name rather than naming one
+func IsWildcard(pattern string) bool {
+	return strings.Contains(pattern, "*")
+}
+
+// matchWildcard reports whether name matches pattern, in which each * matches any run of characters
+func matchWildcard(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	rest := name[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	return strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+// matchesAny reports whether name is one of, or matches any of, patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name || (IsWildcard(pattern) && matchWildcard(pattern, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPatterns splits env patterns into exact names, wildcards, and exclusions, which
+// are the patterns prefixed with ! with the prefix removed
+func splitPatterns(patterns []string) ([]string, []string, []string) {
+	names := []string{}
+	wildcards := []string{}
+	exclusions := []string{}
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			exclusions = append(exclusions, strings.TrimPrefix(pattern, "!"))
+		} else if IsWildcard(pattern) {
+			wildcards = append(wildcards, pattern)
+		} else {
+			names = append(names, pattern)
+		}
+	}
+	return names, wildcards, exclusions
+}
+
+// resolveNames returns the names of the variables selected by patterns. Exact names are
+// selected whether or not they're set, wildcards select the variables in allEnvVars that
+// they match, and exclusions remove anything they match from the result.
+func resolveNames(patterns []string, allEnvVars map[string]string) []string {
+	names, wildcards, exclusions := splitPatterns(patterns)
+	resolved := make(util.Set)
+	for _, name := range names {
+		resolved.Add(name)
+	}
+	for name := range allEnvVars {
+		if matchesAny(wildcards, name) {
+			resolved.Add(name)
+		}
+	}
+	for _, name := range resolved.UnsafeListOfStrings() {
+		if matchesAny(exclusions, name) {
+			resolved.Delete(name)
+		}
+	}
+	resolvedNames := resolved.UnsafeListOfStrings()
+	sort.Strings(resolvedNames)
+	return resolvedNames
+}
+
+// ResolveEnvNames returns the sorted names of the variables in the current environment
+// that are selected by patterns, such as the "env" or "globalEnv" keys of turbo.json.
+// Patterns may contain * wildcards, and patterns prefixed with ! exclude variables.
+func ResolveEnvNames(patterns []string) []string {
+	return resolveNames(patterns, getEnvMap())
+}
+
+// GetHashableEnvPairs returns all sorted key=value env var pairs for both frameworks and from envKeys.
+// envKeys may contain wildcards and exclusions, which also apply to framework variables.
 func GetHashableEnvPairs(envKeys []string, envPrefixes []string) []string {
 	allEnvVars := getEnvMap()
 	excludePrefix := allEnvVars["TURBO_CI_VENDOR_ENV_KEY"]
-	hashableEnvFromKeys := getEnvPairsFromKeys(envKeys, allEnvVars)
+	hashableEnvFromKeys := getEnvPairsFromKeys(resolveNames(envKeys, allEnvVars), allEnvVars)
 	hashableEnvFromPrefixes := getEnvPairsFromPrefixes(envPrefixes, excludePrefix, allEnvVars)
+	_, _, exclusions := splitPatterns(envKeys)
 
 	// convert to set to eliminate duplicates, then cast back to slice to sort for stable hashing
 	uniqueHashableEnvPairs := make(util.Set, len(hashableEnvFromKeys)+len(hashableEnvFromPrefixes))
@@ -67,7 +150,9 @@ func GetHashableEnvPairs(envKeys []string, envPrefixes []string) []string {
 		uniqueHashableEnvPairs.Add(pair)
 	}
 	for _, pair := range hashableEnvFromPrefixes {
-		uniqueHashableEnvPairs.Add(pair)
+		if !matchesAny(exclusions, strings.SplitN(pair, "=", 2)[0]) {
+			uniqueHashableEnvPairs.Add(pair)
+		}
 	}
 
 	allHashableEnvPairs := uniqueHashableEnvPairs.UnsafeListOfStrings()
@@ -275,6 +275,60 @@ func TestGetHashableEnvPairs(t *testing.T) {
 			},
 			want: []string{"MANUAL=true", "NEXT_PUBLIC_VERCEL_ENV=true"},
 		},
+		{
+			env:  []string{"APP_FEATURE_A=on", "APP_FEATURE_B=off", "APP_NAME=web", "OTHER_APP_FEATURE_C=on"},
+			name: "wildcard matches set env vars",
+			args: args{
+				envKeys:     []string{"APP_FEATURE_*"},
+				envPrefixes: []string{},
+			},
+			want: []string{"APP_FEATURE_A=on", "APP_FEATURE_B=off"},
+		},
+		{
+			env:  []string{"APP_FEATURE_A=on", "APP_FEATURE_DEBUG=on", "APP_FEATURE_DEBUG_UI=on"},
+			name: "exclusion removes wildcard matches",
+			args: args{
+				envKeys:     []string{"APP_FEATURE_*", "!APP_FEATURE_DEBUG"},
+				envPrefixes: []string{},
+			},
+			want: []string{"APP_FEATURE_A=on", "APP_FEATURE_DEBUG_UI=on"},
+		},
+		{
+			env:  []string{"APP_FEATURE_A=on", "APP_FEATURE_DEBUG=on", "APP_FEATURE_DEBUG_UI=on"},
+			name: "wildcard exclusion",
+			args: args{
+				envKeys:     []string{"APP_*", "!*_DEBUG*"},
+				envPrefixes: []string{},
+			},
+			want: []string{"APP_FEATURE_A=on"},
+		},
+		{
+			env:  []string{"NEXT_PUBLIC_URL=url", "NEXT_PUBLIC_SECRET=secret"},
+			name: "exclusion applies to framework env vars",
+			args: args{
+				envKeys:     []string{"!NEXT_PUBLIC_SECRET"},
+				envPrefixes: []string{"NEXT_PUBLIC_"},
+			},
+			want: []string{"NEXT_PUBLIC_URL=url"},
+		},
+		{
+			env:  []string{"MANUAL=true"},
+			name: "exclusion removes manually specified key",
+			args: args{
+				envKeys:     []string{"MANUAL", "!MANUAL"},
+				envPrefixes: []string{},
+			},
+			want: []string{},
+		},
+		{
+			env:  []string{},
+			name: "unmatched wildcard adds nothing",
+			args: args{
+				envKeys:     []string{"APP_FEATURE_*", "UNSET"},
+				envPrefixes: []string{},
+			},
+			want: []string{"UNSET="},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -289,3 +343,37 @@ func TestGetHashableEnvPairs(t *testing.T) {
 		})
 	}
 }
+
+func Test_matchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "APP_*", name: "APP_", want: true},
+		{pattern: "APP_*", name: "APP_FEATURE", want: true},
+		{pattern: "APP_*", name: "MY_APP_FEATURE", want: false},
+		{pattern: "*_URL", name: "API_URL", want: true},
+		{pattern: "*_URL", name: "API_URL_OLD", want: false},
+		{pattern: "A*B*C", name: "ABC", want: true},
+		{pattern: "A*B*C", name: "AXXBXXC", want: true},
+		{pattern: "A*B*C", name: "ACB", want: false},
+		{pattern: "A*A", name: "A", want: false},
+		{pattern: "*", name: "ANYTHING", want: true},
+	}
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveEnvNames(t *testing.T) {
+	setEnvs([]string{"CI_COMMIT=abc", "CI_JOB_ID=123", "HOME=/home/me"})
+	defer os.Clearenv()
+	got := ResolveEnvNames([]string{"CI_*", "!CI_JOB_ID", "UNSET"})
+	want := []string{"CI_COMMIT", "UNSET"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveEnvNames() = %v, want %v", got, want)
+	}
+}
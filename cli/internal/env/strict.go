@@ -0,0 +1,122 @@
+package env
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Mode controls which environment variables tasks can read
+type Mode string
+
+const (
+	// LooseMode passes the whole environment to tasks
+	LooseMode Mode = "loose"
+	// StrictMode passes tasks only the variables that are hashed, that are explicitly
+	// passed through, and a minimal set that tools need to work at all
+	StrictMode Mode = "strict"
+)
+
+// ParseMode parses the value of --env-mode or envMode in turbo.json. An empty value
+// is loose mode.
+func ParseMode(value string) (Mode, error) {
+	switch Mode(value) {
+	case "", LooseMode:
+		return LooseMode, nil
+	case StrictMode:
+		return StrictMode, nil
+	default:
+		return "", fmt.Errorf("invalid env mode %q: expected %q or %q", value, StrictMode, LooseMode)
+	}
+}
+
+// DefaultPassThroughEnv are the variables that tasks can read in strict mode without
+// declaring them, since shells, package managers and compilers rely on them
+var DefaultPassThroughEnv = []string{
+	"COLORTERM",
+	"FORCE_COLOR",
+	"HOME",
+	"LANG",
+	"LC_ALL",
+	"LC_CTYPE",
+	"LOGNAME",
+	"NO_COLOR",
+	"PATH",
+	"SHELL",
+	"TERM",
+	"TMPDIR",
+	"TZ",
+	"USER",
+	// Windows
+	"APPDATA",
+	"COMSPEC",
+	"HOMEDRIVE",
+	"HOMEPATH",
+	"LOCALAPPDATA",
+	"PATHEXT",
+	"PROGRAMDATA",
+	"PROGRAMFILES",
+	"PROGRAMFILES(X86)",
+	"SYSTEMDRIVE",
+	"SYSTEMROOT",
+	"TEMP",
+	"TMP",
+	"USERPROFILE",
+	"WINDIR",
+}
+
+// envKey normalizes a variable name for comparison. Names are case-insensitive on Windows.
+func envKey(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+// StrictEnv filters environ, a list of key=value pairs, down to the variables named in
+// allowed and DefaultPassThroughEnv. It returns the pairs that were kept, and the
+// sorted names of the variables that were removed.
+func StrictEnv(environ []string, allowed []string) ([]string, []string) {
+	allowedKeys := make(map[string]bool, len(allowed)+len(DefaultPassThroughEnv))
+	for _, name := range DefaultPassThroughEnv {
+		allowedKeys[envKey(name)] = true
+	}
+	for _, name := range allowed {
+		allowedKeys[envKey(name)] = true
+	}
+	kept := []string{}
+	blocked := []string{}
+	for _, pair := range environ {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if allowedKeys[envKey(name)] {
+			kept = append(kept, pair)
+		} else if name != "" {
+			blocked = append(blocked, name)
+		}
+	}
+	sort.Strings(blocked)
+	return kept, blocked
+}
+
+// ReferencedNames returns the sorted names that are selected by patterns, such as the
+// "env" keys of turbo.json, or that start with one of prefixes, such as a framework's
+// env var prefixes
+func ReferencedNames(names []string, patterns []string, prefixes []string) []string {
+	exact, wildcards, exclusions := splitPatterns(patterns)
+	referenced := []string{}
+	for _, name := range names {
+		if (matchesAny(exact, name) || matchesAny(wildcards, name)) && !matchesAny(exclusions, name) {
+			referenced = append(referenced, name)
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				referenced = append(referenced, name)
+				break
+			}
+		}
+	}
+	sort.Strings(referenced)
+	return referenced
+}
@@ -0,0 +1,63 @@
+package env
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_ParseMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Mode
+		wantErr bool
+	}{
+		{value: "", want: LooseMode},
+		{value: "loose", want: LooseMode},
+		{value: "strict", want: StrictMode},
+		{value: "Strict", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("ParseMode(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_StrictEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/me",
+		"API_URL=https://example.com",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"SSH_AUTH_SOCK=/tmp/agent",
+		"EMPTY=",
+		"WITH_EQUALS=a=b",
+	}
+	gotEnv, gotBlocked := StrictEnv(environ, []string{"API_URL", "EMPTY", "WITH_EQUALS", "NOT_SET"})
+	wantEnv := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/me",
+		"API_URL=https://example.com",
+		"EMPTY=",
+		"WITH_EQUALS=a=b",
+	}
+	wantBlocked := []string{"AWS_SECRET_ACCESS_KEY", "SSH_AUTH_SOCK"}
+	if !reflect.DeepEqual(gotEnv, wantEnv) {
+		t.Errorf("StrictEnv() env = %v, want %v", gotEnv, wantEnv)
+	}
+	if !reflect.DeepEqual(gotBlocked, wantBlocked) {
+		t.Errorf("StrictEnv() blocked = %v, want %v", gotBlocked, wantBlocked)
+	}
+}
+
+func Test_ReferencedNames(t *testing.T) {
+	names := []string{"SSH_AUTH_SOCK", "NEXT_PUBLIC_URL", "API_URL", "AWS_REGION", "AWS_SECRET_ACCESS_KEY"}
+	got := ReferencedNames(names, []string{"API_URL", "AWS_*", "!AWS_SECRET_ACCESS_KEY"}, []string{"NEXT_PUBLIC_"})
+	want := []string{"API_URL", "AWS_REGION", "NEXT_PUBLIC_URL"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReferencedNames() = %v, want %v", got, want)
+	}
+}
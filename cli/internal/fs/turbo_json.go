@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/muhammadmuzzammil1998/jsonc"
 	"github.com/pkg/errors"
@@ -31,20 +33,100 @@ type rawTurboJSON struct {
 	Pipeline Pipeline
 	// Configuration options when interfacing with the remote cache
 	RemoteCacheOptions RemoteCacheOptions `json:"remoteCache,omitempty"`
+	// CachePolicy restricts reading from and writing to each cache, e.g. "local:rw,remote:r"
+	CachePolicy string `json:"cachePolicy,omitempty"`
+	// EnvMode is "strict" to only pass tasks the environment variables they declare
+	EnvMode string `json:"envMode,omitempty"`
+	// GlobalPassThroughEnv are environment variables passed to every task in strict
+	// env mode, without being hashed
+	GlobalPassThroughEnv []string `json:"globalPassThroughEnv,omitempty"`
+	// GlobalDotEnv are .env files, relative to the repository root, that are loaded into
+	// every task's environment and hashed
+	GlobalDotEnv []string `json:"globalDotEnv,omitempty"`
+	// Frameworks are inferred for packages in addition to, and in preference to, the
+	// built-in ones
+	Frameworks []FrameworkDefinition `json:"frameworks,omitempty"`
 }
 
 // TurboJSON is the root turborepo configuration
 type TurboJSON struct {
-	GlobalDeps         []string
-	GlobalEnv          []string
-	Pipeline           Pipeline
-	RemoteCacheOptions RemoteCacheOptions
+	GlobalDeps           []string
+	GlobalEnv            []string
+	GlobalPassThroughEnv []string
+	GlobalDotEnv         []string
+	Frameworks           []FrameworkDefinition
+	Pipeline             Pipeline
+	RemoteCacheOptions   RemoteCacheOptions
+	CachePolicy          string
+	EnvMode              string
 }
 
 // RemoteCacheOptions is a struct for deserializing .remoteCache of configFile
 type RemoteCacheOptions struct {
-	TeamID    string `json:"teamId,omitempty"`
-	Signature bool   `json:"signature,omitempty"`
+	TeamID    string          `json:"teamId,omitempty"`
+	Signature bool            `json:"signature,omitempty"`
+	S3        *S3CacheOptions `json:"s3,omitempty"`
+	// SignatureAlgorithm is either "hmac-sha256" (the default), which signs with a secret
+	// shared by every machine, or "ed25519", which signs with a private key and verifies
+	// with public keys, so that machines which can read the cache can't forge artifacts.
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+	// SignaturePublicKeys are files, relative to the repository root, containing the
+	// Ed25519 public keys trusted to sign artifacts.
+	SignaturePublicKeys []string `json:"signaturePublicKeys,omitempty"`
+	// Encryption encrypts artifacts with AES-256-GCM before they are uploaded, using the
+	// key in TURBO_REMOTE_CACHE_ENCRYPTION_KEY or TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE.
+	Encryption bool `json:"encryption,omitempty"`
+}
+
+// S3CacheOptions is a struct for deserializing .remoteCache.s3 of configFile.
+// When a bucket is configured, it is used as the remote cache instead of the Vercel API.
+type S3CacheOptions struct {
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix is prepended to every artifact key, e.g. "turbo/" stores artifacts at turbo/<hash>.tar.zst
+	Prefix string `json:"prefix,omitempty"`
+	Region string `json:"region,omitempty"`
+	// Endpoint overrides the AWS endpoint, for S3-compatible services such as MinIO or R2.
+	// Buckets on a custom endpoint are addressed path-style, as <endpoint>/<bucket>/<key>.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// FrameworkDefinition is a framework declared in turbo.json. The environment variables
+// starting with any of its EnvPrefixes are hashed for the tasks of packages that use it.
+type FrameworkDefinition struct {
+	Slug            string                   `json:"slug"`
+	EnvPrefixes     []string                 `json:"envPrefixes"`
+	DependencyMatch FrameworkDependencyMatch `json:"dependencyMatch"`
+}
+
+// FrameworkDependencyMatch decides which packages use a framework: those that depend on
+// all of Dependencies, or on some of them, according to Strategy
+type FrameworkDependencyMatch struct {
+	Strategy     string   `json:"strategy"`
+	Dependencies []string `json:"dependencies"`
+}
+
+const (
+	// FrameworkMatchAll matches packages that depend on all of a framework's dependencies
+	FrameworkMatchAll = "all"
+	// FrameworkMatchSome matches packages that depend on any of a framework's dependencies
+	FrameworkMatchSome = "some"
+)
+
+// validate checks that a framework can match packages, and hashes something for them
+func (f *FrameworkDefinition) validate() error {
+	if f.Slug == "" {
+		return errors.New("frameworks must have a \"slug\"")
+	}
+	if f.DependencyMatch.Strategy != FrameworkMatchAll && f.DependencyMatch.Strategy != FrameworkMatchSome {
+		return fmt.Errorf("framework %v: \"strategy\" must be %q or %q, got %q", f.Slug, FrameworkMatchAll, FrameworkMatchSome, f.DependencyMatch.Strategy)
+	}
+	if len(f.DependencyMatch.Dependencies) == 0 {
+		return fmt.Errorf("framework %v: \"dependencies\" must not be empty", f.Slug)
+	}
+	if len(f.EnvPrefixes) == 0 {
+		return fmt.Errorf("framework %v: \"envPrefixes\" must not be empty", f.Slug)
+	}
+	return nil
 }
 
 type rawTask struct {
@@ -54,7 +136,25 @@ type rawTask struct {
 	Inputs     []string            `json:"inputs"`
 	OutputMode util.TaskOutputMode `json:"outputMode"`
 	Env        []string            `json:"env"`
-	Persistent bool                `json:"persistent"`
+	// PassThroughEnv are environment variables passed to the task in strict env mode,
+	// without being hashed
+	PassThroughEnv []string `json:"passThroughEnv"`
+	// DotEnv are .env files, relative to the package, that are loaded into the task's
+	// environment and hashed
+	DotEnv []string `json:"dotEnv"`
+	// FrameworkInference is false to stop hashing the env vars of the package's framework
+	FrameworkInference *bool `json:"frameworkInference"`
+	Persistent         bool  `json:"persistent"`
+	// Timeout is a duration, such as "10m", after which the task is stopped
+	Timeout string `json:"timeout,omitempty"`
+	// Retries is how many times the task is run again after it fails
+	Retries int `json:"retries,omitempty"`
+	// RetryBackoff is a duration to wait before the first retry, which doubles for each one after
+	RetryBackoff string `json:"retryBackoff,omitempty"`
+	// Weight is how many concurrency slots the task takes
+	Weight *int `json:"weight,omitempty"`
+	// Resources are names of mutual-exclusion groups, of which only one task runs at a time
+	Resources []string `json:"resources,omitempty"`
 }
 
 // Pipeline is a struct for deserializing .pipeline in configFile
@@ -68,6 +168,18 @@ type TaskDefinition struct {
 	// This field is custom-marshalled from rawTask.Env and rawTask.DependsOn
 	EnvVarDependencies []string
 
+	// PassThroughEnv are environment variables that the task can read in strict env
+	// mode, but that are not part of its hash
+	PassThroughEnv []string
+
+	// DotEnv are .env files, relative to the package, that are loaded into the task's
+	// environment and hashed. They're in order of precedence, so they aren't sorted.
+	DotEnv []string
+
+	// SkipFrameworkInference stops the env vars of the package's framework from being
+	// hashed. It's custom-marshalled from rawTask.FrameworkInference.
+	SkipFrameworkInference bool
+
 	// TopologicalDependencies are tasks from package dependencies.
 	// E.g. "build" is a topological dependency in:
 	// dependsOn: ['^build'].
@@ -90,6 +202,26 @@ type TaskDefinition struct {
 	// Persistent indicates whether the Task is expected to exit or not
 	// Tasks marked Persistent do not exit (e.g. --watch mode or dev servers)
 	Persistent bool
+
+	// Timeout is how long the task may run before it's stopped. It isn't hashed,
+	// and 0 lets the task run forever.
+	Timeout time.Duration
+
+	// Retries is how many times the task is run again after it fails, before the
+	// failure is reported. Like Timeout, it isn't hashed.
+	Retries int
+
+	// RetryBackoff is how long to wait before the first retry. It doubles for each
+	// retry after that.
+	RetryBackoff time.Duration
+
+	// Weight is how many of the run's concurrency slots the task takes while it runs.
+	// It's 0 when it isn't set, in which case the task takes 1 slot.
+	Weight int
+
+	// Resources name mutual-exclusion groups. Tasks that share a resource never run at
+	// the same time, e.g. two suites that bind the same port.
+	Resources []string
 }
 
 // GetTask returns a TaskDefinition based on the ID (package#task format) or name (e.g. "build")
@@ -167,6 +299,199 @@ func LoadTurboConfig(rootPath turbopath.AbsoluteSystemPath, rootPackageJSON *Pac
 	return turboJSON, nil
 }
 
+// RootWorkspaceReference is the only workspace that a workspace's turbo.json may extend,
+// the root of the monorepo
+const RootWorkspaceReference = "//"
+
+// WorkspaceTurboJSON is a turbo.json in a workspace, which extends the root turbo.json.
+// Its tasks override the root pipeline's definitions of the same tasks, but only for
+// that workspace, and only in the fields that they set.
+type WorkspaceTurboJSON struct {
+	Extends  []string
+	Pipeline Pipeline
+	// taskFields are the keys set by each task in Pipeline
+	taskFields map[string]util.Set
+}
+
+// rawWorkspaceTurboJSON keeps each task's JSON, so that we know which fields it sets
+type rawWorkspaceTurboJSON struct {
+	Extends  []string                   `json:"extends"`
+	Pipeline map[string]json.RawMessage `json:"pipeline"`
+}
+
+// _workspaceTurboJSONKeys are the only keys allowed at the top level of a workspace's turbo.json.
+// Everything else applies to the whole monorepo, and belongs in the root turbo.json.
+var _workspaceTurboJSONKeys = util.SetFromStrings([]string{"$schema", "extends", "pipeline"})
+
+// ReadWorkspaceTurboConfig reads the turbo.json in workspaceDir, if there is one. The error
+// wraps os.ErrNotExist if there isn't.
+func ReadWorkspaceTurboConfig(workspaceDir turbopath.AbsoluteSystemPath) (*WorkspaceTurboJSON, error) {
+	turboJSONPath := workspaceDir.UntypedJoin(configFile)
+	if !turboJSONPath.FileExists() {
+		return nil, errors.Wrapf(os.ErrNotExist, "Could not find %s", turboJSONPath)
+	}
+	data, err := turboJSONPath.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	workspaceTurboJSON, err := parseWorkspaceTurboJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", turboJSONPath, err)
+	}
+	return workspaceTurboJSON, nil
+}
+
+func parseWorkspaceTurboJSON(data []byte) (*WorkspaceTurboJSON, error) {
+	var keys map[string]json.RawMessage
+	if err := jsonc.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for key := range keys {
+		if !_workspaceTurboJSONKeys.Includes(key) {
+			return nil, fmt.Errorf("\"%s\" can only be set in the root %s", key, configFile)
+		}
+	}
+	raw := &rawWorkspaceTurboJSON{}
+	if err := jsonc.Unmarshal(data, raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Extends) != 1 || raw.Extends[0] != RootWorkspaceReference {
+		return nil, fmt.Errorf("\"extends\" must be [\"%s\"], to extend the root %s", RootWorkspaceReference, configFile)
+	}
+
+	workspaceTurboJSON := &WorkspaceTurboJSON{
+		Extends:    raw.Extends,
+		Pipeline:   make(Pipeline, len(raw.Pipeline)),
+		taskFields: make(map[string]util.Set, len(raw.Pipeline)),
+	}
+	for taskName, taskJSON := range raw.Pipeline {
+		if util.IsPackageTask(taskName) {
+			return nil, fmt.Errorf("%v: tasks in a workspace's %s apply to that workspace, so they can't be package tasks (<package>#<task>)", taskName, configFile)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(taskJSON, &fields); err != nil {
+			return nil, fmt.Errorf("%v: %w", taskName, err)
+		}
+		task := rawTask{}
+		if err := json.Unmarshal(taskJSON, &task); err != nil {
+			return nil, fmt.Errorf("%v: %w", taskName, err)
+		}
+		for _, dependency := range task.DependsOn {
+			if strings.HasPrefix(dependency, envPipelineDelimiter) {
+				return nil, fmt.Errorf("%v: found %s in \"dependsOn\". Declare environment variables with the \"env\" key", taskName, dependency)
+			}
+			if util.IsPackageTask(dependency) {
+				return nil, fmt.Errorf("%v: found %s in \"dependsOn\". Tasks in other workspaces can only be depended on from the root %s", taskName, dependency, configFile)
+			}
+		}
+		var taskDefinition TaskDefinition
+		if err := json.Unmarshal(taskJSON, &taskDefinition); err != nil {
+			return nil, fmt.Errorf("%v: %w", taskName, err)
+		}
+		workspaceTurboJSON.Pipeline[taskName] = taskDefinition
+		taskFields := make(util.Set, len(fields))
+		for field := range fields {
+			taskFields.Add(field)
+		}
+		workspaceTurboJSON.taskFields[taskName] = taskFields
+	}
+	return workspaceTurboJSON, nil
+}
+
+// ResolveTask returns the definition of taskName in the workspace: base, the definition
+// from the root pipeline, with the fields that the workspace's turbo.json sets for the task
+// overriding it. base is nil if the root pipeline doesn't define the task, in which case
+// the workspace's definition is used as it is. ok is false if neither defines the task.
+// A nil WorkspaceTurboJSON, for a workspace without a turbo.json, returns base.
+func (w *WorkspaceTurboJSON) ResolveTask(taskName string, base *TaskDefinition) (*TaskDefinition, bool) {
+	if w == nil {
+		return base, base != nil
+	}
+	override, ok := w.Pipeline[taskName]
+	if !ok {
+		return base, base != nil
+	}
+	if base == nil {
+		return &override, true
+	}
+	resolved := *base
+	for field := range w.taskFields[taskName] {
+		switch field {
+		case "outputs":
+			resolved.Outputs = override.Outputs
+		case "cache":
+			resolved.ShouldCache = override.ShouldCache
+		case "dependsOn":
+			resolved.TopologicalDependencies = override.TopologicalDependencies
+			resolved.TaskDependencies = override.TaskDependencies
+		case "inputs":
+			resolved.Inputs = override.Inputs
+		case "outputMode":
+			resolved.OutputMode = override.OutputMode
+		case "env":
+			resolved.EnvVarDependencies = override.EnvVarDependencies
+		case "passThroughEnv":
+			resolved.PassThroughEnv = override.PassThroughEnv
+		case "dotEnv":
+			resolved.DotEnv = override.DotEnv
+		case "frameworkInference":
+			resolved.SkipFrameworkInference = override.SkipFrameworkInference
+		case "persistent":
+			resolved.Persistent = override.Persistent
+		case "timeout":
+			resolved.Timeout = override.Timeout
+		case "retries":
+			resolved.Retries = override.Retries
+		case "retryBackoff":
+			resolved.RetryBackoff = override.RetryBackoff
+		case "weight":
+			resolved.Weight = override.Weight
+		case "resources":
+			resolved.Resources = override.Resources
+		}
+	}
+	return &resolved, true
+}
+
+// TurboJSONKeys returns the keys allowed at the top level of the root turbo.json
+func TurboJSONKeys() []string {
+	return append([]string{"$schema"}, jsonKeys(reflect.TypeOf(rawTurboJSON{}))...)
+}
+
+// WorkspaceTurboJSONKeys returns the keys allowed at the top level of a workspace's turbo.json
+func WorkspaceTurboJSONKeys() []string {
+	return _workspaceTurboJSONKeys.UnsafeListOfStrings()
+}
+
+// TaskKeys returns the keys allowed in a task definition
+func TaskKeys() []string {
+	return jsonKeys(reflect.TypeOf(rawTask{}))
+}
+
+// RemoteCacheKeys returns the keys allowed in "remoteCache"
+func RemoteCacheKeys() []string {
+	return jsonKeys(reflect.TypeOf(RemoteCacheOptions{}))
+}
+
+// jsonKeys returns the JSON keys of a struct's fields. Fields without a json tag are
+// matched case-insensitively by encoding/json, so their keys are the field name, starting
+// with a lowercase letter.
+func jsonKeys(structType reflect.Type) []string {
+	keys := make([]string, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name[:1]) + field.Name[1:]
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // TaskOutputs represents the patterns for including and excluding files from outputs
 type TaskOutputs struct {
 	Inclusions []string
@@ -301,10 +626,8 @@ func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 
 	// Append env key into EnvVarDependencies
 	for _, value := range task.Env {
-		if strings.HasPrefix(value, envPipelineDelimiter) {
-			// Hard error to help people specify this correctly during migration.
-			// TODO: Remove this error after we have run summary.
-			return fmt.Errorf("You specified \"%s\" in the \"env\" key. You should not prefix your environment variables with \"$\"", value)
+		if err := ValidateEnvPattern("env", value); err != nil {
+			return err
 		}
 
 		envVarDependencies.Add(value)
@@ -312,26 +635,127 @@ func (c *TaskDefinition) UnmarshalJSON(data []byte) error {
 
 	c.EnvVarDependencies = envVarDependencies.UnsafeListOfStrings()
 	sort.Strings(c.EnvVarDependencies)
+
+	passThroughEnv, err := parsePassThroughEnv("passThroughEnv", task.PassThroughEnv)
+	if err != nil {
+		return err
+	}
+	c.PassThroughEnv = passThroughEnv
+	c.DotEnv = task.DotEnv
+	c.SkipFrameworkInference = task.FrameworkInference != nil && !*task.FrameworkInference
 	// Note that we don't require Inputs to be sorted, we're going to
 	// hash the resulting files and sort that instead
 	c.Inputs = task.Inputs
 	c.OutputMode = task.OutputMode
 	c.Persistent = task.Persistent
+	if task.Timeout != "" {
+		timeout, err := ParseDuration("timeout", task.Timeout)
+		if err != nil {
+			return err
+		}
+		c.Timeout = timeout
+	}
+	if task.Retries < 0 {
+		return fmt.Errorf("invalid retries %v, expected 0 or more", task.Retries)
+	}
+	c.Retries = task.Retries
+	if task.RetryBackoff != "" {
+		retryBackoff, err := ParseDuration("retryBackoff", task.RetryBackoff)
+		if err != nil {
+			return err
+		}
+		c.RetryBackoff = retryBackoff
+	}
+	if task.Weight != nil {
+		if *task.Weight < 1 {
+			return fmt.Errorf("invalid weight %v, expected 1 or more", *task.Weight)
+		}
+		c.Weight = *task.Weight
+	}
+	if len(task.Resources) > 0 {
+		resources := make(util.Set)
+		for _, resource := range task.Resources {
+			if resource == "" {
+				return fmt.Errorf("\"resources\" must not contain an empty name")
+			}
+			resources.Add(resource)
+		}
+		c.Resources = resources.UnsafeListOfStrings()
+		sort.Strings(c.Resources)
+	}
+	return nil
+}
+
+// ParseDuration parses the value of key, a duration such as "90s" or "10m", which is
+// either "timeout" or "retryBackoff"
+func ParseDuration(key string, value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive duration such as \"90s\" or \"10m\"", key, value)
+	}
+	return duration, nil
+}
+
+// ValidateEnvPattern checks an entry of key, such as "env" or "globalEnv". Entries are variable
+// names, which may contain * wildcards, and may be prefixed with ! to exclude the variables they match.
+func ValidateEnvPattern(key string, value string) error {
+	name := strings.TrimPrefix(value, "!")
+	if strings.HasPrefix(name, envPipelineDelimiter) {
+		// Hard error to help people specify this correctly during migration.
+		// TODO: Remove this error after we have run summary.
+		return fmt.Errorf("You specified \"%s\" in the \"%s\" key. You should not prefix your environment variables with \"%s\"", value, key, envPipelineDelimiter)
+	}
+	if name == "" || strings.HasPrefix(name, "!") {
+		return fmt.Errorf("You specified \"%s\" in the \"%s\" key, which is not a valid environment variable pattern", value, key)
+	}
 	return nil
 }
 
+// parsePassThroughEnv validates and sorts the entries of key, either "passThroughEnv" or
+// "globalPassThroughEnv"
+func parsePassThroughEnv(key string, values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	passThroughEnv := make(util.Set)
+	for _, value := range values {
+		if err := ValidateEnvPattern(key, value); err != nil {
+			return nil, err
+		}
+		passThroughEnv.Add(value)
+	}
+	passThroughEnvList := passThroughEnv.UnsafeListOfStrings()
+	sort.Strings(passThroughEnvList)
+	return passThroughEnvList, nil
+}
+
 // MarshalJSON deserializes JSON into a TaskDefinition
 func (c *TaskDefinition) MarshalJSON() ([]byte, error) {
 	// Initialize with empty arrays, so we get empty arrays serialized into JSON
 	task := rawTask{
-		Outputs:   []string{},
-		Inputs:    []string{},
-		Env:       []string{},
-		DependsOn: []string{},
+		Outputs:        []string{},
+		Inputs:         []string{},
+		Env:            []string{},
+		PassThroughEnv: []string{},
+		DotEnv:         []string{},
+		DependsOn:      []string{},
 	}
 
 	task.Persistent = c.Persistent
+	if c.Timeout > 0 {
+		task.Timeout = c.Timeout.String()
+	}
+	task.Retries = c.Retries
+	if c.RetryBackoff > 0 {
+		task.RetryBackoff = c.RetryBackoff.String()
+	}
+	if c.Weight > 0 {
+		task.Weight = &c.Weight
+	}
+	task.Resources = c.Resources
 	task.Cache = &c.ShouldCache
+	frameworkInference := !c.SkipFrameworkInference
+	task.FrameworkInference = &frameworkInference
 	task.OutputMode = c.OutputMode
 
 	if len(c.Inputs) > 0 {
@@ -342,6 +766,14 @@ func (c *TaskDefinition) MarshalJSON() ([]byte, error) {
 		task.Env = append(task.Env, c.EnvVarDependencies...)
 	}
 
+	if len(c.PassThroughEnv) > 0 {
+		task.PassThroughEnv = append(task.PassThroughEnv, c.PassThroughEnv...)
+	}
+
+	if len(c.DotEnv) > 0 {
+		task.DotEnv = append(task.DotEnv, c.DotEnv...)
+	}
+
 	if len(c.Outputs.Inclusions) > 0 {
 		task.Outputs = append(task.Outputs, c.Outputs.Inclusions...)
 	}
@@ -363,6 +795,7 @@ func (c *TaskDefinition) MarshalJSON() ([]byte, error) {
 	sort.Strings(task.DependsOn)
 	sort.Strings(task.Outputs)
 	sort.Strings(task.Env)
+	sort.Strings(task.PassThroughEnv)
 	sort.Strings(task.Inputs)
 
 	return json.Marshal(task)
@@ -379,10 +812,8 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 	globalFileDependencies := make(util.Set)
 
 	for _, value := range raw.GlobalEnv {
-		if strings.HasPrefix(value, envPipelineDelimiter) {
-			// Hard error to help people specify this correctly during migration.
-			// TODO: Remove this error after we have run summary.
-			return fmt.Errorf("You specified \"%s\" in the \"env\" key. You should not prefix your environment variables with \"%s\"", value, envPipelineDelimiter)
+		if err := ValidateEnvPattern("env", value); err != nil {
+			return err
 		}
 
 		envVarDependencies.Add(value)
@@ -397,6 +828,11 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	globalPassThroughEnv, err := parsePassThroughEnv("globalPassThroughEnv", raw.GlobalPassThroughEnv)
+	if err != nil {
+		return err
+	}
+
 	// turn the set into an array and assign to the TurboJSON struct fields.
 	c.GlobalEnv = envVarDependencies.UnsafeListOfStrings()
 	sort.Strings(c.GlobalEnv)
@@ -406,6 +842,16 @@ func (c *TurboJSON) UnmarshalJSON(data []byte) error {
 	// copy these over, we don't need any changes here.
 	c.Pipeline = raw.Pipeline
 	c.RemoteCacheOptions = raw.RemoteCacheOptions
+	c.CachePolicy = raw.CachePolicy
+	c.EnvMode = raw.EnvMode
+	c.GlobalPassThroughEnv = globalPassThroughEnv
+	c.GlobalDotEnv = raw.GlobalDotEnv
+	for i := range raw.Frameworks {
+		if err := raw.Frameworks[i].validate(); err != nil {
+			return err
+		}
+	}
+	c.Frameworks = raw.Frameworks
 
 	return nil
 }
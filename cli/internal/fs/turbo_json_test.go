@@ -1,11 +1,14 @@
 package fs
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vercel/turbo/cli/internal/turbopath"
@@ -72,7 +75,7 @@ func Test_ReadTurboConfig(t *testing.T) {
 	}
 
 	validateOutput(t, turboJSON, pipelineExpected)
-	remoteCacheOptionsExpected := RemoteCacheOptions{"team_id", true}
+	remoteCacheOptionsExpected := RemoteCacheOptions{TeamID: "team_id", Signature: true}
 	assert.EqualValues(t, remoteCacheOptionsExpected, turboJSON.RemoteCacheOptions)
 }
 
@@ -119,7 +122,7 @@ func Test_LoadTurboConfig_BothCorrectAndLegacy(t *testing.T) {
 
 	validateOutput(t, turboJSON, pipelineExpected)
 
-	remoteCacheOptionsExpected := RemoteCacheOptions{"team_id", true}
+	remoteCacheOptionsExpected := RemoteCacheOptions{TeamID: "team_id", Signature: true}
 	assert.EqualValues(t, remoteCacheOptionsExpected, turboJSON.RemoteCacheOptions)
 	assert.Equal(t, rootPackageJSON.LegacyTurboConfig == nil, true)
 }
@@ -171,6 +174,242 @@ func Test_ReadTurboConfig_EnvDeclarations(t *testing.T) {
 	assert.EqualValues(t, sortedArray([]string{"somefile.txt"}), sortedArray(turboJSON.GlobalDeps))
 }
 
+func Test_ReadTurboConfig_EnvPatterns(t *testing.T) {
+	testDir := getTestDir(t, "env-patterns")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	// Patterns are kept as written, and resolved against the environment when hashing
+	assert.EqualValues(t, []string{"!APP_FEATURE_DEBUG", "API_URL", "APP_FEATURE_*"}, turboJSON.Pipeline["build"].EnvVarDependencies)
+	assert.EqualValues(t, []string{"!CI_JOB_ID", "CI_*"}, turboJSON.GlobalEnv)
+}
+
+func Test_ReadTurboConfig_InvalidEnvPattern(t *testing.T) {
+	testDir := getTestDir(t, "invalid-env-pattern")
+	_, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+	expectedErrorMsg := "turbo.json: You specified \"!\" in the \"env\" key, which is not a valid environment variable pattern"
+	assert.EqualErrorf(t, turboJSONReadErr, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, turboJSONReadErr)
+}
+
+func Test_ReadTurboConfig_PassThroughEnv(t *testing.T) {
+	testDir := getTestDir(t, "pass-through-env")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	build := turboJSON.Pipeline["build"]
+	assert.EqualValues(t, []string{"API_URL"}, build.EnvVarDependencies)
+	assert.EqualValues(t, []string{"AWS_SESSION_TOKEN", "CI_JOB_ID"}, build.PassThroughEnv)
+	assert.Nil(t, turboJSON.Pipeline["lint"].PassThroughEnv)
+	assert.EqualValues(t, []string{"AWS_*", "SSH_AUTH_SOCK"}, turboJSON.GlobalPassThroughEnv)
+
+	// passThroughEnv is shown in the resolved task definition in dry-run output
+	bytes, err := json.Marshal(&build)
+	if err != nil {
+		t.Fatalf("failed to marshal task definition: %v", err)
+	}
+	var marshalled struct {
+		PassThroughEnv []string `json:"passThroughEnv"`
+	}
+	if err := json.Unmarshal(bytes, &marshalled); err != nil {
+		t.Fatalf("failed to unmarshal task definition: %v", err)
+	}
+	assert.EqualValues(t, build.PassThroughEnv, marshalled.PassThroughEnv)
+}
+
+func Test_ReadTurboConfig_DotEnv(t *testing.T) {
+	testDir := getTestDir(t, "dot-env")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	// Files are in order of precedence, so they keep their order
+	assert.EqualValues(t, []string{".env.production.local", ".env.local", ".env.production", ".env"}, turboJSON.Pipeline["build"].DotEnv)
+	assert.Nil(t, turboJSON.Pipeline["lint"].DotEnv)
+	assert.EqualValues(t, []string{".env"}, turboJSON.GlobalDotEnv)
+}
+
+func Test_ReadTurboConfig_Frameworks(t *testing.T) {
+	testDir := getTestDir(t, "frameworks")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	assert.EqualValues(t, []FrameworkDefinition{
+		{
+			Slug:        "acme",
+			EnvPrefixes: []string{"ACME_PUBLIC_"},
+			DependencyMatch: FrameworkDependencyMatch{
+				Strategy:     FrameworkMatchSome,
+				Dependencies: []string{"acme", "acme-cli"},
+			},
+		},
+	}, turboJSON.Frameworks)
+	assert.False(t, turboJSON.Pipeline["build"].SkipFrameworkInference)
+	assert.True(t, turboJSON.Pipeline["lint"].SkipFrameworkInference)
+}
+
+func Test_ReadTurboConfig_InvalidFramework(t *testing.T) {
+	testDir := getTestDir(t, "invalid-framework")
+	_, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+	expectedErrorMsg := "turbo.json: framework acme: \"strategy\" must be \"all\" or \"some\", got \"any\""
+	assert.EqualErrorf(t, turboJSONReadErr, expectedErrorMsg, "Error should be: %v, got: %v", expectedErrorMsg, turboJSONReadErr)
+}
+
+func Test_ReadTurboConfig_Timeout(t *testing.T) {
+	testDir := getTestDir(t, "timeout")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	test := turboJSON.Pipeline["test"]
+	assert.Equal(t, 10*time.Minute, test.Timeout)
+	assert.Equal(t, time.Duration(0), turboJSON.Pipeline["build"].Timeout)
+
+	bytes, err := json.Marshal(&test)
+	if err != nil {
+		t.Fatalf("failed to marshal task definition: %v", err)
+	}
+	assert.Contains(t, string(bytes), `"timeout":"10m0s"`)
+
+	for _, timeout := range []string{"10", "-1m", "0s"} {
+		err := json.Unmarshal([]byte(fmt.Sprintf(`{"timeout": %q}`, timeout)), &TaskDefinition{})
+		assert.EqualError(t, err, fmt.Sprintf("invalid timeout %q, expected a positive duration such as \"90s\" or \"10m\"", timeout))
+	}
+}
+
+func Test_ReadTurboConfig_Retries(t *testing.T) {
+	testDir := getTestDir(t, "retries")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	e2e := turboJSON.Pipeline["e2e"]
+	assert.Equal(t, 2, e2e.Retries)
+	assert.Equal(t, 5*time.Second, e2e.RetryBackoff)
+	assert.Equal(t, 0, turboJSON.Pipeline["build"].Retries)
+
+	bytes, err := json.Marshal(&e2e)
+	if err != nil {
+		t.Fatalf("failed to marshal task definition: %v", err)
+	}
+	assert.Contains(t, string(bytes), `"retries":2,"retryBackoff":"5s"`)
+
+	err = json.Unmarshal([]byte(`{"retries": -1}`), &TaskDefinition{})
+	assert.EqualError(t, err, "invalid retries -1, expected 0 or more")
+	err = json.Unmarshal([]byte(`{"retryBackoff": "soon"}`), &TaskDefinition{})
+	assert.EqualError(t, err, `invalid retryBackoff "soon", expected a positive duration such as "90s" or "10m"`)
+}
+
+func Test_ReadTurboConfig_Concurrency(t *testing.T) {
+	testDir := getTestDir(t, "concurrency")
+	turboJSON, turboJSONReadErr := ReadTurboConfig(testDir.UntypedJoin("turbo.json"))
+
+	if turboJSONReadErr != nil {
+		t.Fatalf("invalid parse: %#v", turboJSONReadErr)
+	}
+
+	build := turboJSON.Pipeline["build"]
+	assert.Equal(t, 4, build.Weight)
+	assert.EqualValues(t, []string{"db", "port-3000"}, turboJSON.Pipeline["e2e"].Resources)
+	assert.Equal(t, 0, turboJSON.Pipeline["lint"].Weight)
+	assert.Nil(t, turboJSON.Pipeline["lint"].Resources)
+
+	bytes, err := json.Marshal(&build)
+	if err != nil {
+		t.Fatalf("failed to marshal task definition: %v", err)
+	}
+	assert.Contains(t, string(bytes), `"weight":4`)
+
+	err = json.Unmarshal([]byte(`{"weight": 0}`), &TaskDefinition{})
+	assert.EqualError(t, err, "invalid weight 0, expected 1 or more")
+	err = json.Unmarshal([]byte(`{"resources": [""]}`), &TaskDefinition{})
+	assert.EqualError(t, err, `"resources" must not contain an empty name`)
+}
+
+func Test_ReadWorkspaceTurboConfig(t *testing.T) {
+	testDir := getTestDir(t, "workspace")
+	workspaceTurboJSON, err := ReadWorkspaceTurboConfig(testDir)
+	if err != nil {
+		t.Fatalf("invalid parse: %#v", err)
+	}
+	assert.EqualValues(t, []string{RootWorkspaceReference}, workspaceTurboJSON.Extends)
+
+	rootBuild := &TaskDefinition{
+		Outputs:                 TaskOutputs{Inclusions: []string{"dist/**"}},
+		ShouldCache:             true,
+		EnvVarDependencies:      []string{"NODE_ENV"},
+		TopologicalDependencies: []string{"build"},
+		TaskDependencies:        []string{},
+		Inputs:                  []string{"src/**"},
+	}
+	build, ok := workspaceTurboJSON.ResolveTask("build", rootBuild)
+	assert.True(t, ok)
+	assert.EqualValues(t, &TaskDefinition{
+		Outputs:                 TaskOutputs{Inclusions: []string{".next/**"}, Exclusions: []string{".next/cache/**"}},
+		ShouldCache:             true,
+		EnvVarDependencies:      []string{"NEXT_PUBLIC_API_URL"},
+		TopologicalDependencies: []string{"build"},
+		TaskDependencies:        []string{},
+		Inputs:                  []string{"src/**"},
+	}, build)
+	// The root pipeline's definition isn't changed
+	assert.EqualValues(t, []string{"dist/**"}, rootBuild.Outputs.Inclusions)
+
+	// Tasks only defined by the workspace are used as they are
+	deploy, ok := workspaceTurboJSON.ResolveTask("deploy", nil)
+	assert.True(t, ok)
+	assert.False(t, deploy.ShouldCache)
+	assert.EqualValues(t, []string{"build"}, deploy.TaskDependencies)
+
+	lint := &TaskDefinition{ShouldCache: true}
+	resolvedLint, ok := workspaceTurboJSON.ResolveTask("lint", lint)
+	assert.True(t, ok)
+	assert.Equal(t, lint, resolvedLint)
+	_, ok = workspaceTurboJSON.ResolveTask("test", nil)
+	assert.False(t, ok)
+
+	// Workspaces without a turbo.json use the root pipeline's definitions
+	var noTurboJSON *WorkspaceTurboJSON
+	resolvedLint, ok = noTurboJSON.ResolveTask("lint", lint)
+	assert.True(t, ok)
+	assert.Equal(t, lint, resolvedLint)
+}
+
+func Test_ReadWorkspaceTurboConfig_Invalid(t *testing.T) {
+	testDir := getTestDir(t, "invalid-workspace-extends")
+	_, err := ReadWorkspaceTurboConfig(testDir)
+	expectedErrorMsg := testDir.UntypedJoin("turbo.json").ToString() + ": \"extends\" must be [\"//\"], to extend the root turbo.json"
+	assert.EqualError(t, err, expectedErrorMsg)
+
+	_, err = ReadWorkspaceTurboConfig(getTestDir(t, "legacy-only"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	testCases := map[string]string{
+		`{"extends": ["//"], "globalEnv": ["CI"], "pipeline": {}}`:                        `"globalEnv" can only be set in the root turbo.json`,
+		`{"extends": ["//"], "pipeline": {"web#build": {}}}`:                              "web#build: tasks in a workspace's turbo.json apply to that workspace, so they can't be package tasks (<package>#<task>)",
+		`{"extends": ["//"], "pipeline": {"build": {"dependsOn": ["docs#build"]}}}`:       "build: found docs#build in \"dependsOn\". Tasks in other workspaces can only be depended on from the root turbo.json",
+		`{"extends": ["//"], "pipeline": {"build": {"dependsOn": ["$NEXT_PUBLIC_URL"]}}}`: "build: found $NEXT_PUBLIC_URL in \"dependsOn\". Declare environment variables with the \"env\" key",
+	}
+	for contents, expected := range testCases {
+		_, err := parseWorkspaceTurboJSON([]byte(contents))
+		assert.EqualError(t, err, expected)
+	}
+}
+
 func Test_TaskOutputsSort(t *testing.T) {
 	inclusions := []string{"foo/**", "bar"}
 	exclusions := []string{"special-file", ".hidden/**"}
@@ -23,6 +23,10 @@ type CompleteGraph struct {
 	// Pipeline is config from turbo.json
 	Pipeline fs.Pipeline
 
+	// WorkspaceTurboJSONs are the turbo.json files in workspaces, by package name.
+	// Workspaces without one aren't included.
+	WorkspaceTurboJSONs map[string]*fs.WorkspaceTurboJSON
+
 	// WorkspaceInfos stores the package.json contents by package name
 	WorkspaceInfos WorkspaceInfos
 
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/doublestar"
 	"github.com/vercel/turbo/cli/internal/encoding/gitoutput"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/globby"
@@ -26,57 +27,129 @@ type PackageDepsOptions struct {
 	InputPatterns []string
 }
 
+// RootInputPrefix marks an input glob that is relative to the repository root, rather
+// than to the package, e.g. "$ROOT/tsconfig.base.json"
+const RootInputPrefix = "$ROOT/"
+
+// splitInputPatterns splits a task's input globs into inclusions and exclusions, which are
+// the globs prefixed with ! with the prefix removed. Globs anchored with RootInputPrefix are
+// made relative to the package, so that every glob and every file that is hashed is
+// relative to the package.
+func splitInputPatterns(rootPath turbopath.AbsoluteSystemPath, pkgPath turbopath.AbsoluteSystemPath, inputPatterns []string) ([]string, []string, error) {
+	inclusions := []string{}
+	exclusions := []string{}
+	for _, pattern := range inputPatterns {
+		isExclusion := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if strings.HasPrefix(pattern, RootInputPrefix) {
+			rootRelative := strings.TrimPrefix(pattern, RootInputPrefix)
+			if rootRelative == "" {
+				return nil, nil, fmt.Errorf("input %q does not match any files", pattern)
+			}
+			packageRelative, err := pkgPath.PathTo(rootPath.UntypedJoin(rootRelative))
+			if err != nil {
+				return nil, nil, err
+			}
+			pattern = filepath.ToSlash(packageRelative)
+		}
+		if isExclusion {
+			exclusions = append(exclusions, pattern)
+		} else {
+			inclusions = append(inclusions, pattern)
+		}
+	}
+	return inclusions, exclusions, nil
+}
+
+// rerootPatterns makes globs that are relative to the package relative to the repository root
+func rerootPatterns(rootPath turbopath.AbsoluteSystemPath, pkgPath turbopath.AbsoluteSystemPath, patterns []string) ([]string, error) {
+	rerootedPatterns := make([]string, len(patterns))
+	for index, pattern := range patterns {
+		rerooted, err := rootPath.PathTo(pkgPath.UntypedJoin(pattern))
+		if err != nil {
+			return nil, err
+		}
+		rerootedPatterns[index] = rerooted
+	}
+	return rerootedPatterns, nil
+}
+
+// GlobInputFiles returns the files matched by a task's input globs, relative to the package.
+// Globs are relative to the package unless they start with RootInputPrefix, and globs
+// prefixed with ! exclude the files they match, from all of the package's files if there
+// are no other globs. The package's package.json is always included.
+func GlobInputFiles(rootPath turbopath.AbsoluteSystemPath, pkgPath turbopath.AbsoluteSystemPath, inputPatterns []string) ([]turbopath.AnchoredSystemPath, error) {
+	inclusions, exclusions, err := splitInputPatterns(rootPath, pkgPath, inputPatterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(inclusions) == 0 {
+		// Inputs that only exclude files apply to all of the files in the package
+		inclusions = []string{"**"}
+	}
+	rerootedInclusions, err := rerootPatterns(rootPath, pkgPath, inclusions)
+	if err != nil {
+		return nil, err
+	}
+	rerootedExclusions, err := rerootPatterns(rootPath, pkgPath, exclusions)
+	if err != nil {
+		return nil, err
+	}
+
+	absoluteFilesToHash, err := globby.GlobFiles(rootPath.ToStringDuringMigration(), rerootedInclusions, rerootedExclusions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve input globs %v", inputPatterns)
+	}
+
+	// If the `scripts` in the package.json change (i.e. the tasks that turbo executes), we
+	// want a cache miss, since any existing cache could be invalid.
+	packageJSONPath := pkgPath.UntypedJoin("package.json")
+	hasPackageJSON := false
+	filesToHash := make([]turbopath.AnchoredSystemPath, 0, len(absoluteFilesToHash)+1)
+	for _, rawPath := range absoluteFilesToHash {
+		relativePathString, err := pkgPath.RelativePathString(rawPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "not relative to package: %v", rawPath)
+		}
+		hasPackageJSON = hasPackageJSON || rawPath == packageJSONPath.ToString()
+		filesToHash = append(filesToHash, turbopath.AnchoredSystemPathFromUpstream(relativePathString))
+	}
+	if !hasPackageJSON && packageJSONPath.FileExists() {
+		filesToHash = append(filesToHash, turbopath.AnchoredSystemPathFromUpstream("package.json"))
+	}
+	return filesToHash, nil
+}
+
 // GetPackageDeps Builds an object containing git hashes for the files under the specified `packagePath` folder.
 func GetPackageDeps(rootPath turbopath.AbsoluteSystemPath, p *PackageDepsOptions) (map[turbopath.AnchoredUnixPath]string, error) {
 	pkgPath := rootPath.UntypedJoin(p.PackagePath.ToStringDuringMigration())
 	// Add all the checked in hashes.
 	var result map[turbopath.AnchoredUnixPath]string
 
-	// make a copy of the inputPatterns array, because we may be appending to it later.
-	calculatedInputs := make([]string, len(p.InputPatterns))
-	copy(calculatedInputs, p.InputPatterns)
+	inclusions, exclusions, err := splitInputPatterns(rootPath, pkgPath, p.InputPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// The patterns to check the repo status of, relative to the package
+	var statusPatterns []string
 
-	if len(calculatedInputs) == 0 {
+	if len(inclusions) == 0 {
+		// Inputs that only exclude files apply to all of the files in the package
 		gitLsTreeOutput, err := gitLsTree(pkgPath)
 		if err != nil {
 			return nil, fmt.Errorf("could not get git hashes for files in package %s: %w", p.PackagePath, err)
 		}
 		result = gitLsTreeOutput
-	} else {
-
-		// Add in package.json to input patterns because if the `scripts` in
-		// the package.json change (i.e. the tasks that turbo executes), we want
-		// a cache miss, since any existing cache could be invalid.
-		// Note this package.json will be resolved relative to the pkgPath.
-		calculatedInputs = append(calculatedInputs, "package.json")
-
-		// The input patterns are relative to the package.
-		// However, we need to change the globbing to be relative to the repo root.
-		// Prepend the package path to each of the input patterns.
-		prefixedInputPatterns := make([]string, len(calculatedInputs))
-		for index, pattern := range calculatedInputs {
-			rerooted, err := rootPath.PathTo(pkgPath.UntypedJoin(pattern))
-			if err != nil {
-				return nil, err
+		for filePath := range result {
+			if isExcludedInput(exclusions, filePath) {
+				delete(result, filePath)
 			}
-			prefixedInputPatterns[index] = rerooted
 		}
-
-		absoluteFilesToHash, err := globby.GlobFiles(rootPath.ToStringDuringMigration(), prefixedInputPatterns, nil)
-
+	} else {
+		filesToHash, err := GlobInputFiles(rootPath, pkgPath, p.InputPatterns)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to resolve input globs %v", calculatedInputs)
-		}
-
-		filesToHash := make([]turbopath.AnchoredSystemPath, len(absoluteFilesToHash))
-		for i, rawPath := range absoluteFilesToHash {
-			relativePathString, err := pkgPath.RelativePathString(rawPath)
-
-			if err != nil {
-				return nil, errors.Wrapf(err, "not relative to package: %v", rawPath)
-			}
-
-			filesToHash[i] = turbopath.AnchoredSystemPathFromUpstream(relativePathString)
+			return nil, err
 		}
 
 		hashes, err := gitHashObject(turbopath.AbsoluteSystemPathFromUpstream(pkgPath.ToStringDuringMigration()), filesToHash)
@@ -84,11 +157,12 @@ func GetPackageDeps(rootPath turbopath.AbsoluteSystemPath, p *PackageDepsOptions
 			return nil, errors.Wrap(err, "failed hashing resolved inputs globs")
 		}
 		result = hashes
+		statusPatterns = append(inclusions, "package.json")
 	}
 
 	// Update the checked in hashes with the current repo status
 	// The paths returned from this call are anchored at the package directory
-	gitStatusOutput, err := gitStatus(pkgPath, calculatedInputs)
+	gitStatusOutput, err := gitStatus(pkgPath, statusPatterns)
 	if err != nil {
 		return nil, fmt.Errorf("Could not get git hashes from git status: %v", err)
 	}
@@ -97,6 +171,9 @@ func GetPackageDeps(rootPath turbopath.AbsoluteSystemPath, p *PackageDepsOptions
 	for filePath, status := range gitStatusOutput {
 		if status.isDelete() {
 			delete(result, filePath)
+		} else if isExcludedInput(exclusions, filePath) {
+			// git's pathspecs don't match like our globs, so apply exclusions ourselves
+			continue
 		} else {
 			filesToHash = append(filesToHash, filePath.ToSystemPath())
 		}
@@ -115,6 +192,16 @@ func GetPackageDeps(rootPath turbopath.AbsoluteSystemPath, p *PackageDepsOptions
 	return result, nil
 }
 
+// isExcludedInput reports whether a file, relative to the package, matches any of exclusions
+func isExcludedInput(exclusions []string, filePath turbopath.AnchoredUnixPath) bool {
+	for _, exclusion := range exclusions {
+		if matched, _ := doublestar.Match(exclusion, filePath.ToString()); matched && filePath != "package.json" {
+			return true
+		}
+	}
+	return false
+}
+
 func manuallyHashFiles(rootPath turbopath.AbsoluteSystemPath, files []turbopath.AnchoredSystemPath) (map[turbopath.AnchoredUnixPath]string, error) {
 	hashObject := make(map[turbopath.AnchoredUnixPath]string)
 	for _, file := range files {
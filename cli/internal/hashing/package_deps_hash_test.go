@@ -365,6 +365,52 @@ func TestGetPackageDeps(t *testing.T) {
 				"uncommitted-file": "4e56ad89387e6379e4e91ddfe9872cf6a72c9976",
 			},
 		},
+		// inputs anchored at the repository root work
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				InputPatterns: []string{"$ROOT/new-root-file", "committed-file"},
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"../new-root-file": "8906ddcdd634706188bd8ef1c98ac07b9be3425e",
+				"committed-file":   "3a29e62ea9ba15c4a4009d1f605d391cdd262033",
+				"package.json":     "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+			},
+		},
+		// inputs exclude files, including untracked ones and those anchored at the root
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				InputPatterns: []string{"../**/*-file", "!uncommitted-file", "!$ROOT/new-root-file"},
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"committed-file":  "3a29e62ea9ba15c4a4009d1f605d391cdd262033",
+				"package.json":    "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+				"dir/nested-file": "bfe53d766e64d78f80050b73cd1c88095bc70abb",
+			},
+		},
+		// exclusions on their own apply to all of the package's files
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				InputPatterns: []string{"!dir/**", "!**/committed-file"},
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"uncommitted-file": "4e56ad89387e6379e4e91ddfe9872cf6a72c9976",
+				"package.json":     "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+			},
+		},
+		// package.json can't be excluded
+		{
+			opts: &PackageDepsOptions{
+				PackagePath:   "my-pkg",
+				InputPatterns: []string{"committed-file", "!*.json"},
+			},
+			expected: map[turbopath.AnchoredUnixPath]string{
+				"committed-file": "3a29e62ea9ba15c4a4009d1f605d391cdd262033",
+				"package.json":   "9e26dfeeb6e641a33dae4961196235bdb965b21b",
+			},
+		},
 	}
 	for _, tt := range tests {
 		got, err := GetPackageDeps(repoRoot, tt.opts)
@@ -5,7 +5,7 @@ import "github.com/vercel/turbo/cli/internal/fs"
 // Framework is an identifier for something that we wish to inference against.
 type Framework struct {
 	Slug            string
-	EnvPrefix       string
+	EnvPrefixes     []string
 	DependencyMatch matcher
 }
 
@@ -23,96 +23,96 @@ const (
 
 var _frameworks = []Framework{
 	{
-		Slug:      "blitzjs",
-		EnvPrefix: "NEXT_PUBLIC_",
+		Slug:        "blitzjs",
+		EnvPrefixes: []string{"NEXT_PUBLIC_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"blitz"},
 		},
 	},
 	{
-		Slug:      "nextjs",
-		EnvPrefix: "NEXT_PUBLIC_",
+		Slug:        "nextjs",
+		EnvPrefixes: []string{"NEXT_PUBLIC_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"next"},
 		},
 	},
 	{
-		Slug:      "gatsby",
-		EnvPrefix: "GATSBY_",
+		Slug:        "gatsby",
+		EnvPrefixes: []string{"GATSBY_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"gatsby"},
 		},
 	},
 	{
-		Slug:      "astro",
-		EnvPrefix: "PUBLIC_",
+		Slug:        "astro",
+		EnvPrefixes: []string{"PUBLIC_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"astro"},
 		},
 	},
 	{
-		Slug:      "solidstart",
-		EnvPrefix: "VITE_",
+		Slug:        "solidstart",
+		EnvPrefixes: []string{"VITE_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"solid-js", "solid-start"},
 		},
 	},
 	{
-		Slug:      "vue",
-		EnvPrefix: "VUE_APP_",
+		Slug:        "vue",
+		EnvPrefixes: []string{"VUE_APP_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"@vue/cli-service"},
 		},
 	},
 	{
-		Slug:      "sveltekit",
-		EnvPrefix: "VITE_",
+		Slug:        "sveltekit",
+		EnvPrefixes: []string{"VITE_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"@sveltejs/kit"},
 		},
 	},
 	{
-		Slug:      "create-react-app",
-		EnvPrefix: "REACT_APP_",
+		Slug:        "create-react-app",
+		EnvPrefixes: []string{"REACT_APP_"},
 		DependencyMatch: matcher{
 			strategy:     some,
 			dependencies: []string{"react-scripts", "react-dev-utils"},
 		},
 	},
 	{
-		Slug:      "nuxtjs",
-		EnvPrefix: "NUXT_ENV_",
+		Slug:        "nuxtjs",
+		EnvPrefixes: []string{"NUXT_ENV_"},
 		DependencyMatch: matcher{
 			strategy:     some,
 			dependencies: []string{"nuxt", "nuxt-edge", "nuxt3", "nuxt3-edge"},
 		},
 	},
 	{
-		Slug:      "redwoodjs",
-		EnvPrefix: "REDWOOD_ENV_",
+		Slug:        "redwoodjs",
+		EnvPrefixes: []string{"REDWOOD_ENV_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"@redwoodjs/core"},
 		},
 	},
 	{
-		Slug:      "vite",
-		EnvPrefix: "VITE_",
+		Slug:        "vite",
+		EnvPrefixes: []string{"VITE_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"vite"},
 		},
 	},
 	{
-		Slug:      "sanity",
-		EnvPrefix: "SANITY_STUDIO_",
+		Slug:        "sanity",
+		EnvPrefixes: []string{"SANITY_STUDIO_"},
 		DependencyMatch: matcher{
 			strategy:     all,
 			dependencies: []string{"@sanity/cli"},
@@ -151,13 +151,34 @@ func (f Framework) match(pkg *fs.PackageJSON) bool {
 	return f.DependencyMatch.match(pkg)
 }
 
-// InferFramework returns a reference to a matched framework
-func InferFramework(pkg *fs.PackageJSON) *Framework {
+// Frameworks returns the frameworks to infer: those declared in turbo.json, followed by
+// the built-in ones, so that declared frameworks take precedence
+func Frameworks(declared []fs.FrameworkDefinition) []Framework {
+	frameworks := make([]Framework, 0, len(declared)+len(_frameworks))
+	for _, definition := range declared {
+		strategy := all
+		if definition.DependencyMatch.Strategy == fs.FrameworkMatchSome {
+			strategy = some
+		}
+		frameworks = append(frameworks, Framework{
+			Slug:        definition.Slug,
+			EnvPrefixes: definition.EnvPrefixes,
+			DependencyMatch: matcher{
+				strategy:     strategy,
+				dependencies: definition.DependencyMatch.Dependencies,
+			},
+		})
+	}
+	return append(frameworks, _frameworks...)
+}
+
+// MatchFramework returns a reference to the first of frameworks that pkg uses
+func MatchFramework(pkg *fs.PackageJSON, frameworks []Framework) *Framework {
 	if pkg == nil {
 		return nil
 	}
 
-	for _, candidateFramework := range _frameworks {
+	for _, candidateFramework := range frameworks {
 		if candidateFramework.match(pkg) {
 			return &candidateFramework
 		}
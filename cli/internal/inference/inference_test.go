@@ -16,7 +16,7 @@ func getFrameworkBySlug(slug string) *Framework {
 	panic("that framework doesn't exist")
 }
 
-func TestInferFramework(t *testing.T) {
+func TestMatchFramework(t *testing.T) {
 	tests := []struct {
 		name string
 		pkg  *fs.PackageJSON
@@ -89,8 +89,75 @@ func TestInferFramework(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := InferFramework(tt.pkg); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("InferFramework() = %v, want %v", got, tt.want)
+			if got := MatchFramework(tt.pkg, Frameworks(nil)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchFramework() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchFramework_Declared(t *testing.T) {
+	frameworks := Frameworks([]fs.FrameworkDefinition{
+		{
+			Slug:        "acme",
+			EnvPrefixes: []string{"ACME_PUBLIC_", "ACME_APP_"},
+			DependencyMatch: fs.FrameworkDependencyMatch{
+				Strategy:     fs.FrameworkMatchSome,
+				Dependencies: []string{"acme", "next"},
+			},
+		},
+		{
+			Slug:        "widget",
+			EnvPrefixes: []string{"WIDGET_"},
+			DependencyMatch: fs.FrameworkDependencyMatch{
+				Strategy:     fs.FrameworkMatchAll,
+				Dependencies: []string{"widget", "widget-cli"},
+			},
+		},
+	})
+	tests := []struct {
+		name string
+		pkg  *fs.PackageJSON
+		want string
+	}{
+		{
+			name: "declared frameworks take precedence over built-in ones",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"next": "*",
+			}},
+			want: "acme",
+		},
+		{
+			name: "all strategy requires every dependency",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"widget": "*",
+			}},
+			want: "",
+		},
+		{
+			name: "all strategy matches",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"widget":     "*",
+				"widget-cli": "*",
+			}},
+			want: "widget",
+		},
+		{
+			name: "built-in frameworks are still inferred",
+			pkg: &fs.PackageJSON{UnresolvedExternalDeps: map[string]string{
+				"gatsby": "*",
+			}},
+			want: "gatsby",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if framework := MatchFramework(tt.pkg, frameworks); framework != nil {
+				got = framework.Slug
+			}
+			if got != tt.want {
+				t.Errorf("MatchFramework() = %q, want %q", got, tt.want)
 			}
 		})
 	}
@@ -26,6 +26,17 @@ func (ce *ChildExit) Error() string {
 	return fmt.Sprintf("command %s exited (%d)", ce.Command, ce.ExitCode)
 }
 
+// ChildTimeout is returned when a child process runs for longer than its timeout
+// and is stopped
+type ChildTimeout struct {
+	Timeout time.Duration
+	Command string
+}
+
+func (ct *ChildTimeout) Error() string {
+	return fmt.Sprintf("command %s timed out after %v", ct.Command, ct.Timeout)
+}
+
 // Manager tracks all of the child processes that have been spawned
 type Manager struct {
 	done     bool
@@ -49,6 +60,14 @@ func NewManager(logger hclog.Logger) *Manager {
 // successfully, ErrClosing if the manager closed during execution, and
 // a ChildExit error if the child process exited with a non-zero exit code.
 func (m *Manager) Exec(cmd *exec.Cmd) error {
+	return m.ExecWithTimeout(cmd, 0)
+}
+
+// ExecWithTimeout behaves like Exec, except that a child process that is still
+// running after timeout is stopped, with SIGINT and then SIGKILL if it doesn't
+// exit within the kill timeout, and a ChildTimeout error is returned. A timeout
+// of 0 lets the child process run forever.
+func (m *Manager) ExecWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
 	m.mu.Lock()
 	if m.done {
 		m.mu.Unlock()
@@ -79,7 +98,33 @@ func (m *Manager) Exec(cmd *exec.Cmd) error {
 		return err
 	}
 	err = nil
-	exitCode, ok := <-child.ExitCh()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	var exitCode int
+	var ok bool
+	select {
+	case exitCode, ok = <-child.ExitCh():
+	case <-timeoutCh:
+		m.logger.Debug("timed out", "command", child.Command(), "timeout", timeout)
+		child.Kill()
+		// Wait for the exit code, which is sent unless the manager stopped the child
+		_, ok = <-child.ExitCh()
+		m.mu.Lock()
+		delete(m.children, child)
+		m.mu.Unlock()
+		// The manager closing takes precedence over the timeout it overlapped with
+		if !ok {
+			return ErrClosing
+		}
+		return &ChildTimeout{
+			Timeout: timeout,
+			Command: child.Command(),
+		}
+	}
 	if !ok {
 		err = ErrClosing
 	} else if exitCode != ExitCodeOK {
@@ -118,3 +163,9 @@ func (m *Manager) Close() {
 	wg.Wait()
 	close(m.doneCh)
 }
+
+// Done returns a channel that is closed once the manager has closed, and all of
+// its child processes have exited
+func (m *Manager) Done() <-chan struct{} {
+	return m.doneCh
+}
@@ -92,3 +92,41 @@ func TestExitCode(t *testing.T) {
 		t.Error("expected non-zero exit code , got 0")
 	}
 }
+
+func TestExecWithTimeout(t *testing.T) {
+	mgr := newManager()
+
+	start := time.Now()
+	err := mgr.ExecWithTimeout(exec.Command("sleep", "5"), 100*time.Millisecond)
+	duration := time.Since(start)
+	timeoutErr := &ChildTimeout{}
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("expected a ChildTimeout err, got %q", err)
+	}
+	if timeoutErr.Timeout != 100*time.Millisecond {
+		t.Errorf("expected a timeout of 100ms, got %v", timeoutErr.Timeout)
+	}
+	if duration >= 5*time.Second {
+		t.Errorf("expected the child to be stopped, total time was %q", duration)
+	}
+
+	// children that finish in time are unaffected
+	err = mgr.ExecWithTimeout(exec.Command("sleep", "0.1"), 5*time.Second)
+	if err != nil {
+		t.Errorf("expected %q to be nil", err)
+	}
+}
+
+func TestExecWithTimeout_closing(t *testing.T) {
+	mgr := newManager()
+
+	// The child ignores SIGINT, so the manager is still stopping it when it times out
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		mgr.Close()
+	}()
+	err := mgr.ExecWithTimeout(exec.Command("sh", "-c", "trap '' INT; sleep 1"), 300*time.Millisecond)
+	if !errors.Is(err, ErrClosing) {
+		t.Errorf("expected ErrClosing, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package run
+
+// This file implements checking the caches for every task in a run up front, so that
+// remote cache hits can be downloaded before the tasks that need them are reached.
+
+import (
+	gocontext "context"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/core"
+	"github.com/vercel/turbo/cli/internal/graph"
+	"github.com/vercel/turbo/cli/internal/nodes"
+	"github.com/vercel/turbo/cli/internal/taskhash"
+)
+
+// hashedTask is a task whose hash has been calculated ahead of running it
+type hashedTask struct {
+	packageTask *nodes.PackageTask
+	hash        string
+}
+
+// calculateTaskHashes walks the task graph in dependency order, hashing every task. A
+// task's hash only depends on the hashes of its dependencies, not on their results, so
+// every hash is known before anything runs.
+func calculateTaskHashes(ctx gocontext.Context, engine *core.Engine, g *graph.CompleteGraph, rs *runSpec, taskHashes *taskhash.Tracker, logger hclog.Logger) ([]hashedTask, error) {
+	hashedTasks := []hashedTask{}
+	visitorFn := g.GetPackageTaskVisitor(ctx, func(ctx gocontext.Context, packageTask *nodes.PackageTask) error {
+		deps := engine.TaskGraph.DownEdges(packageTask.TaskID)
+		hash, err := taskHashes.CalculateTaskHash(packageTask, deps, logger, rs.ArgsForTask(packageTask.Task))
+		if err != nil {
+			return err
+		}
+		hashedTasks = append(hashedTasks, hashedTask{packageTask: packageTask, hash: hash})
+		return nil
+	})
+	errs := engine.Execute(visitorFn, core.EngineExecutionOptions{Concurrency: 1})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return hashedTasks, nil
+}
+
+// batchCacheStatus asks the caches about every hash at once
+func batchCacheStatus(turboCache cache.Cache, hashedTasks []hashedTask) (map[string]cache.ItemStatus, error) {
+	hashes := make([]string, 0, len(hashedTasks))
+	for _, task := range hashedTasks {
+		hashes = append(hashes, task.hash)
+	}
+	return turboCache.BatchExists(hashes)
+}
+
+// cachePreflight downloads the remote cache hits for a run in the background, storing
+// them in the local filesystem cache so that restoring them doesn't wait on the network.
+type cachePreflight struct {
+	downloads map[string]*sync.Once
+	cancel    gocontext.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// startCachePreflight hashes every task in the run, asks the remote cache about all of
+// them in a single batch, and starts downloading the hits that aren't already in the
+// local cache. It returns nil if there is nothing to prefetch, or if the caches are
+// configured such that prefetching can't help.
+func startCachePreflight(ctx gocontext.Context, engine *core.Engine, g *graph.CompleteGraph, rs *runSpec, taskHashes *taskhash.Tracker, turboCache cache.Cache, logger hclog.Logger) *cachePreflight {
+	cacheOpts := rs.Opts.cacheOpts
+	if rs.Opts.runcacheOpts.SkipReads || cacheOpts.SkipRemote || cacheOpts.Policy.Remote.SkipReads ||
+		cacheOpts.SkipFilesystem || cacheOpts.Policy.Local.SkipWrites {
+		return nil
+	}
+	prefetcher, ok := turboCache.(cache.Prefetcher)
+	if !ok {
+		return nil
+	}
+	hashedTasks, err := calculateTaskHashes(ctx, engine, g, rs, taskHashes, logger)
+	if err != nil {
+		// The error will be reported when the task runs
+		logger.Debug("skipping cache preflight", "error", err)
+		return nil
+	}
+	cacheable := []hashedTask{}
+	for _, task := range hashedTasks {
+		if _, ok := task.packageTask.Command(); ok && task.packageTask.TaskDefinition.ShouldCache {
+			cacheable = append(cacheable, task)
+		}
+	}
+	if len(cacheable) == 0 {
+		return nil
+	}
+	itemStatuses, err := batchCacheStatus(turboCache, cacheable)
+	if err != nil {
+		logger.Debug("skipping cache preflight", "error", err)
+		return nil
+	}
+
+	ctx, cancel := gocontext.WithCancel(ctx)
+	p := &cachePreflight{
+		downloads: make(map[string]*sync.Once),
+		cancel:    cancel,
+	}
+	toDownload := []string{}
+	for _, task := range cacheable {
+		itemStatus := itemStatuses[task.hash]
+		if _, ok := p.downloads[task.hash]; ok || !itemStatus.Remote || itemStatus.Local {
+			continue
+		}
+		p.downloads[task.hash] = &sync.Once{}
+		toDownload = append(toDownload, task.hash)
+	}
+	logger.Debug("cache preflight", "tasks", len(cacheable), "downloads", len(toDownload))
+
+	workers := cacheOpts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan string)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for hash := range queue {
+				hash := hash
+				p.downloads[hash].Do(func() { prefetchArtifact(prefetcher, hash, logger) })
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		// Downloads are queued in dependency order, so the first tasks to run are first
+		for _, hash := range toDownload {
+			select {
+			case queue <- hash:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// prefetchArtifact copies an artifact from the remote cache into the local one, without
+// restoring it
+func prefetchArtifact(prefetcher cache.Prefetcher, hash string, logger hclog.Logger) {
+	if _, err := prefetcher.Prefetch(hash); err != nil {
+		logger.Debug("failed to prefetch artifact", "hash", hash, "error", err)
+	}
+}
+
+// wait blocks until any download of the given hash has finished. If the download
+// hasn't started yet, it is skipped, and the task fetches the artifact itself.
+func (p *cachePreflight) wait(hash string) {
+	if p == nil {
+		return
+	}
+	if once, ok := p.downloads[hash]; ok {
+		once.Do(func() {})
+	}
+}
+
+// close stops queueing downloads, and waits for those in progress to finish
+func (p *cachePreflight) close() {
+	if p == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
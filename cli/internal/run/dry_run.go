@@ -19,6 +19,7 @@ import (
 	"github.com/vercel/turbo/cli/internal/cache"
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/core"
+	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
 	"github.com/vercel/turbo/cli/internal/nodes"
@@ -29,15 +30,21 @@ import (
 // DryRunSummary contains a summary of the packages and tasks that would run
 // if the --dry flag had not been passed
 type dryRunSummary struct {
-	Packages []string      `json:"packages"`
-	Tasks    []taskSummary `json:"tasks"`
+	Packages             []string      `json:"packages"`
+	GlobalEnv            []string      `json:"globalEnv"`
+	GlobalPassThroughEnv []string      `json:"globalPassThroughEnv"`
+	GlobalDotEnv         []string      `json:"globalDotEnv"`
+	Tasks                []taskSummary `json:"tasks"`
 }
 
 // DryRunSummarySinglePackage is the same as DryRunSummary with some adjustments
 // to the internal struct for a single package. It's likely that we can use the
 // same struct for Single Package repos in the future.
 type singlePackageDryRunSummary struct {
-	Tasks []singlePackageTaskSummary `json:"tasks"`
+	GlobalEnv            []string                   `json:"globalEnv"`
+	GlobalPassThroughEnv []string                   `json:"globalPassThroughEnv"`
+	GlobalDotEnv         []string                   `json:"globalDotEnv"`
+	Tasks                []singlePackageTaskSummary `json:"tasks"`
 }
 
 // DryRun gets all the info needed from tasks and prints out a summary, but doesn't actually
@@ -137,9 +144,11 @@ func executeDryRun(ctx gocontext.Context, engine *core.Engine, g *graph.Complete
 		}
 		sort.Strings(stringDescendents)
 
-		itemStatus, err := turboCache.Exists(hash)
-		if err != nil {
-			return err
+		envVars := []string{}
+		framework := ""
+		if inputs, ok := taskHashes.HashInputs(packageTask.TaskID); ok {
+			envVars = envNames(inputs.Env)
+			framework = inputs.Framework
 		}
 
 		taskIDs = append(taskIDs, taskSummary{
@@ -147,11 +156,14 @@ func executeDryRun(ctx gocontext.Context, engine *core.Engine, g *graph.Complete
 			Task:                   packageTask.Task,
 			Package:                packageTask.PackageName,
 			Hash:                   hash,
-			CacheState:             itemStatus,
 			Command:                command,
 			Dir:                    packageTask.Pkg.Dir.ToString(),
 			Outputs:                packageTask.TaskDefinition.Outputs.Inclusions,
 			ExcludedOutputs:        packageTask.TaskDefinition.Outputs.Exclusions,
+			EnvVars:                envVars,
+			Framework:              framework,
+			PassThroughEnv:         env.ResolveEnvNames(packageTask.TaskDefinition.PassThroughEnv),
+			DotEnv:                 env.ExistingDotEnvFiles(packageTask.Pkg.Dir.RestoreAnchor(base.RepoRoot), packageTask.TaskDefinition.DotEnv),
 			LogFile:                packageTask.RepoRelativeLogFile(),
 			Dependencies:           stringAncestors,
 			Dependents:             stringDescendents,
@@ -178,6 +190,19 @@ func executeDryRun(ctx gocontext.Context, engine *core.Engine, g *graph.Complete
 		return nil, errors.New("errors occurred during dry-run graph traversal")
 	}
 
+	// Ask the caches about every task at once, as a real run does
+	hashes := make([]string, len(taskIDs))
+	for i, task := range taskIDs {
+		hashes[i] = task.Hash
+	}
+	itemStatuses, err := turboCache.BatchExists(hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i, task := range taskIDs {
+		taskIDs[i].CacheState = itemStatuses[task.Hash]
+	}
+
 	return taskIDs, nil
 }
 
@@ -188,7 +213,7 @@ func renderDryRunSinglePackageJSON(summary *dryRunSummary) (string, error) {
 		singlePackageTasks[i] = ht.toSinglePackageTask()
 	}
 
-	dryRun := &singlePackageDryRunSummary{singlePackageTasks}
+	dryRun := &singlePackageDryRunSummary{summary.GlobalEnv, summary.GlobalPassThroughEnv, summary.GlobalDotEnv, singlePackageTasks}
 
 	bytes, err := json.MarshalIndent(dryRun, "", "  ")
 	if err != nil {
@@ -223,6 +248,18 @@ func displayDryTextRun(ui cli.Ui, summary *dryRunSummary, workspaceInfos graph.W
 		}
 	}
 
+	ui.Output("")
+	ui.Info(util.Sprintf("${CYAN}${BOLD}Global Environment Variables${RESET}"))
+	ui.Output(strings.Join(summary.GlobalEnv, ", "))
+
+	ui.Output("")
+	ui.Info(util.Sprintf("${CYAN}${BOLD}Global Pass-Through Environment Variables${RESET}"))
+	ui.Output(strings.Join(summary.GlobalPassThroughEnv, ", "))
+
+	ui.Output("")
+	ui.Info(util.Sprintf("${CYAN}${BOLD}Global .env Files${RESET}"))
+	ui.Output(strings.Join(summary.GlobalDotEnv, ", "))
+
 	ui.Output("")
 	ui.Info(util.Sprintf("${CYAN}${BOLD}Tasks to Run${RESET}"))
 
@@ -265,6 +302,10 @@ func displayDryTextRun(ui cli.Ui, summary *dryRunSummary, workspaceInfos graph.W
 
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Command\t=\t%s\t${RESET}", task.Command))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Outputs\t=\t%s\t${RESET}", strings.Join(task.Outputs, ", ")))
+		fmt.Fprintln(w, util.Sprintf("  ${GREY}Environment Variables\t=\t%s\t${RESET}", strings.Join(task.EnvVars, ", ")))
+		fmt.Fprintln(w, util.Sprintf("  ${GREY}Pass-Through Environment Variables\t=\t%s\t${RESET}", strings.Join(task.PassThroughEnv, ", ")))
+		fmt.Fprintln(w, util.Sprintf("  ${GREY}.env Files\t=\t%s\t${RESET}", strings.Join(task.DotEnv, ", ")))
+		fmt.Fprintln(w, util.Sprintf("  ${GREY}Framework\t=\t%s\t${RESET}", task.Framework))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Log File\t=\t%s\t${RESET}", task.LogFile))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependencies\t=\t%s\t${RESET}", strings.Join(dependencies, ", ")))
 		fmt.Fprintln(w, util.Sprintf("  ${GREY}Dependendents\t=\t%s\t${RESET}", strings.Join(dependents, ", ")))
@@ -281,6 +322,17 @@ func displayDryTextRun(ui cli.Ui, summary *dryRunSummary, workspaceInfos graph.W
 	return nil
 }
 
+// envNames returns the sorted names of hashed environment variables. Their values are
+// not shown, as they may be secrets.
+func envNames(hashedEnv map[string]string) []string {
+	names := make([]string, 0, len(hashedEnv))
+	for name := range hashedEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 var _isTurbo = regexp.MustCompile(fmt.Sprintf("(?:^|%v|\\s)turbo(?:$|\\s)", regexp.QuoteMeta(string(filepath.Separator))))
 
 func commandLooksLikeTurbo(command string) bool {
@@ -300,6 +352,10 @@ type taskSummary struct {
 	Command                string             `json:"command"`
 	Outputs                []string           `json:"outputs"`
 	ExcludedOutputs        []string           `json:"excludedOutputs"`
+	EnvVars                []string           `json:"environmentVariables"`
+	PassThroughEnv         []string           `json:"passThroughEnvironmentVariables"`
+	DotEnv                 []string           `json:"dotEnv"`
+	Framework              string             `json:"framework"`
 	LogFile                string             `json:"logFile"`
 	Dir                    string             `json:"directory"`
 	Dependencies           []string           `json:"dependencies"`
@@ -314,6 +370,10 @@ type singlePackageTaskSummary struct {
 	Command                string             `json:"command"`
 	Outputs                []string           `json:"outputs"`
 	ExcludedOutputs        []string           `json:"excludedOutputs"`
+	EnvVars                []string           `json:"environmentVariables"`
+	PassThroughEnv         []string           `json:"passThroughEnvironmentVariables"`
+	DotEnv                 []string           `json:"dotEnv"`
+	Framework              string             `json:"framework"`
 	LogFile                string             `json:"logFile"`
 	Dependencies           []string           `json:"dependencies"`
 	Dependents             []string           `json:"dependents"`
@@ -336,6 +396,10 @@ func (ht *taskSummary) toSinglePackageTask() singlePackageTaskSummary {
 		CacheState:             ht.CacheState,
 		Command:                ht.Command,
 		Outputs:                ht.Outputs,
+		EnvVars:                ht.EnvVars,
+		PassThroughEnv:         ht.PassThroughEnv,
+		DotEnv:                 ht.DotEnv,
+		Framework:              ht.Framework,
 		LogFile:                ht.LogFile,
 		Dependencies:           dependencies,
 		Dependents:             dependents,
@@ -0,0 +1,153 @@
+package run
+
+// This file implements explaining cache misses, by comparing a task's hash inputs with
+// those of its last cached run.
+
+import (
+	gocontext "context"
+	"fmt"
+
+	"github.com/mitchellh/cli"
+	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/core"
+	"github.com/vercel/turbo/cli/internal/graph"
+	"github.com/vercel/turbo/cli/internal/signals"
+	"github.com/vercel/turbo/cli/internal/taskhash"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/ui"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+// _maxExplainedChanges limits how many changes are listed for a single task
+const _maxExplainedChanges = 20
+
+// ExecuteWhyMiss executes the why-miss command, which hashes a single task and its
+// dependencies, and explains how their inputs differ from their last cached runs.
+func ExecuteWhyMiss(ctx gocontext.Context, helper *cmdutil.Helper, signalWatcher *signals.Watcher, args *turbostate.ParsedArgsFromRust) error {
+	base, err := helper.GetCmdBase(args)
+	if err != nil {
+		return err
+	}
+	payload := args.Command.WhyMiss
+	if !util.IsPackageTask(payload.Task) {
+		return fmt.Errorf("expected a task in the form <package>#<task>, got %q", payload.Task)
+	}
+	pkg, task := util.GetPackageTaskFromId(payload.Task)
+	runPayload := &turbostate.RunPayload{
+		CacheDir: payload.CacheDir,
+		NoDaemon: true,
+		Tasks:    []string{task},
+	}
+	if pkg != util.RootPkgName {
+		runPayload.Filter = []string{pkg}
+	}
+	runArgs := *args
+	runArgs.Command = turbostate.Command{Run: runPayload}
+	opts, err := optsFromArgs(&runArgs)
+	if err != nil {
+		return err
+	}
+	opts.runOpts.whyMiss = payload.Task
+	run := configureRun(base, opts, signalWatcher)
+	if err := run.run(ctx, runPayload.Tasks); err != nil {
+		base.LogError("why-miss failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// WhyMiss hashes the tasks in the run, and explains how the inputs of the given task
+// differ from those of its last cached run. Dependencies whose hashes changed are
+// explained in turn.
+func WhyMiss(ctx gocontext.Context, g *graph.CompleteGraph, rs *runSpec, engine *core.Engine, taskHashes *taskhash.Tracker, base *cmdutil.CmdBase, taskID string) error {
+	if _, err := calculateTaskHashes(ctx, engine, g, rs, taskHashes, base.Logger); err != nil {
+		return errors.Wrap(err, "failed to hash tasks")
+	}
+	if _, ok := taskHashes.HashInputs(taskID); !ok {
+		return fmt.Errorf("could not find task %v", taskID)
+	}
+	store := taskhash.NewInputsStore(rs.Opts.cacheOpts.ResolveCacheDir(base.RepoRoot))
+
+	explained := make(util.Set)
+	queue := []string{taskID}
+	for len(queue) > 0 {
+		taskID, queue = queue[0], queue[1:]
+		if explained.Includes(taskID) {
+			continue
+		}
+		explained.Add(taskID)
+		current, ok := taskHashes.HashInputs(taskID)
+		if !ok {
+			continue
+		}
+		previous, err := store.Last(taskID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the last cached inputs of %v", taskID)
+		}
+		current, err = store.Seal(current)
+		if err != nil {
+			return errors.Wrapf(err, "failed to compare the inputs of %v", taskID)
+		}
+		base.UI.Output(fmt.Sprintf("%v %v", ui.Bold(taskID), ui.Dim(current.Hash)))
+		explainChanges(base.UI, "  ", previous, current)
+		if previous != nil {
+			queue = append(queue, taskhash.ChangedDependencies(previous, current)...)
+		}
+	}
+	return nil
+}
+
+// explainChanges writes how current differs from previous, which is nil if the task
+// has never been cached
+func explainChanges(terminal cli.Ui, indent string, previous *taskhash.TaskHashInputs, current *taskhash.TaskHashInputs) {
+	if previous == nil {
+		terminal.Output(indent + "no previous cached run to compare with")
+		return
+	}
+	if previous.Hash == current.Hash {
+		terminal.Output(indent + "unchanged since the last cached run, but its artifact is no longer in the cache")
+		return
+	}
+	terminal.Output(fmt.Sprintf("%vchanged since the last cached run %v:", indent, ui.Dim(previous.Hash)))
+	changes := taskhash.Explain(previous, current)
+	for i, change := range changes {
+		if i == _maxExplainedChanges {
+			terminal.Output(fmt.Sprintf("%v  ...and %v more", indent, len(changes)-i))
+			break
+		}
+		terminal.Output(fmt.Sprintf("%v  - %v", indent, change))
+	}
+}
+
+// explainMiss writes how the inputs of a task that missed the cache differ from those
+// of its last cached run
+func (ec *execContext) explainMiss(terminal cli.Ui, taskID string) {
+	current, ok := ec.taskHashes.HashInputs(taskID)
+	if !ok {
+		return
+	}
+	previous, err := ec.inputsStore.Last(taskID)
+	if err != nil {
+		ec.logger.Debug("failed to read the last cached inputs", "task", taskID, "error", err)
+		return
+	}
+	current, err = ec.inputsStore.Seal(current)
+	if err != nil {
+		ec.logger.Debug("failed to compare the inputs", "task", taskID, "error", err)
+		return
+	}
+	explainChanges(terminal, "", previous, current)
+}
+
+// recordInputs stores the inputs of a task that was cached, for later runs to explain
+// their misses against
+func (ec *execContext) recordInputs(taskID string) {
+	inputs, ok := ec.taskHashes.HashInputs(taskID)
+	if !ok {
+		return
+	}
+	if err := ec.inputsStore.Record(inputs); err != nil {
+		ec.logger.Debug("failed to record task inputs", "task", taskID, "error", err)
+	}
+}
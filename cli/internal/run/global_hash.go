@@ -8,11 +8,13 @@ import (
 	"strings"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/globby"
 	"github.com/vercel/turbo/cli/internal/hashing"
 	"github.com/vercel/turbo/cli/internal/lockfile"
 	"github.com/vercel/turbo/cli/internal/packagemanager"
+	"github.com/vercel/turbo/cli/internal/taskhash"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/util"
 )
@@ -24,7 +26,8 @@ var _defaultEnvVars = []string{
 	"VERCEL_ANALYTICS_ID",
 }
 
-func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON *fs.PackageJSON, pipeline fs.Pipeline, envVarDependencies []string, globalFileDependencies []string, packageManager *packagemanager.PackageManager, lockFile lockfile.Lockfile, logger hclog.Logger, env []string) (string, error) {
+// calculateGlobalHash returns the global hash, along with a breakdown of what went into it
+func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON *fs.PackageJSON, pipeline fs.Pipeline, envVarDependencies []string, globalFileDependencies []string, globalDotEnv []string, packageManager *packagemanager.PackageManager, lockFile lockfile.Lockfile, logger hclog.Logger, environ []string) (string, *taskhash.GlobalHashInputs, error) {
 	// Calculate env var dependencies
 	globalHashableEnvNames := []string{}
 	globalHashableEnvPairs := []string{}
@@ -33,8 +36,8 @@ func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON
 		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", builtinEnvVar, os.Getenv(builtinEnvVar)))
 	}
 
-	// Calculate global env var dependencies
-	for _, v := range envVarDependencies {
+	// Calculate global env var dependencies, resolving any wildcards and exclusions
+	for _, v := range env.ResolveEnvNames(envVarDependencies) {
 		globalHashableEnvNames = append(globalHashableEnvNames, v)
 		globalHashableEnvPairs = append(globalHashableEnvPairs, fmt.Sprintf("%v=%v", v, os.Getenv(v)))
 	}
@@ -44,12 +47,12 @@ func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON
 	if len(globalFileDependencies) > 0 {
 		ignores, err := packageManager.GetWorkspaceIgnores(rootpath)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		f, err := globby.GlobFiles(rootpath.ToStringDuringMigration(), globalFileDependencies, ignores)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		for _, val := range f {
@@ -57,9 +60,15 @@ func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON
 		}
 	}
 
+	// .env files are hashed whether or not they're ignored by git, since they're loaded
+	// into every task's environment
+	for _, file := range env.ExistingDotEnvFiles(rootpath, globalDotEnv) {
+		globalDeps.Add(rootpath.UntypedJoin(file).ToString())
+	}
+
 	// get system env vars for hashing purposes, these include any variable that includes "TURBO"
 	// that is NOT TURBO_TOKEN or TURBO_TEAM or TURBO_BINARY_PATH.
-	names, pairs := getHashableTurboEnvVarsFromOs(env)
+	names, pairs := getHashableTurboEnvVarsFromOs(environ)
 	globalHashableEnvNames = append(globalHashableEnvNames, names...)
 	globalHashableEnvPairs = append(globalHashableEnvPairs, pairs...)
 	// sort them for consistent hashing
@@ -80,9 +89,16 @@ func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON
 		globalDepsPaths[i] = turbopath.AbsoluteSystemPathFromUpstream(path)
 	}
 
+	// Pass-through variables must never affect hashes, including when the list of them changes
+	hashablePipeline := make(fs.Pipeline, len(pipeline))
+	for name, taskDefinition := range pipeline {
+		taskDefinition.PassThroughEnv = nil
+		hashablePipeline[name] = taskDefinition
+	}
+
 	globalFileHashMap, err := hashing.GetHashableDeps(rootpath, globalDepsPaths)
 	if err != nil {
-		return "", fmt.Errorf("error hashing files: %w", err)
+		return "", nil, fmt.Errorf("error hashing files: %w", err)
 	}
 	globalHashable := struct {
 		globalFileHashMap    map[turbopath.AnchoredUnixPath]string
@@ -95,13 +111,22 @@ func calculateGlobalHash(rootpath turbopath.AbsoluteSystemPath, rootPackageJSON
 		rootExternalDepsHash: rootPackageJSON.ExternalDepsHash,
 		hashedSortedEnvPairs: globalHashableEnvPairs,
 		globalCacheKey:       _globalCacheKey,
-		pipeline:             pipeline,
+		pipeline:             hashablePipeline,
 	}
 	globalHash, err := fs.HashObject(globalHashable)
 	if err != nil {
-		return "", fmt.Errorf("error hashing global dependencies %w", err)
+		return "", nil, fmt.Errorf("error hashing global dependencies %w", err)
+	}
+	pipelineHash, err := fs.HashObject(hashablePipeline)
+	if err != nil {
+		return "", nil, fmt.Errorf("error hashing pipeline %w", err)
 	}
-	return globalHash, nil
+	return globalHash, &taskhash.GlobalHashInputs{
+		Files:                globalFileHashMap,
+		RootExternalDepsHash: rootPackageJSON.ExternalDepsHash,
+		Env:                  taskhash.HashEnvPairs(globalHashableEnvPairs),
+		PipelineHash:         pipelineHash,
+	}, nil
 }
 
 // getHashableTurboEnvVarsFromOs returns a list of environment variables names and
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -18,6 +19,8 @@ import (
 	"github.com/vercel/turbo/cli/internal/cmdutil"
 	"github.com/vercel/turbo/cli/internal/colorcache"
 	"github.com/vercel/turbo/cli/internal/core"
+	"github.com/vercel/turbo/cli/internal/env"
+	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
 	"github.com/vercel/turbo/cli/internal/logstreamer"
 	"github.com/vercel/turbo/cli/internal/nodes"
@@ -28,6 +31,7 @@ import (
 	"github.com/vercel/turbo/cli/internal/taskhash"
 	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/ui"
+	"github.com/vercel/turbo/cli/internal/util"
 )
 
 // RealRun executes a set of tasks
@@ -53,17 +57,31 @@ func RealRun(
 		base.UI.Output(fmt.Sprintf("%s %s %s", ui.Dim("• Running"), ui.Dim(ui.Bold(strings.Join(rs.Targets, ", "))), ui.Dim(fmt.Sprintf("in %v packages", rs.FilteredPkgs.Len()))))
 	}
 
-	// Log whether remote cache is enabled
+	// Log whether remote cache is enabled, and any restrictions on the caches
 	useHTTPCache := !rs.Opts.cacheOpts.SkipRemote
+	policy := ""
+	if rs.Opts.cacheOpts.Policy.IsRestricted() {
+		policy = fmt.Sprintf(" (cache policy %v)", rs.Opts.cacheOpts.Policy)
+	}
 	if useHTTPCache {
-		base.UI.Info(ui.Dim("• Remote caching enabled"))
+		base.UI.Info(ui.Dim("• Remote caching enabled" + policy))
 	} else {
-		base.UI.Info(ui.Dim("• Remote caching disabled"))
+		base.UI.Info(ui.Dim("• Remote caching disabled" + policy))
+	}
+	if rs.Opts.runOpts.envMode == env.StrictMode {
+		base.UI.Info(ui.Dim("• Strict env mode: tasks can only read the environment variables they declare"))
 	}
 
 	defer func() {
 		_ = spinner.WaitFor(ctx, turboCache.Shutdown, base.UI, "...writing to cache...", 1500*time.Millisecond)
+		// Now that this run's artifacts have been written, evict anything over the
+		// configured filesystem cache limits. This is a no-op if none are configured.
+		turboCache.Clean(base.RepoRoot)
 	}()
+	// Ask the remote cache about every task at once, and start downloading the hits
+	preflight := startCachePreflight(ctx, engine, g, rs, hashes, turboCache, base.Logger)
+	defer preflight.close()
+
 	colorCache := colorcache.New()
 
 	runCache := runcache.New(turboCache, base.RepoRoot, rs.Opts.runcacheOpts, colorCache)
@@ -78,6 +96,8 @@ func RealRun(
 		packageManager:  packageManager,
 		processes:       processes,
 		taskHashes:      hashes,
+		preflight:       preflight,
+		inputsStore:     taskhash.NewInputsStore(rs.Opts.cacheOpts.ResolveCacheDir(base.RepoRoot)),
 		repoRoot:        base.RepoRoot,
 		isSinglePackage: singlePackage,
 	}
@@ -112,6 +132,7 @@ func RealRun(
 		}
 		base.UI.Error(err.Error())
 	}
+	ec.warnBlockedEnv(base.UI, g)
 
 	if err := runState.Close(base.UI); err != nil {
 		return errors.Wrap(err, "error with profiler")
@@ -134,8 +155,14 @@ type execContext struct {
 	packageManager  *packagemanager.PackageManager
 	processes       *process.Manager
 	taskHashes      *taskhash.Tracker
+	preflight       *cachePreflight
+	inputsStore     *taskhash.InputsStore
 	repoRoot        turbopath.AbsoluteSystemPath
 	isSinglePackage bool
+
+	// blockedEnv collects the variables that strict env mode hid from any task
+	blockedEnvMu sync.Mutex
+	blockedEnv   util.Set
 }
 
 func (ec *execContext) logError(log hclog.Logger, prefix string, err error) {
@@ -148,6 +175,109 @@ func (ec *execContext) logError(log hclog.Logger, prefix string, err error) {
 	ec.ui.Error(fmt.Sprintf("%s%s%s", ui.ERROR_PREFIX, prefix, color.RedString(" %v", err)))
 }
 
+// allowedEnv returns the environment variables a task can read in strict env mode:
+// those that are hashed, for the task and globally, and those that are passed through
+func (ec *execContext) allowedEnv(packageTask *nodes.PackageTask) []string {
+	allowed := env.ResolveEnvNames(ec.rs.Opts.runOpts.globalPassThroughEnv)
+	allowed = append(allowed, env.ResolveEnvNames(packageTask.TaskDefinition.PassThroughEnv)...)
+	inputs, ok := ec.taskHashes.HashInputs(packageTask.TaskID)
+	if !ok {
+		return allowed
+	}
+	for name := range inputs.Env {
+		allowed = append(allowed, name)
+	}
+	if inputs.Global != nil {
+		for name := range inputs.Global.Env {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
+
+// _maxRetryBackoff is as long as the wait between attempts gets by doubling
+const _maxRetryBackoff = time.Minute
+
+// retryBackoff returns how long to wait after the given failed attempt, starting at
+// initial and doubling after each attempt, up to _maxRetryBackoff
+func retryBackoff(initial time.Duration, attempt int) time.Duration {
+	limit := _maxRetryBackoff
+	if initial > limit {
+		limit = initial
+	}
+	backoff := initial
+	for i := 1; i < attempt && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		return limit
+	}
+	return backoff
+}
+
+// recordBlockedEnv notes the variables that strict env mode hid from a task
+func (ec *execContext) recordBlockedEnv(names []string) {
+	ec.blockedEnvMu.Lock()
+	defer ec.blockedEnvMu.Unlock()
+	if ec.blockedEnv == nil {
+		ec.blockedEnv = make(util.Set)
+	}
+	for _, name := range names {
+		ec.blockedEnv.Add(name)
+	}
+}
+
+// warnBlockedEnv warns, once per run, about the variables that strict env mode hid from
+// tasks. Only the ones that turbo.json or a framework refers to are named, since those
+// are the ones a task is likely to need. The rest are only counted.
+func (ec *execContext) warnBlockedEnv(terminal cli.Ui, g *graph.CompleteGraph) {
+	ec.blockedEnvMu.Lock()
+	defer ec.blockedEnvMu.Unlock()
+	if ec.blockedEnv.Len() == 0 {
+		return
+	}
+	// Tasks that aren't part of this run count too, so look at every pipeline
+	pipelines := []fs.Pipeline{g.Pipeline}
+	for _, workspaceTurboJSON := range g.WorkspaceTurboJSONs {
+		pipelines = append(pipelines, workspaceTurboJSON.Pipeline)
+	}
+	patterns := []string{}
+	for _, pipeline := range pipelines {
+		for _, taskDefinition := range pipeline {
+			patterns = append(patterns, taskDefinition.EnvVarDependencies...)
+			patterns = append(patterns, taskDefinition.PassThroughEnv...)
+		}
+	}
+	referenced := env.ReferencedNames(ec.blockedEnv.UnsafeListOfStrings(), patterns, ec.taskHashes.FrameworkEnvPrefixes())
+	if len(referenced) == 0 {
+		return
+	}
+	others := ""
+	if unreferenced := ec.blockedEnv.Len() - len(referenced); unreferenced > 0 {
+		others = fmt.Sprintf(", and %v other environment variables", unreferenced)
+	}
+	terminal.Warn(fmt.Sprintf("%s%s", ui.WARNING_PREFIX, color.YellowString(" strict env mode hid %v from tasks that don't declare them%v. Declare any that a task needs in \"env\", \"passThroughEnv\" or \"globalPassThroughEnv\" in turbo.json", strings.Join(referenced, ", "), others)))
+}
+
+// dotEnvPairs reads the task's .env files, followed by the global ones, and returns
+// key=value pairs for the variables they set that aren't already in environ
+func (ec *execContext) dotEnvPairs(packageTask *nodes.PackageTask, environ []string) ([]string, error) {
+	vars, err := env.ReadDotEnvFiles(packageTask.Pkg.Dir.RestoreAnchor(ec.repoRoot), packageTask.TaskDefinition.DotEnv)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load .env files")
+	}
+	globalVars, err := env.ReadDotEnvFiles(ec.repoRoot, ec.rs.Opts.runOpts.globalDotEnv)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load global .env files")
+	}
+	for key, value := range globalVars {
+		if _, ok := vars[key]; !ok {
+			vars[key] = value
+		}
+	}
+	return env.DotEnvPairs(environ, vars), nil
+}
+
 func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTask, deps dag.Set) error {
 	cmdTime := time.Now()
 
@@ -187,13 +317,20 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		ErrorPrefix:  prettyPrefix,
 		WarnPrefix:   prettyPrefix,
 	}
+	// Don't race a background download of this task's artifact
+	ec.preflight.wait(hash)
 	hit, err := taskCache.RestoreOutputs(ctx, prefixedUI, progressLogger)
 	if err != nil {
 		prefixedUI.Error(fmt.Sprintf("error fetching from cache: %s", err))
 	} else if hit {
+		ec.recordInputs(packageTask.TaskID)
 		tracer(TargetCached, nil)
 		return nil
 	}
+	cacheable := packageTask.TaskDefinition.ShouldCache
+	if ec.rs.Opts.runOpts.explain && cacheable && !ec.rs.Opts.runcacheOpts.SkipReads {
+		ec.explainMiss(prefixedUI, packageTask.TaskID)
+	}
 
 	// Setup command execution
 	argsactual := append([]string{"run"}, packageTask.Task)
@@ -203,60 +340,97 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		argsactual = append(argsactual, passThroughArgs...)
 	}
 
-	cmd := exec.Command(ec.packageManager.Command, argsactual...)
-	cmd.Dir = packageTask.Pkg.Dir.ToSystemPath().RestoreAnchor(ec.repoRoot).ToString()
+	cmdDir := packageTask.Pkg.Dir.ToSystemPath().RestoreAnchor(ec.repoRoot).ToString()
 	envs := fmt.Sprintf("TURBO_HASH=%v", hash)
-	cmd.Env = append(os.Environ(), envs)
-
-	// Setup stdout/stderr
-	// If we are not caching anything, then we don't need to write logs to disk
-	// be careful about this conditional given the default of cache = true
-	writer, err := taskCache.OutputWriter(prettyPrefix)
+	var cmdEnv []string
+	if ec.rs.Opts.runOpts.envMode == env.StrictMode {
+		taskEnv, blockedEnv := env.StrictEnv(os.Environ(), ec.allowedEnv(packageTask))
+		cmdEnv = append(taskEnv, envs)
+		progressLogger.Debug("strict env mode", "blocked", blockedEnv)
+		ec.recordBlockedEnv(blockedEnv)
+	} else {
+		cmdEnv = append(os.Environ(), envs)
+	}
+	dotEnvPairs, err := ec.dotEnvPairs(packageTask, cmdEnv)
 	if err != nil {
 		tracer(TargetBuildFailed, err)
 		ec.logError(progressLogger, prettyPrefix, err)
-		if !ec.rs.Opts.runOpts.continueOnError {
-			os.Exit(1)
-		}
+		return err
 	}
+	cmdEnv = append(cmdEnv, dotEnvPairs...)
 
-	// Create a logger
-	logger := log.New(writer, "", 0)
-	// Setup a streamer that we'll pipe cmd.Stdout to
-	logStreamerOut := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
-	// Setup a streamer that we'll pipe cmd.Stderr to.
-	logStreamerErr := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
-	cmd.Stderr = logStreamerErr
-	cmd.Stdout = logStreamerOut
-	// Flush/Reset any error we recorded
-	logStreamerErr.FlushRecord()
-	logStreamerOut.FlushRecord()
-
-	closeOutputs := func() error {
-		var closeErrors []error
-
-		if err := logStreamerOut.Close(); err != nil {
-			closeErrors = append(closeErrors, errors.Wrap(err, "log stdout"))
-		}
-		if err := logStreamerErr.Close(); err != nil {
-			closeErrors = append(closeErrors, errors.Wrap(err, "log stderr"))
+	timeout := packageTask.TaskDefinition.Timeout
+	if ec.rs.Opts.runOpts.timeout > 0 {
+		timeout = ec.rs.Opts.runOpts.timeout
+	}
+	retries := packageTask.TaskDefinition.Retries
+	if ec.rs.Opts.runOpts.retries != nil {
+		retries = *ec.rs.Opts.runOpts.retries
+	}
+	var closeOutputs func() error
+	var duration time.Duration
+	for attempt := 1; ; attempt++ {
+		// A command can only be started once, so each attempt gets a new one
+		cmd := exec.Command(ec.packageManager.Command, argsactual...)
+		cmd.Dir = cmdDir
+		cmd.Env = cmdEnv
+
+		// Setup stdout/stderr
+		// If we are not caching anything, then we don't need to write logs to disk
+		// be careful about this conditional given the default of cache = true.
+		// Each attempt replaces the log of the one before it.
+		writer, err := taskCache.OutputWriter(prettyPrefix)
+		if err != nil {
+			tracer(TargetBuildFailed, err)
+			ec.logError(progressLogger, prettyPrefix, err)
+			if !ec.rs.Opts.runOpts.continueOnError {
+				os.Exit(1)
+			}
 		}
 
-		if err := writer.Close(); err != nil {
-			closeErrors = append(closeErrors, errors.Wrap(err, "log file"))
-		}
-		if len(closeErrors) > 0 {
-			msgs := make([]string, len(closeErrors))
-			for i, err := range closeErrors {
-				msgs[i] = err.Error()
+		// Create a logger
+		logger := log.New(writer, "", 0)
+		// Setup a streamer that we'll pipe cmd.Stdout to
+		logStreamerOut := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
+		// Setup a streamer that we'll pipe cmd.Stderr to.
+		logStreamerErr := logstreamer.NewLogstreamer(logger, prettyPrefix, false)
+		cmd.Stderr = logStreamerErr
+		cmd.Stdout = logStreamerOut
+		// Flush/Reset any error we recorded
+		logStreamerErr.FlushRecord()
+		logStreamerOut.FlushRecord()
+
+		closeOutputs = func() error {
+			var closeErrors []error
+
+			if err := logStreamerOut.Close(); err != nil {
+				closeErrors = append(closeErrors, errors.Wrap(err, "log stdout"))
+			}
+			if err := logStreamerErr.Close(); err != nil {
+				closeErrors = append(closeErrors, errors.Wrap(err, "log stderr"))
+			}
+
+			if err := writer.Close(); err != nil {
+				closeErrors = append(closeErrors, errors.Wrap(err, "log file"))
 			}
-			return fmt.Errorf("could not flush log output: %v", strings.Join(msgs, ", "))
+			if len(closeErrors) > 0 {
+				msgs := make([]string, len(closeErrors))
+				for i, err := range closeErrors {
+					msgs[i] = err.Error()
+				}
+				return fmt.Errorf("could not flush log output: %v", strings.Join(msgs, ", "))
+			}
+			return nil
 		}
-		return nil
-	}
 
-	// Run the command
-	if err := ec.processes.Exec(cmd); err != nil {
+		// Run the command
+		attemptDone := ec.runState.Attempt(packageTask.TaskID)
+		err = ec.processes.ExecWithTimeout(cmd, timeout)
+		// Only the successful attempt counts towards the task's duration
+		duration = attemptDone(err)
+		if err == nil {
+			break
+		}
 		// close off our outputs. We errored, so we mostly don't care if we fail to close
 		_ = closeOutputs()
 		// if we already know we're in the process of exiting,
@@ -264,7 +438,28 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		if errors.Is(err, process.ErrClosing) {
 			return nil
 		}
-		tracer(TargetBuildFailed, err)
+
+		if attempt <= retries {
+			// Show the failed attempt's output, if the output mode only shows errors
+			taskCache.OnError(prefixedUI, progressLogger)
+			backoff := retryBackoff(packageTask.TaskDefinition.RetryBackoff, attempt)
+			progressLogger.Debug("retrying", "attempt", attempt, "error", err, "backoff", backoff)
+			prefixedUI.Warn(fmt.Sprintf("command finished with error, retrying (attempt %v of %v)...", attempt+1, retries+1))
+			select {
+			case <-time.After(backoff):
+			case <-ec.processes.Done():
+				// Another task failed while we waited to retry
+				return nil
+			}
+			continue
+		}
+
+		timeoutErr := &process.ChildTimeout{}
+		if errors.As(err, &timeoutErr) {
+			tracer(TargetBuildTimedOut, err)
+		} else {
+			tracer(TargetBuildFailed, err)
+		}
 		progressLogger.Error(fmt.Sprintf("Error: command finished with error: %v", err))
 		if !ec.rs.Opts.runOpts.continueOnError {
 			prefixedUI.Error(fmt.Sprintf("ERROR: command finished with error: %s", err))
@@ -279,13 +474,14 @@ func (ec *execContext) exec(ctx gocontext.Context, packageTask *nodes.PackageTas
 		return err
 	}
 
-	duration := time.Since(cmdTime)
 	// Close off our outputs and cache them
 	if err := closeOutputs(); err != nil {
 		ec.logError(progressLogger, "", err)
 	} else {
 		if err = taskCache.SaveOutputs(ctx, progressLogger, prefixedUI, int(duration.Milliseconds())); err != nil {
 			ec.logError(progressLogger, "", fmt.Errorf("error caching output: %w", err))
+		} else if cacheable && !ec.rs.Opts.runcacheOpts.SkipWrites {
+			ec.recordInputs(packageTask.TaskID)
 		}
 	}
 
@@ -15,16 +15,20 @@ import (
 	"github.com/vercel/turbo/cli/internal/core"
 	"github.com/vercel/turbo/cli/internal/daemon"
 	"github.com/vercel/turbo/cli/internal/daemonclient"
+	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
+	"github.com/vercel/turbo/cli/internal/inference"
 	"github.com/vercel/turbo/cli/internal/process"
 	"github.com/vercel/turbo/cli/internal/scm"
 	"github.com/vercel/turbo/cli/internal/scope"
 	"github.com/vercel/turbo/cli/internal/signals"
 	"github.com/vercel/turbo/cli/internal/taskhash"
+	"github.com/vercel/turbo/cli/internal/turbopath"
 	"github.com/vercel/turbo/cli/internal/turbostate"
 	"github.com/vercel/turbo/cli/internal/ui"
 	"github.com/vercel/turbo/cli/internal/util"
+	"github.com/vercel/turbo/cli/internal/validate"
 
 	"github.com/pkg/errors"
 )
@@ -76,6 +80,15 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 	opts.cacheOpts.SkipFilesystem = runPayload.RemoteOnly
 	opts.cacheOpts.OverrideDir = runPayload.CacheDir
 	opts.cacheOpts.Workers = runPayload.CacheWorkers
+	if err := opts.cacheOpts.SetEvictionPolicyFromEnv(); err != nil {
+		return nil, err
+	}
+	if err := opts.cacheOpts.SetDedupeFromEnv(); err != nil {
+		return nil, err
+	}
+	if err := opts.cacheOpts.SetSpoolFromEnv(); err != nil {
+		return nil, err
+	}
 
 	// Runcache flags
 	opts.runcacheOpts.SkipReads = runPayload.Force
@@ -102,6 +115,23 @@ func optsFromArgs(args *turbostate.ParsedArgsFromRust) (*Opts, error) {
 	opts.runOpts.only = runPayload.Only
 	opts.runOpts.noDaemon = runPayload.NoDaemon
 	opts.runOpts.singlePackage = args.Command.Run.SinglePackage
+	opts.runOpts.cachePolicy = runPayload.Cache
+	opts.runOpts.explain = runPayload.Explain
+	if runPayload.EnvMode != "" {
+		envMode, err := env.ParseMode(runPayload.EnvMode)
+		if err != nil {
+			return nil, err
+		}
+		opts.runOpts.envMode = envMode
+	}
+	if runPayload.Timeout != "" {
+		timeout, err := fs.ParseDuration("timeout", runPayload.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		opts.runOpts.timeout = timeout
+	}
+	opts.runOpts.retries = runPayload.Retries
 
 	// See comment on Graph in turbostate.go for an explanation on Graph's representation.
 	// If flag is passed...
@@ -160,14 +190,6 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read package.json: %w", err)
 	}
-	turboJSON, err := fs.LoadTurboConfig(r.base.RepoRoot, rootPackageJSON, r.opts.runOpts.singlePackage)
-	if err != nil {
-		return err
-	}
-
-	// TODO: these values come from a config file, hopefully viper can help us merge these
-	r.opts.cacheOpts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
-
 	var pkgDepGraph *context.Context
 	if r.opts.runOpts.singlePackage {
 		pkgDepGraph, err = context.SinglePackageGraph(r.base.RepoRoot, rootPackageJSON)
@@ -183,6 +205,35 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 		}
 	}
 
+	// Validate turbo.json before loading it, so that problems are reported where they are
+	problems, err := validate.Validate(r.base.RepoRoot, pkgDepGraph.WorkspaceInfos, r.opts.runOpts.singlePackage)
+	if err != nil {
+		return err
+	}
+	if err := validate.Error(problems); err != nil {
+		return err
+	}
+
+	turboJSON, err := fs.LoadTurboConfig(r.base.RepoRoot, rootPackageJSON, r.opts.runOpts.singlePackage)
+	if err != nil {
+		return err
+	}
+
+	// TODO: these values come from a config file, hopefully viper can help us merge these
+	r.opts.cacheOpts.RemoteCacheOpts = turboJSON.RemoteCacheOptions
+	if err := r.opts.cacheOpts.SetPolicy(r.opts.runOpts.cachePolicy, turboJSON.CachePolicy); err != nil {
+		return err
+	}
+	if r.opts.runOpts.envMode == "" {
+		envMode, err := env.ParseMode(turboJSON.EnvMode)
+		if err != nil {
+			return fmt.Errorf("turbo.json: %w", err)
+		}
+		r.opts.runOpts.envMode = envMode
+	}
+	r.opts.runOpts.globalPassThroughEnv = turboJSON.GlobalPassThroughEnv
+	r.opts.runOpts.globalDotEnv = turboJSON.GlobalDotEnv
+
 	if ui.IsCI && !r.opts.runOpts.noDaemon {
 		r.base.Logger.Info("skipping turbod since we appear to be in a non-interactive context")
 	} else if !r.opts.runOpts.noDaemon {
@@ -201,8 +252,13 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 		return errors.Wrap(err, "Invalid package dependency graph")
 	}
 
+	workspaceTurboJSONs, err := loadWorkspaceTurboConfigs(r.base.RepoRoot, pkgDepGraph.WorkspaceInfos)
+	if err != nil {
+		return err
+	}
+
 	pipeline := turboJSON.Pipeline
-	if err := validateTasks(pipeline, targets); err != nil {
+	if err := validateTasks(pipeline, workspaceTurboJSONs, targets); err != nil {
 		location := ""
 		if r.opts.runOpts.singlePackage {
 			location = "in `scripts` in \"package.json\""
@@ -235,12 +291,13 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 			}
 		}
 	}
-	globalHash, err := calculateGlobalHash(
+	globalHash, globalHashInputs, err := calculateGlobalHash(
 		r.base.RepoRoot,
 		rootPackageJSON,
 		pipeline,
 		turboJSON.GlobalEnv,
 		turboJSON.GlobalDeps,
+		turboJSON.GlobalDotEnv,
 		pkgDepGraph.PackageManager,
 		pkgDepGraph.Lockfile,
 		r.base.Logger,
@@ -254,12 +311,13 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 
 	// TODO: consolidate some of these arguments
 	g := &graph.CompleteGraph{
-		WorkspaceGraph:  pkgDepGraph.WorkspaceGraph,
-		Pipeline:        pipeline,
-		WorkspaceInfos:  pkgDepGraph.WorkspaceInfos,
-		GlobalHash:      globalHash,
-		RootNode:        pkgDepGraph.RootNode,
-		TaskDefinitions: map[string]*fs.TaskDefinition{},
+		WorkspaceGraph:      pkgDepGraph.WorkspaceGraph,
+		Pipeline:            pipeline,
+		WorkspaceTurboJSONs: workspaceTurboJSONs,
+		WorkspaceInfos:      pkgDepGraph.WorkspaceInfos,
+		GlobalHash:          globalHash,
+		RootNode:            pkgDepGraph.RootNode,
+		TaskDefinitions:     map[string]*fs.TaskDefinition{},
 	}
 	rs := &runSpec{
 		Targets:      targets,
@@ -281,8 +339,10 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 	tracker := taskhash.NewTracker(
 		g.RootNode,
 		g.GlobalHash,
-		g.Pipeline,
+		globalHashInputs,
+		g.TaskDefinitions,
 		g.WorkspaceInfos,
+		inference.Frameworks(turboJSON.Frameworks),
 	)
 
 	err = tracker.CalculateFileHashes(engine.TaskGraph.Vertices(), rs.Opts.runOpts.concurrency, r.base.RepoRoot)
@@ -305,6 +365,10 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 		}
 	}
 
+	if rs.Opts.runOpts.whyMiss != "" {
+		return WhyMiss(ctx, g, rs, engine, tracker, r.base, rs.Opts.runOpts.whyMiss)
+	}
+
 	// Graph Run
 	if rs.Opts.runOpts.graphFile != "" || rs.Opts.runOpts.graphDot {
 		return GraphRun(ctx, rs, engine, r.base)
@@ -331,8 +395,11 @@ func (r *run) run(ctx gocontext.Context, targets []string) error {
 		// the tasks that we expect to run based on the user command.
 		// Currently, we only emit this on dry runs, but it may be useful for real runs later also.
 		summary := &dryRunSummary{
-			Packages: packagesInScope,
-			Tasks:    []taskSummary{},
+			Packages:             packagesInScope,
+			GlobalEnv:            envNames(globalHashInputs.Env),
+			GlobalPassThroughEnv: env.ResolveEnvNames(rs.Opts.runOpts.globalPassThroughEnv),
+			GlobalDotEnv:         env.ExistingDotEnvFiles(r.base.RepoRoot, rs.Opts.runOpts.globalDotEnv),
+			Tasks:                []taskSummary{},
 		}
 
 		return DryRun(
@@ -372,7 +439,10 @@ func (r *run) initAnalyticsClient(ctx gocontext.Context) analytics.Client {
 	if apiClient.IsLinked() {
 		analyticsSink = apiClient
 	} else {
-		r.opts.cacheOpts.SkipRemote = true
+		// An S3 remote cache doesn't need a linked Vercel account
+		if !r.opts.cacheOpts.UsesS3() {
+			r.opts.cacheOpts.SkipRemote = true
+		}
 		analyticsSink = analytics.NullSink
 	}
 	analyticsClient := analytics.NewClient(ctx, analyticsSink, r.base.Logger.Named("analytics"))
@@ -422,6 +492,19 @@ func buildTaskGraphEngine(g *graph.CompleteGraph, rs *runSpec) (*core.Engine, er
 		return nil, fmt.Errorf("Invalid persistent task dependency:\n%v", err)
 	}
 
+	// Check that no tasks would wait forever for a persistent task's resources
+	if err := engine.ValidatePersistentResources(g); err != nil {
+		return nil, fmt.Errorf("Invalid persistent task resources:\n%v", err)
+	}
+
+	// Check that no tasks would wait forever for the slots that persistent tasks hold.
+	// Tasks don't take slots with --parallel.
+	if !rs.Opts.runOpts.parallel {
+		if err := engine.ValidatePersistentWeights(g, rs.Opts.runOpts.concurrency); err != nil {
+			return nil, fmt.Errorf("Invalid persistent task weights:\n%v", err)
+		}
+	}
+
 	return engine, nil
 }
 
@@ -433,11 +516,40 @@ const (
 	_dryRunTextValue = "Text"
 )
 
-func validateTasks(pipeline fs.Pipeline, tasks []string) error {
+func validateTasks(pipeline fs.Pipeline, workspaceTurboJSONs map[string]*fs.WorkspaceTurboJSON, tasks []string) error {
 	for _, task := range tasks {
-		if !pipeline.HasTask(task) {
+		if !pipeline.HasTask(task) && !workspacesHaveTask(workspaceTurboJSONs, task) {
 			return fmt.Errorf("task `%v` not found", task)
 		}
 	}
 	return nil
 }
+
+// workspacesHaveTask returns true if any workspace's turbo.json defines the given task
+func workspacesHaveTask(workspaceTurboJSONs map[string]*fs.WorkspaceTurboJSON, task string) bool {
+	for _, workspaceTurboJSON := range workspaceTurboJSONs {
+		if _, ok := workspaceTurboJSON.Pipeline[task]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWorkspaceTurboConfigs reads the turbo.json files in workspaces other than the root,
+// by package name
+func loadWorkspaceTurboConfigs(repoRoot turbopath.AbsoluteSystemPath, workspaceInfos graph.WorkspaceInfos) (map[string]*fs.WorkspaceTurboJSON, error) {
+	workspaceTurboJSONs := make(map[string]*fs.WorkspaceTurboJSON)
+	for pkgName, pkg := range workspaceInfos {
+		if pkgName == util.RootPkgName {
+			continue
+		}
+		workspaceTurboJSON, err := fs.ReadWorkspaceTurboConfig(pkg.Dir.RestoreAnchor(repoRoot))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		workspaceTurboJSONs[pkgName] = workspaceTurboJSON
+	}
+	return workspaceTurboJSONs, nil
+}
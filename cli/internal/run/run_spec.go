@@ -3,7 +3,10 @@
 package run
 
 import (
+	"time"
+
 	"github.com/vercel/turbo/cli/internal/cache"
+	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/runcache"
 	"github.com/vercel/turbo/cli/internal/scope"
 	"github.com/vercel/turbo/cli/internal/util"
@@ -74,4 +77,21 @@ type runOpts struct {
 	graphFile     string
 	noDaemon      bool
 	singlePackage bool
+	// cachePolicy is the value of --cache, which overrides TURBO_CACHE and turbo.json
+	cachePolicy string
+	// explain shows what changed since the last cached run of each task that misses
+	explain bool
+	// envMode is the value of --env-mode, which overrides envMode in turbo.json
+	envMode env.Mode
+	// globalPassThroughEnv are passed to every task in strict env mode, from turbo.json
+	globalPassThroughEnv []string
+	// globalDotEnv are .env files loaded into every task's environment, from turbo.json
+	globalDotEnv []string
+	// timeout is the value of --timeout, which overrides the timeout of every task
+	timeout time.Duration
+	// retries is the value of --retries, which overrides the retries of every task.
+	// It's nil when the flag isn't passed.
+	retries *int
+	// whyMiss is the task ID to explain instead of running anything, for `turbo why-miss`
+	whyMiss string
 }
@@ -3,6 +3,8 @@ package run
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,6 +42,8 @@ const (
 	TargetBuilt
 	TargetCached
 	TargetBuildFailed
+	// TargetBuildTimedOut is a failure where the task was stopped for exceeding its timeout
+	TargetBuildTimedOut
 )
 
 type BuildTargetState struct {
@@ -52,6 +56,18 @@ type BuildTargetState struct {
 	Status RunResultStatus
 	// Error, only populated for failure statuses
 	Err error
+	// Attempts are each run of the target's command, including retries
+	Attempts []TaskAttempt
+	// Flaky is true if the target was built, but only after retrying
+	Flaky bool
+}
+
+// TaskAttempt is a single run of a target's command
+type TaskAttempt struct {
+	StartAt  time.Time
+	Duration time.Duration
+	// Error, only populated if the attempt failed
+	Err error
 }
 
 type RunState struct {
@@ -59,6 +75,10 @@ type RunState struct {
 	state   map[string]*BuildTargetState
 	Success int
 	Failure int
+	// TimedOut counts the failures where the task exceeded its timeout
+	TimedOut int
+	// Flaky counts the targets that were built after retrying
+	Flaky int
 	// Is the output streaming?
 	Cached    int
 	Attempted int
@@ -78,6 +98,8 @@ func NewRunState(startedAt time.Time, tracingProfile string) *RunState {
 	return &RunState{
 		Success:         0,
 		Failure:         0,
+		TimedOut:        0,
+		Flaky:           0,
 		Cached:          0,
 		Attempted:       0,
 		state:           make(map[string]*BuildTargetState),
@@ -113,6 +135,35 @@ func (r *RunState) Run(label string) func(outcome RunResultStatus, err error) {
 	}
 }
 
+// Attempt records the start of a run of label's command, which is traced as its own
+// event. The returned function records the end of the run, failed with err if it isn't
+// nil, and returns how long it took.
+func (r *RunState) Attempt(label string) func(err error) time.Duration {
+	start := time.Now()
+	r.mu.Lock()
+	number := 1
+	if s, ok := r.state[label]; ok {
+		number = len(s.Attempts) + 1
+	}
+	r.mu.Unlock()
+	tracer := chrometracing.Event(fmt.Sprintf("%v (attempt %v)", label, number))
+
+	return func(err error) time.Duration {
+		defer tracer.Done()
+		duration := time.Since(start)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if s, ok := r.state[label]; ok {
+			s.Attempts = append(s.Attempts, TaskAttempt{
+				StartAt:  start,
+				Duration: duration,
+				Err:      err,
+			})
+		}
+		return duration
+	}
+}
+
 func (r *RunState) add(result *RunResult, previous string, active bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -133,12 +184,20 @@ func (r *RunState) add(result *RunResult, previous string, active bool) {
 	case result.Status == TargetBuildFailed:
 		r.Failure++
 		r.Attempted++
+	case result.Status == TargetBuildTimedOut:
+		r.Failure++
+		r.TimedOut++
+		r.Attempted++
 	case result.Status == TargetCached:
 		r.Cached++
 		r.Attempted++
 	case result.Status == TargetBuilt:
 		r.Success++
 		r.Attempted++
+		if s := r.state[result.Label]; len(s.Attempts) > 1 {
+			s.Flaky = true
+			r.Flaky++
+		}
 	}
 }
 
@@ -167,13 +226,62 @@ func (r *RunState) Close(terminal cli.Ui) error {
 		terminal.Warn("No tasks were executed as part of this run.")
 	}
 	terminal.Output("") // Clear the line
-	terminal.Output(util.Sprintf("${BOLD} Tasks:${BOLD_GREEN}    %v successful${RESET}${GRAY}, %v total${RESET}", r.Cached+r.Success, r.Attempted))
+	if r.TimedOut > 0 {
+		terminal.Output(util.Sprintf("${BOLD} Tasks:${BOLD_GREEN}    %v successful${RESET}${GRAY}, ${RESET}${BOLD_RED}%v timed out${RESET}${GRAY}, %v total${RESET}", r.Cached+r.Success, r.TimedOut, r.Attempted))
+	} else {
+		terminal.Output(util.Sprintf("${BOLD} Tasks:${BOLD_GREEN}    %v successful${RESET}${GRAY}, %v total${RESET}", r.Cached+r.Success, r.Attempted))
+	}
+	if r.Flaky > 0 {
+		terminal.Output(util.Sprintf("${BOLD} Flaky:${BOLD_YELLOW}    %v passed after retrying${RESET}${GRAY}: %v${RESET}", r.Flaky, strings.Join(r.flakyLabels(), ", ")))
+	}
+	for _, line := range r.attemptLines() {
+		terminal.Output(util.Sprintf("${GRAY}           %v${RESET}", line))
+	}
 	terminal.Output(util.Sprintf("${BOLD}Cached:    %v cached${RESET}${GRAY}, %v total${RESET}", r.Cached, r.Attempted))
 	terminal.Output(util.Sprintf("${BOLD}  Time:    %v${RESET} %v${RESET}", time.Since(r.startedAt).Truncate(time.Millisecond), maybeFullTurbo))
 	terminal.Output("")
 	return nil
 }
 
+// flakyLabels returns the sorted labels of the targets that passed after retrying
+func (r *RunState) flakyLabels() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	labels := []string{}
+	for label, s := range r.state {
+		if s.Flaky {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// attemptLines describes each attempt of the targets that were retried, sorted by label
+func (r *RunState) attemptLines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	labels := []string{}
+	for label, s := range r.state {
+		if len(s.Attempts) > 1 {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	lines := []string{}
+	for _, label := range labels {
+		for i, attempt := range r.state[label].Attempts {
+			duration := attempt.Duration.Truncate(time.Millisecond)
+			if attempt.Err != nil {
+				lines = append(lines, fmt.Sprintf("%v attempt %v failed after %v: %v", label, i+1, duration, attempt.Err))
+			} else {
+				lines = append(lines, fmt.Sprintf("%v attempt %v passed after %v", label, i+1, duration))
+			}
+		}
+	}
+	return lines
+}
+
 func writeChrometracing(filename string, terminal cli.Ui) error {
 	outputPath := chrometracing.Path()
 	if outputPath == "" {
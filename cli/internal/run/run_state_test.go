@@ -0,0 +1,60 @@
+package run
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRunState_RetriesAndTimeouts(t *testing.T) {
+	runState := NewRunState(time.Now(), "")
+	attemptErr := errors.New("exited (1)")
+
+	// passes after retrying
+	tracer := runState.Run("web#e2e")
+	runState.Attempt("web#e2e")(attemptErr)
+	runState.Attempt("web#e2e")(nil)
+	tracer(TargetBuilt, nil)
+
+	// passes the first time
+	tracer = runState.Run("web#build")
+	runState.Attempt("web#build")(nil)
+	tracer(TargetBuilt, nil)
+
+	// times out on every attempt
+	tracer = runState.Run("docs#e2e")
+	runState.Attempt("docs#e2e")(attemptErr)
+	runState.Attempt("docs#e2e")(attemptErr)
+	tracer(TargetBuildTimedOut, attemptErr)
+
+	assert.Equal(t, runState.Attempted, 3)
+	assert.Equal(t, runState.Success, 2)
+	assert.Equal(t, runState.Failure, 1)
+	assert.Equal(t, runState.TimedOut, 1)
+	assert.Equal(t, runState.Flaky, 1)
+	assert.DeepEqual(t, runState.flakyLabels(), []string{"web#e2e"})
+	assert.Equal(t, len(runState.state["web#e2e"].Attempts), 2)
+	assert.ErrorIs(t, runState.state["web#e2e"].Attempts[0].Err, attemptErr)
+	assert.Equal(t, runState.state["docs#e2e"].Flaky, false)
+
+	// Each attempt of a retried target is listed
+	lines := runState.attemptLines()
+	assert.Equal(t, len(lines), 4)
+	assert.Assert(t, strings.HasPrefix(lines[0], "docs#e2e attempt 1 failed after "))
+	assert.Assert(t, strings.HasSuffix(lines[0], ": exited (1)"))
+	assert.Assert(t, strings.HasPrefix(lines[3], "web#e2e attempt 2 passed after "))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, retryBackoff(0, 3), time.Duration(0))
+	assert.Equal(t, retryBackoff(5*time.Second, 1), 5*time.Second)
+	assert.Equal(t, retryBackoff(5*time.Second, 3), 20*time.Second)
+	// The wait stops doubling at a minute, without overflowing
+	assert.Equal(t, retryBackoff(5*time.Second, 5), time.Minute)
+	assert.Equal(t, retryBackoff(5*time.Second, 100), time.Minute)
+	// unless the first wait is already longer
+	assert.Equal(t, retryBackoff(2*time.Minute, 100), 2*time.Minute)
+}
@@ -124,10 +124,13 @@ func (tc TaskCache) RestoreOutputs(ctx context.Context, prefixedUI *cli.Prefixed
 
 	hasChangedOutputs := len(changedOutputGlobs) > 0
 	if hasChangedOutputs {
-		// Note that we currently don't use the output globs when restoring, but we could in the
-		// future to avoid doing unnecessary file I/O. We also need to pass along the exclusion
-		// globs as well.
-		hit, _, _, err := tc.rc.cache.Fetch(tc.rc.repoRoot, tc.hash, nil)
+		// Only restore the outputs that have changed, to avoid rewriting files that are
+		// already up to date.
+		outputGlobs := &fs.TaskOutputs{
+			Inclusions: changedOutputGlobs,
+			Exclusions: tc.repoRelativeGlobs.Exclusions,
+		}
+		hit, _, _, err := tc.rc.cache.Fetch(tc.rc.repoRoot, tc.hash, outputGlobs)
 		if err != nil {
 			return false, err
 		} else if !hit {
@@ -0,0 +1,172 @@
+package taskhash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// GlobalHashInputs is a breakdown of what went into the global hash
+type GlobalHashInputs struct {
+	Files                map[turbopath.AnchoredUnixPath]string `json:"files"`
+	RootExternalDepsHash string                                `json:"rootExternalDepsHash"`
+	// Env maps the names of the hashed environment variables to hashes of their values
+	Env          map[string]string `json:"env"`
+	PipelineHash string            `json:"pipelineHash"`
+}
+
+// TaskHashInputs is everything that went into a task's hash, in a form that can be
+// persisted and compared with the inputs of a later run of the same task
+type TaskHashInputs struct {
+	Hash   string `json:"hash"`
+	TaskID string `json:"taskId"`
+
+	PackageDir turbopath.AnchoredUnixPath `json:"packageDir"`
+	// Files maps the package's input files, relative to the package, to their hashes
+	Files            map[turbopath.AnchoredUnixPath]string `json:"files"`
+	ExternalDepsHash string                                `json:"externalDepsHash"`
+	Outputs          fs.TaskOutputs                        `json:"outputs"`
+	PassThroughArgs  []string                              `json:"passThroughArgs"`
+	// Env maps the names of the hashed environment variables to hashes of their values,
+	// so that their values aren't written to disk
+	Env map[string]string `json:"env"`
+	// Framework is the slug of the framework whose env var prefixes were hashed, if any
+	Framework string `json:"framework,omitempty"`
+	// Dependencies maps the task IDs of the task's dependencies to their hashes
+	Dependencies map[string]string `json:"dependencies"`
+	GlobalHash   string            `json:"globalHash"`
+	Global       *GlobalHashInputs `json:"global,omitempty"`
+}
+
+// HashEnvPairs turns a list of key=value pairs into a map of keys to hashes of their
+// values. The hashes are unsalted, so InputsStore keys them before they are stored.
+func HashEnvPairs(pairs []string) map[string]string {
+	hashed := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		sum := sha256.Sum256([]byte(value))
+		hashed[kv[0]] = hex.EncodeToString(sum[:8])
+	}
+	return hashed
+}
+
+// Explain describes how the inputs of a task changed between previous and current,
+// one change per line, most significant first
+func Explain(previous *TaskHashInputs, current *TaskHashInputs) []string {
+	changes := []string{}
+	if previous.PackageDir != current.PackageDir {
+		changes = append(changes, fmt.Sprintf("package moved from %v to %v", previous.PackageDir, current.PackageDir))
+	}
+	changes = append(changes, diffHashes("file", fileHashesByName(previous.Files), fileHashesByName(current.Files))...)
+	changes = append(changes, diffHashes("env var", previous.Env, current.Env)...)
+	if previous.Framework != current.Framework {
+		changes = append(changes, fmt.Sprintf("framework changed from %q to %q", previous.Framework, current.Framework))
+	}
+	changes = append(changes, diffHashes("dependency", previous.Dependencies, current.Dependencies)...)
+	if previous.ExternalDepsHash != current.ExternalDepsHash {
+		changes = append(changes, "external dependencies in the lockfile changed")
+	}
+	if !sameStrings(previous.Outputs.Inclusions, current.Outputs.Inclusions) || !sameStrings(previous.Outputs.Exclusions, current.Outputs.Exclusions) {
+		changes = append(changes, "outputs changed")
+	}
+	if !sameStrings(previous.PassThroughArgs, current.PassThroughArgs) {
+		changes = append(changes, fmt.Sprintf("arguments changed from %q to %q", previous.PassThroughArgs, current.PassThroughArgs))
+	}
+	if previous.GlobalHash != current.GlobalHash {
+		changes = append(changes, explainGlobal(previous.Global, current.Global)...)
+	}
+	if len(changes) == 0 && previous.Hash != current.Hash {
+		changes = append(changes, "task hash inputs changed")
+	}
+	return changes
+}
+
+// ChangedDependencies returns the task IDs of the dependencies whose hashes differ
+// between previous and current, sorted
+func ChangedDependencies(previous *TaskHashInputs, current *TaskHashInputs) []string {
+	changed := []string{}
+	for taskID, hash := range current.Dependencies {
+		if previousHash, ok := previous.Dependencies[taskID]; ok && previousHash != hash {
+			changed = append(changed, taskID)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func explainGlobal(previous *GlobalHashInputs, current *GlobalHashInputs) []string {
+	if previous == nil || current == nil {
+		return []string{"global hash changed"}
+	}
+	changes := []string{}
+	changes = append(changes, diffHashes("global file", fileHashesByName(previous.Files), fileHashesByName(current.Files))...)
+	changes = append(changes, diffHashes("global env var", previous.Env, current.Env)...)
+	if previous.RootExternalDepsHash != current.RootExternalDepsHash {
+		changes = append(changes, "root external dependencies in the lockfile changed")
+	}
+	if previous.PipelineHash != current.PipelineHash {
+		changes = append(changes, "pipeline in turbo.json changed")
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "global hash changed")
+	}
+	return changes
+}
+
+// sameStrings compares two lists, treating nil and empty as equal
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func fileHashesByName(fileHashes map[turbopath.AnchoredUnixPath]string) map[string]string {
+	byName := make(map[string]string, len(fileHashes))
+	for path, hash := range fileHashes {
+		byName[path.ToString()] = hash
+	}
+	return byName
+}
+
+// diffHashes describes the keys that were added, removed, or whose hashes changed
+func diffHashes(kind string, previous map[string]string, current map[string]string) []string {
+	keys := make([]string, 0, len(previous)+len(current))
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	changes := []string{}
+	for _, key := range keys {
+		previousHash, inPrevious := previous[key]
+		currentHash, inCurrent := current[key]
+		switch {
+		case !inPrevious:
+			changes = append(changes, fmt.Sprintf("%v %v was added", kind, key))
+		case !inCurrent:
+			changes = append(changes, fmt.Sprintf("%v %v was removed", kind, key))
+		case previousHash != currentHash:
+			changes = append(changes, fmt.Sprintf("%v %v changed", kind, key))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,159 @@
+package taskhash
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+func testInputs(hash string) *TaskHashInputs {
+	return &TaskHashInputs{
+		Hash:       hash,
+		TaskID:     "web#build",
+		PackageDir: "apps/web",
+		Files: map[turbopath.AnchoredUnixPath]string{
+			"package.json":   "aaa",
+			"src/index.ts":   "bbb",
+			"src/removed.ts": "ccc",
+		},
+		ExternalDepsHash: "deps",
+		PassThroughArgs:  []string{},
+		Env:              HashEnvPairs([]string{"API_URL=https://example.com", "NODE_ENV=production"}),
+		Dependencies:     map[string]string{"ui#build": "111", "config#build": "222"},
+		GlobalHash:       "global",
+		Global: &GlobalHashInputs{
+			Files:                map[turbopath.AnchoredUnixPath]string{"yarn.lock": "lock"},
+			RootExternalDepsHash: "root",
+			Env:                  HashEnvPairs([]string{"VERCEL_ANALYTICS_ID="}),
+			PipelineHash:         "pipeline",
+		},
+	}
+}
+
+func Test_Explain(t *testing.T) {
+	previous := testInputs("previous")
+	current := testInputs("current")
+	current.Files = map[turbopath.AnchoredUnixPath]string{
+		"package.json": "aaa",
+		"src/index.ts": "changed",
+		"src/added.ts": "ddd",
+	}
+	current.Env = HashEnvPairs([]string{"API_URL=https://example.org", "NODE_ENV=production"})
+	current.Dependencies = map[string]string{"ui#build": "333", "config#build": "222"}
+	current.PassThroughArgs = []string{"--prod"}
+	current.GlobalHash = "new-global"
+	current.Global = &GlobalHashInputs{
+		Files:                map[turbopath.AnchoredUnixPath]string{"yarn.lock": "new-lock"},
+		RootExternalDepsHash: "root",
+		Env:                  HashEnvPairs([]string{"VERCEL_ANALYTICS_ID="}),
+		PipelineHash:         "new-pipeline",
+	}
+
+	got := Explain(previous, current)
+	want := []string{
+		"file src/added.ts was added",
+		"file src/index.ts changed",
+		"file src/removed.ts was removed",
+		"env var API_URL changed",
+		"dependency ui#build changed",
+		`arguments changed from [] to ["--prod"]`,
+		"global file yarn.lock changed",
+		"pipeline in turbo.json changed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Explain() got %v, want %v", got, want)
+	}
+
+	gotDeps := ChangedDependencies(previous, current)
+	if !reflect.DeepEqual(gotDeps, []string{"ui#build"}) {
+		t.Errorf("ChangedDependencies() got %v, want [ui#build]", gotDeps)
+	}
+
+	// Environment variable values are never recorded
+	for name, valueHash := range current.Env {
+		if valueHash == "https://example.org" || valueHash == "production" {
+			t.Errorf("Env[%v] contains the variable's value", name)
+		}
+	}
+}
+
+func Test_ExplainUnknownChange(t *testing.T) {
+	previous := testInputs("previous")
+	current := testInputs("current")
+	current.GlobalHash = "new-global"
+	got := Explain(previous, current)
+	if !reflect.DeepEqual(got, []string{"global hash changed"}) {
+		t.Errorf("Explain() got %v, want [global hash changed]", got)
+	}
+
+	current.GlobalHash = previous.GlobalHash
+	got = Explain(previous, current)
+	if !reflect.DeepEqual(got, []string{"task hash inputs changed"}) {
+		t.Errorf("Explain() got %v, want [task hash inputs changed]", got)
+	}
+}
+
+func Test_InputsStore(t *testing.T) {
+	cacheDir := turbopath.AbsoluteSystemPathFromUpstream(t.TempDir())
+	store := NewInputsStore(cacheDir)
+
+	last, err := store.Last("web#build")
+	if err != nil {
+		t.Fatalf("Last() error: %v", err)
+	}
+	if last != nil {
+		t.Errorf("Last() got %v, want nil before anything is recorded", last)
+	}
+
+	first := testInputs("first")
+	if err := store.Record(first); err != nil {
+		t.Fatalf("Record() error: %v", err)
+	}
+	last, err = store.Last("web#build")
+	if err != nil {
+		t.Fatalf("Last() error: %v", err)
+	}
+	sealed, err := store.Seal(first)
+	if err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if !reflect.DeepEqual(last, sealed) {
+		t.Errorf("Last() got %v, want %v", last, sealed)
+	}
+
+	// Env var hashes are stored keyed with the repo's salt, which later runs reuse
+	if reflect.DeepEqual(last.Env, first.Env) || reflect.DeepEqual(last.Global.Env, first.Global.Env) {
+		t.Errorf("Last() got env hashes %v, want them to be keyed", last.Env)
+	}
+	resealed, err := NewInputsStore(cacheDir).Seal(first)
+	if err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if !reflect.DeepEqual(resealed, sealed) {
+		t.Errorf("Seal() got %v from a new store, want %v", resealed, sealed)
+	}
+	otherRepo, err := NewInputsStore(turbopath.AbsoluteSystemPathFromUpstream(t.TempDir())).Seal(first)
+	if err != nil {
+		t.Fatalf("Seal() error: %v", err)
+	}
+	if reflect.DeepEqual(otherRepo.Env, sealed.Env) {
+		t.Errorf("Seal() got the same env hashes %v in another repo", otherRepo.Env)
+	}
+
+	// Recording a new run replaces the old one
+	second := testInputs("second")
+	if err := store.Record(second); err != nil {
+		t.Fatalf("Record() error: %v", err)
+	}
+	last, err = store.Last("web#build")
+	if err != nil {
+		t.Fatalf("Last() error: %v", err)
+	}
+	if last == nil || last.Hash != "second" {
+		t.Errorf("Last() got %v, want the second run", last)
+	}
+	if old, err := store.Load("first"); err != nil || old != nil {
+		t.Errorf("Load(first) got %v, %v, want the old inputs to be removed", old, err)
+	}
+}
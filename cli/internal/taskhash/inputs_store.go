@@ -0,0 +1,221 @@
+package taskhash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/vercel/turbo/cli/internal/turbopath"
+)
+
+// _inputsDirectory is where the inputs of cached tasks are kept, inside the cache directory
+const _inputsDirectory = "hash-inputs"
+
+// _saltFile holds the random key, inside the inputs directory, that env var hashes are
+// keyed with before they are stored. Without it, a low-entropy secret could be
+// recovered from its hash by anyone who can read the cache directory.
+const _saltFile = "salt"
+
+// InputsStore persists the inputs of cached tasks, so that when a task misses the
+// cache, its inputs can be compared with those of the last run that was cached.
+// Inputs are stored by task hash, along with a pointer from each task to the hash of
+// its last cached run. Only the inputs of each task's last cached run are kept.
+// Inputs are stored, and must be compared, in the form returned by Seal.
+type InputsStore struct {
+	dir turbopath.AbsoluteSystemPath
+
+	mu   sync.Mutex
+	salt []byte
+}
+
+// NewInputsStore returns a store in the given cache directory
+func NewInputsStore(cacheDir turbopath.AbsoluteSystemPath) *InputsStore {
+	return &InputsStore{dir: cacheDir.UntypedJoin(_inputsDirectory)}
+}
+
+func (s *InputsStore) inputsPath(hash string) turbopath.AbsoluteSystemPath {
+	return s.dir.UntypedJoin(hash + ".json")
+}
+
+func (s *InputsStore) lastPath(taskID string) turbopath.AbsoluteSystemPath {
+	return s.dir.UntypedJoin("last", url.PathEscape(taskID))
+}
+
+// Seal returns a copy of inputs with its env var hashes keyed with this repo's salt,
+// which is the form that inputs are stored in
+func (s *InputsStore) Seal(inputs *TaskHashInputs) (*TaskHashInputs, error) {
+	salt, err := s.getSalt()
+	if err != nil {
+		return nil, err
+	}
+	sealed := *inputs
+	sealed.Env = keyEnvHashes(salt, inputs.Env)
+	if inputs.Global != nil {
+		global := *inputs.Global
+		global.Env = keyEnvHashes(salt, inputs.Global.Env)
+		sealed.Global = &global
+	}
+	return &sealed, nil
+}
+
+func keyEnvHashes(salt []byte, env map[string]string) map[string]string {
+	keyed := make(map[string]string, len(env))
+	for name, hash := range env {
+		mac := hmac.New(sha256.New, salt)
+		_, _ = mac.Write([]byte(hash))
+		keyed[name] = hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+	return keyed
+}
+
+// getSalt returns this repo's salt, creating it if there isn't one yet
+func (s *InputsStore) getSalt() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.salt != nil {
+		return s.salt, nil
+	}
+	saltPath := s.dir.UntypedJoin(_saltFile)
+	contents, err := saltPath.ReadFile()
+	if errors.Is(err, os.ErrNotExist) {
+		contents, err = createSalt(saltPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, err
+	}
+	s.salt = salt
+	return salt, nil
+}
+
+// createSalt writes a new random salt to path, unless another process gets there first,
+// in which case its salt is returned instead
+func createSalt(path turbopath.AbsoluteSystemPath) ([]byte, error) {
+	if err := path.EnsureDir(); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	contents := []byte(hex.EncodeToString(salt))
+	tmp, err := os.CreateTemp(path.Dir().ToString(), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Unlike a rename, a link never replaces a salt that already exists
+	if err := os.Link(tmp.Name(), path.ToString()); errors.Is(err, os.ErrExist) {
+		return path.ReadFile()
+	} else if err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// Record stores the inputs of a task that was cached, and makes it the task's last
+// cached run
+func (s *InputsStore) Record(inputs *TaskHashInputs) error {
+	lastPath := s.lastPath(inputs.TaskID)
+	if err := lastPath.EnsureDir(); err != nil {
+		return err
+	}
+	inputs, err := s.Seal(inputs)
+	if err != nil {
+		return err
+	}
+	if !s.inputsPath(inputs.Hash).FileExists() {
+		contents, err := json.Marshal(inputs)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.inputsPath(inputs.Hash), contents); err != nil {
+			return err
+		}
+	}
+	previous, err := s.lastHash(inputs.TaskID)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(lastPath, []byte(inputs.Hash)); err != nil {
+		return err
+	}
+	if previous != "" && previous != inputs.Hash {
+		if err := s.inputsPath(previous).Remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load returns the stored inputs for the given hash, or nil if there are none
+func (s *InputsStore) Load(hash string) (*TaskHashInputs, error) {
+	contents, err := s.inputsPath(hash).ReadFile()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	inputs := &TaskHashInputs{}
+	if err := json.Unmarshal(contents, inputs); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// Last returns the inputs of the last cached run of the given task, or nil if there
+// are none
+func (s *InputsStore) Last(taskID string) (*TaskHashInputs, error) {
+	hash, err := s.lastHash(taskID)
+	if err != nil || hash == "" {
+		return nil, err
+	}
+	return s.Load(hash)
+}
+
+func (s *InputsStore) lastHash(taskID string) (string, error) {
+	contents, err := s.lastPath(taskID).ReadFile()
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// writeFileAtomic writes contents to a temporary file, and moves it into place, so
+// that concurrent readers never see a partial file
+func writeFileAtomic(path turbopath.AbsoluteSystemPath, contents []byte) error {
+	tmp, err := os.CreateTemp(path.Dir().ToString(), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(contents)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path.ToString())
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
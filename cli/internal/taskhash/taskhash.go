@@ -5,6 +5,8 @@ package taskhash
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -12,7 +14,6 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/pyr-sh/dag"
 	gitignore "github.com/sabhiram/go-gitignore"
-	"github.com/vercel/turbo/cli/internal/doublestar"
 	"github.com/vercel/turbo/cli/internal/env"
 	"github.com/vercel/turbo/cli/internal/fs"
 	"github.com/vercel/turbo/cli/internal/graph"
@@ -32,34 +33,46 @@ import (
 type Tracker struct {
 	rootNode            string
 	globalHash          string
-	pipeline            fs.Pipeline
+	taskDefinitions     map[string]*fs.TaskDefinition
 	workspaceInfos      graph.WorkspaceInfos
+	globalInputs        *GlobalHashInputs
+	frameworks          []inference.Framework
 	mu                  sync.RWMutex
 	packageInputsHashes packageFileHashes
-	packageTaskHashes   map[string]string // taskID -> hash
+	packageInputsFiles  map[packageFileHashKey]map[turbopath.AnchoredUnixPath]string
+	packageTaskHashes   map[string]string          // taskID -> hash
+	packageTaskInputs   map[string]*TaskHashInputs // taskID -> inputs
 }
 
 // NewTracker creates a tracker for package-inputs combinations and package-task combinations.
-func NewTracker(rootNode string, globalHash string, pipeline fs.Pipeline, workspaceInfos graph.WorkspaceInfos) *Tracker {
+// globalInputs is the breakdown of globalHash, which is recorded with each task's inputs.
+// frameworks are the frameworks whose env var prefixes are hashed for the packages using them.
+func NewTracker(rootNode string, globalHash string, globalInputs *GlobalHashInputs, taskDefinitions map[string]*fs.TaskDefinition, workspaceInfos graph.WorkspaceInfos, frameworks []inference.Framework) *Tracker {
 	return &Tracker{
 		rootNode:          rootNode,
 		globalHash:        globalHash,
-		pipeline:          pipeline,
+		globalInputs:      globalInputs,
+		frameworks:        frameworks,
+		taskDefinitions:   taskDefinitions,
 		workspaceInfos:    workspaceInfos,
 		packageTaskHashes: make(map[string]string),
+		packageTaskInputs: make(map[string]*TaskHashInputs),
 	}
 }
 
-// packageFileSpec defines a combination of a package and optional set of input globs
+// packageFileSpec defines a combination of a package, an optional set of input globs,
+// and the .env files that are loaded for its tasks
 type packageFileSpec struct {
 	pkg    string
 	inputs []string
+	dotEnv []string
 }
 
 func specFromPackageTask(packageTask *nodes.PackageTask) packageFileSpec {
 	return packageFileSpec{
 		pkg:    packageTask.PackageName,
 		inputs: packageTask.TaskDefinition.Inputs,
+		dotEnv: packageTask.TaskDefinition.DotEnv,
 	}
 }
 
@@ -69,7 +82,7 @@ type packageFileHashKey string
 // hashes the inputs for a packageTask
 func (pfs packageFileSpec) ToKey() packageFileHashKey {
 	sort.Strings(pfs.inputs)
-	return packageFileHashKey(fmt.Sprintf("%v#%v", pfs.pkg, strings.Join(pfs.inputs, "!")))
+	return packageFileHashKey(fmt.Sprintf("%v#%v#%v", pfs.pkg, strings.Join(pfs.inputs, "!"), strings.Join(pfs.dotEnv, "!")))
 }
 
 func safeCompileIgnoreFile(filepath string) (*gitignore.GitIgnore, error) {
@@ -80,7 +93,7 @@ func safeCompileIgnoreFile(filepath string) (*gitignore.GitIgnore, error) {
 	return gitignore.CompileIgnoreLines([]string{}...), nil
 }
 
-func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.AbsoluteSystemPath) (string, error) {
+func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.AbsoluteSystemPath) (string, map[turbopath.AnchoredUnixPath]string, error) {
 	hashObject, pkgDepsErr := hashing.GetPackageDeps(repoRoot, &hashing.PackageDepsOptions{
 		PackagePath:   pkg.Dir,
 		InputPatterns: pfs.inputs,
@@ -88,15 +101,34 @@ func (pfs *packageFileSpec) hash(pkg *fs.PackageJSON, repoRoot turbopath.Absolut
 	if pkgDepsErr != nil {
 		manualHashObject, err := manuallyHashPackage(pkg, pfs.inputs, repoRoot)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		hashObject = manualHashObject
 	}
+	// .env files are hashed whether or not they match the inputs, or are ignored by git,
+	// since they're loaded into the task's environment
+	pkgPath := pkg.Dir.RestoreAnchor(repoRoot)
+	for _, file := range env.ExistingDotEnvFiles(pkgPath, pfs.dotEnv) {
+		hash, err := fs.GitLikeHashFile(pkgPath.UntypedJoin(file).ToString())
+		if err != nil {
+			return "", nil, fmt.Errorf("could not hash file %v. \n%w", file, err)
+		}
+		hashObject[turbopath.AnchoredUnixPath(path.Clean(filepath.ToSlash(file)))] = hash
+	}
+	// The workspace's turbo.json is hashed whether or not it matches the inputs, since it
+	// configures the workspace's tasks. The root turbo.json is part of the global hash instead.
+	if turboJSONPath := pkgPath.UntypedJoin("turbo.json"); pfs.pkg != util.RootPkgName && turboJSONPath.FileExists() {
+		hash, err := fs.GitLikeHashFile(turboJSONPath.ToString())
+		if err != nil {
+			return "", nil, fmt.Errorf("could not hash file %v. \n%w", turboJSONPath, err)
+		}
+		hashObject[turbopath.AnchoredUnixPath("turbo.json")] = hash
+	}
 	hashOfFiles, otherErr := fs.HashObject(hashObject)
 	if otherErr != nil {
-		return "", otherErr
+		return "", nil, otherErr
 	}
-	return hashOfFiles, nil
+	return hashOfFiles, hashObject, nil
 }
 
 func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath turbopath.AbsoluteSystemPath) (map[turbopath.AnchoredUnixPath]string, error) {
@@ -113,41 +145,43 @@ func manuallyHashPackage(pkg *fs.PackageJSON, inputs []string, rootPath turbopat
 		return nil, err
 	}
 
-	includePattern := ""
-	if len(inputs) > 0 {
-		includePattern = "{" + strings.Join(inputs, ",") + "}"
-	}
-
 	pathPrefix := rootPath.UntypedJoin(pkg.Dir.ToStringDuringMigration()).ToString()
 	convertedPathPrefix := turbopath.AbsoluteSystemPathFromUpstream(pathPrefix)
-	fs.Walk(pathPrefix, func(name string, isDir bool) error {
-		convertedName := turbopath.AbsoluteSystemPathFromUpstream(name)
-		rootMatch := ignore.MatchesPath(convertedName.ToString())
-		otherMatch := ignorePkg.MatchesPath(convertedName.ToString())
-		if !rootMatch && !otherMatch {
-			if !isDir {
-				if includePattern != "" {
-					val, err := doublestar.PathMatch(includePattern, convertedName.ToString())
-					if err != nil {
-						return err
-					}
-					if !val {
-						return nil
-					}
-				}
-				hash, err := fs.GitLikeHashFile(convertedName.ToString())
-				if err != nil {
-					return fmt.Errorf("could not hash file %v. \n%w", convertedName.ToString(), err)
-				}
+	hashFile := func(convertedName turbopath.AbsoluteSystemPath) error {
+		if ignore.MatchesPath(convertedName.ToString()) || ignorePkg.MatchesPath(convertedName.ToString()) {
+			return nil
+		}
+		hash, err := fs.GitLikeHashFile(convertedName.ToString())
+		if err != nil {
+			return fmt.Errorf("could not hash file %v. \n%w", convertedName.ToString(), err)
+		}
 
-				relativePath, err := convertedName.RelativeTo(convertedPathPrefix)
-				if err != nil {
-					return fmt.Errorf("File path cannot be made relative: %w", err)
-				}
-				hashObject[relativePath.ToUnixPath()] = hash
-			}
+		relativePath, err := convertedName.RelativeTo(convertedPathPrefix)
+		if err != nil {
+			return fmt.Errorf("File path cannot be made relative: %w", err)
 		}
+		hashObject[relativePath.ToUnixPath()] = hash
 		return nil
+	}
+
+	if len(inputs) > 0 {
+		files, err := hashing.GlobInputFiles(rootPath, convertedPathPrefix, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if err := hashFile(file.RestoreAnchor(convertedPathPrefix)); err != nil {
+				return nil, err
+			}
+		}
+		return hashObject, nil
+	}
+
+	fs.Walk(pathPrefix, func(name string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		return hashFile(turbopath.AbsoluteSystemPathFromUpstream(name))
 	})
 	return hashObject, nil
 }
@@ -174,9 +208,8 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 			continue
 		}
 
-		// TODO(mehulkar): Once we start composing turbo.json, we need to change this
-		// to look in the graph for TaskDefinitions, rather than the root pipeline.
-		taskDefinition, ok := th.pipeline.GetTaskDefinition(taskID)
+		// The resolved definitions include the overrides from workspaces' turbo.json files
+		taskDefinition, ok := th.taskDefinitions[taskID]
 		if !ok {
 			return fmt.Errorf("missing pipeline entry %v", taskID)
 		}
@@ -184,12 +217,14 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 		pfs := &packageFileSpec{
 			pkg:    pkgName,
 			inputs: taskDefinition.Inputs,
+			dotEnv: taskDefinition.DotEnv,
 		}
 
 		hashTasks.Add(pfs)
 	}
 
 	hashes := make(map[packageFileHashKey]string)
+	files := make(map[packageFileHashKey]map[turbopath.AnchoredUnixPath]string)
 	hashQueue := make(chan *packageFileSpec, workerCount)
 	hashErrs := &errgroup.Group{}
 
@@ -200,13 +235,14 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 				if !ok {
 					return fmt.Errorf("cannot find package %v", packageFileSpec.pkg)
 				}
-				hash, err := packageFileSpec.hash(pkg, repoRoot)
+				hash, fileHashes, err := packageFileSpec.hash(pkg, repoRoot)
 				if err != nil {
 					return err
 				}
 				th.mu.Lock()
 				pfsKey := packageFileSpec.ToKey()
 				hashes[pfsKey] = hash
+				files[pfsKey] = fileHashes
 				th.mu.Unlock()
 			}
 			return nil
@@ -221,6 +257,7 @@ func (th *Tracker) CalculateFileHashes(allTasks []dag.Vertex, workerCount int, r
 		return err
 	}
 	th.packageInputsHashes = hashes
+	th.packageInputsFiles = files
 	return nil
 }
 
@@ -236,8 +273,9 @@ type taskHashInputs struct {
 	taskDependencyHashes []string
 }
 
-func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, error) {
-	dependencyHashSet := make(util.Set)
+// calculateDependencyHashes returns the hashes of the given tasks, by task ID
+func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) (map[string]string, error) {
+	dependencyHashes := make(map[string]string)
 
 	rootPrefix := th.rootNode + util.TaskDelimiter
 	th.mu.RLock()
@@ -257,11 +295,20 @@ func (th *Tracker) calculateDependencyHashes(dependencySet dag.Set) ([]string, e
 		if !ok {
 			return nil, fmt.Errorf("missing hash for dependent task: %v", dependencyTask)
 		}
-		dependencyHashSet.Add(dependencyHash)
+		dependencyHashes[dependencyTask] = dependencyHash
+	}
+	return dependencyHashes, nil
+}
+
+// sortedUniqueHashes returns the distinct hashes of dependencyHashes, sorted
+func sortedUniqueHashes(dependencyHashes map[string]string) []string {
+	dependencyHashSet := make(util.Set)
+	for _, hash := range dependencyHashes {
+		dependencyHashSet.Add(hash)
 	}
 	dependenciesHashList := dependencyHashSet.UnsafeListOfStrings()
 	sort.Strings(dependenciesHashList)
-	return dependenciesHashList, nil
+	return dependenciesHashList
 }
 
 // CalculateTaskHash calculates the hash for package-task combination. It is threadsafe, provided
@@ -277,19 +324,24 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 	}
 
 	var envPrefixes []string
-	framework := inference.InferFramework(packageTask.Pkg)
-	if framework != nil && framework.EnvPrefix != "" {
-		// log auto detected framework and env prefix
-		logger.Debug(fmt.Sprintf("auto detected framework for %s", packageTask.PackageName), "framework", framework.Slug, "env_prefix", framework.EnvPrefix)
-		envPrefixes = append(envPrefixes, framework.EnvPrefix)
+	frameworkSlug := ""
+	if !packageTask.TaskDefinition.SkipFrameworkInference {
+		framework := inference.MatchFramework(packageTask.Pkg, th.frameworks)
+		if framework != nil && len(framework.EnvPrefixes) > 0 {
+			// log auto detected framework and env prefixes
+			logger.Debug(fmt.Sprintf("auto detected framework for %s", packageTask.PackageName), "framework", framework.Slug, "env_prefixes", framework.EnvPrefixes)
+			envPrefixes = append(envPrefixes, framework.EnvPrefixes...)
+			frameworkSlug = framework.Slug
+		}
 	}
 
 	hashableEnvPairs := env.GetHashableEnvPairs(packageTask.TaskDefinition.EnvVarDependencies, envPrefixes)
-	outputs := packageTask.HashableOutputs()
-	taskDependencyHashes, err := th.calculateDependencyHashes(dependencySet)
+	sortedOutputs := packageTask.HashableOutputs().Sort()
+	dependencyHashes, err := th.calculateDependencyHashes(dependencySet)
 	if err != nil {
 		return "", err
 	}
+	taskDependencyHashes := sortedUniqueHashes(dependencyHashes)
 	// log any auto detected env vars
 	logger.Debug(fmt.Sprintf("task hash env vars for %s:%s", packageTask.PackageName, packageTask.Task), "vars", hashableEnvPairs)
 
@@ -298,7 +350,7 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 		hashOfFiles:          hashOfFiles,
 		externalDepsHash:     packageTask.Pkg.ExternalDepsHash,
 		task:                 packageTask.Task,
-		outputs:              outputs.Sort(),
+		outputs:              sortedOutputs,
 		passThruArgs:         args,
 		hashableEnvPairs:     hashableEnvPairs,
 		globalHash:           th.globalHash,
@@ -309,6 +361,39 @@ func (th *Tracker) CalculateTaskHash(packageTask *nodes.PackageTask, dependencyS
 	}
 	th.mu.Lock()
 	th.packageTaskHashes[packageTask.TaskID] = hash
+	th.packageTaskInputs[packageTask.TaskID] = &TaskHashInputs{
+		Hash:             hash,
+		TaskID:           packageTask.TaskID,
+		PackageDir:       packageTask.Pkg.Dir.ToUnixPath(),
+		Files:            th.packageInputsFiles[pkgFileHashKey],
+		ExternalDepsHash: packageTask.Pkg.ExternalDepsHash,
+		Outputs:          sortedOutputs,
+		PassThroughArgs:  args,
+		Env:              HashEnvPairs(hashableEnvPairs),
+		Framework:        frameworkSlug,
+		Dependencies:     dependencyHashes,
+		GlobalHash:       th.globalHash,
+		Global:           th.globalInputs,
+	}
 	th.mu.Unlock()
 	return hash, nil
 }
+
+// FrameworkEnvPrefixes returns the env var prefixes of every framework that can be
+// inferred, whether or not any package uses it
+func (th *Tracker) FrameworkEnvPrefixes() []string {
+	prefixes := []string{}
+	for _, framework := range th.frameworks {
+		prefixes = append(prefixes, framework.EnvPrefixes...)
+	}
+	return prefixes
+}
+
+// HashInputs returns the inputs that went into the hash of the given task, which
+// must already have been calculated
+func (th *Tracker) HashInputs(taskID string) (*TaskHashInputs, bool) {
+	th.mu.RLock()
+	defer th.mu.RUnlock()
+	inputs, ok := th.packageTaskInputs[taskID]
+	return inputs, ok
+}
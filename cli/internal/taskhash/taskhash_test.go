@@ -2,6 +2,7 @@ package taskhash
 
 import (
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -134,4 +135,17 @@ func Test_manuallyHashPackage(t *testing.T) {
 	if count != len(justFileHashes) {
 		t.Errorf("found extra hashes in %v", hashes)
 	}
+
+	// Inputs can be anchored at the repository root, and exclude files
+	anchoredHashes, err := manuallyHashPackage(pkg, []string{"$ROOT/top-level-file", "**/*file", "!some-dir/**"}, repoRoot)
+	if err != nil {
+		t.Fatalf("failed to calculate manual hashes: %v", err)
+	}
+	expectedAnchoredHashes := map[turbopath.AnchoredUnixPath]string{
+		"../../top-level-file": "561961a68c548da18a4d33915c9a52c3d613b206",
+		"some-file":            "7e59c6a6ea9098c6d3beb00e753e2c54ea502311",
+	}
+	if !reflect.DeepEqual(anchoredHashes, expectedAnchoredHashes) {
+		t.Errorf("manuallyHashPackage() got %v, want %v", anchoredHashes, expectedAnchoredHashes)
+	}
 }
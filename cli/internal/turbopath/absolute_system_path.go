@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // AbsoluteSystemPath is a root-relative path using system separators.
@@ -218,6 +219,21 @@ func (p AbsoluteSystemPath) RemoveAll() error {
 	return os.RemoveAll(p.ToString())
 }
 
+// Chtimes implements os.Chtimes for an absolute path
+func (p AbsoluteSystemPath) Chtimes(atime time.Time, mtime time.Time) error {
+	return os.Chtimes(p.ToString(), atime, mtime)
+}
+
+// Chmod implements os.Chmod for an absolute path
+func (p AbsoluteSystemPath) Chmod(mode os.FileMode) error {
+	return os.Chmod(p.ToString(), mode)
+}
+
+// Link implements os.Link(target, p) for an absolute path
+func (p AbsoluteSystemPath) Link(target AbsoluteSystemPath) error {
+	return os.Link(target.ToString(), p.ToString())
+}
+
 // Base implements filepath.Base for an absolute path
 func (p AbsoluteSystemPath) Base() string {
 	return filepath.Base(p.ToString())
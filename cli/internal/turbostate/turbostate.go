@@ -12,6 +12,26 @@ type RepoState struct {
 	Mode string `json:"mode"`
 }
 
+// CachePayload is the extra flags and subcommand that are
+// passed for the `cache` subcommand
+type CachePayload struct {
+	CacheDir      string   `json:"cache_dir"`
+	JSON          bool     `json:"json"`
+	Command       string   `json:"command"`
+	All           bool     `json:"all"`
+	MaxSize       string   `json:"max_size"`
+	MaxAge        string   `json:"max_age"`
+	Hash          string   `json:"hash"`
+	Hashes        []string `json:"hashes"`
+	Output        string   `json:"output"`
+	File          string   `json:"file"`
+	Remote        bool     `json:"remote"`
+	Host          string   `json:"host"`
+	Port          int      `json:"port"`
+	MaxUploadSize string   `json:"max_upload_size"`
+	Retry         bool     `json:"retry"`
+}
+
 // DaemonPayload is the extra flags and command that are
 // passed for the `daemon` subcommand
 type DaemonPayload struct {
@@ -40,10 +60,13 @@ type PrunePayload struct {
 // RunPayload is the extra flags passed for the `run` subcommand
 type RunPayload struct {
 	CacheDir          string   `json:"cache_dir"`
+	Cache             string   `json:"cache"`
 	CacheWorkers      int      `json:"cache_workers"`
 	Concurrency       string   `json:"concurrency"`
 	ContinueExecution bool     `json:"continue_execution"`
 	DryRun            string   `json:"dry_run"`
+	EnvMode           string   `json:"env_mode"`
+	Explain           bool     `json:"explain"`
 	Filter            []string `json:"filter"`
 	Force             bool     `json:"force"`
 	GlobalDeps        []string `json:"global_deps"`
@@ -65,23 +88,35 @@ type RunPayload struct {
 	Parallel            bool     `json:"parallel"`
 	Profile             string   `json:"profile"`
 	RemoteOnly          bool     `json:"remote_only"`
-	Scope               []string `json:"scope"`
-	Since               string   `json:"since"`
-	SinglePackage       bool     `json:"single_package"`
-	Tasks               []string `json:"tasks"`
-	PkgInferenceRoot    string   `json:"pkg_inference_root"`
+	// Retries is nil when --retries isn't passed, so that turbo.json applies
+	Retries          *int     `json:"retries"`
+	Scope            []string `json:"scope"`
+	Since            string   `json:"since"`
+	SinglePackage    bool     `json:"single_package"`
+	Tasks            []string `json:"tasks"`
+	Timeout          string   `json:"timeout"`
+	PkgInferenceRoot string   `json:"pkg_inference_root"`
 }
 
 // Command consists of the data necessary to run a command.
 // Only one of these fields should be initialized at a time.
 type Command struct {
-	Daemon *DaemonPayload `json:"daemon"`
-	Link   *LinkPayload   `json:"link"`
-	Login  *LoginPayload  `json:"login"`
-	Logout *struct{}      `json:"logout"`
-	Prune  *PrunePayload  `json:"prune"`
-	Run    *RunPayload    `json:"run"`
-	Unlink *struct{}      `json:"unlink"`
+	Cache    *CachePayload   `json:"cache"`
+	Daemon   *DaemonPayload  `json:"daemon"`
+	Link     *LinkPayload    `json:"link"`
+	Login    *LoginPayload   `json:"login"`
+	Logout   *struct{}       `json:"logout"`
+	Prune    *PrunePayload   `json:"prune"`
+	Run      *RunPayload     `json:"run"`
+	Unlink   *struct{}       `json:"unlink"`
+	Validate *struct{}       `json:"validate"`
+	WhyMiss  *WhyMissPayload `json:"whyMiss"`
+}
+
+// WhyMissPayload is the extra flags passed for the `why-miss` subcommand
+type WhyMissPayload struct {
+	Task     string `json:"task"`
+	CacheDir string `json:"cache_dir"`
 }
 
 // ParsedArgsFromRust are the parsed command line arguments passed
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longest suffixes first so that "GB" is not mistaken for "B".
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a human-readable size such as 512MB or 10G into a number of bytes.
+// Units are binary (1KB == 1024 bytes) and a bare number is interpreted as bytes.
+func ParseByteSize(sizeRaw string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(sizeRaw))
+	multiplier := int64(1)
+	for _, unit := range _byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q. This should be a number of bytes with an optional unit, for example 512MB or 10GB", sizeRaw)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("invalid size %q. Sizes cannot be negative", sizeRaw)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// ParseDurationWithDays parses a duration in the format accepted by time.ParseDuration,
+// additionally accepting a whole number of days with a "d" suffix, e.g. 7d.
+func ParseDurationWithDays(durationRaw string) (time.Duration, error) {
+	value := strings.TrimSpace(durationRaw)
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration %q. This should be a number of days such as 7d, or a duration such as 72h", durationRaw)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q. This should be a number of days such as 7d, or a duration such as 72h", durationRaw)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q. Durations cannot be negative", durationRaw)
+	}
+	return duration, nil
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"10B", 10},
+		{"1KB", 1024},
+		{"1k", 1024},
+		{"512MB", 512 * 1024 * 1024},
+		{"1.5GB", 1536 * 1024 * 1024},
+		{"2T", 2 << 40},
+		{" 10 GB ", 10 << 30},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			result, err := ParseByteSize(tc.Input)
+			if err != nil {
+				t.Fatalf("invalid parse: %#v", err)
+			}
+			assert.EqualValues(t, tc.Expected, result)
+		})
+	}
+}
+
+func TestInvalidByteSizes(t *testing.T) {
+	inputs := []string{"", "GB", "-1GB", "ten", "10PB"}
+	for _, tc := range inputs {
+		t.Run(tc, func(t *testing.T) {
+			val, err := ParseByteSize(tc)
+			assert.Error(t, err, "input %v got %v", tc, val)
+		})
+	}
+}
+
+func TestParseDurationWithDays(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"0d", 0},
+		{"72h", 72 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			result, err := ParseDurationWithDays(tc.Input)
+			if err != nil {
+				t.Fatalf("invalid parse: %#v", err)
+			}
+			assert.Equal(t, tc.Expected, result)
+		})
+	}
+
+	for _, tc := range []string{"", "d", "-1d", "1.5d", "-5h", "week"} {
+		t.Run(tc, func(t *testing.T) {
+			val, err := ParseDurationWithDays(tc)
+			assert.Error(t, err, "input %v got %v", tc, val)
+		})
+	}
+}
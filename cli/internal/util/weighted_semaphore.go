@@ -0,0 +1,130 @@
+package util
+
+import "sync"
+
+// WeightedSemaphore limits the total weight of simultaneous acquisitions. An
+// acquisition may also hold named resources, each of which only one acquisition
+// can hold at a time. Waiters take slots in the order they arrived, so a heavy
+// acquisition isn't starved by a stream of lighter ones.
+type WeightedSemaphore struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	used    int
+	held    Set
+	waiters []*semaphoreWaiter
+}
+
+// semaphoreWaiter is an Acquire call that is waiting its turn
+type semaphoreWaiter struct {
+	weight    int
+	resources []string
+}
+
+// NewWeightedSemaphore creates a semaphore that allows simultaneous acquisitions
+// with a total weight of up to limit
+func NewWeightedSemaphore(limit int) *WeightedSemaphore {
+	if limit <= 0 {
+		panic("semaphore with limit <=0")
+	}
+	s := &WeightedSemaphore{
+		limit: limit,
+		held:  make(Set),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// clamp returns the weight that an acquisition takes. A weight larger than the
+// limit takes the whole limit, so that it can still be acquired.
+func (s *WeightedSemaphore) clamp(weight int) int {
+	if weight > s.limit {
+		return s.limit
+	}
+	return weight
+}
+
+// Acquire blocks until weight slots and all of resources are available, then takes
+// them. Everything is taken at once, rather than one at a time, so an acquisition
+// never holds part of what another is waiting for, and they can't deadlock.
+func (s *WeightedSemaphore) Acquire(weight int, resources []string) {
+	weight = s.clamp(weight)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiter := &semaphoreWaiter{weight: weight, resources: resources}
+	s.waiters = append(s.waiters, waiter)
+	for !s.admissible(waiter) {
+		s.cond.Wait()
+	}
+	s.removeWaiter(waiter)
+	s.used += weight
+	for _, resource := range resources {
+		s.held.Add(resource)
+	}
+	// Waiters queued behind this one may have been waiting for it to go first
+	s.cond.Broadcast()
+}
+
+// admissible returns whether waiter can take its slots and resources now. It can't
+// while an earlier waiter needs slots and has all of its resources free, since taking
+// slots ahead of it could keep it waiting indefinitely. An earlier waiter that is held
+// up by a resource doesn't hold up the rest of the queue. s.mu must be held.
+func (s *WeightedSemaphore) admissible(waiter *semaphoreWaiter) bool {
+	if !s.slotsFree(waiter.weight) || !s.resourcesFree(waiter.resources) {
+		return false
+	}
+	if waiter.weight == 0 {
+		return true
+	}
+	for _, earlier := range s.waiters {
+		if earlier == waiter {
+			break
+		}
+		if earlier.weight > 0 && s.resourcesFree(earlier.resources) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeWaiter removes waiter from the queue. s.mu must be held.
+func (s *WeightedSemaphore) removeWaiter(waiter *semaphoreWaiter) {
+	for i, queued := range s.waiters {
+		if queued == waiter {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// slotsFree returns whether weight slots are free. s.mu must be held.
+func (s *WeightedSemaphore) slotsFree(weight int) bool {
+	return s.used+weight <= s.limit
+}
+
+// resourcesFree returns whether all of resources are free. s.mu must be held.
+func (s *WeightedSemaphore) resourcesFree(resources []string) bool {
+	for _, resource := range resources {
+		if s.held.Includes(resource) {
+			return false
+		}
+	}
+	return true
+}
+
+// Release returns weight slots and resources. Acquire must have been called with
+// the same arguments as a pre-condition.
+func (s *WeightedSemaphore) Release(weight int, resources []string) {
+	weight = s.clamp(weight)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used < weight {
+		panic("release without an acquire")
+	}
+	s.used -= weight
+	for _, resource := range resources {
+		s.held.Delete(resource)
+	}
+	// Waiters may need different slots and resources, so they all check again
+	s.cond.Broadcast()
+}
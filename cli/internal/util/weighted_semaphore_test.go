@@ -0,0 +1,106 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// acquireAsync acquires s in a goroutine, and returns a channel that's closed once it has
+func acquireAsync(s *WeightedSemaphore, weight int, resources []string) <-chan struct{} {
+	acquired := make(chan struct{})
+	go func() {
+		s.Acquire(weight, resources)
+		close(acquired)
+	}()
+	return acquired
+}
+
+func assertBlocked(t *testing.T, acquired <-chan struct{}, msg string) {
+	t.Helper()
+	select {
+	case <-acquired:
+		t.Errorf("expected to block: %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func assertAcquired(t *testing.T, acquired <-chan struct{}, msg string) {
+	t.Helper()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("expected to acquire: %v", msg)
+	}
+}
+
+func TestWeightedSemaphore_Weight(t *testing.T) {
+	s := NewWeightedSemaphore(3)
+	s.Acquire(2, nil)
+
+	heavy := acquireAsync(s, 2, nil)
+	assertBlocked(t, heavy, "only 1 slot is free")
+	light := acquireAsync(s, 1, nil)
+	assertBlocked(t, light, "the heavy acquisition is waiting first")
+
+	s.Release(2, nil)
+	assertAcquired(t, heavy, "2 slots are free")
+	assertAcquired(t, light, "1 slot is still free")
+	s.Release(2, nil)
+	s.Release(1, nil)
+
+	// Weights over the limit take the whole limit
+	s.Acquire(10, nil)
+	assertBlocked(t, acquireAsync(s, 1, nil), "the whole limit is taken")
+}
+
+func TestWeightedSemaphore_Resources(t *testing.T) {
+	s := NewWeightedSemaphore(10)
+	s.Acquire(1, []string{"port-3000", "db"})
+
+	blocked := acquireAsync(s, 1, []string{"port-3000"})
+	assertBlocked(t, blocked, "port-3000 is held")
+	assertAcquired(t, acquireAsync(s, 1, []string{"port-4000"}), "port-4000 is free")
+
+	// Weight 0 still holds resources
+	zeroWeight := acquireAsync(s, 0, []string{"db"})
+	assertBlocked(t, zeroWeight, "db is held")
+
+	s.Release(1, []string{"port-3000", "db"})
+	assertAcquired(t, blocked, "port-3000 was released")
+	assertAcquired(t, zeroWeight, "db was released")
+}
+
+func TestWeightedSemaphore_FIFO(t *testing.T) {
+	s := NewWeightedSemaphore(4)
+	s.Acquire(1, nil)
+
+	heavy := acquireAsync(s, 4, nil)
+	assertBlocked(t, heavy, "only 3 slots are free")
+
+	// Lighter acquisitions that arrive later don't take the slots ahead of it
+	lights := []<-chan struct{}{}
+	for i := 0; i < 3; i++ {
+		light := acquireAsync(s, 1, nil)
+		assertBlocked(t, light, "the heavy acquisition is waiting first")
+		lights = append(lights, light)
+	}
+
+	s.Release(1, nil)
+	assertAcquired(t, heavy, "all slots are free")
+	s.Release(4, nil)
+	for _, light := range lights {
+		assertAcquired(t, light, "the heavy acquisition was released")
+	}
+}
+
+func TestWeightedSemaphore_FIFOSkipsResourceWaiters(t *testing.T) {
+	s := NewWeightedSemaphore(4)
+	s.Acquire(1, []string{"db"})
+
+	blocked := acquireAsync(s, 2, []string{"db"})
+	assertBlocked(t, blocked, "db is held")
+	assertAcquired(t, acquireAsync(s, 1, nil), "the earlier acquisition is waiting for a resource, not slots")
+
+	s.Release(1, []string{"db"})
+	assertAcquired(t, blocked, "db was released")
+}
@@ -0,0 +1,57 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vercel/turbo/cli/internal/cmdutil"
+	"github.com/vercel/turbo/cli/internal/context"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/turbostate"
+	"github.com/vercel/turbo/cli/internal/ui"
+)
+
+// ExecuteValidate executes the `validate` command, which reports the problems in the
+// monorepo's turbo.json files
+func ExecuteValidate(helper *cmdutil.Helper, args *turbostate.ParsedArgsFromRust) error {
+	base, err := helper.GetCmdBase(args)
+	if err != nil {
+		return err
+	}
+	rootPackageJSON, err := fs.ReadPackageJSON(base.RepoRoot.UntypedJoin("package.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read package.json: %w", err)
+	}
+	singlePackage := false
+	pkgDepGraph, err := context.BuildPackageGraph(base.RepoRoot, rootPackageJSON)
+	if err != nil {
+		var warnings *context.Warnings
+		if errors.As(err, &warnings) {
+			base.LogWarning("Issues occurred when constructing package graph. Some workspaces may not be validated", err)
+		} else {
+			// Without workspaces, this is a single-package repository
+			base.Logger.Debug("validating as a single package", "reason", err)
+			singlePackage = true
+			pkgDepGraph, err = context.SinglePackageGraph(base.RepoRoot, rootPackageJSON)
+			if err != nil {
+				return errors.Wrap(err, "could not construct graph")
+			}
+		}
+	}
+	problems, err := Validate(base.RepoRoot, pkgDepGraph.WorkspaceInfos, singlePackage)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		if problem.Severity == SeverityWarning {
+			base.UI.Warn(problem.String())
+		} else {
+			base.UI.Error(problem.String())
+		}
+	}
+	if errs := Errors(problems); len(errs) > 0 {
+		return fmt.Errorf("found %v in %s", pluralize(len(errs), "problem"), configFile)
+	}
+	base.UI.Output(ui.Dim(fmt.Sprintf("No problems found in %s", configFile)))
+	return nil
+}
@@ -0,0 +1,319 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// valueKind is the type of a JSON value
+type valueKind int
+
+const (
+	objectValue valueKind = iota
+	arrayValue
+	stringValue
+	numberValue
+	boolValue
+	nullValue
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case objectValue:
+		return "an object"
+	case arrayValue:
+		return "an array"
+	case stringValue:
+		return "a string"
+	case numberValue:
+		return "a number"
+	case boolValue:
+		return "a boolean"
+	}
+	return "null"
+}
+
+// value is a JSON value, along with the offset in the file where it starts, so that
+// problems with it can be reported at a line and column
+type value struct {
+	kind    valueKind
+	offset  int
+	str     string
+	boolean bool
+	// fields are an object's fields, in the order they appear in the file
+	fields []*field
+	// items are an array's items
+	items []*value
+}
+
+// field is a key of an object, and its value
+type field struct {
+	key       string
+	keyOffset int
+	value     *value
+}
+
+// get returns the value of key in an object, or nil
+func (v *value) get(key string) *value {
+	if v == nil || v.kind != objectValue {
+		return nil
+	}
+	for _, f := range v.fields {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return nil
+}
+
+// syntaxError is a JSON syntax error at an offset in a file
+type syntaxError struct {
+	offset int
+	msg    string
+}
+
+func (e *syntaxError) Error() string {
+	return e.msg
+}
+
+// parser is a JSON parser that understands the comments that turbo.json may contain:
+// // and # to the end of the line, and /* */. It keeps the offset of each value.
+type parser struct {
+	data   []byte
+	offset int
+}
+
+// parseJSONC parses a turbo.json
+func parseJSONC(data []byte) (*value, error) {
+	p := &parser{data: data}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.offset < len(p.data) {
+		return nil, p.errorf("unexpected %q after the end of the file's value", p.data[p.offset])
+	}
+	return v, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &syntaxError{offset: p.offset, msg: fmt.Sprintf(format, args...)}
+}
+
+// skipWhitespace skips whitespace and comments
+func (p *parser) skipWhitespace() error {
+	for p.offset < len(p.data) {
+		switch c := p.data[p.offset]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.offset++
+		case c == '#' || (c == '/' && p.peek(1) == '/'):
+			for p.offset < len(p.data) && p.data[p.offset] != '\n' {
+				p.offset++
+			}
+		case c == '/' && p.peek(1) == '*':
+			start := p.offset
+			p.offset += 2
+			for p.offset < len(p.data) && !(p.data[p.offset] == '*' && p.peek(1) == '/') {
+				p.offset++
+			}
+			if p.offset >= len(p.data) {
+				p.offset = start
+				return p.errorf("unterminated comment")
+			}
+			p.offset += 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// peek returns the byte n bytes ahead, or 0 at the end of the file
+func (p *parser) peek(n int) byte {
+	if p.offset+n < len(p.data) {
+		return p.data[p.offset+n]
+	}
+	return 0
+}
+
+func (p *parser) parseValue() (*value, error) {
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.offset >= len(p.data) {
+		return nil, p.errorf("unexpected end of file")
+	}
+	start := p.offset
+	switch c := p.data[p.offset]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		str, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &value{kind: stringValue, offset: start, str: str}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		for p.offset < len(p.data) && isNumberByte(p.data[p.offset]) {
+			p.offset++
+		}
+		if _, err := strconv.ParseFloat(string(p.data[start:p.offset]), 64); err != nil {
+			p.offset = start
+			return nil, p.errorf("invalid number")
+		}
+		return &value{kind: numberValue, offset: start, str: string(p.data[start:p.offset])}, nil
+	}
+	for _, literal := range []string{"true", "false", "null"} {
+		if p.offset+len(literal) <= len(p.data) && string(p.data[p.offset:p.offset+len(literal)]) == literal {
+			p.offset += len(literal)
+			if literal == "null" {
+				return &value{kind: nullValue, offset: start}, nil
+			}
+			return &value{kind: boolValue, offset: start, boolean: literal == "true"}, nil
+		}
+	}
+	return nil, p.errorf("unexpected %q, expected a value", p.data[p.offset])
+}
+
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func (p *parser) parseObject() (*value, error) {
+	object := &value{kind: objectValue, offset: p.offset}
+	p.offset++
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.peek(0) == '}' {
+		p.offset++
+		return object, nil
+	}
+	for {
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.peek(0) == '}' && len(object.fields) > 0 {
+			return nil, p.errorf("unexpected '}' after a trailing comma")
+		}
+		if p.peek(0) != '"' {
+			return nil, p.errorf("expected a key in double quotes")
+		}
+		keyOffset := p.offset
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.peek(0) != ':' {
+			return nil, p.errorf("expected ':' after key %q", key)
+		}
+		p.offset++
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		object.fields = append(object.fields, &field{key: key, keyOffset: keyOffset, value: v})
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		switch p.peek(0) {
+		case ',':
+			p.offset++
+		case '}':
+			p.offset++
+			return object, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' after the value of %q", key)
+		}
+	}
+}
+
+func (p *parser) parseArray() (*value, error) {
+	array := &value{kind: arrayValue, offset: p.offset}
+	p.offset++
+	if err := p.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	if p.peek(0) == ']' {
+		p.offset++
+		return array, nil
+	}
+	for {
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		if p.peek(0) == ']' {
+			return nil, p.errorf("unexpected ']' after a trailing comma")
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array.items = append(array.items, v)
+		if err := p.skipWhitespace(); err != nil {
+			return nil, err
+		}
+		switch p.peek(0) {
+		case ',':
+			p.offset++
+		case ']':
+			p.offset++
+			return array, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' after an item of the array")
+		}
+	}
+}
+
+// parseString parses the string starting at the current offset, which is a double quote
+func (p *parser) parseString() (string, error) {
+	start := p.offset
+	p.offset++
+	for p.offset < len(p.data) {
+		switch p.data[p.offset] {
+		case '\\':
+			p.offset += 2
+		case '\n':
+			return "", p.errorf("unexpected newline in string")
+		case '"':
+			p.offset++
+			var str string
+			if err := json.Unmarshal(p.data[start:p.offset], &str); err != nil {
+				p.offset = start
+				return "", p.errorf("invalid string")
+			}
+			return str, nil
+		default:
+			p.offset++
+		}
+	}
+	p.offset = start
+	return "", p.errorf("unterminated string")
+}
+
+// position returns the 1-based line and column of offset in data. Columns count characters,
+// not bytes.
+func position(data []byte, offset int) (int, int) {
+	line := 1
+	lineStart := 0
+	for i := 0; i < offset && i < len(data); i++ {
+		if data[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return line, utf8.RuneCount(data[lineStart:offset]) + 1
+}
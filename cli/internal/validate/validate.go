@@ -0,0 +1,557 @@
+// Package validate checks turbo.json files, reporting each problem at the line and
+// column where it occurs
+package validate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vercel/turbo/cli/internal/env"
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/graph"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+)
+
+const configFile = "turbo.json"
+
+// Severity is how serious a problem is
+type Severity int
+
+const (
+	// SeverityError is a problem that stops turbo from running tasks
+	SeverityError Severity = iota
+	// SeverityWarning is a deprecated configuration, which still works
+	SeverityWarning
+)
+
+// Problem is something wrong with a turbo.json
+type Problem struct {
+	// File is the path of the turbo.json, relative to the repository root
+	File     string
+	Line     int
+	Column   int
+	Severity Severity
+	Message  string
+}
+
+// String formats the problem as file:line:column: message
+func (p Problem) String() string {
+	if p.Severity == SeverityWarning {
+		return fmt.Sprintf("%s:%d:%d: warning: %s", p.File, p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// Errors returns the problems that are errors, rather than warnings
+func Errors(problems []Problem) []Problem {
+	errs := []Problem{}
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			errs = append(errs, problem)
+		}
+	}
+	return errs
+}
+
+// Error returns an error listing the errors in problems, or nil if there aren't any
+func Error(problems []Problem) error {
+	errs := Errors(problems)
+	if len(errs) == 0 {
+		return nil
+	}
+	lines := make([]string, len(errs))
+	for i, problem := range errs {
+		lines[i] = problem.String()
+	}
+	return fmt.Errorf("found %v in %s:\n%s", pluralize(len(errs), "problem"), configFile, strings.Join(lines, "\n"))
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%v %ss", count, noun)
+}
+
+// config is a parsed turbo.json
+type config struct {
+	// file is the path of the turbo.json, relative to the repository root
+	file string
+	data []byte
+	// workspace is the package whose turbo.json this is, or util.RootPkgName for the
+	// root turbo.json
+	workspace string
+	root      *value
+}
+
+func (c *config) isRoot() bool {
+	return c.workspace == util.RootPkgName
+}
+
+// tasks returns the fields of the config's pipeline
+func (c *config) tasks() []*field {
+	if c == nil {
+		return nil
+	}
+	if pipeline := c.root.get("pipeline"); pipeline != nil && pipeline.kind == objectValue {
+		return pipeline.fields
+	}
+	return nil
+}
+
+// task returns the definition of a task in the config's pipeline, or nil
+func (c *config) task(key string) *value {
+	for _, task := range c.tasks() {
+		if task.key == key {
+			return task.value
+		}
+	}
+	return nil
+}
+
+type validator struct {
+	workspaceInfos   graph.WorkspaceInfos
+	singlePackage    bool
+	rootConfig       *config
+	workspaceConfigs map[string]*config
+	problems         []Problem
+}
+
+// Validate checks the root turbo.json, and in a monorepo, the turbo.json files in its
+// workspaces. It returns the problems it finds, in order of file and position. A missing
+// root turbo.json isn't a problem, since it may be synthesized from package.json.
+func Validate(repoRoot turbopath.AbsoluteSystemPath, workspaceInfos graph.WorkspaceInfos, singlePackage bool) ([]Problem, error) {
+	v := &validator{
+		workspaceInfos:   workspaceInfos,
+		singlePackage:    singlePackage,
+		workspaceConfigs: make(map[string]*config),
+	}
+	rootConfig, err := v.read(repoRoot, util.RootPkgName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	v.rootConfig = rootConfig
+	if !singlePackage {
+		for pkgName, pkg := range workspaceInfos {
+			if pkgName == util.RootPkgName {
+				continue
+			}
+			workspaceConfig, err := v.read(repoRoot, pkgName, path.Join(pkg.Dir.ToUnixPath().ToString(), configFile))
+			if err != nil {
+				return nil, err
+			}
+			if workspaceConfig != nil {
+				v.workspaceConfigs[pkgName] = workspaceConfig
+			}
+		}
+	}
+
+	if v.rootConfig != nil {
+		v.checkConfig(v.rootConfig)
+	}
+	for _, workspaceConfig := range v.workspaceConfigs {
+		v.checkConfig(workspaceConfig)
+	}
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.problems, nil
+}
+
+// read parses the turbo.json at file, relative to repoRoot. It returns nil if the file
+// doesn't exist, or has a syntax error, which is reported.
+func (v *validator) read(repoRoot turbopath.AbsoluteSystemPath, workspace string, file string) (*config, error) {
+	data, err := repoRoot.UntypedJoin(filepath.FromSlash(file)).ReadFile()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	c := &config{file: file, data: data, workspace: workspace}
+	root, err := parseJSONC(data)
+	if err != nil {
+		offset := len(data)
+		if syntaxErr, ok := err.(*syntaxError); ok {
+			offset = syntaxErr.offset
+		}
+		v.report(c, offset, SeverityError, "%v", err)
+		return nil, nil
+	}
+	c.root = root
+	return c, nil
+}
+
+func (v *validator) report(c *config, offset int, severity Severity, format string, args ...interface{}) {
+	line, column := position(c.data, offset)
+	v.problems = append(v.problems, Problem{
+		File:     c.file,
+		Line:     line,
+		Column:   column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) checkConfig(c *config) {
+	if c.root.kind != objectValue {
+		v.report(c, c.root.offset, SeverityError, "expected an object, got %v", c.root.kind)
+		return
+	}
+	allowedKeys := fs.TurboJSONKeys()
+	if !c.isRoot() {
+		allowedKeys = fs.WorkspaceTurboJSONKeys()
+		if c.root.get("extends") == nil {
+			v.report(c, c.root.offset, SeverityError, "\"extends\" must be [\"%s\"], to extend the root %s", fs.RootWorkspaceReference, configFile)
+		}
+	}
+	for _, f := range c.root.fields {
+		if !util.SetFromStrings(allowedKeys).Includes(f.key) {
+			if c.isRoot() && f.key == "extends" {
+				v.report(c, f.keyOffset, SeverityError, "\"extends\" can only be set in a workspace's %s", configFile)
+			} else if !c.isRoot() && util.SetFromStrings(fs.TurboJSONKeys()).Includes(f.key) {
+				v.report(c, f.keyOffset, SeverityError, "\"%s\" can only be set in the root %s", f.key, configFile)
+			} else {
+				v.reportUnknownKey(c, f, allowedKeys)
+			}
+			continue
+		}
+		switch f.key {
+		case "globalDependencies":
+			for _, item := range v.strings(c, f) {
+				if strings.HasPrefix(item.str, "$") {
+					v.report(c, item.offset, SeverityWarning, "declaring an environment variable in \"globalDependencies\" is deprecated, found %s. Use \"globalEnv\" instead", item.str)
+				}
+			}
+		case "globalEnv", "globalPassThroughEnv":
+			v.checkEnvPatterns(c, f)
+		case "globalDotEnv":
+			v.strings(c, f)
+		case "envMode":
+			if v.kind(c, f, stringValue) {
+				if _, err := env.ParseMode(f.value.str); err != nil {
+					v.report(c, f.value.offset, SeverityError, "%v", err)
+				}
+			}
+		case "cachePolicy":
+			v.kind(c, f, stringValue)
+		case "remoteCache":
+			if v.kind(c, f, objectValue) {
+				for _, option := range f.value.fields {
+					if !util.SetFromStrings(fs.RemoteCacheKeys()).Includes(option.key) {
+						v.reportUnknownKey(c, option, fs.RemoteCacheKeys())
+					}
+				}
+			}
+		case "extends":
+			items := v.strings(c, f)
+			if len(items) != 1 || items[0].str != fs.RootWorkspaceReference {
+				v.report(c, f.value.offset, SeverityError, "\"extends\" must be [\"%s\"], to extend the root %s", fs.RootWorkspaceReference, configFile)
+			}
+		case "pipeline":
+			if v.kind(c, f, objectValue) {
+				for _, task := range f.value.fields {
+					v.checkTask(c, task)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) checkTask(c *config, task *field) {
+	if util.IsPackageTask(task.key) {
+		pkg, _ := util.GetPackageTaskFromId(task.key)
+		if !c.isRoot() {
+			v.report(c, task.keyOffset, SeverityError, "tasks in a workspace's %s apply to that workspace, so they can't be package tasks (<package>#<task>)", configFile)
+		} else if v.singlePackage {
+			v.report(c, task.keyOffset, SeverityError, "package tasks (<package>#<task>) are not allowed in single-package repositories")
+		} else if _, ok := v.workspaceInfos[pkg]; !ok {
+			v.report(c, task.keyOffset, SeverityError, "unknown workspace %q in task %q", pkg, task.key)
+		}
+	}
+	if !v.kind(c, task, objectValue) {
+		return
+	}
+	for _, f := range task.value.fields {
+		if !util.SetFromStrings(fs.TaskKeys()).Includes(f.key) {
+			v.reportUnknownKey(c, f, fs.TaskKeys())
+			continue
+		}
+		switch f.key {
+		case "outputs":
+			for _, item := range v.strings(c, f) {
+				output := path.Clean(strings.TrimPrefix(item.str, "!"))
+				if path.IsAbs(output) || output == ".." || strings.HasPrefix(output, "../") {
+					v.report(c, item.offset, SeverityError, "output %q is outside the workspace, so it can't be cached", item.str)
+				}
+			}
+		case "dependsOn":
+			for _, item := range v.strings(c, f) {
+				v.checkDependency(c, task.key, item)
+			}
+		case "env", "passThroughEnv":
+			v.checkEnvPatterns(c, f)
+		case "inputs", "dotEnv":
+			v.strings(c, f)
+		case "resources":
+			for _, item := range v.strings(c, f) {
+				if item.str == "" {
+					v.report(c, item.offset, SeverityError, "\"resources\" must not contain an empty name")
+				}
+			}
+		case "outputMode":
+			if v.kind(c, f, stringValue) {
+				if _, err := util.FromTaskOutputModeString(f.value.str); err != nil {
+					v.report(c, f.value.offset, SeverityError, "invalid outputMode %q, expected one of %s", f.value.str, strings.Join(util.TaskOutputModeStrings, ", "))
+				}
+			}
+		case "cache", "persistent", "frameworkInference":
+			v.kind(c, f, boolValue)
+		case "timeout", "retryBackoff":
+			if v.kind(c, f, stringValue) {
+				if _, err := fs.ParseDuration(f.key, f.value.str); err != nil {
+					v.report(c, f.value.offset, SeverityError, "%v", err)
+				}
+			}
+		case "weight":
+			if v.kind(c, f, numberValue) {
+				if weight, err := strconv.Atoi(f.value.str); err != nil || weight < 1 {
+					v.report(c, f.value.offset, SeverityError, "invalid weight %s, expected 1 or more", f.value.str)
+				}
+			}
+		case "retries":
+			if v.kind(c, f, numberValue) {
+				if retries, err := strconv.Atoi(f.value.str); err != nil || retries < 0 {
+					v.report(c, f.value.offset, SeverityError, "invalid retries %s, expected 0 or more", f.value.str)
+				}
+			}
+		}
+	}
+}
+
+// checkDependency checks an entry in the dependsOn of taskKey
+func (v *validator) checkDependency(c *config, taskKey string, dependency *value) {
+	// the package whose tasks the dependency refers to, or "" for any package
+	pkg := ""
+	if !c.isRoot() {
+		pkg = c.workspace
+	} else if util.IsPackageTask(taskKey) {
+		pkg, _ = util.GetPackageTaskFromId(taskKey)
+	}
+
+	name := dependency.str
+	switch {
+	case strings.HasPrefix(name, "$"):
+		if c.isRoot() {
+			v.report(c, dependency.offset, SeverityWarning, "declaring an environment variable in \"dependsOn\" is deprecated, found %s. Use \"env\" instead", name)
+		} else {
+			v.report(c, dependency.offset, SeverityError, "found %s in \"dependsOn\". Declare environment variables with the \"env\" key", name)
+		}
+		return
+	case strings.HasPrefix(name, "^"):
+		name = strings.TrimPrefix(name, "^")
+		// topological dependencies run in the package's dependencies
+		pkg = ""
+	case util.IsPackageTask(name):
+		if !c.isRoot() {
+			v.report(c, dependency.offset, SeverityError, "found %s in \"dependsOn\". Tasks in other workspaces can only be depended on from the root %s", name, configFile)
+			return
+		}
+		pkg, name = util.GetPackageTaskFromId(name)
+		if _, ok := v.workspaceInfos[pkg]; !ok {
+			v.report(c, dependency.offset, SeverityError, "unknown workspace %q in \"dependsOn\" of %q", pkg, taskKey)
+			return
+		}
+	}
+
+	if !v.isTaskDefined(pkg, name) {
+		if suggestion := closest(name, v.taskNames()); suggestion != "" {
+			v.report(c, dependency.offset, SeverityError, "unknown task %q in \"dependsOn\" of %q, did you mean %q?", name, taskKey, suggestion)
+		} else {
+			v.report(c, dependency.offset, SeverityError, "unknown task %q in \"dependsOn\" of %q", name, taskKey)
+		}
+		return
+	}
+	if v.isPersistent(pkg, name) {
+		v.report(c, dependency.offset, SeverityError, "%q is a persistent task, %q cannot depend on it", name, taskKey)
+	}
+}
+
+// isTaskDefined returns true if task is defined for pkg, or for any package if pkg is ""
+func (v *validator) isTaskDefined(pkg string, task string) bool {
+	if v.singlePackage {
+		if rootPackageJSON, ok := v.workspaceInfos[util.RootPkgName]; ok {
+			if _, ok := rootPackageJSON.Scripts[task]; ok {
+				return true
+			}
+		}
+		return v.rootConfig.task(task) != nil
+	}
+	if pkg != "" {
+		return v.rootConfig.task(task) != nil || v.rootConfig.task(util.GetTaskId(pkg, task)) != nil || v.workspaceConfigs[pkg].task(task) != nil
+	}
+	for _, rootTask := range v.rootConfig.tasks() {
+		if rootTask.key == task || (util.IsPackageTask(rootTask.key) && strings.HasSuffix(rootTask.key, util.TaskDelimiter+task)) {
+			return true
+		}
+	}
+	for _, workspaceConfig := range v.workspaceConfigs {
+		if workspaceConfig.task(task) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isPersistent returns true if task is persistent in pkg, or in any package if pkg is "",
+// in a package that has a script for it
+func (v *validator) isPersistent(pkg string, task string) bool {
+	pkgs := []string{pkg}
+	if pkg == "" {
+		pkgs = nil
+		for pkgName := range v.workspaceInfos {
+			pkgs = append(pkgs, pkgName)
+		}
+	}
+	for _, pkgName := range pkgs {
+		pkgJSON, ok := v.workspaceInfos[pkgName]
+		if !ok {
+			continue
+		}
+		if _, hasScript := pkgJSON.Scripts[task]; !hasScript {
+			continue
+		}
+		// the workspace's turbo.json overrides a package task in the root pipeline, which
+		// overrides the task
+		for _, definition := range []*value{v.workspaceConfigs[pkgName].task(task), v.rootConfig.task(util.GetTaskId(pkgName, task)), v.rootConfig.task(task)} {
+			if persistent := definition.get("persistent"); persistent != nil {
+				if persistent.kind == boolValue && persistent.boolean {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// taskNames returns the names of the tasks defined anywhere, to suggest in place of
+// unknown ones
+func (v *validator) taskNames() []string {
+	names := make(util.Set)
+	configs := []*config{v.rootConfig}
+	for _, workspaceConfig := range v.workspaceConfigs {
+		configs = append(configs, workspaceConfig)
+	}
+	for _, c := range configs {
+		for _, task := range c.tasks() {
+			name := task.key
+			if util.IsPackageTask(name) {
+				_, name = util.GetPackageTaskFromId(name)
+			}
+			names.Add(name)
+		}
+	}
+	return names.UnsafeListOfStrings()
+}
+
+func (v *validator) checkEnvPatterns(c *config, f *field) {
+	for _, item := range v.strings(c, f) {
+		if err := fs.ValidateEnvPattern(f.key, item.str); err != nil {
+			v.report(c, item.offset, SeverityError, "%v", err)
+		}
+	}
+}
+
+// kind reports a problem unless f's value is of the given kind
+func (v *validator) kind(c *config, f *field, kind valueKind) bool {
+	if f.value.kind != kind {
+		v.report(c, f.value.offset, SeverityError, "%q must be %v, got %v", f.key, kind, f.value.kind)
+		return false
+	}
+	return true
+}
+
+// strings returns the items of f's value, which should be an array of strings, reporting
+// any that aren't strings
+func (v *validator) strings(c *config, f *field) []*value {
+	if !v.kind(c, f, arrayValue) {
+		return nil
+	}
+	items := make([]*value, 0, len(f.value.items))
+	for _, item := range f.value.items {
+		if item.kind != stringValue {
+			v.report(c, item.offset, SeverityError, "%q must be an array of strings, got %v", f.key, item.kind)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (v *validator) reportUnknownKey(c *config, f *field, allowedKeys []string) {
+	if suggestion := closest(f.key, allowedKeys); suggestion != "" {
+		v.report(c, f.keyOffset, SeverityError, "unknown key %q, did you mean %q?", f.key, suggestion)
+	} else {
+		v.report(c, f.keyOffset, SeverityError, "unknown key %q", f.key)
+	}
+}
+
+// closest returns the candidate that is within two edits of s, or "" if there isn't one
+func closest(s string, candidates []string) string {
+	sort.Strings(candidates)
+	best := ""
+	bestDistance := 3
+	for _, candidate := range candidates {
+		if distance := editDistance(s, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// minInt returns the smallest of values
+func minInt(values ...int) int {
+	m := values[0]
+	for _, value := range values[1:] {
+		if value < m {
+			m = value
+		}
+	}
+	return m
+}
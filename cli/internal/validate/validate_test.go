@@ -0,0 +1,199 @@
+package validate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vercel/turbo/cli/internal/fs"
+	"github.com/vercel/turbo/cli/internal/graph"
+	"github.com/vercel/turbo/cli/internal/turbopath"
+	"github.com/vercel/turbo/cli/internal/util"
+	"gotest.tools/v3/assert"
+)
+
+func Test_parseJSONC(t *testing.T) {
+	data := []byte(`{
+  // a comment
+  "pipeline": { /* another */
+    "build": ["a", "b\/c"] # and another
+  }
+}`)
+	root, err := parseJSONC(data)
+	assert.NilError(t, err)
+	pipeline := root.get("pipeline")
+	assert.Equal(t, pipeline.kind, objectValue)
+	build := pipeline.fields[0]
+	assert.Equal(t, build.key, "build")
+	line, column := position(data, build.keyOffset)
+	assert.Equal(t, line, 4)
+	assert.Equal(t, column, 5)
+	assert.Equal(t, build.value.items[1].str, "b/c")
+
+	testCases := []struct {
+		data   string
+		line   int
+		column int
+		msg    string
+	}{
+		{`{"a": 1,}`, 1, 9, "unexpected '}' after a trailing comma"},
+		{"{\n  \"a\": [1, 2,]\n}", 2, 14, "unexpected ']' after a trailing comma"},
+		{`{"a" 1}`, 1, 6, `expected ':' after key "a"`},
+		{`{"a": tru}`, 1, 7, `unexpected 't', expected a value`},
+		{`{"a": "b}`, 1, 7, "unterminated string"},
+		{`{} {}`, 1, 4, `unexpected '{' after the end of the file's value`},
+	}
+	for _, tc := range testCases {
+		_, err := parseJSONC([]byte(tc.data))
+		syntaxErr, ok := err.(*syntaxError)
+		assert.Assert(t, ok, "expected a syntax error for %v, got %v", tc.data, err)
+		assert.Equal(t, syntaxErr.msg, tc.msg)
+		line, column := position([]byte(tc.data), syntaxErr.offset)
+		assert.Equal(t, line, tc.line, tc.data)
+		assert.Equal(t, column, tc.column, tc.data)
+	}
+}
+
+// writeRepo writes files, by path relative to the repository root, and returns the root
+func writeRepo(t *testing.T, files map[string]string) turbopath.AbsoluteSystemPath {
+	repoRoot := fs.AbsoluteSystemPathFromUpstream(t.TempDir())
+	for name, contents := range files {
+		file := repoRoot.UntypedJoin(filepath.FromSlash(name))
+		assert.NilError(t, file.EnsureDir())
+		assert.NilError(t, file.WriteFile([]byte(contents), 0644))
+	}
+	return repoRoot
+}
+
+func testWorkspaceInfos() graph.WorkspaceInfos {
+	return graph.WorkspaceInfos{
+		util.RootPkgName: {Name: "root", Scripts: map[string]string{}},
+		"web": {
+			Name:    "web",
+			Dir:     turbopath.AnchoredSystemPath(filepath.Join("apps", "web")),
+			Scripts: map[string]string{"build": "next build", "dev": "next dev"},
+		},
+		"docs": {
+			Name:    "docs",
+			Dir:     turbopath.AnchoredSystemPath(filepath.Join("apps", "docs")),
+			Scripts: map[string]string{"build": "next build", "lint": "eslint ."},
+		},
+	}
+}
+
+func problemStrings(problems []Problem) string {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestValidate(t *testing.T) {
+	repoRoot := writeRepo(t, map[string]string{
+		"turbo.json": `{
+  "$schema": "https://turbo.build/schema.json",
+  "globalDependencies": ["$CI", ".env"],
+  "envMode": "strict",
+  "pipeline": {
+    "build": {
+      "dependsOn": ["^biuld", "$NODE_ENV"],
+      "ouputs": ["dist/**"],
+      "outputs": ["../dist/**", "!/tmp/**", "dist/**"],
+      "outputMode": "quiet"
+    },
+    "dev": {
+      "persistent": true, "env": ["$API_URL"],
+      "cache": "no"
+    },
+    "test": {
+      "dependsOn": ["dev", "admin#build", "docs#build"]
+    },
+    "admin#lint": {"timeout": "5", "retries": -1, "weight": 0}
+  }
+}
+`,
+		"apps/web/turbo.json": `{
+  "extends": ["//"],
+  "globalEnv": ["CI"],
+  "pipeline": {
+    "build": {
+      "dependsOn": ["docs#build", "prebuild"],
+      "outputs": [".next/**"]
+    },
+    "prebuild": {}
+  }
+}
+`,
+		"apps/docs/turbo.json": `{
+  "pipeline": {
+    "build": {"outputs": ["dist/**"],}
+  }
+}
+`,
+	})
+	problems, err := Validate(repoRoot, testWorkspaceInfos(), false)
+	assert.NilError(t, err)
+	expected := []string{
+		`apps/docs/turbo.json:3:38: unexpected '}' after a trailing comma`,
+		`apps/web/turbo.json:3:3: "globalEnv" can only be set in the root turbo.json`,
+		`apps/web/turbo.json:6:21: found docs#build in "dependsOn". Tasks in other workspaces can only be depended on from the root turbo.json`,
+		`turbo.json:3:26: warning: declaring an environment variable in "globalDependencies" is deprecated, found $CI. Use "globalEnv" instead`,
+		`turbo.json:7:21: unknown task "biuld" in "dependsOn" of "build", did you mean "build"?`,
+		`turbo.json:7:31: warning: declaring an environment variable in "dependsOn" is deprecated, found $NODE_ENV. Use "env" instead`,
+		`turbo.json:8:7: unknown key "ouputs", did you mean "outputs"?`,
+		`turbo.json:9:19: output "../dist/**" is outside the workspace, so it can't be cached`,
+		`turbo.json:9:33: output "!/tmp/**" is outside the workspace, so it can't be cached`,
+		`turbo.json:10:21: invalid outputMode "quiet", expected one of full, none, hash-only, new-only, errors-only`,
+		`turbo.json:13:35: You specified "$API_URL" in the "env" key. You should not prefix your environment variables with "$"`,
+		`turbo.json:14:16: "cache" must be a boolean, got a string`,
+		`turbo.json:17:21: "dev" is a persistent task, "test" cannot depend on it`,
+		`turbo.json:17:28: unknown workspace "admin" in "dependsOn" of "test"`,
+		`turbo.json:19:5: unknown workspace "admin" in task "admin#lint"`,
+		`turbo.json:19:31: invalid timeout "5", expected a positive duration such as "90s" or "10m"`,
+		`turbo.json:19:47: invalid retries -1, expected 0 or more`,
+		`turbo.json:19:61: invalid weight 0, expected 1 or more`,
+	}
+	assert.Equal(t, problemStrings(problems), strings.Join(expected, "\n"))
+	assert.Equal(t, len(Errors(problems)), len(expected)-2)
+	assert.ErrorContains(t, Error(problems), "found 16 problems in turbo.json:\napps/docs/turbo.json:3:38:")
+}
+
+func TestValidate_Valid(t *testing.T) {
+	repoRoot := writeRepo(t, map[string]string{
+		"turbo.json": `{
+  "pipeline": {
+    "build": {"dependsOn": ["^build"], "outputs": ["dist/**", "!dist/cache/**"]},
+    "dev": {"persistent": true, "cache": false},
+    "test": {"timeout": "10m", "retries": 2, "retryBackoff": "1s", "weight": 2, "resources": ["port-3000"]},
+    "lint": {"dependsOn": ["web#build"]},
+    "web#build": {"outputMode": "new-only"}
+  }
+}
+`,
+		"apps/web/turbo.json": `{
+  "extends": ["//"],
+  "pipeline": {
+    "build": {"dependsOn": ["^build", "codegen"]},
+    "codegen": {}
+  }
+}
+`,
+	})
+	problems, err := Validate(repoRoot, testWorkspaceInfos(), false)
+	assert.NilError(t, err)
+	assert.Equal(t, problemStrings(problems), "")
+	assert.NilError(t, Error(problems))
+
+	// A missing turbo.json isn't a problem, since it may be synthesized
+	problems, err = Validate(writeRepo(t, map[string]string{}), testWorkspaceInfos(), true)
+	assert.NilError(t, err)
+	assert.Equal(t, len(problems), 0)
+}
+
+func Test_closest(t *testing.T) {
+	candidates := []string{"outputs", "inputs", "outputMode", "dependsOn"}
+	assert.Equal(t, closest("ouputs", candidates), "outputs")
+	assert.Equal(t, closest("dependson", candidates), "dependsOn")
+	assert.Equal(t, closest("persistent", candidates), "")
+}
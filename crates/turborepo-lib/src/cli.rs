@@ -52,6 +52,15 @@ pub enum DryRunMode {
     Json,
 }
 
+// NOTE: These *must* be kept in sync with env.Mode in env/strict.go.
+#[derive(Copy, Clone, Debug, PartialEq, Serialize, ValueEnum)]
+pub enum EnvMode {
+    #[serde(rename = "loose")]
+    Loose,
+    #[serde(rename = "strict")]
+    Strict,
+}
+
 #[derive(Parser, Clone, Default, Debug, PartialEq, Serialize)]
 #[clap(author, about = "The build system that makes ship happen", long_about = None)]
 #[clap(disable_help_subcommand = true)]
@@ -158,6 +167,92 @@ pub enum DaemonCommand {
     Stop,
 }
 
+#[derive(Subcommand, Clone, Debug, Serialize, PartialEq)]
+#[serde(tag = "command")]
+pub enum CacheCommand {
+    /// Evict artifacts from the local filesystem cache
+    Clean {
+        /// Remove every artifact, rather than only those over the size or
+        /// age limits
+        #[clap(long)]
+        all: bool,
+        /// Evict least recently used artifacts until the cache is under this
+        /// size, e.g. 10GB. Defaults to TURBO_CACHE_MAX_SIZE
+        #[clap(long)]
+        max_size: Option<String>,
+        /// Evict artifacts that have not been used within this duration, e.g.
+        /// 7d or 72h. Defaults to TURBO_CACHE_MAX_AGE
+        #[clap(long)]
+        max_age: Option<String>,
+    },
+    /// Export an artifact to a file
+    Export {
+        /// The hash of the artifact
+        hash: String,
+        /// The file to write the artifact to. Defaults to <hash>.tar.zst
+        #[clap(short, long)]
+        output: Option<String>,
+        /// Export from the remote cache rather than the local filesystem cache
+        #[clap(long)]
+        remote: bool,
+    },
+    /// Import an artifact from a file written by `turbo cache export`
+    Import {
+        /// The artifact file to import
+        file: String,
+        /// The hash to store the artifact under. Defaults to the file name
+        /// without its .tar.zst extension
+        #[clap(long)]
+        hash: Option<String>,
+        /// Upload to the remote cache rather than the local filesystem cache
+        #[clap(long)]
+        remote: bool,
+    },
+    /// Show the files, metadata and logs of an artifact
+    Inspect {
+        /// The hash of the artifact
+        hash: String,
+        /// Inspect the artifact in the remote cache rather than the local
+        /// filesystem cache
+        #[clap(long)]
+        remote: bool,
+    },
+    /// List the artifacts in the local filesystem cache
+    Ls {
+        /// Only report on these hashes
+        hashes: Vec<String>,
+        /// Also check whether each artifact is in the remote cache
+        #[clap(long)]
+        remote: bool,
+    },
+    /// Remove artifacts from the local filesystem cache
+    Rm {
+        /// The hashes of the artifacts to remove
+        #[clap(required = true)]
+        hashes: Vec<String>,
+    },
+    /// Serve the local filesystem cache over the Remote Caching API
+    Serve {
+        /// The address to listen on. Use 0.0.0.0 to accept connections from
+        /// other machines
+        #[clap(long, default_value = "127.0.0.1")]
+        host: String,
+        /// The port to listen on
+        #[clap(long, default_value_t = 3000)]
+        port: u16,
+        /// Reject uploaded artifacts larger than this size, e.g. 500MB.
+        /// Defaults to 1GB
+        #[clap(long)]
+        max_upload_size: Option<String>,
+    },
+    /// Show the remote cache uploads that are waiting to be sent, or have failed
+    Status {
+        /// Retry the uploads that have failed
+        #[clap(long)]
+        retry: bool,
+    },
+}
+
 impl Args {
     pub fn new() -> Result<Self> {
         let mut clap_args = match Args::try_parse() {
@@ -213,6 +308,18 @@ pub enum Command {
     // them as `{ "Bin": {} }` instead of as `"Bin"`.
     /// Get the path to the Turbo binary
     Bin {},
+    /// Manage the local and remote caches
+    Cache {
+        /// Override the filesystem cache directory.
+        #[clap(long, global = true)]
+        cache_dir: Option<String>,
+        /// Output machine-readable JSON
+        #[clap(long, global = true)]
+        json: bool,
+        #[clap(subcommand)]
+        #[serde(flatten)]
+        command: CacheCommand,
+    },
     /// Generate the autocompletion script for the specified shell
     #[serde(skip)]
     Completion { shell: Shell },
@@ -262,10 +369,27 @@ pub enum Command {
     /// Unlink the current directory from your Vercel organization and disable
     /// Remote Caching
     Unlink {},
+    /// Check turbo.json files for problems, reporting the file, line and
+    /// column of each
+    Validate {},
+    /// Explain why a task misses the cache, by comparing its inputs with those
+    /// of its last cached run
+    WhyMiss {
+        /// The task to explain, as <package>#<task>
+        task: String,
+        /// Override the filesystem cache directory.
+        #[clap(long)]
+        cache_dir: Option<String>,
+    },
 }
 
 #[derive(Parser, Clone, Debug, Default, Serialize, PartialEq)]
 pub struct RunArgs {
+    /// Restrict reading from and writing to each cache, e.g.
+    /// local:rw,remote:r. Overrides TURBO_CACHE and cachePolicy in
+    /// turbo.json
+    #[clap(long)]
+    pub cache: Option<String>,
     /// Override the filesystem cache directory.
     #[clap(long)]
     pub cache_dir: Option<String>,
@@ -282,6 +406,14 @@ pub struct RunArgs {
     pub continue_execution: bool,
     #[clap(alias = "dry", long = "dry-run", num_args = 0..=1, default_missing_value = "text")]
     pub dry_run: Option<DryRunMode>,
+    /// When a task misses the cache, show what changed since its last
+    /// cached run
+    #[clap(long)]
+    pub explain: bool,
+    /// Use strict to only pass tasks the environment variables they declare.
+    /// Overrides envMode in turbo.json
+    #[clap(long, value_enum)]
+    pub env_mode: Option<EnvMode>,
     /// Run turbo in single-package mode
     #[clap(long, global = true)]
     pub single_package: bool,
@@ -343,6 +475,10 @@ pub struct RunArgs {
     /// allow reading and caching artifacts using the remote cache.
     #[clap(long)]
     pub remote_only: bool,
+    /// Run each task that fails up to this many more times before reporting
+    /// the failure. Overrides retries in turbo.json
+    #[clap(long)]
+    pub retries: Option<u32>,
     /// Specify package(s) to act as entry points for task execution.
     /// Supports globs.
     #[clap(long)]
@@ -352,6 +488,10 @@ pub struct RunArgs {
     /// to identify which packages have changed.
     #[clap(long)]
     pub since: Option<String>,
+    /// Stop each task that runs for longer than the given duration, e.g. 10m.
+    /// Overrides timeout in turbo.json
+    #[clap(long)]
+    pub timeout: Option<String>,
     // NOTE: The following two are hidden because clap displays them in the help text incorrectly:
     // > Usage: turbo [OPTIONS] [TASKS]... [-- <FORWARDED_ARGS>...] [COMMAND]
     #[clap(hide = true)]
@@ -443,12 +583,15 @@ pub fn run(repo_state: Option<RepoState>) -> Result<Payload> {
 
             Ok(Payload::Rust(Ok(0)))
         }
-        Command::Login { .. }
+        Command::Cache { .. }
+        | Command::Login { .. }
         | Command::Link { .. }
         | Command::Unlink { .. }
         | Command::Daemon { .. }
         | Command::Prune { .. }
-        | Command::Run(_) => Ok(Payload::Go(Box::new(clap_args))),
+        | Command::Run(_)
+        | Command::Validate { .. }
+        | Command::WhyMiss { .. } => Ok(Payload::Go(Box::new(clap_args))),
         Command::Completion { shell } => {
             generate(*shell, &mut Args::command(), "turbo", &mut io::stdout());
 
@@ -526,7 +669,7 @@ mod test {
 
     use anyhow::Result;
 
-    use crate::cli::{Args, Command, DryRunMode, OutputLogsMode, RunArgs, Verbosity};
+    use crate::cli::{Args, CacheCommand, Command, DryRunMode, OutputLogsMode, RunArgs, Verbosity};
 
     #[test]
     fn test_parse_run() -> Result<()> {
@@ -552,6 +695,19 @@ mod test {
             }
         );
 
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "build", "--cache", "local:rw,remote:r"])
+                .unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["build".to_string()],
+                    cache: Some("local:rw,remote:r".to_string()),
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+
         assert_eq!(
             Args::try_parse_from(["turbo", "run", "build", "--cache-dir", "foobar"]).unwrap(),
             Args {
@@ -1139,6 +1295,315 @@ mod test {
         .test();
     }
 
+    #[test]
+    fn test_parse_cache() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "clean"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Clean {
+                        all: false,
+                        max_size: None,
+                        max_age: None,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        let expected = Args {
+            command: Some(Command::Cache {
+                cache_dir: Some("foobar".to_string()),
+                json: false,
+                command: CacheCommand::Clean {
+                    all: false,
+                    max_size: Some("10GB".to_string()),
+                    max_age: Some("7d".to_string()),
+                },
+            }),
+            ..Args::default()
+        };
+        assert_eq!(
+            Args::try_parse_from([
+                "turbo",
+                "cache",
+                "--cache-dir",
+                "foobar",
+                "clean",
+                "--max-size",
+                "10GB",
+                "--max-age",
+                "7d"
+            ])
+            .unwrap(),
+            expected
+        );
+        assert_eq!(
+            Args::try_parse_from([
+                "turbo",
+                "cache",
+                "clean",
+                "--max-age",
+                "7d",
+                "--cache-dir",
+                "foobar",
+                "--max-size",
+                "10GB"
+            ])
+            .unwrap(),
+            expected
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "clean", "--all"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Clean {
+                        all: true,
+                        max_size: None,
+                        max_age: None,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_cache_artifact_commands() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "ls", "--json"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: true,
+                    command: CacheCommand::Ls {
+                        hashes: vec![],
+                        remote: false,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "ls", "--remote", "abc", "def"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Ls {
+                        hashes: vec!["abc".to_string(), "def".to_string()],
+                        remote: true,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "export", "abc", "-o", "abc.tar.zst"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Export {
+                        hash: "abc".to_string(),
+                        output: Some("abc.tar.zst".to_string()),
+                        remote: false,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "import", "abc.tar.zst", "--remote"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Import {
+                        file: "abc.tar.zst".to_string(),
+                        hash: None,
+                        remote: true,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert!(Args::try_parse_from(["turbo", "cache", "rm"]).is_err());
+    }
+
+    #[test]
+    fn test_parse_cache_serve() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "serve"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Serve {
+                        host: "127.0.0.1".to_string(),
+                        port: 3000,
+                        max_upload_size: None,
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from([
+                "turbo",
+                "cache",
+                "serve",
+                "--host",
+                "0.0.0.0",
+                "--port",
+                "8080",
+                "--max-upload-size",
+                "500MB",
+                "--token",
+                "secret"
+            ])
+            .unwrap(),
+            Args {
+                token: Some("secret".to_string()),
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Serve {
+                        host: "0.0.0.0".to_string(),
+                        port: 8080,
+                        max_upload_size: Some("500MB".to_string()),
+                    },
+                }),
+                ..Args::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_env_mode() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "build", "--env-mode", "strict"]).unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["build".to_string()],
+                    env_mode: Some(EnvMode::Strict),
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+
+        assert!(Args::try_parse_from(["turbo", "run", "build", "--env-mode", "lax"]).is_err());
+    }
+
+    #[test]
+    fn test_parse_timeout() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "test", "--timeout", "10m"]).unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["test".to_string()],
+                    timeout: Some("10m".to_string()),
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_retries() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "e2e", "--retries", "2"]).unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["e2e".to_string()],
+                    retries: Some(2),
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+
+        assert!(Args::try_parse_from(["turbo", "run", "e2e", "--retries", "-1"]).is_err());
+    }
+
+    #[test]
+    fn test_parse_explain() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "run", "build", "--explain"]).unwrap(),
+            Args {
+                command: Some(Command::Run(Box::new(RunArgs {
+                    tasks: vec!["build".to_string()],
+                    explain: true,
+                    ..get_default_run_args()
+                }))),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "why-miss", "web#build"]).unwrap(),
+            Args {
+                command: Some(Command::WhyMiss {
+                    task: "web#build".to_string(),
+                    cache_dir: None,
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert!(Args::try_parse_from(["turbo", "why-miss"]).is_err());
+    }
+
+    #[test]
+    fn test_parse_validate() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "validate"]).unwrap(),
+            Args {
+                command: Some(Command::Validate {}),
+                ..Args::default()
+            }
+        );
+    }
+
+    #[test]
+    fn test_parse_cache_status() {
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "status"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: false,
+                    command: CacheCommand::Status { retry: false },
+                }),
+                ..Args::default()
+            }
+        );
+
+        assert_eq!(
+            Args::try_parse_from(["turbo", "cache", "status", "--retry", "--json"]).unwrap(),
+            Args {
+                command: Some(Command::Cache {
+                    cache_dir: None,
+                    json: true,
+                    command: CacheCommand::Status { retry: true },
+                }),
+                ..Args::default()
+            }
+        );
+    }
+
     #[test]
     fn test_pass_through_args() {
         assert_eq!(
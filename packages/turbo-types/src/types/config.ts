@@ -3,6 +3,13 @@ export interface Schema {
   /** @default https://turbo.build/schema.json */
   $schema?: string;
 
+  /**
+   * Only used in a workspace's turbo.json, where it must be ["//"], to extend
+   * the root turbo.json. The workspace's tasks override the fields that they
+   * set in the root pipeline, for that workspace only.
+   */
+  extends?: string[];
+
   /**
    * A list of globs for implicit global hash dependencies.
    *
@@ -23,10 +30,55 @@ export interface Schema {
    * A list of environment variables, (e.g. GITHUB_TOKEN),
    * for implicit global hash dependencies.
    *
+   * Entries may use * as a wildcard (e.g. CI_*), and entries prefixed with !
+   * exclude the variables they match (e.g. !CI_JOB_ID).
+   *
    * @default []
    */
   globalEnv?: string[];
 
+  /**
+   * A list of environment variables that every task can read in strict env mode,
+   * without them affecting any hashes.
+   *
+   * @default []
+   */
+  globalPassThroughEnv?: string[];
+
+  /**
+   * A list of .env files, relative to the repository root, that are loaded into
+   * every task's environment and included in the global hash. Files are listed
+   * from the highest precedence to the lowest.
+   *
+   * @default []
+   */
+  globalDotEnv?: string[];
+
+  /**
+   * Frameworks whose environment variable prefixes are hashed for the workspaces
+   * that depend on them. Declared frameworks are matched before the built-in ones.
+   *
+   * @default []
+   */
+  frameworks?: FrameworkDefinition[];
+
+  /**
+   * "strict" only passes tasks the environment variables in their hash, those in
+   * globalPassThroughEnv and passThroughEnv, and a minimal set such as PATH and HOME. "loose" passes
+   * the whole environment.
+   *
+   * @default "loose"
+   */
+  envMode?: "loose" | "strict";
+
+  /**
+   * Restricts how runs use each cache, as a comma-separated list such as
+   * "local:rw,remote:r". Access is one of rw, r, w, or none.
+   *
+   * @default "local:rw,remote:rw"
+   */
+  cachePolicy?: string;
+
   /**
    * An object representing the task dependency graph of your project. turbo interprets
    * these conventions to properly schedule, execute, and cache the outputs of tasks in
@@ -70,10 +122,38 @@ export interface Pipeline {
   /**
    * A list of environment variables, **not** prefixed with $ (e.g. $GITHUB_TOKEN), that this task depends on.
    *
+   * Entries may use * as a wildcard (e.g. APP_FEATURE_*), and entries prefixed with !
+   * exclude the variables they match (e.g. !APP_FEATURE_DEBUG).
+   *
    * @default []
    */
   env?: string[];
 
+  /**
+   * A list of environment variables that this task can read in strict env mode,
+   * without them affecting its hash.
+   *
+   * @default []
+   */
+  passThroughEnv?: string[];
+
+  /**
+   * A list of .env files, relative to the package, that are loaded into this
+   * task's environment and included in its hash. Files are listed from the
+   * highest precedence to the lowest.
+   *
+   * @default []
+   */
+  dotEnv?: string[];
+
+  /**
+   * Whether to infer the task's framework and hash the environment variables
+   * that start with its prefixes.
+   *
+   * @default true
+   */
+  frameworkInference?: boolean;
+
   /**
    * The set of glob patterns indicating a task's cacheable filesystem outputs.
    *
@@ -101,6 +181,9 @@ export interface Pipeline {
    * will not cause a cache miss.
    *
    * If omitted or empty, all files in the package are considered as inputs.
+   *
+   * Globs are relative to the package unless they start with $ROOT/, which anchors
+   * them at the repository root. Globs starting with ! exclude files.
    * @default []
    */
   inputs?: string[];
@@ -122,6 +205,65 @@ export interface Pipeline {
    * @default false
    */
   persistent?: boolean;
+
+  /**
+   * A duration, such as "90s" or "10m", after which the task is stopped with SIGINT,
+   * and then SIGKILL if it doesn't exit. Tasks can run forever when it isn't set.
+   */
+  timeout?: string;
+
+  /**
+   * How many more times to run the task when it fails, before reporting the failure.
+   *
+   * @default 0
+   */
+  retries?: number;
+
+  /**
+   * A duration, such as "5s", to wait before the first retry. It doubles for each
+   * retry after that.
+   */
+  retryBackoff?: string;
+
+  /**
+   * How many of the run's concurrency slots the task takes while it runs.
+   *
+   * @default 1
+   */
+  weight?: number;
+
+  /**
+   * Names of resources, such as a port, that the task needs to itself. Tasks that
+   * share a resource never run at the same time.
+   *
+   * @default []
+   */
+  resources?: string[];
+}
+
+export interface FrameworkDefinition {
+  /**
+   * The name of the framework.
+   */
+  slug: string;
+
+  /**
+   * The prefixes of the environment variables that the framework inlines into
+   * its build output.
+   */
+  envPrefixes: string[];
+
+  /**
+   * The dependencies that identify a workspace as using the framework.
+   */
+  dependencyMatch: {
+    /**
+     * "all" matches workspaces that depend on every dependency, "some" those
+     * that depend on at least one of them.
+     */
+    strategy: "all" | "some";
+    dependencies: string[];
+  };
 }
 
 export interface RemoteCache {
@@ -134,4 +276,36 @@ export interface RemoteCache {
    * @default false
    */
   signature?: boolean;
+
+  /**
+   * The algorithm used to sign artifacts when `signature` is enabled.
+   *
+   * `hmac-sha256` signs with a secret shared by every machine that uses the cache.
+   *
+   * `ed25519` signs with a private key from `TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY` or
+   * `TURBO_REMOTE_CACHE_SIGNATURE_PRIVATE_KEY_FILE`, and verifies with the public keys in
+   * `signaturePublicKeys`. Machines without the private key read from the cache but never upload to it.
+   *
+   * @default "hmac-sha256"
+   */
+  signatureAlgorithm?: "hmac-sha256" | "ed25519";
+
+  /**
+   * Files, relative to the repository root, containing the Ed25519 public keys trusted to sign
+   * artifacts. An artifact is accepted if any of these keys signed it, so a new key can be added
+   * before the old one is retired.
+   *
+   * @default []
+   */
+  signaturePublicKeys?: string[];
+
+  /**
+   * Indicates if artifacts should be encrypted with AES-256-GCM before they are uploaded, using
+   * the base64-encoded key in `TURBO_REMOTE_CACHE_ENCRYPTION_KEY`, or in the file named by
+   * `TURBO_REMOTE_CACHE_ENCRYPTION_KEY_FILE`. Downloaded artifacts that are not encrypted with
+   * a configured key are treated as cache misses.
+   *
+   * @default false
+   */
+  encryption?: boolean;
 }